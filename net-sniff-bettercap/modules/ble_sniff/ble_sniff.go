@@ -2,10 +2,15 @@
 package ble_sniff
 
 // Importing necessary packages:
-// time for handling time-related functionalities,
+// io for the end of input, strconv for the command arguments, strings for normalizing the addresses,
+// sync for guarding the subscribers, time for handling time-related functionalities,
 // jstream for JSON streaming,
 // and bettercap/session for session management in bettercap.
 import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bcicen/jstream"
@@ -14,47 +19,435 @@ import (
 
 // Sniffer struct extends session.SessionModule and contains sniffer-specific fields.
 type Sniffer struct {
-	session.SessionModule         // Embedding SessionModule for handling sessions.
-	Stats         *SnifferStats   // Pointer to SnifferStats for tracking statistics.
-	Ctx           *SnifferContext // Pointer to SnifferContext for context management.
-	pktSourceChan chan *jstream.MetaValue // Channel for streaming parsed JSON data.
+	session.SessionModule                         // Embedding SessionModule for handling sessions.
+	Stats                 *SnifferStats           // Pointer to SnifferStats for tracking statistics.
+	Ctx                   *SnifferContext         // Pointer to SnifferContext for context management.
+	pktSourceChan         chan *jstream.MetaValue // Channel for streaming parsed JSON data.
+	eventHandlers         []int                   // Identifiers of the event handlers added while running.
+	handlers              map[int]EventHandler    // Handlers notified of the events pushed by the module, keyed by their identifier.
+	handlersID            int                     // Identifier assigned to the last added handler.
+	handlersLock          *sync.RWMutex           // Lock guarding the handlers, a pointer since the module is also passed by value.
+	pushHandler           int                     // Identifier of the module among the handlers of SnifferEvent.Push while running.
+	auxChains             map[string]*auxChain    // Extended advertisements being reassembled keyed by advertising set.
+	auxChainsLock         *sync.Mutex             // Lock guarding the extended advertisements shared by the workers.
+	heartbeatReset        chan struct{}           // Signals the heartbeat loop a packet arrived.
+	heartbeatQuit         chan struct{}           // Closed to stop the heartbeat loop.
+	rateQuit              chan struct{}           // Closed to stop sampling the event rate.
+	summaryQuit           chan struct{}           // Closed to stop the summary events.
+	subscribers           []chan SnifferEvent     // Channels of the library subscribers.
+	subscribersLock       *sync.Mutex             // Lock guarding the subscribers, a pointer since the module is also passed by value.
+	recon                 bool                    // Set while running in recon mode, only building the device inventory.
+	sink                  EventSink               // Receives the events instead of the session, if set.
+	follow                string                  // Address of the device whose packets are the only ones reported, if set.
+	followLock            *sync.Mutex             // Lock guarding the followed address, changed while capturing.
+	captureStop           chan struct{}           // Closed to ask the capture loop to drain the queue and return.
+	captureDone           chan struct{}           // Closed once the capture loop returned.
+	drainDeadline         time.Time               // Time after which the packets still queued are dropped.
+	source                io.Reader               // Input decoded instead of TShark or ble.sniff.source, injected by the tests.
+	explicitParams        map[string]bool         // Parameters set in the session or by an option, kept over ble.sniff.config.
+	explicitParamsLock    *sync.Mutex             // Lock guarding the explicit parameters, set from the session commands.
+	applyingConfig        bool                    // Set while ble.sniff.config sets the parameters, which aren't explicit then.
 }
 
 // NewSniffer creates and returns a new instance of Sniffer.
 func NewSniffer(s *session.Session) *Sniffer {
 	mod := &Sniffer{
-		SessionModule: session.NewSessionModule("ble.sniff", s), // Initializing session module with name and session.
-		Ctx:           nil, // Context initially set to nil.
-		Stats:         nil, // Stats initially set to nil.
+		SessionModule:   session.NewSessionModule("ble.sniff", s), // Initializing session module with name and session.
+		Ctx:             nil,                                      // Context initially set to nil.
+		Stats:           nil,                                      // Stats initially set to nil.
+		subscribersLock: &sync.Mutex{},                            // Lock for the library subscribers.
+		handlersLock:    &sync.RWMutex{},                          // Lock for the event handlers.
+		auxChainsLock:   &sync.Mutex{},                            // Lock for the extended advertisements.
+		followLock:      &sync.Mutex{},                            // Lock for the followed address.
+
+		explicitParams:     make(map[string]bool), // Parameters set explicitly.
+		explicitParamsLock: &sync.Mutex{},         // Lock for the parameters set explicitly.
 	}
 
 	mod.Ctx = NewSnifferContext() // Setting up the sniffer context.
 
 	// Adding various parameters to the module for configuration.
-	mod.AddParam(session.NewBoolParameter("ble.sniff.verbose",
+	mod.addParam(session.NewStringParameter("ble.sniff.config",
+		"",
+		"",
+		"If set, JSON or YAML file of parameter values applied when the sniffer is started, the parameters set in the session taking precedence."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.dry_run",
+		"false",
+		"If true, ble.sniff on will only validate the configuration and log it, without starting the capture."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.verbose",
+		"false",
+		"If true, link-layer control PDUs captured on data channels will also be sent to the events.stream for displaying, otherwise only the advertisements."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.color",
+		"false",
+		"If true, the message of the displayed events starts with their protocol colored by packet type, the outputs keep the plain message."))
+	mod.addParam(session.NewIntParameter("ble.sniff.display.rate",
+		"0",
+		"If greater than 0, maximum number of events per second pushed to the session and shown by events.stream, the others are still counted and written to the outputs."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.hexdump",
+		"false",
+		"If true, TShark outputs the raw bytes of the packets and the hexdump of their BLE layer is attached to the advertising events, for debugging the parsers."))
+	mod.addParam(session.NewIntParameter("ble.sniff.hexdump.max",
+		"64",
+		"Maximum number of bytes of the hexdumps attached by ble.sniff.hexdump, 0 for no limit."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.compat",
+		"false",
+		"If true, events will be pushed with the net.sniff.<protocol> tags and event type of the net.sniff module, otherwise with the native tag set by ble.sniff.tag."))
+	mod.addParam(session.NewStringParameter("ble.sniff.tag",
+		"ble.sniff",
+		`^[a-zA-Z0-9_\-]+(\.[a-zA-Z0-9_\-]+)*$`,
+		"Tag events are pushed with when not in compat mode, tags starting with ble. are displayed as BLE events by events.stream."))
+	mod.addParam(session.NewStringParameter("ble.sniff.session_id",
+		"",
+		"",
+		"Identifier attached to every event to tell apart the sensors writing to the same store, a random UUID is generated on every start if empty."))
+	mod.addParam(session.NewStringParameter("ble.sniff.gps",
+		"",
+		"",
+		"If set, NMEA serial device like /dev/ttyUSB0 or COM4, or host:port of a gpsd instance, the last fix is attached to every event as its location."))
+	mod.addParam(session.NewIntParameter("ble.sniff.gps.baudrate",
+		"4800",
+		"Baud rate of the NMEA serial device set by ble.sniff.gps."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.anonymize",
+		"false",
+		"If true, the device addresses of the events and of every output are replaced with a keyed hash, stable for a given key, and the hexdumps are removed."))
+	mod.addParam(session.NewStringParameter("ble.sniff.anonymize.key",
+		"",
+		"",
+		"Key of the address hashes of ble.sniff.anonymize, set it to get the same pseudonyms across sessions, otherwise a random key is generated on every start."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.connectable_only",
+		"false",
+		"If true, only events for connectable advertisements (ADV_IND, ADV_DIRECT_IND and ADV_EXT_IND) will be emitted."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.changes_only",
+		"false",
+		"If true, only the advertisements and scan responses whose payload differs from the previous one of their device are decoded, the repeated ones are only counted."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.merge",
+		"true",
+		"If true, the AD structures of an advertisement are reported in a single event combining their data, otherwise in an event each."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.directed.target",
+		"true",
+		"If true, the events of the directed advertisements have their target address as destination, otherwise BROADCAST like the other advertisements."))
+	mod.addParam(session.NewStringParameter("ble.sniff.ad_types",
+		"",
+		"",
+		"Comma separated list of the AD type codes to parse, such as 0xff for the manufacturer data only, the structures of the other types are skipped. Empty to parse them all."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.drop_bad_crc",
 		"false",
-		"If true, every captured and parsed packet will be sent to the events.stream for displaying, otherwise only the ones parsed at the application layer (sni, http, etc)."))
-	mod.AddParam(session.NewStringParameter("ble.sniff.interface",
+		"If true, the packets whose CRC check failed are counted but not decoded, otherwise they are decoded as the valid ones."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.adv_channels_only",
+		"false",
+		"If true, only the packets captured on the primary advertising channels 37, 38 and 39 are decoded, the ones of the data channels are counted and dropped, also in verbose mode."))
+	mod.addParam(session.NewStringParameter("ble.sniff.pdu",
+		"",
+		"",
+		"If set, comma separated list of the advertising PDU types whose events will be emitted, for instance ADV_IND,SCAN_RSP."))
+	mod.addParam(session.NewStringParameter("ble.sniff.service",
+		"",
+		"",
+		"If set, comma separated list of service UUIDs, 16 bit like FEAA or 128 bit, only advertisements carrying service data for one of them will be emitted."))
+	mod.addParam(session.NewIntParameter("ble.sniff.min_len",
+		"0",
+		"Minimum length in bytes of the advertising data, the advertisements and scan responses with less data are dropped before being decoded."))
+	mod.addParam(session.NewIntParameter("ble.sniff.max_len",
+		"0",
+		"If greater than 0, maximum length in bytes of the advertising data, the advertisements and scan responses with more data are dropped before being decoded."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.log.json",
+		"false",
+		"If true, the module will log JSON lines to the standard output instead of the colored session log."))
+	mod.addParam(session.NewStringParameter("ble.sniff.name",
+		"",
+		"",
+		"If set, only events of the devices whose local name contains this case insensitive substring will be emitted."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.name.strict",
+		"true",
+		"If true, devices whose name is still unknown are excluded by ble.sniff.name, otherwise they are included."))
+	mod.addParam(session.NewIntParameter("ble.sniff.proximity.immediate",
+		"-50",
+		"Devices whose smoothed RSSI is greater or equal than this value in dBm are classified as immediate."))
+	mod.addParam(session.NewIntParameter("ble.sniff.proximity.near",
+		"-70",
+		"Devices whose smoothed RSSI is greater or equal than this value in dBm are classified as near, the weaker ones as far."))
+	mod.addParam(session.NewDecimalParameter("ble.sniff.rssi.alpha",
+		"0.3",
+		"Smoothing factor in the (0.0,1.0] interval of the RSSI moving average, higher values follow the instantaneous RSSI more closely."))
+	mod.addParam(session.NewStringParameter("ble.sniff.rssi.reset",
+		"30",
+		durationValidator,
+		"Time after which the RSSI moving average of a device that hasn't been seen is reset, in seconds or as a duration such as 1m30s, 0 to never reset it."))
+	mod.addParam(session.NewStringParameter("ble.sniff.interface",
 		"nRF Sniffer for Bluetooth LE",
 		"",
 		"extcap nRF Sniffer interface"))
-	mod.AddParam(session.NewStringParameter("ble.sniff.source",
+	mod.addParam(session.NewBoolParameter("ble.sniff.interface.strict",
+		"false",
+		"If true, only capture from ble.sniff.interface, otherwise the first nRF Sniffer interface listed by TShark is used if it isn't found."))
+	mod.addParam(session.NewStringParameter("ble.sniff.source",
 		"",
 		"",
 		"If set, the sniffer will read from this JSON file instead of the current interface."))
-	mod.AddParam(session.NewStringParameter("ble.sniff.pcap",
+	mod.addParam(session.NewStringParameter("ble.sniff.pcap",
 		"",
 		"",
 		"If set, the sniffer will read from this PCAP file instead of the current interface."))
-	mod.AddParam(session.NewStringParameter("ble.sniff.output",
+	mod.addParam(session.NewStringParameter("ble.sniff.filter",
+		"",
+		"",
+		"If set, only the packets matching this TShark display filter will be processed."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output",
+		"",
+		"",
+		"If set, the sniffer will write to this json file, or stream NDJSON events to a named pipe like \\\\.\\pipe\\blesniff on Windows."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.output.gzip",
+		"false",
+		"If true, the output file will be compressed with gzip and named with the .gz extension, rotated files included."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.output.pretty",
+		"false",
+		"If true, events written to the output file will be indented, otherwise each event will be a compact JSON line."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.output.split_by_device",
+		"false",
+		"If true, ble.sniff.output is a directory where the events of every device are appended as NDJSON to <address>.ndjson, with dashes instead of colons, and aren't rotated."))
+	mod.addParam(session.NewIntParameter("ble.sniff.output.split_by_device.max_open",
+		"64",
+		"Maximum number of per-device output files open at the same time, the least recently used one is closed and reopened when needed."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output.rotate.size",
+		"",
+		"",
+		"If set, the output file will be rotated before growing beyond this size, for instance 100MB."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output.rotate.interval",
+		"0",
+		durationValidator,
+		"If greater than 0, the output file will be rotated every this many seconds, or at this interval if set as a duration such as 1h."))
+	mod.addParam(session.NewIntParameter("ble.sniff.output.rotate.keep",
+		"0",
+		"Number of rotated output files to keep, deleting the oldest ones, 0 to keep them all."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output.flush",
+		"1",
+		durationValidator,
+		"Interval in seconds, or as a duration such as 500ms, the buffered events are written to the output file at, and on stop, 0 to write every event at once."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output.buffer",
+		"64KB",
 		"",
+		"Size of the output file buffer, events are written at once when it is full."))
+	mod.addParam(session.NewStringParameter("ble.sniff.output.s3",
 		"",
-		"If set, the sniffer will write to this json file."))
-	mod.AddParam(session.NewStringParameter("ble.sniff.tshark",
+		"",
+		"If set, s3://bucket/prefix the rotated output files are uploaded to, with the credentials and the region of the AWS_* environment variables and AWS_ENDPOINT_URL for other object storages."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.output.s3.delete_local",
+		"false",
+		"If true, the rotated output files are deleted once uploaded by ble.sniff.output.s3."))
+	mod.addParam(session.NewStringParameter("ble.sniff.influx",
+		"",
+		"",
+		"If set, URL of an InfluxDB 2 server like http://localhost:8086 every event is written to, in batches, as a line protocol point tagged by address and vendor."))
+	mod.addParam(session.NewStringParameter("ble.sniff.influx.org",
+		"",
+		"",
+		"Organization of the bucket of ble.sniff.influx."))
+	mod.addParam(session.NewStringParameter("ble.sniff.influx.bucket",
+		"",
+		"",
+		"Bucket the events are written to by ble.sniff.influx."))
+	mod.addParam(session.NewStringParameter("ble.sniff.influx.token",
+		"",
+		"",
+		"API token of ble.sniff.influx, the INFLUX_TOKEN environment variable is used if empty."))
+	mod.addParam(session.NewStringParameter("ble.sniff.oui.db",
+		"",
+		"",
+		"If set, OUI database in the Wireshark manuf format used to look up the manufacturer of public addresses before the bundled one."))
+	mod.addParam(session.NewStringParameter("ble.sniff.inventory.load",
+		"",
+		"",
+		"If set, JSON inventory saved by ble.sniff.inventory.save to pre-populate the device table with when the sniffer starts."))
+	mod.addParam(session.NewStringParameter("ble.sniff.sqlite",
+		"",
+		"",
+		"If set, the sniffer will also store events into this SQLite database file."))
+	mod.addParam(session.NewIntParameter("ble.sniff.json.emit_depth",
+		"3",
+		"Depth of the TShark JSON output at which the packet layers are decoded, 3 for the [{\"_source\": {\"layers\": {...}}}] layout."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.json.strict",
+		"false",
+		"Report the input ending before the TShark JSON array is closed, as when TShark is killed, as a truncated capture."))
+	mod.addParam(session.NewStringParameter("ble.sniff.read_buffer",
+		"64KB",
+		"",
+		"Size of the buffer the output of TShark or the source file is read with, like 256KB or 1MB, at least 4KB. Larger buffers take fewer reads on big captures."))
+	mod.addParam(session.NewIntParameter("ble.sniff.queue.size",
+		"1024",
+		"Number of decoded packets waiting to be processed, when the queue is full the oldest packets are dropped."))
+	mod.addParam(session.NewIntParameter("ble.sniff.workers",
+		"1",
+		"Number of goroutines decoding the packets, more than one trades the ordering of the events for throughput."))
+	mod.addParam(session.NewStringParameter("ble.sniff.shutdown.timeout",
+		"5",
+		durationValidator,
+		"Time in seconds, or as a duration such as 2.5s, given on stop to process the queued packets and flush the outputs, less than 10s, 0 to drop them right away."))
+	mod.addParam(session.NewStringParameter("ble.sniff.heartbeat",
+		"0",
+		durationValidator,
+		"If greater than 0, a heartbeat event will be pushed every time no packet arrives for this many seconds, or for this duration if set as one such as 1m."))
+	mod.addParam(session.NewStringParameter("ble.sniff.summary.interval",
+		"0",
+		durationValidator,
+		"If greater than 0, a BLE SUMMARY event with the advertisements, devices and bytes since the previous one will be pushed every this many seconds, or at this interval if set as a duration such as 1m."))
+	mod.addParam(session.NewStringParameter("ble.sniff.starvation.timeout",
+		"30",
+		durationValidator,
+		"If greater than 0, warn once per idle period when TShark is running but no event is produced for this many seconds, or for this duration if set as one such as 1m."))
+	mod.addParam(session.NewIntParameter("ble.sniff.report.top",
+		"5",
+		"Number of entries listed in each ranking of the report printed when the sniffer is stopped, 0 to only print the totals."))
+	mod.addParam(session.NewBoolParameter("ble.sniff.autorestart",
+		"false",
+		"If true, TShark will be restarted when it terminates unexpectedly, with an increasing delay between attempts."))
+	mod.addParam(session.NewIntParameter("ble.sniff.autorestart.max",
+		"3",
+		"Maximum number of TShark restarts before the sniffer stops."))
+	mod.addParam(session.NewIntParameter("ble.sniff.history",
+		"100",
+		"Number of recent events retained in memory and printed by ble.sniff.recent, 0 to disable the history."))
+	mod.addParam(session.NewIntParameter("ble.sniff.sensors.log",
+		"0",
+		"If greater than 0, the manufacturer data of every device is logged each time it changes, keeping this many readings per device for ble.sniff.sensors."))
+	mod.addParam(session.NewStringParameter("ble.sniff.alert.company",
+		"",
+		"",
+		"Comma separated company identifiers with their threshold, like 0x004c:50,0x0075:20: a BLE ALERT event is pushed when more advertisements of a company than its threshold are seen within ble.sniff.alert.window."))
+	mod.addParam(session.NewStringParameter("ble.sniff.alert.window",
+		"10",
+		durationValidator,
+		"Length in seconds, or as a duration such as 1m30s, of the sliding window the advertisements of the companies of ble.sniff.alert.company are counted over."))
+	mod.addParam(session.NewStringParameter("ble.sniff.alert.cooldown",
+		"60",
+		durationValidator,
+		"Minimum time in seconds, or as a duration such as 5m, between two alerts about the same company."))
+	mod.addParam(session.NewStringParameter("ble.sniff.show.sort",
+		"rssi",
+		"^(address|type|name|vendor|rssi|packets|age|seen)$",
+		"Default column the ble.sniff.show table is sorted by, one of address, type, name, vendor, rssi, packets or age (seen is an alias of age)."))
+	mod.addParam(session.NewStringParameter("ble.sniff.remote",
+		"",
+		"",
+		"If set, ssh://[user@]host[:port] destination TShark is run on instead of locally, with ble.sniff.tshark, ble.sniff.interface and ble.sniff.pcap referring to the remote host."))
+	mod.addParam(session.NewStringParameter("ble.sniff.remote.key",
+		"",
+		"",
+		"Private key file used to log in to ble.sniff.remote, if empty the ssh agent and configuration are used."))
+	mod.addParam(session.NewStringParameter("ble.sniff.tshark",
 		"tshark",
 		"",
 		"location of tshark command"))
 
+	// Adding handlers to start and stop the recon mode, and to show the device inventory.
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.recon on", "",
+		"Start sniffing in background only to build the device inventory, without pushing an event for every advertisement.",
+		func(args []string) error {
+			return mod.StartRecon()
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.recon off", "",
+		"Stop the recon mode, the device inventory is kept until the next start.",
+		func(args []string) error {
+			return mod.StopRecon()
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.show", "",
+		"Show the devices discovered by the sniffer, sorted by the ble.sniff.show.sort column.",
+		func(args []string) error {
+			return mod.Show("")
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.show COLUMN", `ble\.sniff\.show (.+)`,
+		"Show the devices discovered by the sniffer sorted by COLUMN, one of address, type, name, vendor, rssi, packets or age.",
+		func(args []string) error {
+			return mod.Show(args[0])
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.recent", "",
+		"Print the events retained by ble.sniff.history, oldest first.",
+		func(args []string) error {
+			return mod.ShowRecent(0)
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.recent N", `ble\.sniff\.recent (\d+)`,
+		"Print the last N events retained by ble.sniff.history, oldest first.",
+		func(args []string) error {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return err
+			}
+			return mod.ShowRecent(n)
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.sensors", "",
+		"List the devices logged by ble.sniff.sensors.log with their last manufacturer data reading.",
+		func(args []string) error {
+			return mod.ShowSensors("")
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.sensors ADDRESS", `ble\.sniff\.sensors ([0-9a-fA-F:]{17})`,
+		"Print the manufacturer data readings logged for ADDRESS, oldest first.",
+		func(args []string) error {
+			return mod.ShowSensors(args[0])
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.clear.devices", "",
+		"Forget the devices discovered so far, keeping the packet and event counters.",
+		func(args []string) error {
+			return mod.ClearDevices()
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.clear.stats", "",
+		"Zero the packet, event and company counters, keeping the devices discovered so far.",
+		func(args []string) error {
+			return mod.ClearStats()
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.decode HEX", `ble\.sniff\.decode (.+)`,
+		"Decode the advertising data HEX, such as 0201061aff4c00..., through the AD structure parsers and print an event per structure.",
+		func(args []string) error {
+			return mod.DecodeHex(args[0])
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.uniques", "",
+		"Print the distinct addresses seen in this session with their names, one per line, followed by their count.",
+		func(args []string) error {
+			return mod.ShowUniques()
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.inventory.save PATH", `ble\.sniff\.inventory\.save (.+)`,
+		"Save a snapshot of the devices discovered by the sniffer to PATH, as CSV if it ends with .csv and as JSON otherwise.",
+		func(args []string) error {
+			return mod.SaveInventory(strings.TrimSpace(args[0]))
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.save PATH", `ble\.sniff\.save (.+)`,
+		"Save the current value of every ble.sniff parameter to PATH as a caplet of set commands, to reproduce the capture setup.",
+		func(args []string) error {
+			return mod.SaveConfig(strings.TrimSpace(args[0]))
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.follow ADDRESS", `ble\.sniff\.follow ((?:[0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2})`,
+		"Only report the packets sent by or to a device, including its connections in verbose mode, ignoring the other filters.",
+		func(args []string) error {
+			mod.Follow(args[0])
+			return nil
+		}))
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.follow off", "",
+		"Stop following a device, restoring the filters.",
+		func(args []string) error {
+			mod.Follow("")
+			return nil
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.rssi ADDRESS", `ble\.sniff\.rssi ((?:[0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2})`,
+		"Show the distribution of the RSSI samples received from a device.",
+		func(args []string) error {
+			return mod.ShowRSSI(strings.Replace(args[0], "-", ":", -1))
+		}))
+
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.interfaces", "",
+		"List the capture interfaces of ble.sniff.tshark, highlighting the nRF Sniffer ones, the name or the description can be used as ble.sniff.interface.",
+		func(args []string) error {
+			return mod.ShowInterfaces()
+		}))
+
+	// Adding handler to list the connections being tracked.
+	mod.AddHandler(session.NewModuleHandler("ble.sniff.connections", "",
+		"Show the connections observed by the sniffer.",
+		func(args []string) error {
+			return mod.ShowConnections()
+		}))
+
 	// Adding handlers to start and stop the sniffer module.
 	mod.AddHandler(session.NewModuleHandler("ble.sniff on", "",
 		"Start blework sniffer in background.",
@@ -92,6 +485,9 @@ func (mod *Sniffer) Configure() error {
 	if mod.Running() {
 		// Return an error if the module is already started.
 		return session.ErrAlreadyStarted(mod.Name())
+	} else if err = mod.applyConfig(); err != nil {
+		// The configuration file is applied before the parameters are read.
+		return err
 	} else if err, mod.Ctx = mod.GetContext(); err != nil {
 		// If there is an error in getting the context, close the context and return the error.
 		if mod.Ctx != nil {
@@ -110,69 +506,187 @@ func (mod *Sniffer) Start() error {
 		return err
 	}
 
+	// In dry-run mode the configuration has been validated, report it and tear down.
+	if mod.Ctx.DryRun {
+		mod.Ctx.Log(mod.Session)
+		mod.Ctx.Close()
+		mod.Info("dry run completed, the configuration is valid")
+		return nil
+	}
+
+	// Let Stop wait for the capture loop, created before it runs since it can be stopped right away.
+	capture_stop, capture_done := make(chan struct{}), make(chan struct{})
+	mod.captureStop, mod.captureDone = capture_stop, capture_done
+
 	// Set the module as running and start the main logic in a go routine.
 	return mod.SetRunning(true, func() {
 
 		mod.Stats = NewSnifferStats() // Initialize sniffer statistics.
+		// Continue tracking the devices of a previous session, if requested.
+		if mod.Ctx.InventoryLoad != "" {
+			mod.loadInventory(mod.Ctx.InventoryLoad)
+		}
+		mod.auxChains = make(map[string]*auxChain)
 
-		// Set up the packet source channel to stream JSON data.
-		mod.pktSourceChan = jstream.NewDecoder(mod.Ctx.Reader, 3).Stream()
-		for packet := range mod.pktSourceChan {
-			if !mod.Running() {
-				// If the module is no longer running, exit the loop.
-				mod.Debug("end pkt loop")
-				break
-			}
+		// Select the schema and the tag events are pushed with by the deprecated SnifferEvent.Push.
+		setCompatMode(mod.Ctx.Compat)
+		setEventTag(mod.Ctx.Tag)
+		// Select how the module logs.
+		setJSONLogs(mod.Ctx.LogJSON)
 
-			now := time.Now() // Record the current time.
-			if mod.Stats.FirstPacket.IsZero() {
-				// If this is the first packet, record its time.
-				mod.Stats.FirstPacket = now
-			}
-			mod.Stats.LastPacket = now // Update the last packet time.
+		// Write every pushed event to the output file, if any, and feed it to the subscribers.
+		mod.eventHandlers = []int{
+			mod.addEventHandler(mod.onEventOutput),
+			mod.addEventHandler(mod.onEventSubscribers),
+			mod.addEventHandler(mod.onEventHistory),
+		}
+		// The events of the deprecated SnifferEvent.Push reach the handlers of every running sniffer.
+		mod.pushHandler = addPushHandler(mod.notifyHandlers)
 
-			// Extract packet data as a map.
-			packet_map, ok := packet.Value.(map[string]interface{})
-			if !ok {
-				// If the packet map is not valid, continue to the next packet.
-				continue
-			}
+		// Let the operators know the sniffer is alive during quiet captures.
+		if mod.Ctx.Heartbeat > 0 {
+			mod.startHeartbeat(mod.Ctx.Heartbeat)
+		}
+		// Push the aggregate counters for the dashboards.
+		if mod.Ctx.SummaryInterval > 0 {
+			mod.startSummary(mod.Ctx.SummaryInterval)
+		}
+		// Sample the event rate and notice when nothing is decoded.
+		mod.startRateMonitor(mod.Ctx.StarvationTimeout)
 
-			// Extract BLE data from the packet.
-			btle_data, ok := packet_map["btle"].(map[string]interface{})
-			if !ok {
-				// If BLE data is not present, continue to the next packet.
-				continue
-			}
+		// Let Stop know the queued packets have been processed.
+		defer close(capture_done)
 
-			// Extract the access address from the BLE data.
-			access_address, ok := btle_data["btle.access_address"].(string)
-			if !ok {
-				return
+		// Decode packets until the input ends, for as many times as TShark is restarted.
+		for {
+			// Set up the packet source channel to stream JSON data.
+			mod.Debug("decoding packets at JSON depth %d", mod.Ctx.EmitDepth)
+			input := newInputReader(mod.Ctx.Reader)
+			decoder := jstream.NewDecoder(input, mod.Ctx.EmitDepth)
+			// Keep the decoder going when processing is slow, bounding the packets held in memory.
+			mod.pktSourceChan = mod.queuePackets(decoder.Stream(), mod.Ctx.QueueSize)
+			// Spread the packets over the workers, if more than one is configured.
+			pool := mod.newWorkerPool(mod.Ctx.Workers)
+		packets:
+			for {
+				select {
+				case packet, ok := <-mod.pktSourceChan:
+					if !ok {
+						break packets
+					}
+					mod.dispatchPacket(pool, packet.Value)
+				case <-capture_stop:
+					// The module is stopping, process what is already queued and exit the loop.
+					mod.Debug("end pkt loop")
+					mod.drainPackets(pool, mod.pktSourceChan, mod.drainDeadline)
+					break packets
+				}
+			}
+			// Set the packet source channel to nil once the loop ends.
+			mod.pktSourceChan = nil
+			// Let the workers finish the packets they were given.
+			if pool != nil {
+				pool.Wait()
 			}
 
-			// Check if the access address matches a specific value.
-			if access_address == "0x8e89bed6" {
-				// Process the advertisement data.
-				onAdvertisement(btle_data)
-				// Increment the advertisement count.
-				mod.Stats.NumAdvertisements++
+			// Report the extended advertisements whose chain didn't complete before the end of the input.
+			mod.flushAuxChains(time.Now(), true)
+
+			// Tell a capture truncated by bad input apart from one that reached its end.
+			if mod.Running() {
+				mod.checkDecoderErr(decoder, input)
 			}
 
-			// Increment the matched packets count.
-			mod.Stats.NumMatched++
+			// Notice if the capture ended because TShark died, restarting it if allowed.
+			if !mod.onCaptureEnd(capture_stop) {
+				break
+			}
 		}
-		// Set the packet source channel to nil once the loop ends.
-		mod.pktSourceChan = nil
 	})
 }
 
+// dispatchPacket records the arrival of a packet and decodes it, on a worker of the pool if there is one.
+func (mod *Sniffer) dispatchPacket(pool *workerPool, value interface{}) {
+	// Use the time the packet was captured at, which differs from the current one when reading a file,
+	// falling back to the current time if TShark didn't provide it.
+	packet_map, _ := value.(map[string]interface{})
+	now, ok := packetTime(packet_map)
+	if !ok {
+		now = time.Now()
+	}
+	// Record the capture times, restarted if the counters were cleared.
+	mod.Stats.trackPacket(now)
+	// Look for gaps in the packet counter while the packets are still in capture order.
+	mod.Stats.trackSequence(packet_map)
+	if mod.Ctx.Heartbeat > 0 {
+		// Postpone the next heartbeat.
+		mod.resetHeartbeat()
+	}
+
+	// Decode the packet and push its events.
+	if pool != nil {
+		pool.Process(value, now)
+	} else {
+		mod.onPacket(value, now)
+	}
+}
+
+// checkDecoderErr logs why the decoder stopped emitting packets, if it wasn't the end of the input.
+func (mod *Sniffer) checkDecoderErr(decoder *jstream.Decoder, input *inputReader) {
+	err := decoder.Err()
+	if err == nil {
+		mod.Debug("end of input reached after %d bytes", decoder.Pos())
+		return
+	}
+
+	// TShark never closes its JSON array when it is killed, the packets decoded until then are still valid.
+	if input.Unterminated(decoder) && !mod.Ctx.JSONStrict {
+		mod.Debug("end of input reached after %d bytes, before the JSON array was closed", decoder.Pos())
+		return
+	}
+
+	// Errors returned by the underlying reader are wrapped in the decoder error.
+	if derr, ok := err.(jstream.DecoderError); ok {
+		if rerr := derr.ReaderErr(); rerr == io.EOF {
+			mod.Debug("end of input reached after %d bytes", decoder.Pos())
+			return
+		} else if rerr != nil {
+			mod.Warning("capture truncated, error reading the input at byte %d: %v", decoder.Pos(), rerr)
+			return
+		}
+	}
+
+	mod.Warning("capture truncated, malformed JSON input at byte %d: %v", decoder.Pos(), err)
+}
+
 // Stop method stops the sniffer module.
 func (mod *Sniffer) Stop() error {
 	// Set the module as not running and handle the cleanup.
 	return mod.SetRunning(false, func() {
-		// Close the context as part of the cleanup.
-		mod.Ctx.Close()
+		// Give the capture loop some time to process the queued packets while the outputs are still open.
+		deadline := time.Now().Add(mod.Ctx.ShutdownTimeout)
+		mod.waitCapture(deadline)
+		// Stop writing events before the output file is closed.
+		removePushHandler(mod.pushHandler)
+		for _, id := range mod.eventHandlers {
+			mod.removeEventHandler(id)
+		}
+		mod.eventHandlers = nil
+		// Stop the heartbeat events.
+		mod.stopHeartbeat()
+		// Stop the summary events.
+		mod.stopSummary()
+		// Stop sampling the event rate.
+		mod.stopRateMonitor()
+		// Summarize the capture, unless it is stopped before the stats were built.
+		if mod.Stats != nil {
+			mod.Stats.report(mod.Ctx.ReportTop, mod.Ctx.anonymizer)
+		}
+		// Close the context as part of the cleanup, flushing the outputs.
+		mod.closeContext(deadline)
+		// Let the subscribers know no more events will come.
+		mod.closeSubscribers()
+		// The next start is a regular one unless the recon mode is requested again.
+		mod.recon = false
 	})
 }
-
@@ -0,0 +1,317 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, strconv for string conversion, strings for joining the decoded values and time for time-related
+// functions.
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AD structure types as defined by the Bluetooth Assigned Numbers (2.3 Common Data Types).
+const (
+	AD_FLAGS                 = 0x01
+	AD_INCOMPLETE_UUID16     = 0x02
+	AD_COMPLETE_UUID16       = 0x03
+	AD_INCOMPLETE_UUID32     = 0x04
+	AD_COMPLETE_UUID32       = 0x05
+	AD_INCOMPLETE_UUID128    = 0x06
+	AD_COMPLETE_UUID128      = 0x07
+	AD_SHORT_LOCAL_NAME      = 0x08
+	AD_COMPLETE_LOCAL_NAME   = 0x09
+	AD_TX_POWER_LEVEL        = 0x0a
+	AD_CLASS_OF_DEVICE       = 0x0d
+	AD_CONN_INTERVAL_RANGE   = 0x12
+	AD_SERVICE_DATA16        = 0x16
+	AD_PUBLIC_TARGET_ADDRESS = 0x17
+	AD_RANDOM_TARGET_ADDRESS = 0x18
+	AD_APPEARANCE            = 0x19
+	AD_ADV_INTERVAL          = 0x1a
+	AD_LE_DEVICE_ADDRESS     = 0x1b
+	AD_SERVICE_DATA32        = 0x20
+	AD_SERVICE_DATA128       = 0x21
+	AD_URI                   = 0x24
+	AD_MESH_MESSAGE          = 0x29
+	AD_MESH_BEACON           = 0x2a
+	AD_PB_ADV                = 0x2b
+	AD_ADV_INTERVAL_LONG     = 0x2f
+	AD_MANUFACTURER_DATA     = 0xff
+)
+
+// advertisement struct holds the advertisement an AD structure belongs to, along with what its parser may need.
+type advertisement struct {
+	Data     map[string]interface{}   // BLE layer of the packet as decoded by TShark.
+	Entries  []map[string]interface{} // AD structures of the advertisement.
+	PDU      string                   // Name of the advertising PDU type, looked up once for all the AD structures.
+	Signal   *SnifferSignal           // Signal information of the advertiser, if known.
+	Stats    *SnifferStats            // Statistics of the sniffer.
+	Time     time.Time                // Time the advertisement was captured at.
+	Target   string                   // Destination of the events, the target address if the advertisement is directed.
+	services bool                     // Set once the service UUID lists have been reported.
+}
+
+// ADParser is a function processing an AD structure of a given type, returning the events it produced
+// for the caller to push.
+type ADParser func(adv *advertisement, entry map[string]interface{}) []SnifferEvent
+
+// adParsers is the dispatch table of the AD structure parsers keyed by AD type.
+var adParsers = map[uint8]ADParser{}
+
+// registerADParser sets the parser of an AD type, replacing any previous one.
+func registerADParser(adType uint8, parser ADParser) {
+	adParsers[adType] = parser
+}
+
+// Registering the parsers of the AD types decoded by the module.
+func init() {
+	registerADParser(AD_FLAGS, onFlags)
+	registerADParser(AD_INCOMPLETE_UUID16, onServiceUUIDs)
+	registerADParser(AD_COMPLETE_UUID16, onServiceUUIDs)
+	registerADParser(AD_INCOMPLETE_UUID32, onServiceUUIDs32)
+	registerADParser(AD_COMPLETE_UUID32, onServiceUUIDs32)
+	registerADParser(AD_INCOMPLETE_UUID128, onServiceUUIDs)
+	registerADParser(AD_COMPLETE_UUID128, onServiceUUIDs)
+	registerADParser(AD_SHORT_LOCAL_NAME, onLocalName)
+	registerADParser(AD_COMPLETE_LOCAL_NAME, onLocalName)
+	registerADParser(AD_TX_POWER_LEVEL, onTxPower)
+	registerADParser(AD_CLASS_OF_DEVICE, onClassOfDevice)
+	registerADParser(AD_CONN_INTERVAL_RANGE, onConnIntervalRange)
+	registerADParser(AD_SERVICE_DATA16, onServiceData)
+	registerADParser(AD_PUBLIC_TARGET_ADDRESS, onTargetAddress)
+	registerADParser(AD_RANDOM_TARGET_ADDRESS, onTargetAddress)
+	registerADParser(AD_APPEARANCE, onAppearance)
+	registerADParser(AD_ADV_INTERVAL, onAdvInterval)
+	registerADParser(AD_LE_DEVICE_ADDRESS, onLEDeviceAddress)
+	registerADParser(AD_SERVICE_DATA32, onServiceData)
+	registerADParser(AD_SERVICE_DATA128, onServiceData)
+	registerADParser(AD_URI, onURI)
+	registerADParser(AD_MESH_MESSAGE, onMesh)
+	registerADParser(AD_MESH_BEACON, onMesh)
+	registerADParser(AD_PB_ADV, onMesh)
+	registerADParser(AD_ADV_INTERVAL_LONG, onAdvInterval)
+	registerADParser(AD_MANUFACTURER_DATA, onProprietary)
+}
+
+// event returns a "BLE ADVERT" event for an AD structure of the advertisement, adding the signal information of the advertiser.
+func (adv *advertisement) event(data SniffData, format string, args ...interface{}) []SnifferEvent {
+	return adv.protocolEvent("BLE ADVERT", data, format, args...)
+}
+
+// protocolEvent returns an event of the given protocol for an AD structure of the advertisement, for the AD
+// structures carrying another protocol over the advertisements, adding the signal information of the advertiser.
+func (adv *advertisement) protocolEvent(protocol string, data SniffData, format string, args ...interface{}) []SnifferEvent {
+	// Extract the advertising address from the BLE data.
+	advert_address, ok := adv.Data["btle.advertising_address"].(string)
+	// If the address isn't present, there is no one to attribute the event to.
+	if !ok {
+		return nil
+	}
+
+	if adv.Signal != nil {
+		data["rssi"] = adv.Signal.RSSI
+		data["rssi_smoothed"] = adv.Signal.SmoothedRSSI
+		data["proximity"] = adv.Signal.Proximity
+	}
+	if adv.Stats != nil {
+		if vendor := adv.Stats.HardwareVendor(advert_address); vendor != "" {
+			data["hardware_vendor"] = vendor
+		}
+	}
+
+	// Create a new SnifferEvent with the capture time, protocol, source address,
+	// destination as the target or "BROADCAST", data, and a formatted message.
+	return []SnifferEvent{NewSnifferEvent(adv.Time,
+		protocol,
+		advert_address,
+		adv.Target,
+		data,
+		format,
+		args...,
+	).WithPDU(adv.PDU)}
+}
+
+// adFlags maps the TShark fields of the flags AD structure to the names of the flags.
+var adFlags = []struct {
+	Field string
+	Name  string
+}{
+	{"btcommon.eir_ad.entry.flags.le_limited_discoverable_mode", "LE Limited Discoverable"},
+	{"btcommon.eir_ad.entry.flags.le_general_discoverable_mode", "LE General Discoverable"},
+	{"btcommon.eir_ad.entry.flags.bredr_not_supported", "BR/EDR Not Supported"},
+	{"btcommon.eir_ad.entry.flags.le_bredr_support_controller", "LE and BR/EDR Controller"},
+	{"btcommon.eir_ad.entry.flags.le_bredr_support_host", "LE and BR/EDR Host"},
+}
+
+// adType extracts the type of an AD structure.
+func adType(entry map[string]interface{}) (uint8, bool) {
+	type_string, ok := entry["btcommon.eir_ad.entry.type"].(string)
+	if !ok {
+		return 0, false
+	}
+
+	ad_type, err := parseUint(type_string, 8)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint8(ad_type), true
+}
+
+// adPayload checks the size of the payload of an AD structure told by its length, which includes the type byte, and
+// returns the raw payload, checking its size too, unless the structure was decoded by TShark. The name of the
+// structure is used in the errors.
+func adPayload(entry map[string]interface{}, name string, decoded bool, validSize func(size int) bool) ([]byte, error) {
+	if length_string, ok := entry["btcommon.eir_ad.entry.length"].(string); ok {
+		if length, err := parseUint(length_string, 8); err == nil && !validSize(int(length)-1) {
+			return nil, fmt.Errorf("invalid %s size %d", name, int(length)-1)
+		}
+	}
+	if decoded {
+		return nil, nil
+	}
+
+	data_string, ok := entry["btcommon.eir_ad.entry.data"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s not decoded", name)
+	}
+	raw, err := parseHexBytes(data_string)
+	if err != nil {
+		return nil, err
+	} else if !validSize(len(raw)) {
+		return nil, fmt.Errorf("invalid %s size %d", name, len(raw))
+	}
+	return raw, nil
+}
+
+// isSet returns true for the TShark representations of a set bit.
+func isSet(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && (s == "1" || s == "True" || s == "true")
+}
+
+// onFlags processes the flags AD structure, reporting the discoverable mode and the BR/EDR support.
+func onFlags(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	flags := make([]string, 0)
+	for _, flag := range adFlags {
+		if isSet(entry[flag.Field]) {
+			flags = append(flags, flag.Name)
+		}
+	}
+
+	return adv.event(SniffData{
+		"flags": flags,
+	},
+		"Flags %s",
+		strings.Join(flags, ", "),
+	)
+}
+
+// onLocalName processes the shortened and complete local name AD structures.
+func onLocalName(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	name, ok := entry["btcommon.eir_ad.entry.device_name"].(string)
+	if !ok {
+		return nil
+	}
+
+	return adv.event(SniffData{
+		"name": name,
+	},
+		"Local name %q",
+		name,
+	)
+}
+
+// isUUIDList returns true for the AD types of the complete and incomplete lists of service UUIDs.
+func isUUIDList(adType uint8) bool {
+	return adType >= AD_INCOMPLETE_UUID16 && adType <= AD_COMPLETE_UUID128
+}
+
+// onServiceUUIDs processes the lists of 16 and 128 bit service UUIDs.
+func onServiceUUIDs(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	return adv.serviceUUIDs(entry)
+}
+
+// onServiceUUIDs32 processes the lists of 32 bit service UUIDs, which are reported in the canonical 0x0000180f form.
+func onServiceUUIDs32(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	return adv.serviceUUIDs(entry)
+}
+
+// serviceUUIDs reports the complete service set of the advertisement in a single event, merging the lists of
+// every width when the first of them is parsed. Without the AD structures of the advertisement, only the list
+// of the given one is reported.
+func (adv *advertisement) serviceUUIDs(entry map[string]interface{}) []SnifferEvent {
+	if adv.services {
+		return nil
+	}
+	adv.services = true
+
+	entries := adv.Entries
+	if entries == nil {
+		entries = []map[string]interface{}{entry}
+	}
+
+	uuids := make([]string, 0)
+	for _, e := range entries {
+		if ad_type, ok := adType(e); ok && isUUIDList(ad_type) {
+			uuids = append(uuids, entryUUIDs(e)...)
+		}
+	}
+	if len(uuids) == 0 {
+		return nil
+	}
+
+	data := SniffData{
+		"uuids": uuids,
+	}
+	// The Tile trackers are told by their services.
+	note := ""
+	if hasTileService(uuids) {
+		note = adv.tileTracker(data)
+	}
+
+	return adv.event(data,
+		"Services %s%s",
+		strings.Join(uuids, ", "),
+		note,
+	)
+}
+
+// onTxPower processes the TX power level AD structure.
+func onTxPower(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	power_string, ok := entry["btcommon.eir_ad.entry.power_level"].(string)
+	if !ok {
+		return nil
+	}
+
+	power, err := strconv.Atoi(power_string)
+	if err != nil {
+		return nil
+	}
+
+	return adv.event(SniffData{
+		"tx_power": power,
+	},
+		"TX power %d dBm",
+		power,
+	)
+}
+
+// onUnknownAD reports the AD structures no parser is registered for, with every field TShark decoded.
+func onUnknownAD(adv *advertisement, adType uint8, entry map[string]interface{}) []SnifferEvent {
+	data := SniffData{
+		"type": adType,
+	}
+	for key, value := range entry {
+		if key != "btcommon.eir_ad.entry.type" && strings.HasPrefix(key, "btcommon.eir_ad.entry.") {
+			data[strings.TrimPrefix(key, "btcommon.eir_ad.entry.")] = value
+		}
+	}
+
+	return adv.event(data,
+		"AD type 0x%02x",
+		adType,
+	)
+}
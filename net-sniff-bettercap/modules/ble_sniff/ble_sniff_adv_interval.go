@@ -0,0 +1,75 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings.
+import (
+	"fmt"
+)
+
+// Declaring the sizes of the advertising interval AD structures and the unit of the interval.
+const (
+	advIntervalSize        = 2
+	advIntervalLongMinSize = 3
+	advIntervalLongMaxSize = 4
+	advIntervalUnit        = 0.625
+)
+
+// validAdvIntervalSize returns true if the payload size is the one of the advertising interval AD type.
+func validAdvIntervalSize(adType uint8, size int) bool {
+	if adType == AD_ADV_INTERVAL_LONG {
+		return size >= advIntervalLongMinSize && size <= advIntervalLongMaxSize
+	}
+	return size == advIntervalSize
+}
+
+// decodeAdvInterval decodes the little-endian advertising interval of the AD structure payload, in 0.625 ms units.
+func decodeAdvInterval(adType uint8, raw []byte) (uint32, error) {
+	if !validAdvIntervalSize(adType, len(raw)) {
+		return 0, fmt.Errorf("invalid advertising interval size %d for AD type 0x%02x", len(raw), adType)
+	}
+
+	interval := uint32(0)
+	for i := len(raw) - 1; i >= 0; i-- {
+		interval = interval<<8 | uint32(raw[i])
+	}
+	return interval, nil
+}
+
+// advInterval extracts the advertising interval of an AD structure, either from the field decoded by TShark
+// or from its raw payload.
+func advInterval(adType uint8, entry map[string]interface{}) (uint32, error) {
+	interval_string, decoded := entry["btcommon.eir_ad.entry.advertising_interval"].(string)
+	raw, err := adPayload(entry, "advertising interval", decoded, func(size int) bool {
+		return validAdvIntervalSize(adType, size)
+	})
+	if err != nil {
+		return 0, err
+	} else if !decoded {
+		return decodeAdvInterval(adType, raw)
+	}
+
+	interval, err := parseUint(interval_string, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(interval), nil
+}
+
+// onAdvInterval processes the advertising interval AD structures, reporting how often the device advertises
+// in milliseconds. Malformed structures are ignored.
+func onAdvInterval(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	ad_type, _ := adType(entry)
+	interval, err := advInterval(ad_type, entry)
+	if err != nil {
+		return nil
+	}
+
+	ms := float64(interval) * advIntervalUnit
+	return adv.event(SniffData{
+		"adv_interval": ms,
+	},
+		"Advertising interval %gms",
+		ms,
+	)
+}
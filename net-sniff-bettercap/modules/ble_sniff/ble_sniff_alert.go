@@ -0,0 +1,176 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings, sort for listing the companies in order, strconv for the thresholds,
+// strings for parsing the list, sync for guarding the windows, time for the windows and the cooldown,
+// and bettercap/gatt for the company names.
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bettercap/gatt"
+)
+
+// companySighting is an advertisement of a company within the alert window.
+type companySighting struct {
+	time    time.Time // Capture time of the advertisement.
+	address string    // Address of its advertiser.
+}
+
+// companyAlerts detects the bursts of advertisements of some companies, such as a swarm of trackers: an alert is
+// raised when more advertisements carrying the manufacturer data of a company than its threshold are seen within
+// the sliding window. The company is then not reported again before the cooldown, so that a lasting burst doesn't
+// flood the events.
+type companyAlerts struct {
+	lock       sync.Mutex                   // Lock guarding the windows, the workers record concurrently.
+	thresholds map[uint16]int               // Maximum number of advertisements per window, keyed by company.
+	window     time.Duration                // Duration of the sliding window.
+	cooldown   time.Duration                // Minimum time between two alerts about the same company.
+	sightings  map[uint16][]companySighting // Advertisements of each company within the window, oldest first.
+	alerted    map[uint16]time.Time         // Time of the last alert about each company.
+}
+
+// newCompanyAlerts creates the detector of the bursts of the companies of the thresholds.
+func newCompanyAlerts(thresholds map[uint16]int, window time.Duration, cooldown time.Duration) *companyAlerts {
+	return &companyAlerts{
+		thresholds: thresholds,
+		window:     window,
+		cooldown:   cooldown,
+		sightings:  make(map[uint16][]companySighting),
+		alerted:    make(map[uint16]time.Time),
+	}
+}
+
+// Record adds an advertisement of a company seen at t, returning the advertisements of the company within the
+// window and true if they exceed its threshold and no alert was raised during the cooldown.
+func (a *companyAlerts) Record(id uint16, address string, t time.Time) ([]companySighting, bool) {
+	threshold, watched := a.thresholds[id]
+	if !watched {
+		return nil, false
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// Forget the advertisements which left the window.
+	sightings := append(a.sightings[id], companySighting{time: t, address: address})
+	start := t.Add(-a.window)
+	expired := 0
+	for expired < len(sightings) && !sightings[expired].time.After(start) {
+		expired++
+	}
+	sightings = append(sightings[:0], sightings[expired:]...)
+	a.sightings[id] = sightings
+
+	if len(sightings) <= threshold {
+		return nil, false
+	} else if last, found := a.alerted[id]; found && t.Sub(last) < a.cooldown {
+		return nil, false
+	}
+	a.alerted[id] = t
+	return append([]companySighting(nil), sightings...), true
+}
+
+// parseCompanyAlerts parses a comma separated list of company identifiers with their threshold, in hex or decimal,
+// such as "0x004c:50,0x0075:20". An empty list disables the alerts and returns a nil map.
+func parseCompanyAlerts(list string) (map[uint16]int, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	thresholds := make(map[uint16]int)
+	for _, item := range strings.Split(list, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("'%s' is not a company identifier with its threshold, like 0x004c:50", item)
+		}
+		id, err := parseUint(strings.TrimSpace(parts[0]), 16)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a company identifier between 0x0000 and 0xffff", parts[0])
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || threshold < 1 {
+			return nil, fmt.Errorf("the threshold of company 0x%04x must be a number greater than 0, got '%s'", id, parts[1])
+		}
+		thresholds[uint16(id)] = threshold
+	}
+	if len(thresholds) == 0 {
+		return nil, fmt.Errorf("no company in '%s'", list)
+	}
+	return thresholds, nil
+}
+
+// companyAlertsLabel lists the thresholds of the companies in order, or "none" for a nil map.
+func companyAlertsLabel(thresholds map[uint16]int) string {
+	if thresholds == nil {
+		return "none"
+	}
+
+	ids := make([]int, 0, len(thresholds))
+	for id := range thresholds {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	labels := make([]string, len(ids))
+	for i, id := range ids {
+		labels[i] = fmt.Sprintf("0x%04x:%d", id, thresholds[uint16(id)])
+	}
+	return strings.Join(labels, ",")
+}
+
+// checkCompanyAlerts records the companies of the manufacturer specific data of an advertisement, pushing a
+// "BLE ALERT" event when one of them exceeds its threshold. A company is counted once per advertisement.
+func (mod *Sniffer) checkCompanyAlerts(btleData map[string]interface{}, entries []map[string]interface{}, t time.Time) {
+	address, _ := btleData["btle.advertising_address"].(string)
+
+	counted := make(map[uint16]bool)
+	for _, manufacturer := range manufacturerData(entries) {
+		id, _ := manufacturer["company_id"].(uint16)
+		if counted[id] {
+			continue
+		}
+		counted[id] = true
+
+		sightings, alert := mod.Ctx.alerts.Record(id, address, t)
+		if !alert {
+			continue
+		}
+
+		devices := make(map[string]bool)
+		for _, s := range sightings {
+			if s.address != "" {
+				devices[s.address] = true
+			}
+		}
+		company := CompanyCount{ID: id, Name: gatt.CompanyIdents[id]}
+		mod.Push(NewSnifferEvent(t,
+			"BLE ALERT",
+			"SNIFFER",
+			"SNIFFER",
+			SniffData{
+				"company_id":     id,
+				"company":        company.Name,
+				"advertisements": len(sightings),
+				"devices":        len(devices),
+				"threshold":      mod.Ctx.alerts.thresholds[id],
+				"window":         int(mod.Ctx.alerts.window / time.Second),
+			},
+			"%d advertisements of %s from %d devices in the last %s, over the threshold of %d",
+			len(sightings),
+			company.Label(),
+			len(devices),
+			mod.Ctx.alerts.window,
+			mod.Ctx.alerts.thresholds[id],
+		))
+	}
+}
@@ -0,0 +1,88 @@
+package ble_sniff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCompanyAlerts(t *testing.T) {
+	thresholds, err := parseCompanyAlerts(" 0x004C:50, 117:20 ,")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(thresholds) != 2 || thresholds[0x004c] != 50 || thresholds[0x0075] != 20 {
+		t.Errorf("unexpected thresholds %v", thresholds)
+	} else if label := companyAlertsLabel(thresholds); label != "0x004c:50,0x0075:20" {
+		t.Errorf("unexpected label %s", label)
+	}
+
+	if thresholds, err = parseCompanyAlerts(""); err != nil || thresholds != nil {
+		t.Errorf("expected no alert, got %v %v", thresholds, err)
+	}
+	for _, list := range []string{"0x004c", "0x1004c:5", "0x004c:0", "0x004c:many", " , "} {
+		if _, err = parseCompanyAlerts(list); err == nil {
+			t.Errorf("expected '%s' to be rejected", list)
+		}
+	}
+}
+
+func TestCompanyAlertsWindow(t *testing.T) {
+	alerts := newCompanyAlerts(map[uint16]int{0x004c: 2}, 10*time.Second, time.Minute)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, alert := alerts.Record(0x0075, "aa:aa:aa:aa:aa:aa", start); alert {
+		t.Error("expected the companies without threshold to be ignored")
+	}
+
+	// Spread over more than the window, the advertisements never exceed the threshold.
+	for i := 0; i < 6; i++ {
+		if _, alert := alerts.Record(0x004c, "aa:aa:aa:aa:aa:aa", start.Add(time.Duration(i)*6*time.Second)); alert {
+			t.Fatalf("unexpected alert at advertisement %d", i)
+		}
+	}
+
+	// A burst exceeds it, but is only reported once per cooldown.
+	burst := start.Add(time.Minute)
+	alerts.Record(0x004c, "aa:aa:aa:aa:aa:aa", burst)
+	alerts.Record(0x004c, "bb:bb:bb:bb:bb:bb", burst.Add(time.Second))
+	sightings, alert := alerts.Record(0x004c, "bb:bb:bb:bb:bb:bb", burst.Add(2*time.Second))
+	if !alert || len(sightings) != 3 {
+		t.Fatalf("expected an alert about 3 advertisements, got %v %v", alert, sightings)
+	}
+	if _, alert = alerts.Record(0x004c, "cc:cc:cc:cc:cc:cc", burst.Add(3*time.Second)); alert {
+		t.Error("expected the alert to be rate limited")
+	}
+	for i := 0; i < 3; i++ {
+		alerts.Record(0x004c, "cc:cc:cc:cc:cc:cc", burst.Add(time.Minute+time.Duration(i)*time.Second))
+	}
+	if last := alerts.alerted[0x004c]; !last.Equal(burst.Add(time.Minute + 2*time.Second)) {
+		t.Errorf("expected a new alert once the cooldown elapsed, last one at %v", last)
+	}
+}
+
+func TestCompanyAlertsPackets(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.AlertCompanies = map[uint16]int{0x004c: 2}
+	mod.Ctx.alerts = newCompanyAlerts(mod.Ctx.AlertCompanies, mod.Ctx.AlertWindow, mod.Ctx.AlertCooldown)
+
+	// Every round replays the same Apple advertisement, the third one is over the threshold.
+	for round := 0; round < 5; round++ {
+		for _, packet := range fixturePackets(t) {
+			mod.dispatchPacket(nil, packet)
+		}
+	}
+
+	alerts := make([]SnifferEvent, 0)
+	for _, e := range sink.events {
+		if e.Protocol == "BLE ALERT" {
+			alerts = append(alerts, e)
+		}
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected a single alert, got %d", len(alerts))
+	}
+	data := alerts[0].Data.(SniffData)
+	if data["company_id"] != uint16(0x004c) || data["advertisements"] != 3 || data["devices"] != 1 || data["threshold"] != 2 {
+		t.Errorf("unexpected alert data %v", data)
+	}
+}
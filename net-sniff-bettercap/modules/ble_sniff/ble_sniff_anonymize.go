@@ -0,0 +1,200 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// crypto/hmac and crypto/sha256 for the keyed hash, crypto/rand for the per-session key, fmt for formatting the
+// pseudonyms, regexp for finding the addresses, and strings for normalizing them.
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// anonymizeKeySize is the size in bytes of the random key generated when none is configured.
+const anonymizeKeySize = 32
+
+// macAddressPattern matches the device addresses, in the colon separated form TShark outputs.
+var macAddressPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?::[0-9a-f]{2}){5}\b`)
+
+// addressValuePattern matches a whole value holding a device address.
+var addressValuePattern = regexp.MustCompile(`(?i)^[0-9a-f]{2}(?::[0-9a-f]{2}){5}$`)
+
+// addressKeys are the keys of the event data holding device addresses, the other values being left untouched since
+// the payloads use the same colon separated form.
+var addressKeys = map[string]bool{
+	"target_address":   true,
+	"target_addresses": true,
+	"le_address":       true,
+	"ruuvi_mac":        true,
+	"mibeacon_mac":     true,
+	"initiator":        true,
+	"advertiser":       true,
+}
+
+// anonymizer replaces the device addresses with pseudonyms computed with a keyed hash, the same address
+// always getting the same pseudonym for a given key so that the devices can still be told apart and counted.
+type anonymizer struct {
+	key []byte // Key of the HMAC, the pseudonyms can't be linked to the addresses without it.
+}
+
+// newAnonymizer creates an anonymizer with the given key, or with a random one valid for the session only
+// if the key is empty.
+func newAnonymizer(key string) (*anonymizer, error) {
+	if key != "" {
+		return &anonymizer{key: []byte(key)}, nil
+	}
+
+	random := make([]byte, anonymizeKeySize)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	return &anonymizer{key: random}, nil
+}
+
+// Address returns the pseudonym of an address, formatted as a locally administered unicast address so that it
+// still parses as an address but can't be mistaken for the one of a real device. Without anonymizer, the address
+// is returned as is.
+func (a *anonymizer) Address(address string) string {
+	if a == nil {
+		return address
+	}
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(strings.ToLower(address)))
+	sum := mac.Sum(nil)
+
+	sum[0] = sum[0]&0xfc | 0x02
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", sum[0], sum[1], sum[2], sum[3], sum[4], sum[5])
+}
+
+// String replaces a value holding a device address with its pseudonym, the other values being returned as is.
+func (a *anonymizer) String(value string) string {
+	if a == nil || !addressValuePattern.MatchString(value) {
+		return value
+	}
+	return a.Address(value)
+}
+
+// text replaces the given addresses found in a text with their pseudonyms. The address shaped runs which are part
+// of a longer one, like the bytes of a payload, are left untouched.
+func (a *anonymizer) text(value string, addresses map[string]bool) string {
+	matches := macAddressPattern.FindAllStringIndex(value, -1)
+	if a == nil || len(matches) == 0 {
+		return value
+	}
+
+	anonymized := strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if !addresses[strings.ToLower(value[start:end])] || (start > 0 && value[start-1] == ':') || (end < len(value) && value[end] == ':') {
+			continue
+		}
+		anonymized.WriteString(value[last:start])
+		anonymized.WriteString(a.Address(value[start:end]))
+		last = end
+	}
+	anonymized.WriteString(value[last:])
+	return anonymized.String()
+}
+
+// Matches returns true if an address is the lower case one given, or has it as pseudonym, so that the devices can
+// be designated by the pseudonyms the outputs show.
+func (a *anonymizer) Matches(address string, target string) bool {
+	address = strings.ToLower(address)
+	return address == target || (a != nil && a.Address(address) == target)
+}
+
+// DeviceAddress returns the pseudonym of the address of a device, the records loaded from an anonymized inventory
+// already holding it.
+func (a *anonymizer) DeviceAddress(dev SnifferDevice) string {
+	if dev.Anonymized {
+		return dev.Address
+	}
+	return a.Address(dev.Address)
+}
+
+// Devices returns a copy of the devices with their addresses replaced with their pseudonyms, marked as anonymized
+// so that they aren't replaced again once loaded.
+func (a *anonymizer) Devices(devices []SnifferDevice) []SnifferDevice {
+	if a == nil {
+		return devices
+	}
+
+	anonymized := make([]SnifferDevice, len(devices))
+	for i, dev := range devices {
+		dev.Address = a.DeviceAddress(dev)
+		dev.Anonymized = true
+		anonymized[i] = dev
+	}
+	return anonymized
+}
+
+// value replaces the addresses held by the known address keys of the data of an event, copying the containers
+// instead of modifying them since they can be shared with the parsers. The addresses replaced are collected.
+func (a *anonymizer) value(value interface{}, address bool, found map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !address {
+			return v
+		}
+		found[strings.ToLower(v)] = true
+		return a.String(v)
+	case []string:
+		if !address {
+			return v
+		}
+		anonymized := make([]string, len(v))
+		for i, s := range v {
+			found[strings.ToLower(s)] = true
+			anonymized[i] = a.String(s)
+		}
+		return anonymized
+	case []interface{}:
+		anonymized := make([]interface{}, len(v))
+		for i, item := range v {
+			anonymized[i] = a.value(item, address, found)
+		}
+		return anonymized
+	case SniffData:
+		anonymized := make(SniffData, len(v))
+		for key, item := range v {
+			anonymized[key] = a.value(item, addressKeys[key], found)
+		}
+		return anonymized
+	case map[string]interface{}:
+		anonymized := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			anonymized[key] = a.value(item, addressKeys[key], found)
+		}
+		return anonymized
+	case *ConnectIndData:
+		if v == nil {
+			return v
+		}
+		anonymized := *v
+		anonymized.Initiator = a.value(v.Initiator, true, found).(string)
+		anonymized.Advertiser = a.value(v.Advertiser, true, found).(string)
+		return &anonymized
+	}
+	return value
+}
+
+// Event returns a copy of an event whose addresses, in its ends and the address fields of its data, are replaced
+// with their pseudonyms, as are their occurrences in its message. The hexdump of the packet is removed since it
+// contains the addresses.
+func (a *anonymizer) Event(e SnifferEvent) SnifferEvent {
+	found := map[string]bool{
+		strings.ToLower(e.Source):      true,
+		strings.ToLower(e.Destination): true,
+	}
+	e.Source = a.String(e.Source)
+	e.Destination = a.String(e.Destination)
+	e.Data = a.value(e.Data, false, found)
+	e.Message = a.text(e.Message, found)
+	e.RawHex = ""
+	return e
+}
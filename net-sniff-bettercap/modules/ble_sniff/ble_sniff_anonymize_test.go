@@ -0,0 +1,131 @@
+package ble_sniff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnonymizerAddress(t *testing.T) {
+	a, _ := newAnonymizer("research key")
+	b, _ := newAnonymizer("another key")
+
+	pseudonym := a.Address("D4:3A:2C:11:8E:07")
+	if pseudonym != a.Address("d4:3a:2c:11:8e:07") {
+		t.Errorf("expected the same pseudonym whatever the case")
+	} else if pseudonym == "d4:3a:2c:11:8e:07" || pseudonym == b.Address("d4:3a:2c:11:8e:07") {
+		t.Errorf("expected a pseudonym depending on the key, got %s", pseudonym)
+	} else if !macAddressPattern.MatchString(pseudonym) {
+		t.Errorf("expected the pseudonym to look like an address, got %s", pseudonym)
+	}
+
+	// Locally administered and unicast.
+	if first, err := parseHexBytes(pseudonym[:2]); err != nil || first[0]&0x03 != 0x02 {
+		t.Errorf("expected a locally administered unicast pseudonym, got %s", pseudonym)
+	}
+
+	if random, _ := newAnonymizer(""); random.Address("d4:3a:2c:11:8e:07") == pseudonym {
+		t.Errorf("expected a random key when none is configured")
+	}
+}
+
+func TestAnonymizedEvents(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.anonymizer, _ = newAnonymizer("research key")
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+	mod.Push(NewSnifferEvent(time.Now(), "BLE CONNECT", "11:22:33:44:55:66", "d4:3a:2c:11:8e:07",
+		&ConnectIndData{Initiator: "11:22:33:44:55:66", Advertiser: "d4:3a:2c:11:8e:07"}, "New connection").WithRawHex("00000000  d4 3a"))
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected events")
+	}
+	devices := make(map[string]bool)
+	for _, e := range sink.events {
+		raw, _ := json.Marshal(e)
+		for _, address := range []string{"d4:3a:2c:11:8e:07", "c0:ff:ee:00:be:ef", "00:1a:7d:da:71:13", "11:22:33:44:55:66"} {
+			if strings.Contains(strings.ToLower(string(raw)), address) {
+				t.Errorf("found the address %s in %s", address, raw)
+			}
+		}
+		if e.RawHex != "" {
+			t.Errorf("expected the hexdump to be removed")
+		}
+		devices[e.Source] = true
+	}
+	// The 3 advertisers and the initiator keep distinct pseudonyms.
+	if len(devices) != 4 {
+		t.Errorf("expected 4 distinct pseudonyms, got %v", devices)
+	}
+
+	// The tables of the sniffer keep the real addresses.
+	if mod.Stats.DeviceName("d4:3a:2c:11:8e:07") == "" {
+		t.Errorf("expected the device table to keep the real addresses")
+	}
+}
+
+func TestAnonymizedTables(t *testing.T) {
+	mod := newBenchSniffer(&collectSink{})
+	a, _ := newAnonymizer("research key")
+	mod.Ctx.anonymizer = a
+	mod.Ctx.sensors = newSensorLog(4)
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	// The saved inventory and the sensor log only hold the pseudonyms.
+	raw := &strings.Builder{}
+	if err := writeInventoryJSON(raw, a.Devices(mod.Stats.DevicesList())); err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range []string{"d4:3a:2c:11:8e:07", "c0:ff:ee:00:be:ef", "00:1a:7d:da:71:13"} {
+		if strings.Contains(raw.String(), address) {
+			t.Errorf("found the address %s in the inventory", address)
+		}
+	}
+	pseudonym := a.Address("d4:3a:2c:11:8e:07")
+	if !strings.Contains(raw.String(), pseudonym) {
+		t.Errorf("expected the pseudonym %s in the inventory", pseudonym)
+	} else if readings := mod.Ctx.sensors.Readings(pseudonym); len(readings) == 0 {
+		t.Errorf("expected the readings to be logged under the pseudonym, got %v", mod.Ctx.sensors.Addresses())
+	}
+
+	// A device can be followed by its pseudonym.
+	btle := map[string]interface{}{"btle.advertising_address": "D4:3A:2C:11:8E:07"}
+	if !involvesAddress(btle, pseudonym, a) || involvesAddress(btle, pseudonym, nil) {
+		t.Errorf("expected the pseudonym to only match when anonymizing")
+	} else if !involvesAddress(btle, "d4:3a:2c:11:8e:07", a) {
+		t.Errorf("expected the real address to still match")
+	}
+}
+
+func TestAnonymizedEventKeepsPayloads(t *testing.T) {
+	a, _ := newAnonymizer("research key")
+	payload := "10:eb:01:67:6f:6f:67:6c:65:00"
+	data := SniffData{
+		"manufacturer":   []SniffData{{"company_id": uint16(0x004c), "data": payload}},
+		"data":           "aa:bb:cc:dd:ee:ff",
+		"target_address": "D4:3A:2C:11:8E:07",
+	}
+	e := a.Event(NewSnifferEvent(time.Now(), "BLE ADVERT", "c0:ff:ee:00:be:ef", "BROADCAST", data,
+		"Advertisement from c0:ff:ee:00:be:ef to d4:3a:2c:11:8e:07 data=%s", payload))
+
+	anonymized := e.Data.(SniffData)
+	if got := anonymized["manufacturer"].([]SniffData)[0]["data"]; got != payload {
+		t.Errorf("expected the payload to be kept, got %v", got)
+	} else if anonymized["data"] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("expected an address shaped payload to be kept, got %v", anonymized["data"])
+	} else if anonymized["target_address"] != a.Address("d4:3a:2c:11:8e:07") {
+		t.Errorf("expected the target address to be replaced, got %v", anonymized["target_address"])
+	}
+
+	expected := "Advertisement from " + a.Address("c0:ff:ee:00:be:ef") + " to " + a.Address("d4:3a:2c:11:8e:07") + " data=" + payload
+	if e.Source != a.Address("c0:ff:ee:00:be:ef") || e.Destination != "BROADCAST" || e.Message != expected {
+		t.Errorf("unexpected event %s -> %s: %s", e.Source, e.Destination, e.Message)
+	}
+}
@@ -0,0 +1,173 @@
+package ble_sniff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcicen/jstream"
+)
+
+// discardSink is an EventSink dropping every event.
+type discardSink struct{}
+
+func (discardSink) Push(e SnifferEvent) {}
+
+// newBenchSniffer returns a sniffer processing packets without a session, its events going to sink.
+func newBenchSniffer(sink EventSink) *Sniffer {
+	return &Sniffer{
+		Ctx:             NewSnifferContext(),
+		Stats:           NewSnifferStats(),
+		auxChains:       make(map[string]*auxChain),
+		auxChainsLock:   &sync.Mutex{},
+		followLock:      &sync.Mutex{},
+		subscribersLock: &sync.Mutex{},
+		handlersLock:    &sync.RWMutex{},
+		sink:            sink,
+	}
+}
+
+// cannedStream returns the fixture packets repeated n times as a single TShark JSON array.
+func cannedStream(b *testing.B, n int) []byte {
+	raw, err := ioutil.ReadFile("testdata/advertisements.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	packets := bytes.TrimSpace(raw)
+	packets = packets[1 : len(packets)-1]
+
+	stream := bytes.NewBufferString("[")
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			stream.WriteString(",")
+		}
+		stream.Write(packets)
+	}
+	stream.WriteString("]")
+	return stream.Bytes()
+}
+
+func BenchmarkPacketStream(b *testing.B) {
+	stream := cannedStream(b, 100)
+	mod := newBenchSniffer(discardSink{})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoder := jstream.NewDecoder(bytes.NewReader(stream), mod.Ctx.EmitDepth)
+		for packet := range decoder.Stream() {
+			mod.onPacket(packet.Value, time.Now())
+		}
+	}
+}
+
+// BenchmarkReadBuffer decodes a capture file read with buffers of several sizes, the larger ones taking fewer
+// reads of the file.
+func BenchmarkReadBuffer(b *testing.B) {
+	stream := cannedStream(b, 1000)
+	source := filepath.Join(b.TempDir(), "capture.json")
+	if err := ioutil.WriteFile(source, stream, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, size := range []int{minReadBuffer, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			b.SetBytes(int64(len(stream)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				file, err := os.Open(source)
+				if err != nil {
+					b.Fatal(err)
+				}
+				decoder := jstream.NewDecoder(bufio.NewReaderSize(file, size), 3)
+				for range decoder.Stream() {
+				}
+				file.Close()
+			}
+		})
+	}
+}
+
+func TestReadBufferMinimum(t *testing.T) {
+	if _, err := NewSnifferWithOptions(newTestSession(t), WithReadBuffer(minReadBuffer-1)); err == nil {
+		t.Error("expected a read buffer below the minimum to be rejected")
+	}
+
+	mod, err := NewSnifferWithOptions(newTestSession(t), WithReadBuffer(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err, value := mod.StringParam("ble.sniff.read_buffer"); err != nil || value != "1048576" {
+		t.Errorf("expected the read buffer to be set, got %v %s", err, value)
+	}
+}
+
+func BenchmarkOnPacket(b *testing.B) {
+	packets := make([]interface{}, 0)
+	for _, btle := range loadFixtures(b, "advertisements.json") {
+		packets = append(packets, map[string]interface{}{"btle": btle})
+	}
+	mod := newBenchSniffer(discardSink{})
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mod.onPacket(packets[i%len(packets)], now)
+	}
+}
+
+func TestOnPacketSkipsNonBLE(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+
+	if mod.onPacket(map[string]interface{}{"frame": map[string]interface{}{}}, time.Now()) {
+		t.Error("expected a packet without BLE layer to be skipped")
+	}
+	if mod.onPacket(map[string]interface{}{"btle": map[string]interface{}{}}, time.Now()) {
+		t.Error("expected a packet without access address to be skipped")
+	}
+	if mod.Stats.NumMatched != 0 || len(sink.events) != 0 {
+		t.Errorf("expected skipped packets not to be accounted, got %d matched and %d events", mod.Stats.NumMatched, len(sink.events))
+	}
+
+	for _, btle := range loadFixtures(t, "advertisements.json") {
+		if !mod.onPacket(map[string]interface{}{"btle": btle}, time.Now()) {
+			t.Error("expected an advertisement to be processed")
+		}
+	}
+	if mod.Stats.NumAdvertisements != 3 || len(mod.Stats.Devices) != 3 || len(sink.events) == 0 {
+		t.Errorf("unexpected stats after the fixtures: %d advertisements, %d devices, %d events",
+			mod.Stats.NumAdvertisements, len(mod.Stats.Devices), len(sink.events))
+	}
+}
+
+func TestOnPacketScanResponse(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+
+	// A scan response is only reported as such, not as an advertisement of the same structures.
+	btle := loadFixtures(t, "advertisements.json")[0]
+	btle["btle.advertising_header_tree"].(map[string]interface{})["btle.advertising_header.pdu_type"] = "0x04"
+	mod.onPacket(map[string]interface{}{"btle": btle}, time.Now())
+	if len(sink.events) != 1 || sink.events[0].Protocol != "BLE SCAN_RSP" {
+		t.Fatalf("expected a single scan response event, got %v", sink.events)
+	} else if name := sink.events[0].Data.(SniffData)["name"]; name != "Thermo" {
+		t.Errorf("unexpected name %v", name)
+	}
+}
+
+// collectSink is an EventSink keeping the pushed events.
+type collectSink struct {
+	events []SnifferEvent
+}
+
+func (c *collectSink) Push(e SnifferEvent) {
+	c.events = append(c.events, e)
+}
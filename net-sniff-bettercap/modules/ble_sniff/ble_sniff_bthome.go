@@ -0,0 +1,266 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings, math for rounding the scaled values, strings for the event message, and
+// unicode/utf8 for checking the texts.
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Declaring the bits of the BTHome device information byte.
+const (
+	BTHOME_ENCRYPTED     = 0x01
+	BTHOME_TRIGGER_BASED = 0x04
+	BTHOME_VERSION_SHIFT = 5
+)
+
+// Declaring the object IDs of the BTHome objects whose value isn't a plain number.
+const (
+	BTHOME_BUTTON = 0x3a
+	BTHOME_DIMMER = 0x3c
+	BTHOME_TEXT   = 0x53
+	BTHOME_RAW    = 0x54
+)
+
+// btHomeObject describes a BTHome object: the name of its measurement, the size in bytes of its little-endian value,
+// whether it is signed, the factor it is scaled by and its unit. The binary sensors report a boolean.
+type btHomeObject struct {
+	Name   string
+	Size   int
+	Signed bool
+	Factor float64
+	Unit   string
+	Binary bool
+}
+
+// btHomeObjects maps the object IDs of the BTHome v2 format to their description. The objects must be listed by
+// increasing ID, so decoding stops at the first unknown one since its size can't be known.
+var btHomeObjects = map[uint8]btHomeObject{
+	0x00: {Name: "packet_id", Size: 1, Factor: 1},
+	0x01: {Name: "battery", Size: 1, Factor: 1, Unit: "%"},
+	0x02: {Name: "temperature", Size: 2, Signed: true, Factor: 0.01, Unit: "°C"},
+	0x03: {Name: "humidity", Size: 2, Factor: 0.01, Unit: "%"},
+	0x04: {Name: "pressure", Size: 3, Factor: 0.01, Unit: "hPa"},
+	0x05: {Name: "illuminance", Size: 3, Factor: 0.01, Unit: "lux"},
+	0x06: {Name: "mass", Size: 2, Factor: 0.01, Unit: "kg"},
+	0x07: {Name: "mass", Size: 2, Factor: 0.01, Unit: "lb"},
+	0x08: {Name: "dewpoint", Size: 2, Signed: true, Factor: 0.01, Unit: "°C"},
+	0x09: {Name: "count", Size: 1, Factor: 1},
+	0x0a: {Name: "energy", Size: 3, Factor: 0.001, Unit: "kWh"},
+	0x0b: {Name: "power", Size: 3, Factor: 0.01, Unit: "W"},
+	0x0c: {Name: "voltage", Size: 2, Factor: 0.001, Unit: "V"},
+	0x0d: {Name: "pm2_5", Size: 2, Factor: 1, Unit: "ug/m3"},
+	0x0e: {Name: "pm10", Size: 2, Factor: 1, Unit: "ug/m3"},
+	0x0f: {Name: "generic", Size: 1, Binary: true},
+	0x10: {Name: "power_on", Size: 1, Binary: true},
+	0x11: {Name: "opening", Size: 1, Binary: true},
+	0x12: {Name: "co2", Size: 2, Factor: 1, Unit: "ppm"},
+	0x13: {Name: "tvoc", Size: 2, Factor: 1, Unit: "ug/m3"},
+	0x14: {Name: "moisture", Size: 2, Factor: 0.01, Unit: "%"},
+	0x15: {Name: "battery_low", Size: 1, Binary: true},
+	0x16: {Name: "battery_charging", Size: 1, Binary: true},
+	0x17: {Name: "carbon_monoxide", Size: 1, Binary: true},
+	0x18: {Name: "cold", Size: 1, Binary: true},
+	0x19: {Name: "connectivity", Size: 1, Binary: true},
+	0x1a: {Name: "door", Size: 1, Binary: true},
+	0x1b: {Name: "garage_door", Size: 1, Binary: true},
+	0x1c: {Name: "gas_detected", Size: 1, Binary: true},
+	0x1d: {Name: "heat", Size: 1, Binary: true},
+	0x1e: {Name: "light", Size: 1, Binary: true},
+	0x1f: {Name: "lock", Size: 1, Binary: true},
+	0x20: {Name: "moisture_detected", Size: 1, Binary: true},
+	0x21: {Name: "motion", Size: 1, Binary: true},
+	0x22: {Name: "moving", Size: 1, Binary: true},
+	0x23: {Name: "occupancy", Size: 1, Binary: true},
+	0x24: {Name: "plug", Size: 1, Binary: true},
+	0x25: {Name: "presence", Size: 1, Binary: true},
+	0x26: {Name: "problem", Size: 1, Binary: true},
+	0x27: {Name: "running", Size: 1, Binary: true},
+	0x28: {Name: "safety", Size: 1, Binary: true},
+	0x29: {Name: "smoke", Size: 1, Binary: true},
+	0x2a: {Name: "sound", Size: 1, Binary: true},
+	0x2b: {Name: "tamper", Size: 1, Binary: true},
+	0x2c: {Name: "vibration", Size: 1, Binary: true},
+	0x2d: {Name: "window", Size: 1, Binary: true},
+	0x2e: {Name: "humidity", Size: 1, Factor: 1, Unit: "%"},
+	0x2f: {Name: "moisture", Size: 1, Factor: 1, Unit: "%"},
+	0x3d: {Name: "count", Size: 2, Factor: 1},
+	0x3e: {Name: "count", Size: 4, Factor: 1},
+	0x3f: {Name: "rotation", Size: 2, Signed: true, Factor: 0.1, Unit: "°"},
+	0x40: {Name: "distance", Size: 2, Factor: 1, Unit: "mm"},
+	0x41: {Name: "distance", Size: 2, Factor: 0.1, Unit: "m"},
+	0x42: {Name: "duration", Size: 3, Factor: 0.001, Unit: "s"},
+	0x43: {Name: "current", Size: 2, Factor: 0.001, Unit: "A"},
+	0x44: {Name: "speed", Size: 2, Factor: 0.01, Unit: "m/s"},
+	0x45: {Name: "temperature", Size: 2, Signed: true, Factor: 0.1, Unit: "°C"},
+	0x46: {Name: "uv_index", Size: 1, Factor: 0.1},
+	0x47: {Name: "volume", Size: 2, Factor: 0.1, Unit: "L"},
+	0x48: {Name: "volume", Size: 2, Factor: 1, Unit: "mL"},
+	0x49: {Name: "volume_flow_rate", Size: 2, Factor: 0.001, Unit: "m3/h"},
+	0x4a: {Name: "voltage", Size: 2, Factor: 0.1, Unit: "V"},
+	0x4b: {Name: "gas", Size: 3, Factor: 0.001, Unit: "m3"},
+	0x4c: {Name: "gas", Size: 4, Factor: 0.001, Unit: "m3"},
+	0x4d: {Name: "energy", Size: 4, Factor: 0.001, Unit: "kWh"},
+	0x4e: {Name: "volume", Size: 4, Factor: 0.001, Unit: "L"},
+	0x4f: {Name: "water", Size: 4, Factor: 0.001, Unit: "L"},
+	0x50: {Name: "timestamp", Size: 4, Factor: 1, Unit: "s"},
+	0x51: {Name: "acceleration", Size: 2, Factor: 0.001, Unit: "m/s2"},
+	0x52: {Name: "gyroscope", Size: 2, Factor: 0.001, Unit: "°/s"},
+}
+
+// btHomeButtonEvents are the names of the events of the BTHome button objects.
+var btHomeButtonEvents = map[uint8]string{
+	0x00: "none",
+	0x01: "press",
+	0x02: "double_press",
+	0x03: "triple_press",
+	0x04: "long_press",
+	0x05: "long_double_press",
+	0x06: "long_triple_press",
+	0x80: "hold_press",
+}
+
+// btHomeDimmerEvents are the names of the events of the BTHome dimmer objects.
+var btHomeDimmerEvents = map[uint8]string{
+	0x00: "none",
+	0x01: "rotate_left",
+	0x02: "rotate_right",
+}
+
+// btHomeValue reads the little-endian value of a numeric BTHome object and scales it. The values without a
+// factor are returned as integers, the others as floats rounded to the precision of the factor.
+func btHomeValue(object btHomeObject, raw []byte) interface{} {
+	var value uint64
+	for i := len(raw) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(raw[i])
+	}
+
+	if object.Binary {
+		return value != 0
+	}
+
+	var number int64
+	if object.Signed {
+		// Extend the sign of the value to 64 bits.
+		shift := uint(64 - 8*len(raw))
+		number = int64(value<<shift) >> shift
+	} else {
+		number = int64(value)
+	}
+	if object.Factor == 1 {
+		return number
+	}
+
+	decimals := math.Round(-math.Log10(object.Factor))
+	scale := math.Pow(10, decimals)
+	return math.Round(float64(number)*object.Factor*scale) / scale
+}
+
+// btHomeName returns the key a measurement is stored with, suffixed when the same measurement was already reported
+// by a previous object of the payload.
+func btHomeName(data SniffData, name string) string {
+	key := name
+	for i := 2; data[key] != nil; i++ {
+		key = fmt.Sprintf("%s_%d", name, i)
+	}
+	return key
+}
+
+// decodeBTHome decodes the BTHome v2 service data, the open format of the DIY sensors, into named measurements.
+// The encrypted payloads aren't decrypted, they are only reported as such. Decoding stops at the first unknown
+// object, the measurements read until then are still reported.
+func decodeBTHome(data []byte) (SniffData, string, error) {
+	if len(data) < 1 {
+		return nil, "", fmt.Errorf("BTHome payload is empty")
+	}
+
+	info := data[0]
+	version := info >> BTHOME_VERSION_SHIFT
+	if version != 2 {
+		return nil, "", fmt.Errorf("unsupported BTHome version %d", version)
+	}
+
+	decoded := SniffData{
+		"bthome_version": version,
+		"encrypted":      info&BTHOME_ENCRYPTED != 0,
+		"trigger_based":  info&BTHOME_TRIGGER_BASED != 0,
+	}
+	if info&BTHOME_ENCRYPTED != 0 {
+		decoded["note"] = "encrypted payload, not decoded"
+		return decoded, "BTHome v2 encrypted", nil
+	}
+
+	measurements := make([]string, 0)
+	for i := 1; i < len(data); {
+		id := data[i]
+		i++
+
+		var key string
+		var value interface{}
+		var unit string
+		var quote bool
+		switch id {
+		case BTHOME_BUTTON:
+			if i+1 > len(data) {
+				return nil, "", fmt.Errorf("BTHome button object truncated")
+			}
+			name, ok := btHomeButtonEvents[data[i]]
+			if !ok {
+				name = fmt.Sprintf("0x%02x", data[i])
+			}
+			key, value = btHomeName(decoded, "button"), name
+			i++
+		case BTHOME_DIMMER:
+			if i+2 > len(data) {
+				return nil, "", fmt.Errorf("BTHome dimmer object truncated")
+			}
+			name, ok := btHomeDimmerEvents[data[i]]
+			if !ok {
+				name = fmt.Sprintf("0x%02x", data[i])
+			}
+			key, value = btHomeName(decoded, "dimmer"), fmt.Sprintf("%s %d", name, data[i+1])
+			i += 2
+		case BTHOME_TEXT, BTHOME_RAW:
+			// These objects are prefixed by their length.
+			if i+1 > len(data) || i+1+int(data[i]) > len(data) {
+				return nil, "", fmt.Errorf("BTHome object 0x%02x truncated", id)
+			}
+			payload := data[i+1 : i+1+int(data[i])]
+			// The texts come over the air, the ones which aren't valid UTF-8 are reported in hex.
+			if id == BTHOME_RAW {
+				key, value = btHomeName(decoded, "raw"), fmt.Sprintf("%x", payload)
+			} else if utf8.Valid(payload) {
+				key, value, quote = btHomeName(decoded, "text"), string(payload), true
+			} else {
+				key, value = btHomeName(decoded, "text_hex"), fmt.Sprintf("%x", payload)
+			}
+			i += 1 + len(payload)
+		default:
+			object, ok := btHomeObjects[id]
+			if !ok {
+				decoded["note"] = fmt.Sprintf("unknown object 0x%02x, the rest of the payload is not decoded", id)
+				i = len(data)
+				continue
+			} else if i+object.Size > len(data) {
+				return nil, "", fmt.Errorf("BTHome object 0x%02x truncated", id)
+			}
+			key, value, unit = btHomeName(decoded, object.Name), btHomeValue(object, data[i:i+object.Size]), object.Unit
+			i += object.Size
+		}
+
+		decoded[key] = value
+		if quote {
+			measurements = append(measurements, fmt.Sprintf("%s=%q", key, value))
+		} else if unit != "" {
+			measurements = append(measurements, fmt.Sprintf("%s=%v%s", key, value, unit))
+		} else {
+			measurements = append(measurements, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+
+	return decoded, fmt.Sprintf("BTHome v2 %s", strings.Join(measurements, " ")), nil
+}
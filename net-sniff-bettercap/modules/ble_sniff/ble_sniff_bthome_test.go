@@ -0,0 +1,87 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func TestDecodeBTHome(t *testing.T) {
+	// Battery 97%, temperature 23.45 C, humidity 51.01 %, pressure 1008.83 hPa, motion detected.
+	data := []byte{0x40, 0x01, 0x61, 0x02, 0x29, 0x09, 0x03, 0xed, 0x13, 0x04, 0x13, 0x8a, 0x01, 0x21, 0x01}
+
+	decoded, description, err := decodeBTHome(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := SniffData{
+		"battery":     int64(97),
+		"temperature": 23.45,
+		"humidity":    51.01,
+		"pressure":    1008.83,
+		"motion":      true,
+		"encrypted":   false,
+	}
+	for key, value := range expected {
+		if decoded[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, decoded[key])
+		}
+	}
+	if description != "BTHome v2 battery=97% temperature=23.45°C humidity=51.01% pressure=1008.83hPa motion=true" {
+		t.Errorf("unexpected description %q", description)
+	}
+}
+
+func TestDecodeBTHomeNegative(t *testing.T) {
+	// Two temperatures, -5.5 C with a 0.1 factor then -12.34 C.
+	decoded, _, err := decodeBTHome([]byte{0x44, 0x45, 0xc9, 0xff, 0x02, 0x2e, 0xfb})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["temperature"] != -5.5 || decoded["temperature_2"] != -12.34 {
+		t.Errorf("expected -5.5 and -12.34, got %v and %v", decoded["temperature"], decoded["temperature_2"])
+	}
+	if decoded["trigger_based"] != true {
+		t.Error("expected a trigger based device")
+	}
+}
+
+func TestDecodeBTHomeEncrypted(t *testing.T) {
+	decoded, description, err := decodeBTHome([]byte{0x41, 0xa4, 0x7b, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["encrypted"] != true || decoded["note"] == nil || description != "BTHome v2 encrypted" {
+		t.Errorf("expected an encrypted payload, got %v %q", decoded, description)
+	}
+}
+
+func TestDecodeBTHomeMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{},
+		{0x20, 0x01, 0x61},
+		{0x40, 0x02, 0x29},
+	} {
+		if _, _, err := decodeBTHome(data); err == nil {
+			t.Errorf("expected an error for % x", data)
+		}
+	}
+
+	// The objects after an unknown one are skipped.
+	decoded, _, err := decodeBTHome([]byte{0x40, 0x01, 0x61, 0xf0, 0x01, 0x02})
+	if err != nil || decoded["battery"] != int64(97) || decoded["note"] == nil {
+		t.Errorf("expected the battery and a note, got %v %v", decoded, err)
+	}
+}
+
+func TestDecodeBTHomeText(t *testing.T) {
+	// A text with a NUL and a newline, then one which isn't valid UTF-8.
+	decoded, description, err := decodeBTHome([]byte{0x40, 0x53, 0x04, 'a', 0x00, 'b', '\n', 0x53, 0x02, 0xff, 0xfe})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["text"] != "a\x00b\n" || decoded["text_hex"] != "fffe" {
+		t.Errorf("expected the valid text as is and the other one in hex, got %v", decoded)
+	}
+	if description != `BTHome v2 text="a\x00b\n" text_hex=fffe` {
+		t.Errorf("expected the text to be quoted, got %q", description)
+	}
+}
@@ -0,0 +1,54 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/json for a canonical form of the AD structures, hash/fnv for hashing it,
+// and sync/atomic for the counters shared with the workers.
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+// payloadHash hashes the AD structures of an advertisement. They are hashed in their JSON form, whose keys are
+// sorted, so that the same payload always gets the same hash.
+func payloadHash(entries []map[string]interface{}) uint64 {
+	hash := fnv.New64a()
+	if err := json.NewEncoder(hash).Encode(entries); err != nil {
+		return 0
+	}
+	return hash.Sum64()
+}
+
+// payloadChanged records the payload hash of an advertisement and returns true if it differs from the previous
+// one with the same key, always for the first one. The counters of changed and unchanged payloads are updated.
+func (s *SnifferStats) payloadChanged(key string, hash uint64) bool {
+	s.Lock()
+	if s.payloads == nil {
+		s.payloads = make(map[string]uint64)
+	}
+	previous, seen := s.payloads[key]
+	s.payloads[key] = hash
+	s.Unlock()
+
+	if seen && previous == hash {
+		atomic.AddUint64(&s.NumUnchanged, 1)
+		return false
+	}
+	atomic.AddUint64(&s.NumChanged, 1)
+	return true
+}
+
+// isChanged returns true if the payload of an advertisement differs from the previous one of its device, or if
+// ble.sniff.changes_only is false. The payloads are compared per PDU type, since the advertisements and the scan
+// responses of a device carry different data.
+func (mod *Sniffer) isChanged(btleData map[string]interface{}, entries []map[string]interface{}) bool {
+	if !mod.Ctx.ChangesOnly {
+		return true
+	}
+	address, ok := btleData["btle.advertising_address"].(string)
+	if !ok {
+		return true
+	}
+	return mod.Stats.payloadChanged(address+"/"+pduLabel(btleData), payloadHash(entries))
+}
@@ -0,0 +1,233 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings, and strings for joining the service classes.
+import (
+	"fmt"
+	"strings"
+)
+
+// Declaring the sizes of the Class of Device and Appearance AD structures.
+const (
+	classOfDeviceSize = 3
+	appearanceSize    = 2
+)
+
+// codMajorClasses maps the major device classes of a Class of Device to their names.
+var codMajorClasses = map[uint32]string{
+	0x00: "Miscellaneous",
+	0x01: "Computer",
+	0x02: "Phone",
+	0x03: "LAN/Network Access Point",
+	0x04: "Audio/Video",
+	0x05: "Peripheral",
+	0x06: "Imaging",
+	0x07: "Wearable",
+	0x08: "Toy",
+	0x09: "Health",
+	0x1f: "Uncategorized",
+}
+
+// codMinorClasses maps the minor device classes of the most common major classes to their names.
+var codMinorClasses = map[uint32]map[uint32]string{
+	0x01: {
+		0x00: "Uncategorized",
+		0x01: "Desktop Workstation",
+		0x02: "Server",
+		0x03: "Laptop",
+		0x04: "Handheld PC/PDA",
+		0x05: "Palm-size PC/PDA",
+		0x06: "Wearable Computer",
+		0x07: "Tablet",
+	},
+	0x02: {
+		0x00: "Uncategorized",
+		0x01: "Cellular",
+		0x02: "Cordless",
+		0x03: "Smartphone",
+		0x04: "Wired Modem",
+		0x05: "ISDN Access",
+	},
+	0x04: {
+		0x00: "Uncategorized",
+		0x01: "Wearable Headset",
+		0x02: "Hands-free",
+		0x04: "Microphone",
+		0x05: "Loudspeaker",
+		0x06: "Headphones",
+		0x07: "Portable Audio",
+		0x08: "Car Audio",
+		0x09: "Set-top Box",
+		0x0a: "HiFi Audio",
+		0x0b: "VCR",
+		0x0c: "Video Camera",
+		0x0d: "Camcorder",
+		0x0e: "Video Monitor",
+		0x0f: "Video Display and Loudspeaker",
+		0x10: "Video Conferencing",
+		0x12: "Gaming/Toy",
+	},
+	0x07: {
+		0x01: "Wristwatch",
+		0x02: "Pager",
+		0x03: "Jacket",
+		0x04: "Helmet",
+		0x05: "Glasses",
+	},
+}
+
+// codServiceClasses are the names of the service class bits of a Class of Device, from bit 13 to bit 23.
+var codServiceClasses = []struct {
+	Bit  uint
+	Name string
+}{
+	{13, "Limited Discoverable"},
+	{14, "LE Audio"},
+	{16, "Positioning"},
+	{17, "Networking"},
+	{18, "Rendering"},
+	{19, "Capturing"},
+	{20, "Object Transfer"},
+	{21, "Audio"},
+	{22, "Telephony"},
+	{23, "Information"},
+}
+
+// appearanceCategories maps the categories of the LE Appearance values, their upper 10 bits, to their names.
+var appearanceCategories = map[uint16]string{
+	0x00: "Unknown",
+	0x01: "Phone",
+	0x02: "Computer",
+	0x03: "Watch",
+	0x04: "Clock",
+	0x05: "Display",
+	0x06: "Remote Control",
+	0x07: "Eye-glasses",
+	0x08: "Tag",
+	0x09: "Keyring",
+	0x0a: "Media Player",
+	0x0b: "Barcode Scanner",
+	0x0c: "Thermometer",
+	0x0d: "Heart Rate Sensor",
+	0x0e: "Blood Pressure",
+	0x0f: "Human Interface Device",
+	0x10: "Glucose Meter",
+	0x11: "Running Walking Sensor",
+	0x12: "Cycling",
+	0x31: "Pulse Oximeter",
+	0x32: "Weight Scale",
+	0x33: "Personal Mobility Device",
+	0x34: "Continuous Glucose Monitor",
+	0x35: "Insulin Pump",
+	0x36: "Medication Delivery",
+	0x51: "Outdoor Sports Activity",
+}
+
+// decodeClassOfDevice splits a Class of Device into the names of its major and minor device classes and of its
+// service classes. The minor classes without a name are reported by number.
+func decodeClassOfDevice(cod uint32) (string, string, []string) {
+	major_class := (cod >> 8) & 0x1f
+	minor_class := (cod >> 2) & 0x3f
+
+	major, ok := codMajorClasses[major_class]
+	if !ok {
+		major = fmt.Sprintf("Reserved (0x%02x)", major_class)
+	}
+	minor, ok := codMinorClasses[major_class][minor_class]
+	if !ok {
+		minor = fmt.Sprintf("0x%02x", minor_class)
+	}
+
+	services := make([]string, 0)
+	for _, service := range codServiceClasses {
+		if cod&(1<<service.Bit) != 0 {
+			services = append(services, service.Name)
+		}
+	}
+	return major, minor, services
+}
+
+// classOfDevice extracts the Class of Device of an AD structure, either from the field decoded by TShark or from its
+// little-endian raw payload, which must be 3 bytes long.
+func classOfDevice(entry map[string]interface{}) (uint32, error) {
+	value, _ := findField(entry, "btcommon.cod.class_of_device")
+	cod_string, decoded := value.(string)
+	raw, err := adPayload(entry, "class of device", decoded, func(size int) bool {
+		return size == classOfDeviceSize
+	})
+	if err != nil {
+		return 0, err
+	} else if !decoded {
+		return uint32(raw[0]) | uint32(raw[1])<<8 | uint32(raw[2])<<16, nil
+	}
+
+	cod, err := parseUint(cod_string, 24)
+	return uint32(cod), err
+}
+
+// onClassOfDevice processes the Class of Device AD structure some dual-mode devices advertise, reporting their
+// BR/EDR device and service classes. Malformed structures are ignored.
+func onClassOfDevice(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	cod, err := classOfDevice(entry)
+	if err != nil {
+		return nil
+	}
+
+	major, minor, services := decodeClassOfDevice(cod)
+	return adv.event(SniffData{
+		"class_of_device": fmt.Sprintf("0x%06x", cod),
+		"major_class":     major,
+		"minor_class":     minor,
+		"service_classes": services,
+	},
+		"Class of device %s/%s (%s)",
+		major,
+		minor,
+		strings.Join(services, ", "),
+	)
+}
+
+// appearanceCategory returns the name of the category of an LE Appearance value.
+func appearanceCategory(appearance uint16) string {
+	if name, ok := appearanceCategories[appearance>>6]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reserved (0x%03x)", appearance>>6)
+}
+
+// appearance extracts the LE Appearance of an AD structure, either from the field decoded by TShark or from its
+// little-endian raw payload, which must be 2 bytes long.
+func appearance(entry map[string]interface{}) (uint16, error) {
+	value_string, decoded := entry["btcommon.eir_ad.entry.appearance"].(string)
+	raw, err := adPayload(entry, "appearance", decoded, func(size int) bool {
+		return size == appearanceSize
+	})
+	if err != nil {
+		return 0, err
+	} else if !decoded {
+		return uint16(raw[0]) | uint16(raw[1])<<8, nil
+	}
+
+	value, err := parseUint(value_string, 16)
+	return uint16(value), err
+}
+
+// onAppearance processes the Appearance AD structure, reporting the category of the device. Malformed structures
+// are ignored.
+func onAppearance(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	value, err := appearance(entry)
+	if err != nil {
+		return nil
+	}
+
+	category := appearanceCategory(value)
+	return adv.event(SniffData{
+		"appearance":          fmt.Sprintf("0x%04x", value),
+		"appearance_category": category,
+	},
+		"Appearance %s (0x%04x)",
+		category,
+		value,
+	)
+}
@@ -0,0 +1,98 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, sync/atomic for the counters updated by the packet loop and the workers, and time for the
+// capture times.
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// counterDelta returns how much a cumulative counter grew since a previous value, or its value if it was cleared
+// in between.
+func counterDelta(current uint64, previous uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// counters returns the cumulative counters of the statistics.
+func (s *SnifferStats) counters() []*uint64 {
+	return []*uint64{
+		&s.NumAdvertisements,
+		&s.NumMatched,
+		&s.NumDumped,
+		&s.NumDropped,
+		&s.NumBadCRC,
+		&s.NumSequenced,
+		&s.NumMissed,
+		&s.NumBytes,
+		&s.NumLengthFiltered,
+		&s.NumChannelFiltered,
+		&s.NumChanged,
+		&s.NumUnchanged,
+		&s.NumWrote,
+		&s.NumSubscriberDropped,
+		&s.NumDisplayDropped,
+		&s.NumEvents,
+	}
+}
+
+// ClearDevices forgets the devices discovered so far and returns how many there were, the counters are kept. The
+// devices still advertising are tracked again from their next advertisement.
+func (s *SnifferStats) ClearDevices() int {
+	s.Lock()
+	defer s.Unlock()
+
+	cleared := len(s.Devices)
+	s.Devices = make(map[string]*SnifferDevice)
+	return cleared
+}
+
+// ClearCounters zeroes the packet and event counters and the company counts, the devices are kept. The capture
+// times are restarted by the packet loop from the next packet.
+func (s *SnifferStats) ClearCounters() {
+	for _, counter := range s.counters() {
+		atomic.StoreUint64(counter, 0)
+	}
+	atomic.StoreInt32(&s.restart, 1)
+
+	s.Lock()
+	defer s.Unlock()
+	s.Companies = make(map[uint16]uint64)
+}
+
+// restartCapture forgets the capture times when the counters were cleared, it must be called by the packet loop with
+// the lock held.
+func (s *SnifferStats) restartCapture() {
+	if atomic.CompareAndSwapInt32(&s.restart, 1, 0) {
+		s.FirstPacket = time.Time{}
+		s.LastPacket = time.Time{}
+		s.LongestGap = 0
+		s.LongestGapEnd = time.Time{}
+	}
+}
+
+// ClearDevices handles ble.sniff.clear.devices, emptying the device inventory.
+func (mod *Sniffer) ClearDevices() error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	mod.Info("cleared %d devices from the inventory, the counters are kept", mod.Stats.ClearDevices())
+	return nil
+}
+
+// ClearStats handles ble.sniff.clear.stats, zeroing the counters.
+func (mod *Sniffer) ClearStats() error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	mod.Stats.ClearCounters()
+	mod.Info("cleared the packet, event and company counters, the device inventory is kept")
+	return nil
+}
@@ -0,0 +1,78 @@
+package ble_sniff
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestClearDevicesAndStats(t *testing.T) {
+	quietLogs(t)
+	mod := newBenchSniffer(&collectSink{})
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	// Clearing the devices keeps the counters.
+	if cleared := mod.Stats.ClearDevices(); cleared != 3 {
+		t.Errorf("expected 3 devices to be cleared, got %d", cleared)
+	}
+	if devices := len(mod.Stats.DevicesList()); devices != 0 || mod.Stats.NumAdvertisements != 3 || len(mod.Stats.CompaniesList()) == 0 {
+		t.Errorf("expected no device and the counters kept, got %d devices, %d advertisements and %d companies", devices, mod.Stats.NumAdvertisements, len(mod.Stats.CompaniesList()))
+	}
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	// Clearing the counters keeps the devices, the capture times restart from the next packet.
+	first := mod.Stats.FirstPacket
+	mod.Stats.ClearCounters()
+	if devices := len(mod.Stats.DevicesList()); devices != 3 || mod.Stats.NumAdvertisements != 0 || mod.Stats.NumEvents != 0 || len(mod.Stats.CompaniesList()) != 0 {
+		t.Errorf("expected the devices kept and no count, got %d devices, %d advertisements, %d events and %d companies", devices, mod.Stats.NumAdvertisements, mod.Stats.NumEvents, len(mod.Stats.CompaniesList()))
+	}
+	packets := fixturePackets(t)
+	mod.dispatchPacket(nil, packets[0])
+	if mod.Stats.NumAdvertisements != 1 || mod.Stats.FirstPacket.Equal(first) || mod.Stats.LongestGap != 0 {
+		t.Errorf("expected the capture to restart, got %d advertisements since %s", mod.Stats.NumAdvertisements, mod.Stats.FirstPacket)
+	}
+	if devices := mod.Stats.DevicesList(); devices[0].Packets < 2 {
+		t.Errorf("expected the devices to keep their counts, got %d packets", devices[0].Packets)
+	}
+}
+
+func TestClearWhileCapturing(t *testing.T) {
+	quietLogs(t)
+	mod := newBenchSniffer(&lockedSink{})
+	pool := mod.newWorkerPool(4)
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			mod.Stats.ClearDevices()
+			mod.Stats.ClearCounters()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		for _, packet := range fixturePackets(t) {
+			mod.dispatchPacket(pool, packet)
+		}
+	}
+	wg.Wait()
+	pool.Wait()
+
+	if advertisements := mod.Stats.NumAdvertisements; advertisements > 300 {
+		t.Errorf("expected at most 300 advertisements, got %d", advertisements)
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	if delta := counterDelta(10, 4); delta != 6 {
+		t.Errorf("expected a delta of 6, got %d", delta)
+	}
+	// The counter was cleared since the previous value.
+	if delta := counterDelta(3, 40); delta != 3 {
+		t.Errorf("expected a delta of 3 after a clear, got %d", delta)
+	}
+}
@@ -0,0 +1,35 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// islazy/tui for the colors.
+import (
+	"github.com/evilsocket/islazy/tui"
+)
+
+// cyan is the escape sequence of the color tui has no helper for.
+const cyan = "\033[36m"
+
+// colorProtocol colors the protocol label of an event by the kind of packet it was decoded from: advertisements in
+// green, scan requests and responses in yellow, connections in blue, control PDUs in cyan and errors in red.
+func colorProtocol(protocol string) string {
+	switch protocol {
+	case "BLE ADVERT":
+		return tui.Green(protocol)
+	case "BLE SCAN_REQ", "BLE SCAN_RSP":
+		return tui.Yellow(protocol)
+	case "BLE CONNECT":
+		return tui.Blue(protocol)
+	case "BLE CTRL":
+		return tui.Wrap(cyan, protocol)
+	case "BLE ERROR":
+		return tui.Red(protocol)
+	}
+	return tui.Dim(protocol)
+}
+
+// colorize returns a copy of the event whose message starts with its colored protocol label, the data is left as is.
+func colorize(e SnifferEvent) SnifferEvent {
+	e.Message = colorProtocol(e.Protocol) + " " + e.Message
+	return e
+}
@@ -0,0 +1,52 @@
+package ble_sniff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.Color = true
+	// The outputs are fed by the handlers, which get the plain message.
+	handled := make([]SnifferEvent, 0)
+	mod.addEventHandler(func(e SnifferEvent) {
+		handled = append(handled, e)
+	})
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected events")
+	}
+	for _, e := range sink.events {
+		if !strings.Contains(e.Message, e.Protocol) {
+			t.Errorf("expected the message to contain the protocol, got %q", e.Message)
+		}
+	}
+	if len(handled) != len(sink.events) {
+		t.Fatalf("expected %d handled events, got %d", len(sink.events), len(handled))
+	}
+	for _, e := range handled {
+		if strings.Contains(e.Message, "\033[") {
+			t.Errorf("expected no colors in the outputs, got %q", e.Message)
+		}
+	}
+
+	plain := &collectSink{}
+	mod = newBenchSniffer(plain)
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+	for i, e := range plain.events {
+		if !strings.HasSuffix(sink.events[i].Message, " "+e.Message) {
+			t.Errorf("expected the original message after the label, got %q and %q", sink.events[i].Message, e.Message)
+		}
+		if strings.Contains(e.Message, e.Protocol) {
+			t.Errorf("expected no label without colors, got %q", e.Message)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, sort for ordering the companies table,
+// and bettercap/gatt for the company identifiers.
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bettercap/gatt"
+)
+
+// CompanyCount struct holds the number of advertisements seen for a company.
+type CompanyCount struct {
+	ID    uint16 `json:"company_id"` // Company identifier assigned by the Bluetooth SIG.
+	Name  string `json:"company"`    // Name of the company, empty if unknown.
+	Count uint64 `json:"count"`      // Count of advertisements carrying the company identifier.
+}
+
+// Label returns the company name along with its identifier.
+func (c CompanyCount) Label() string {
+	if c.Name == "" {
+		return fmt.Sprintf("Unknown (0x%04x)", c.ID)
+	}
+	return fmt.Sprintf("%s (0x%04x)", c.Name, c.ID)
+}
+
+// CountCompany increments the advertisement count of a company.
+func (s *SnifferStats) CountCompany(id uint16) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Companies[id]++
+}
+
+// CompaniesList returns the companies table sorted by number of advertisements, most frequent first.
+func (s *SnifferStats) CompaniesList() []CompanyCount {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]CompanyCount, 0, len(s.Companies))
+	for id, count := range s.Companies {
+		list = append(list, CompanyCount{
+			ID:    id,
+			Name:  gatt.CompanyIdents[id],
+			Count: count,
+		})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count == list[j].Count {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].Count > list[j].Count
+	})
+
+	return list
+}
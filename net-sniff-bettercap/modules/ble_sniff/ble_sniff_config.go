@@ -0,0 +1,299 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for writing the caplet and reading the YAML files, bytes for reading the files, encoding/json for the JSON
+// files, fmt for errors and formatted lines, io for the writer, io/ioutil for reading the files, os for the caplet
+// file, path/filepath for the file extensions, sort for a stable order of the parameters, strconv for the numbers,
+// strings for quoting the values, and session for the parameters.
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bettercap/bettercap/session"
+)
+
+// configParamPrefix is the prefix of the parameters of the module, optional in the configuration files.
+const configParamPrefix = "ble.sniff."
+
+// capletValue quotes a parameter value so that the session reads it back unchanged, the empty values and the ones
+// containing quotes or the ';' command separator being quoted.
+func capletValue(value string) (string, error) {
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("value spans multiple lines")
+	}
+
+	switch {
+	case value == "":
+		return `""`, nil
+	case !strings.ContainsAny(value, `;"'`):
+		return value, nil
+	case !strings.Contains(value, `"`):
+		return `"` + value + `"`, nil
+	case !strings.Contains(value, `'`):
+		return `'` + value + `'`, nil
+	}
+	return "", fmt.Errorf("value contains both single and double quotes")
+}
+
+// writeCaplet writes a set command for every parameter, sorted by name.
+func writeCaplet(w io.Writer, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "# ble.sniff configuration, replay it with: bettercap -caplet <file>\n")
+	for _, name := range names {
+		value, err := capletValue(values[name])
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		fmt.Fprintf(writer, "set %s %s\n", name, value)
+	}
+	return writer.Flush()
+}
+
+// parameterValues returns the current values of the parameters of the module, as set in the session environment.
+func (mod *Sniffer) parameterValues() map[string]string {
+	values := make(map[string]string)
+	for name, param := range mod.Parameters() {
+		value := param.Value
+		if found, current := mod.Session.Env.Get(name); found {
+			value = current
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// SaveConfig writes the current values of every ble.sniff parameter to a caplet, as set commands that can be
+// replayed to reproduce the capture setup. The file is replaced only once fully written.
+func (mod *Sniffer) SaveConfig(path string) error {
+	values := mod.parameterValues()
+
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	err = writeCaplet(file, values)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	} else if err = os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	mod.Info("saved %d parameters to %s", len(values), path)
+	return nil
+}
+
+// jsonConfigValue converts a value of a JSON configuration file to the string of a parameter. The lists, like the
+// ones of ble.sniff.ad_types, are joined with commas.
+func jsonConfigValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := jsonConfigValue(item)
+			if err != nil {
+				return "", err
+			} else if _, list := item.([]interface{}); list {
+				return "", fmt.Errorf("nested lists aren't supported")
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
+
+// parseJSONConfig parses a JSON configuration file, an object whose keys are the parameters.
+func parseJSONConfig(raw []byte) (map[string]string, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(object))
+	for name, value := range object {
+		s, err := jsonConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// parseYAMLConfig parses a YAML configuration file, only a flat mapping of the parameters to scalar values being
+// supported. The values can be quoted, the lines starting with # are comments.
+func parseYAMLConfig(raw []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		} else if text != trimmed {
+			return nil, fmt.Errorf("line %d: only a flat mapping of the parameters is supported", line)
+		}
+
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'parameter: value'", line)
+		}
+		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			// A comment can follow the unquoted values.
+			value = strings.TrimSpace(value[:i])
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
+
+// readConfigFile reads the parameter values of a configuration file, as YAML if its extension is .yaml or .yml
+// and as JSON otherwise.
+func readConfigFile(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return parseYAMLConfig(raw)
+	}
+	return parseJSONConfig(raw)
+}
+
+// applyConfig sets the parameters to the values of the ble.sniff.config file, if any, before they are read by
+// GetContext. The parameters set explicitly, with the set command or an option, keep their value even when it is
+// the default. The unknown parameters of the file and its invalid values are reported as errors.
+func (mod *Sniffer) applyConfig() error {
+	err, path := mod.StringParam("ble.sniff.config")
+	if err != nil || path == "" {
+		return err
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("ble.sniff.config: %v", err)
+	}
+
+	// Every key is checked before any parameter is changed, the parameters already changed being restored if a
+	// value turns out to be invalid.
+	params := mod.Parameters()
+	resolved := make(map[string]string, len(values))
+	unknown := make([]string, 0)
+	for name, value := range values {
+		full := name
+		if !strings.HasPrefix(full, configParamPrefix) {
+			full = configParamPrefix + full
+		}
+		if _, found := params[full]; !found || full == "ble.sniff.config" {
+			unknown = append(unknown, name)
+			continue
+		}
+		resolved[full] = value
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("ble.sniff.config: unknown parameters in %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	names := make([]string, 0, len(resolved))
+	for name := range resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mod.explicitParamsLock.Lock()
+	mod.applyingConfig = true
+	mod.explicitParamsLock.Unlock()
+	defer func() {
+		mod.explicitParamsLock.Lock()
+		mod.applyingConfig = false
+		mod.explicitParamsLock.Unlock()
+	}()
+
+	kept := 0
+	previous := make(map[string]string, len(names))
+	for _, name := range names {
+		if mod.isExplicit(name) {
+			kept++
+			continue
+		}
+
+		_, value := mod.Session.Env.Get(name)
+		if err = withParam(name, resolved[name])(mod); err != nil {
+			for changed, prev := range previous {
+				mod.Session.Env.Set(changed, prev)
+			}
+			return fmt.Errorf("ble.sniff.config: %s: %v", name, err)
+		}
+		previous[name] = value
+	}
+
+	mod.Info("applied %d parameters of %s, %d set in the session kept", len(names)-kept, path, kept)
+	return nil
+}
+
+// addParam adds a parameter to the module, observed to record when it is set in the session or by an option.
+func (mod *Sniffer) addParam(p *session.ModuleParam) *session.ModuleParam {
+	// The observer is called once with the default value while it is registered.
+	registered := false
+	mod.AddObservableParam(p, func(string) {
+		if registered {
+			mod.markExplicit(p.Name)
+		}
+	})
+	registered = true
+	return p
+}
+
+// markExplicit records a parameter set in the session or by an option, unless ble.sniff.config is setting it.
+func (mod *Sniffer) markExplicit(name string) {
+	mod.explicitParamsLock.Lock()
+	defer mod.explicitParamsLock.Unlock()
+
+	if !mod.applyingConfig {
+		mod.explicitParams[name] = true
+	}
+}
+
+// isExplicit returns true if the parameter was set in the session or by an option.
+func (mod *Sniffer) isExplicit(name string) bool {
+	mod.explicitParamsLock.Lock()
+	defer mod.explicitParamsLock.Unlock()
+
+	return mod.explicitParams[name]
+}
@@ -0,0 +1,189 @@
+package ble_sniff
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCapletValue(t *testing.T) {
+	for value, expected := range map[string]string{
+		"":                    `""`,
+		"ble.sniff":           "ble.sniff",
+		"btle && btle.length": "btle && btle.length",
+		"a;b":                 `"a;b"`,
+		`say "hi"`:            `'say "hi"'`,
+		"it's":                `"it's"`,
+	} {
+		if quoted, err := capletValue(value); err != nil || quoted != expected {
+			t.Errorf("expected %s for '%s', got %s (%v)", expected, value, quoted, err)
+		}
+	}
+
+	for _, value := range []string{"a\nb", `"it's"`} {
+		if _, err := capletValue(value); err == nil {
+			t.Errorf("expected an error for '%s'", value)
+		}
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	s := newTestSession(t)
+	mod, err := NewSnifferWithOptions(s, WithTag("ble.lab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Env.Set("ble.sniff.filter", "btle.length > 10; frame")
+
+	path := filepath.Join(t.TempDir(), "ble.cap")
+	if err = mod.SaveConfig(path); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every parameter is saved, and reads back with the value it was saved with.
+	values := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 || parts[0] != "set" {
+			t.Fatalf("unexpected command '%s'", line)
+		}
+		// The session strips the quotes around the values.
+		values[parts[1]] = strings.Trim(parts[2], `"'`)
+	}
+
+	if len(values) != len(mod.Parameters()) {
+		t.Errorf("expected %d parameters, got %d", len(mod.Parameters()), len(values))
+	}
+	for name, expected := range map[string]string{
+		"ble.sniff.tag":    "ble.lab",
+		"ble.sniff.filter": "btle.length > 10; frame",
+		"ble.sniff.output": "",
+	} {
+		if values[name] != expected {
+			t.Errorf("expected %s to be '%s', got '%s'", name, expected, values[name])
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "ble.json")
+	yamlPath := filepath.Join(dir, "ble.yml")
+	if err := ioutil.WriteFile(jsonPath, []byte(`{"tag": "lab", "ble.sniff.merge": true, "workers": 4, "ad_types": ["0x01", "0xff"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(yamlPath, []byte("# Lab setup\n---\ntag: 'lab'\nble.sniff.merge: true # merged\nworkers: 4\nfilter: \"btle.length > 10 # bytes\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readConfigFile(jsonPath)
+	if err != nil {
+		t.Fatal(err)
+	} else if values["tag"] != "lab" || values["ble.sniff.merge"] != "true" || values["workers"] != "4" || values["ad_types"] != "0x01,0xff" {
+		t.Errorf("unexpected JSON values %v", values)
+	}
+
+	if values, err = readConfigFile(yamlPath); err != nil {
+		t.Fatal(err)
+	} else if values["tag"] != "lab" || values["ble.sniff.merge"] != "true" || values["workers"] != "4" || values["filter"] != "btle.length > 10 # bytes" {
+		t.Errorf("unexpected YAML values %v", values)
+	}
+
+	for name, content := range map[string]string{
+		"null.json":   `{"tag": null}`,
+		"object.json": `{"tag": {"name": "lab"}}`,
+		"nested.yaml": "ble:\n  sniff:\n    tag: lab\n",
+		"line.yaml":   "tag lab\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		} else if _, err = readConfigFile(path); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ble.json")
+	if err := ioutil.WriteFile(path, []byte(`{"tag": "lab", "workers": 4}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSession(t)
+	mod, err := NewSnifferWithOptions(s, WithConfig(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The values set in the session win over the file, even the defaults.
+	s.Env.Set("ble.sniff.workers", "2")
+	s.Env.Set("ble.sniff.tag", mod.Param("ble.sniff.tag").Value)
+	if err = mod.applyConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, tag := s.Env.Get("ble.sniff.tag"); tag != mod.Param("ble.sniff.tag").Value {
+		t.Errorf("expected the default tag set in the session, got '%s'", tag)
+	} else if _, workers := s.Env.Get("ble.sniff.workers"); workers != "2" {
+		t.Errorf("expected the workers set in the session, got '%s'", workers)
+	}
+
+	// A changed file replaces the values it set before.
+	if err = ioutil.WriteFile(path, []byte(`{"tag": "field", "verbose": true}`), 0644); err != nil {
+		t.Fatal(err)
+	} else if err = mod.applyConfig(); err != nil {
+		t.Fatal(err)
+	} else if _, verbose := s.Env.Get("ble.sniff.verbose"); verbose != "true" {
+		t.Errorf("expected the verbose flag of the file, got '%s'", verbose)
+	}
+	if err = ioutil.WriteFile(path, []byte(`{"verbose": false}`), 0644); err != nil {
+		t.Fatal(err)
+	} else if err = mod.applyConfig(); err != nil {
+		t.Fatal(err)
+	} else if _, verbose := s.Env.Get("ble.sniff.verbose"); verbose != "false" {
+		t.Errorf("expected the verbose flag of the changed file, got '%s'", verbose)
+	}
+
+	// The unknown parameters are all reported, and nothing is changed.
+	if err = ioutil.WriteFile(path, []byte(`{"verbose": true, "wokers": 4, "ble.sniff.config": "x.json"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = mod.applyConfig(); err == nil || !strings.Contains(err.Error(), "ble.sniff.config, wokers") {
+		t.Errorf("expected the unknown parameters to be reported, got %v", err)
+	} else if _, verbose := s.Env.Get("ble.sniff.verbose"); verbose != "false" {
+		t.Errorf("expected the verbose flag to be unchanged, got '%s'", verbose)
+	}
+
+	if err = ioutil.WriteFile(path, []byte(`{"alert.window": "many"}`), 0644); err != nil {
+		t.Fatal(err)
+	} else if err = mod.applyConfig(); err == nil || !strings.Contains(err.Error(), "ble.sniff.alert.window") {
+		t.Errorf("expected the invalid value to be reported, got %v", err)
+	}
+
+	// The values applied before an invalid one are restored.
+	_, color := s.Env.Get("ble.sniff.color")
+	if err = ioutil.WriteFile(path, []byte(`{"color": "`+flipBool(color)+`", "verbose": "maybe"}`), 0644); err != nil {
+		t.Fatal(err)
+	} else if err = mod.applyConfig(); err == nil || !strings.Contains(err.Error(), "ble.sniff.verbose") {
+		t.Errorf("expected the invalid value to be reported, got %v", err)
+	} else if _, restored := s.Env.Get("ble.sniff.color"); restored != color {
+		t.Errorf("expected the color flag to be restored to '%s', got '%s'", color, restored)
+	} else if mod.isExplicit("ble.sniff.color") {
+		t.Error("expected the restored color flag not to be explicit")
+	}
+}
+
+// flipBool returns the opposite of a boolean value.
+func flipBool(value string) string {
+	if value == "true" {
+		return "false"
+	}
+	return "true"
+}
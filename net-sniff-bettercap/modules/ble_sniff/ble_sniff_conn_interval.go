@@ -0,0 +1,82 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the little-endian values, fmt for errors and formatted strings.
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Declaring the size of the peripheral connection interval range AD structure and its "no preference" value.
+const (
+	connIntervalRangeSize = 4
+	connIntervalNoPref    = 0xffff
+)
+
+// connIntervalMs converts a connection interval in 1.25 ms units to milliseconds, nil meaning no preference.
+func connIntervalMs(value uint16) interface{} {
+	if value == connIntervalNoPref {
+		return nil
+	}
+	return float64(value) * 1.25
+}
+
+// connIntervalString formats a connection interval for the event message.
+func connIntervalString(value uint16) string {
+	if value == connIntervalNoPref {
+		return "any"
+	}
+	return fmt.Sprintf("%gms", float64(value)*1.25)
+}
+
+// decodeConnIntervalRange decodes the minimum and maximum connection intervals of the AD structure payload.
+func decodeConnIntervalRange(raw []byte) (uint16, uint16, error) {
+	if len(raw) != connIntervalRangeSize {
+		return 0, 0, fmt.Errorf("connection interval range must be %d bytes long, got %d", connIntervalRangeSize, len(raw))
+	}
+	return binary.LittleEndian.Uint16(raw[0:2]), binary.LittleEndian.Uint16(raw[2:4]), nil
+}
+
+// connIntervalRange extracts the connection interval range of an AD structure, either from the fields decoded
+// by TShark or from its raw payload.
+func connIntervalRange(entry map[string]interface{}) (uint16, uint16, error) {
+	min_string, has_min := entry["btcommon.eir_ad.entry.connection_interval_min"].(string)
+	max_string, has_max := entry["btcommon.eir_ad.entry.connection_interval_max"].(string)
+	raw, err := adPayload(entry, "connection interval range", has_min && has_max, func(size int) bool {
+		return size == connIntervalRangeSize
+	})
+	if err != nil {
+		return 0, 0, err
+	} else if !has_min || !has_max {
+		return decodeConnIntervalRange(raw)
+	}
+
+	min, err := parseUint(min_string, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := parseUint(max_string, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(min), uint16(max), nil
+}
+
+// onConnIntervalRange processes the peripheral connection interval range AD structure, reporting the
+// connection intervals the peripheral prefers in milliseconds.
+func onConnIntervalRange(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	min, max, err := connIntervalRange(entry)
+	if err != nil {
+		return nil
+	}
+
+	return adv.event(SniffData{
+		"interval_min": connIntervalMs(min),
+		"interval_max": connIntervalMs(max),
+	},
+		"Preferred connection interval %s - %s",
+		connIntervalString(min),
+		connIntervalString(max),
+	)
+}
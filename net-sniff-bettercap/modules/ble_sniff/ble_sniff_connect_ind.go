@@ -0,0 +1,182 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for little-endian decoding, fmt for formatted strings,
+// and time for time-related functions.
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Sizes of the CONNECT_IND LLData payload and of the channel map it carries,
+// and the number of data channels the channel map describes.
+const (
+	llDataSize      = 22
+	channelMapSize  = 5
+	numDataChannels = 37
+)
+
+// decodeChannelMap returns the indices of the data channels enabled in a channel map.
+// Only the low 37 bits are meaningful, the top 3 bits of the last byte are reserved and ignored.
+func decodeChannelMap(channelMap []byte) []int {
+	channels := make([]int, 0, numDataChannels)
+	for i := 0; i < numDataChannels && i/8 < len(channelMap); i++ {
+		if channelMap[i/8]&(1<<uint(i%8)) != 0 {
+			channels = append(channels, i)
+		}
+	}
+	return channels
+}
+
+// ConnectIndData struct holds the connection parameters carried by a CONNECT_IND.
+type ConnectIndData struct {
+	Initiator     string  `json:"initiator"`      // Address of the central initiating the connection.
+	Advertiser    string  `json:"advertiser"`     // Address of the advertiser being connected to.
+	AccessAddress string  `json:"access_address"` // Access address used on data channels.
+	CRCInit       uint32  `json:"crc_init"`       // CRC initialization value.
+	WindowSize    float64 `json:"window_size"`    // Transmit window size in milliseconds.
+	WindowOffset  float64 `json:"window_offset"`  // Transmit window offset in milliseconds.
+	Interval      float64 `json:"interval"`       // Connection interval in milliseconds.
+	Latency       uint16  `json:"latency"`        // Peripheral latency in connection events.
+	Timeout       float64 `json:"timeout"`        // Supervision timeout in milliseconds.
+	ChannelMap    []byte  `json:"channel_map"`    // Raw 5 bytes channel map.
+	Channels      []int   `json:"channels"`       // Data channels enabled by the channel map.
+	Hop           uint8   `json:"hop"`            // Hop increment.
+	SCA           uint8   `json:"sca"`            // Sleep clock accuracy.
+}
+
+// decodeLLData decodes the raw 22 bytes LLData of a CONNECT_IND, whose multi-byte fields are little-endian.
+func decodeLLData(raw []byte) (*ConnectIndData, error) {
+	if len(raw) != llDataSize {
+		return nil, fmt.Errorf("LLData is %d bytes, expected %d", len(raw), llDataSize)
+	}
+
+	params := &ConnectIndData{
+		AccessAddress: fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(raw[0:4])),
+		CRCInit:       uint32(raw[4]) | uint32(raw[5])<<8 | uint32(raw[6])<<16,
+		WindowSize:    float64(raw[7]) * 1.25,
+		WindowOffset:  float64(binary.LittleEndian.Uint16(raw[8:10])) * 1.25,
+		Interval:      float64(binary.LittleEndian.Uint16(raw[10:12])) * 1.25,
+		Latency:       binary.LittleEndian.Uint16(raw[12:14]),
+		Timeout:       float64(binary.LittleEndian.Uint16(raw[14:16])) * 10,
+		ChannelMap:    append([]byte{}, raw[16:21]...),
+		Hop:           raw[21] & 0x1f,
+		SCA:           raw[21] >> 5,
+	}
+
+	return params, nil
+}
+
+// decodeLLDataFields builds the connection parameters from the fields already decoded by TShark.
+func decodeLLDataFields(llData map[string]interface{}) (*ConnectIndData, error) {
+	// fields maps every TShark field to the size in bits it must fit in.
+	fields := map[string]int{
+		"btle.link_layer_data.access_address":       32,
+		"btle.link_layer_data.crc_init":             24,
+		"btle.link_layer_data.window_size":          8,
+		"btle.link_layer_data.window_offset":        16,
+		"btle.link_layer_data.interval":             16,
+		"btle.link_layer_data.latency":              16,
+		"btle.link_layer_data.timeout":              16,
+		"btle.link_layer_data.hop":                  5,
+		"btle.link_layer_data.sleep_clock_accuracy": 3,
+	}
+
+	values := make(map[string]uint64)
+	for name, bits := range fields {
+		value, ok := llData[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing %s", name)
+		}
+
+		parsed, err := parseUint(value, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		values[name] = parsed
+	}
+
+	// The channel map is reported as colon separated bytes.
+	channel_map_string, ok := llData["btle.link_layer_data.channel_map"].(string)
+	if !ok {
+		return nil, fmt.Errorf("missing btle.link_layer_data.channel_map")
+	}
+	channel_map, err := parseHexBytes(channel_map_string)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel map: %v", err)
+	} else if len(channel_map) != channelMapSize {
+		return nil, fmt.Errorf("channel map is %d bytes, expected %d", len(channel_map), channelMapSize)
+	}
+
+	params := &ConnectIndData{
+		AccessAddress: fmt.Sprintf("0x%08x", values["btle.link_layer_data.access_address"]),
+		CRCInit:       uint32(values["btle.link_layer_data.crc_init"]),
+		WindowSize:    float64(values["btle.link_layer_data.window_size"]) * 1.25,
+		WindowOffset:  float64(values["btle.link_layer_data.window_offset"]) * 1.25,
+		Interval:      float64(values["btle.link_layer_data.interval"]) * 1.25,
+		Latency:       uint16(values["btle.link_layer_data.latency"]),
+		Timeout:       float64(values["btle.link_layer_data.timeout"]) * 10,
+		ChannelMap:    channel_map,
+		Hop:           uint8(values["btle.link_layer_data.hop"]),
+		SCA:           uint8(values["btle.link_layer_data.sleep_clock_accuracy"]),
+	}
+
+	return params, nil
+}
+
+// parseConnectInd extracts the connection parameters of a CONNECT_IND from the BLE data.
+func parseConnectInd(btleData map[string]interface{}) (*ConnectIndData, error) {
+	var params *ConnectIndData
+	var err error
+
+	// TShark either dissects the LLData into its fields or, when it can't, reports the raw bytes.
+	switch ll_data := btleData["btle.link_layer_data"].(type) {
+	case map[string]interface{}:
+		params, err = decodeLLDataFields(ll_data)
+	case string:
+		var raw []byte
+		if raw, err = parseHexBytes(ll_data); err == nil {
+			params, err = decodeLLData(raw)
+		}
+	default:
+		err = fmt.Errorf("no LLData found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Expand the channel map into the list of enabled data channels.
+	params.Channels = decodeChannelMap(params.ChannelMap)
+
+	// Addresses of both parties, if TShark reported them.
+	params.Initiator, _ = btleData["btle.initiator_address"].(string)
+	params.Advertiser, _ = btleData["btle.advertising_address"].(string)
+
+	return params, nil
+}
+
+// onConnectInd is a function that processes CONNECT_IND PDUs, returning the parsed connection parameters
+// along with the event describing the new connection, stamped with the capture time t.
+func onConnectInd(btleData map[string]interface{}, t time.Time) (*ConnectIndData, []SnifferEvent) {
+	params, err := parseConnectInd(btleData)
+	if err != nil {
+		// Malformed CONNECT_IND packets are skipped.
+		return nil, nil
+	}
+
+	// Create a new SnifferEvent with protocol "BLE CONNECT" describing the new connection.
+	return params, []SnifferEvent{NewSnifferEvent(t,
+		"BLE CONNECT",
+		params.Initiator,
+		params.Advertiser,
+		params,
+		"New connection %s Interval=%gms Latency=%d Timeout=%gms",
+		params.AccessAddress,
+		params.Interval,
+		params.Latency,
+		params.Timeout,
+	).WithPDU(pduLabel(btleData))}
+}
@@ -0,0 +1,134 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, sort for ordering the connections table,
+// time for time-related functions, and tui for rendering tables to the console.
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// SnifferConnection struct describes a connection observed after a CONNECT_IND.
+type SnifferConnection struct {
+	AccessAddress     string    `json:"access_address"`      // Access address used by the connection on data channels.
+	Initiator         string    `json:"initiator"`           // Address of the central that initiated the connection.
+	Advertiser        string    `json:"advertiser"`          // Address of the peripheral that accepted the connection.
+	Interval          float64   `json:"interval"`            // Negotiated connection interval in milliseconds.
+	Started           time.Time `json:"started"`             // Time when the CONNECT_IND was seen.
+	LastSeen          time.Time `json:"last_seen"`           // Time when the last packet of the connection was seen.
+	NumFromCentral    uint64    `json:"num_from_central"`    // Count of packets sent by the central.
+	NumFromPeripheral uint64    `json:"num_from_peripheral"` // Count of packets sent by the peripheral.
+}
+
+// NewSnifferConnection creates a tracked connection from the parameters of its CONNECT_IND captured at t.
+func NewSnifferConnection(params *ConnectIndData, t time.Time) *SnifferConnection {
+	return &SnifferConnection{
+		AccessAddress: params.AccessAddress,
+		Initiator:     params.Initiator,
+		Advertiser:    params.Advertiser,
+		Interval:      params.Interval,
+		Started:       t,
+		LastSeen:      t,
+	}
+}
+
+// isFromCentral checks the nRF direction flag to tell whether a data packet was sent by the central.
+func isFromCentral(packetMap map[string]interface{}) bool {
+	nordic, ok := packetMap["nordic_ble"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	flags, ok := nordic["nordic_ble.flags_tree"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	return flags["nordic_ble.direction"] == "1"
+}
+
+// AddConnection starts tracking a new connection, replacing any previous one with the same access address.
+func (s *SnifferStats) AddConnection(conn *SnifferConnection) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Connections[conn.AccessAddress] = conn
+}
+
+// CountConnectionPacket updates the per-direction counters of a tracked connection.
+func (s *SnifferStats) CountConnectionPacket(accessAddress string, fromCentral bool, t time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Packets of connections whose CONNECT_IND was never seen are ignored.
+	conn, found := s.Connections[accessAddress]
+	if !found {
+		return
+	}
+
+	if fromCentral {
+		conn.NumFromCentral++
+	} else {
+		conn.NumFromPeripheral++
+	}
+	conn.LastSeen = t
+}
+
+// RemoveConnection stops tracking the connection with the given access address.
+func (s *SnifferStats) RemoveConnection(accessAddress string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.Connections, accessAddress)
+}
+
+// ConnectionsList returns a copy of the tracked connections sorted by start time.
+func (s *SnifferStats) ConnectionsList() []SnifferConnection {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]SnifferConnection, 0, len(s.Connections))
+	for _, conn := range s.Connections {
+		list = append(list, *conn)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Started.Before(list[j].Started)
+	})
+
+	return list
+}
+
+// ShowConnections prints the currently tracked connections as a table.
+func (mod *Sniffer) ShowConnections() error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	rows := make([][]string, 0)
+	for _, conn := range mod.Stats.ConnectionsList() {
+		rows = append(rows, []string{
+			conn.AccessAddress,
+			mod.Ctx.anonymizer.Address(conn.Initiator),
+			mod.Ctx.anonymizer.Address(conn.Advertiser),
+			fmt.Sprintf("%.2f ms", conn.Interval),
+			fmt.Sprintf("%d", conn.NumFromCentral),
+			fmt.Sprintf("%d", conn.NumFromPeripheral),
+			conn.LastSeen.Format("15:04:05"),
+		})
+	}
+
+	if len(rows) == 0 {
+		mod.Info("no active connections")
+		return nil
+	}
+
+	tui.Table(mod.Session.Events.Stdout, []string{"Access Address", "Initiator", "Advertiser", "Interval", "Central", "Peripheral", "Seen"}, rows)
+	mod.Session.Refresh()
+
+	return nil
+}
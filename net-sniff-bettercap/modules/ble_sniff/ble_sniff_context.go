@@ -2,38 +2,147 @@
 package ble_sniff
 
 // Importing necessary packages:
-// bufio for buffered I/O operations, context for managing the lifecycle of processes,
-// os for interacting with the operating system, os/exec for running external commands,
-// regexp for regular expression functionality,
+// bufio for buffered I/O operations, compress/gzip for the compressed output, fmt for errors,
+// os for interacting with the operating system, os/exec for the TShark command,
+// regexp for regular expression functionality, sync for guarding the output file, time for durations,
 // and specific bettercap and islazy packages for BLE sniffing and UI enhancements.
 import (
 	"bufio"
-	"context"
+	"compress/gzip"
+	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
+	"sync"
+	"time"
 
-	"github.com/bettercap/bettercap/log"
 	"github.com/bettercap/bettercap/session"
 
 	"github.com/evilsocket/islazy/tui"
 )
 
+// Declaring the range of depths the JSON input can be decoded at, packets are never nested deeper than a few levels.
+const (
+	minEmitDepth = 1
+	maxEmitDepth = 8
+)
+
+// minReadBuffer is the smallest buffer the input can be read with, below it the reads of a busy capture turn into
+// as many syscalls.
+const minReadBuffer = 4 << 10
+
 // SnifferContext struct defines the context for the sniffer including various configuration parameters and state.
 type SnifferContext struct {
-	Reader        *bufio.Reader  // Reader to read the output from TShark or file.
-	TSharkProc    *exec.Cmd      // Command representing the TShark process.
-	TSharkRunning bool           // Flag to check if TShark is running.
-	Interface     string         // Network interface to sniff on.
-	Source        string         // Source file for offline analysis.
-	PcapFile      string         // File path for pcap file.
-	DumpLocal     bool           // Flag to include or exclude local packets.
-	Verbose       bool           // Enable verbose logging.
-	Filter        string         // BPF (Berkeley Packet Filter) string.
-	Expression    string         // Regular expression for packet filtering.
-	Compiled      *regexp.Regexp // Compiled regular expression.
-	Output        string         // Output file or destination.
-	OutputFile    *os.File       // File object for output.
+	Reader             *bufio.Reader  // Reader to read the output from TShark or file.
+	TSharkProc         *exec.Cmd      // Command representing the TShark process.
+	tsharkRunning      int32          // Set to 1 while TShark is running, read atomically by the rate monitor.
+	TShark             string         // Location of the TShark command.
+	TSharkArgs         []string       // Arguments TShark is started with.
+	TSharkExit         chan error     // Receives the result of TShark once it exited.
+	AutoRestart        bool           // Restart TShark if it terminates unexpectedly.
+	AutoRestartMax     int            // Maximum number of TShark restarts.
+	tsharkRestarts     int            // Count of TShark restarts so far.
+	tsharkOut          *os.File       // Read end of the TShark output pipe.
+	Remote             string         // SSH destination TShark is run on instead of locally, if set.
+	RemoteKey          string         // Private key file used to log in to the remote host, the ssh agent is used if empty.
+	remote             *remoteTarget  // Parsed SSH destination, nil for local captures.
+	remoteIn           *os.File       // Input of the ssh command, closed to stop TShark on the remote host.
+	DryRun             bool           // Only validate the configuration without capturing.
+	Interface          string         // Network interface to sniff on.
+	InterfaceStrict    bool           // Only capture from the configured interface, without looking for another nRF Sniffer.
+	Source             string         // Source file for offline analysis.
+	PcapFile           string         // File path for pcap file.
+	DumpLocal          bool           // Flag to include or exclude local packets.
+	Verbose            bool           // Enable verbose logging.
+	Color              bool           // Prefix the message of the events with their colored protocol.
+	Hexdump            bool           // Attach the hexdump of the BLE layer of the packets to their events.
+	HexdumpMax         int            // Maximum number of bytes of the hexdumps, 0 for no limit.
+	Compat             bool           // Push events in the same schema used by net.sniff.
+	Tag                string         // Tag events are pushed to the session with, unless in compat mode.
+	DisplayRate        int            // Maximum number of events pushed to the session per second, 0 for no limit.
+	displayLimiter     *tokenBucket   // Limits the events pushed to the session, nil without limit.
+	SessionID          string         // Identifier of the capture session attached to every event.
+	Anonymize          bool           // Replace the device addresses of the events with keyed hashes.
+	AnonymizeKey       string         // Key of the address hashes, a random one is generated for every session if empty.
+	anonymizer         *anonymizer    // Replaces the device addresses, nil unless anonymizing.
+	GPS                string         // NMEA serial device or gpsd host:port the location of the events is read from.
+	GPSBaudRate        int            // Baud rate of the NMEA serial device.
+	gps                *gpsTracker    // Tracker of the last GPS fix, nil without a GPS.
+	ConnectableOnly    bool           // Only emit events for connectable advertisements.
+	ChangesOnly        bool           // Only emit events for the advertisements whose payload changed.
+	Merge              bool           // Report the AD structures of an advertisement in a single event instead of an event each.
+	DirectedTarget     bool           // Use the target address of the directed advertisements as destination of their events.
+	ADTypes            map[uint8]bool // Types of the AD structures parsed, nil to parse them all.
+	DropBadCRC         bool           // Don't decode the packets whose CRC check failed.
+	AdvChannelsOnly    bool           // Drop the packets not captured on the primary advertising channels 37, 38 and 39.
+	PDU                string         // Comma separated list of the advertising PDU types to emit events for.
+	PDUTypes           map[uint8]bool // Advertising PDU types to emit events for, nil for all of them.
+	Service            string         // Comma separated list of the services whose data advertisements must carry.
+	Services           uuidSet        // Normalized UUIDs of the services whose data advertisements must carry, nil for any.
+	MinLen             int            // Minimum length in bytes of the advertising data.
+	MaxLen             int            // Maximum length in bytes of the advertising data, 0 for no limit.
+	Name               string         // Substring the local name of the devices must contain.
+	NameStrict         bool           // Exclude the devices whose name is unknown from the name filter.
+	LogJSON            bool           // Log JSON lines instead of the colored session log.
+	ProximityImmediate int            // RSSI threshold in dBm for the immediate proximity zone.
+	ProximityNear      int            // RSSI threshold in dBm for the near proximity zone.
+	RSSIAlpha          float64        // Smoothing factor of the RSSI moving average.
+	RSSIReset          time.Duration  // Time after which the RSSI average of a device not seen is reset.
+	EmitDepth          int            // Depth of the JSON input at which the packet layers are decoded.
+	JSONStrict         bool           // Flag to report an unterminated JSON input as a truncated capture.
+	ReadBuffer         int            // Size in bytes of the buffer the output of TShark or the source file is read with.
+	QueueSize          int            // Number of decoded packets waiting to be processed before the oldest are dropped.
+	Workers            int            // Number of goroutines decoding the packets.
+	ShutdownTimeout    time.Duration  // Time given on stop to process the queued packets and flush the outputs.
+	ReportTop          int            // Number of entries of each ranking of the final report.
+	History            int            // Number of recent events retained in memory, 0 to disable the history.
+	history            *eventHistory  // Recent events, nil if the history is disabled.
+	SensorsLog         int            // Number of manufacturer data readings kept per device, 0 to disable the sensor log.
+	sensors            *sensorLog     // Manufacturer data readings, nil if the sensor log is disabled.
+	AlertCompanies     map[uint16]int // Maximum number of advertisements per alert window keyed by company, nil to disable the alerts.
+	AlertWindow        time.Duration  // Sliding window the advertisements of the companies are counted over.
+	AlertCooldown      time.Duration  // Minimum time between two alerts about the same company.
+	alerts             *companyAlerts // Detector of the bursts of the companies, nil if the alerts are disabled.
+	Heartbeat          time.Duration  // Time without packets after which a heartbeat event is pushed, 0 to disable it.
+	SummaryInterval    time.Duration  // Interval between the summary events, 0 to disable them.
+	StarvationTimeout  time.Duration  // Time without events after which a warning is logged while TShark runs, 0 to disable it.
+	Filter             string         // TShark display filter string.
+	Expression         string         // Regular expression for packet filtering.
+	Compiled           *regexp.Regexp // Compiled regular expression.
+	Output             string         // Output file or destination.
+	OutputFile         *os.File       // File object for output.
+	OutputPipe         *pipeWriter    // Named pipe used for output instead of a file, only on Windows.
+	OutputPretty       bool           // Flag to indent the events written to the output file.
+	OutputGzip         bool           // Flag to compress the output file with gzip.
+	outputGzip         *gzip.Writer   // Compressor of the output file, nil unless it is compressed.
+	SplitByDevice      bool           // Write the events of every device to its own file in the output directory.
+	SplitMaxOpen       int            // Maximum number of per-device files open at the same time.
+	deviceFiles        *deviceFiles   // Per-device output files, nil unless split by device.
+	RotateSize         int64          // Size in bytes after which the output file is rotated, 0 to disable it.
+	RotateInterval     time.Duration  // Time after which the output file is rotated, 0 to disable it.
+	RotateKeep         int            // Number of rotated output files to keep, 0 to keep them all.
+	S3                 string         // Bucket and prefix the rotated output files are uploaded to, as s3://bucket/prefix.
+	S3DeleteLocal      bool           // Delete the rotated output files once uploaded.
+	s3                 *s3Uploader    // Uploader of the rotated output files, nil if not set.
+	OutputFlush        time.Duration  // Interval the buffered events are written to the output file at, 0 to write them at once.
+	OutputBuffer       int64          // Size in bytes of the output file buffer.
+	outputWriter       *bufio.Writer  // Buffer of the output file, nil unless the writes are buffered.
+	outputQuit         chan struct{}  // Closed to stop flushing the output buffer.
+	outputDone         chan struct{}  // Closed once the output buffer isn't flushed anymore.
+	outputSize         int64          // Bytes written to the current output file.
+	outputOpened       time.Time      // Time when the current output file was created.
+	outputLost         error          // Error of the rotation which lost the output file, returned by every write.
+	InventoryLoad      string         // JSON inventory the device table is pre-populated with.
+	OUIDB              string         // OUI database looked up before the bundled manufacturers table.
+	OUITable           ouiTable       // Manufacturers read from the OUI database keyed by OUI, nil if not set.
+	SQLite             string         // SQLite database file the events are stored into.
+	SQLiteSink         *SQLiteSink    // Sink writing the events to the SQLite database.
+	Influx             string         // URL of the InfluxDB server the events are written to.
+	InfluxOrg          string         // Organization of the InfluxDB bucket.
+	InfluxBucket       string         // InfluxDB bucket the events are written to.
+	InfluxToken        string         // API token of the InfluxDB server, read from INFLUX_TOKEN if empty.
+	influx             *influxWriter  // Writer of the events to InfluxDB, nil if not set.
+	outputLock         sync.Mutex     // Lock serializing the writes to the output file.
 }
 
 // GetContext is a function associated with the Sniffer module to initialize and get the SnifferContext.
@@ -48,18 +157,279 @@ func (mod *Sniffer) GetContext() (error, *SnifferContext) {
 		return err, ctx
 	}
 
-	// Check if Source is not specified, then set up TShark for live sniffing.
-	if ctx.Source == "" {
+	// Retrieving dry-run parameter and handling errors.
+	if err, ctx.DryRun = mod.BoolParam("ble.sniff.dry_run"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving verbose parameter and handling errors.
+	if err, ctx.Verbose = mod.BoolParam("ble.sniff.verbose"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the colored messages parameter and handling errors.
+	if err, ctx.Color = mod.BoolParam("ble.sniff.color"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the display rate and handling errors.
+	if err, ctx.DisplayRate = mod.IntParam("ble.sniff.display.rate"); err != nil {
+		return err, ctx
+	} else if ctx.DisplayRate < 0 {
+		return fmt.Errorf("ble.sniff.display.rate can't be negative"), ctx
+	} else if ctx.DisplayRate > 0 {
+		ctx.displayLimiter = newTokenBucket(ctx.DisplayRate, time.Now())
+	}
+
+	// Retrieving the hexdump parameters and handling errors.
+	if err, ctx.Hexdump = mod.BoolParam("ble.sniff.hexdump"); err != nil {
+		return err, ctx
+	} else if err, ctx.HexdumpMax = mod.IntParam("ble.sniff.hexdump.max"); err != nil {
+		return err, ctx
+	} else if ctx.HexdumpMax < 0 {
+		return fmt.Errorf("ble.sniff.hexdump.max can't be negative"), ctx
+	}
+
+	// Retrieving compatibility parameter and handling errors.
+	if err, ctx.Compat = mod.BoolParam("ble.sniff.compat"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the events tag parameter and handling errors.
+	if err, ctx.Tag = mod.StringParam("ble.sniff.tag"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the session identifier, generating a new one for every capture if not set.
+	if err, ctx.SessionID = mod.StringParam("ble.sniff.session_id"); err != nil {
+		return err, ctx
+	} else if ctx.SessionID == "" {
+		ctx.SessionID = newSessionID()
+	}
+
+	// Retrieving the anonymization parameters, generating a key for the session if none is set.
+	if err, ctx.Anonymize = mod.BoolParam("ble.sniff.anonymize"); err != nil {
+		return err, ctx
+	} else if err, ctx.AnonymizeKey = mod.StringParam("ble.sniff.anonymize.key"); err != nil {
+		return err, ctx
+	} else if ctx.Anonymize {
+		if ctx.anonymizer, err = newAnonymizer(ctx.AnonymizeKey); err != nil {
+			return err, ctx
+		}
+	}
+
+	// Retrieving connectable filter parameter and handling errors.
+	if err, ctx.ConnectableOnly = mod.BoolParam("ble.sniff.connectable_only"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the changed payloads filter and handling errors.
+	if err, ctx.ChangesOnly = mod.BoolParam("ble.sniff.changes_only"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the merging of the AD structures and handling errors.
+	if err, ctx.Merge = mod.BoolParam("ble.sniff.merge"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the destination of the directed advertisements and handling errors.
+	if err, ctx.DirectedTarget = mod.BoolParam("ble.sniff.directed.target"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the AD types to parse and handling errors.
+	if err, ad_types := mod.StringParam("ble.sniff.ad_types"); err != nil {
+		return err, ctx
+	} else if ctx.ADTypes, err = parseADTypes(ad_types); err != nil {
+		return fmt.Errorf("ble.sniff.ad_types: %v", err), ctx
+	}
+
+	// Retrieving the advertising PDU types filter and handling errors.
+	if err, ctx.PDU = mod.StringParam("ble.sniff.pdu"); err != nil {
+		return err, ctx
+	} else if ctx.PDUTypes, err = parsePDUTypes(ctx.PDU); err != nil {
+		return fmt.Errorf("ble.sniff.pdu: %v", err), ctx
+	}
+
+	// Retrieving the bad CRC handling and handling errors.
+	if err, ctx.DropBadCRC = mod.BoolParam("ble.sniff.drop_bad_crc"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the advertising channels filter and handling errors.
+	if err, ctx.AdvChannelsOnly = mod.BoolParam("ble.sniff.adv_channels_only"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the service data filter and handling errors.
+	if err, ctx.Service = mod.StringParam("ble.sniff.service"); err != nil {
+		return err, ctx
+	} else if ctx.Services, err = parseServiceUUIDs(ctx.Service); err != nil {
+		return fmt.Errorf("ble.sniff.service: %v", err), ctx
+	}
+
+	// Retrieving the advertising data length filter and handling errors.
+	if err, ctx.MinLen = mod.IntParam("ble.sniff.min_len"); err != nil {
+		return err, ctx
+	} else if err, ctx.MaxLen = mod.IntParam("ble.sniff.max_len"); err != nil {
+		return err, ctx
+	} else if ctx.MinLen < 0 || ctx.MaxLen < 0 {
+		return fmt.Errorf("ble.sniff.min_len and ble.sniff.max_len can't be negative"), ctx
+	} else if ctx.MaxLen > 0 && ctx.MinLen > ctx.MaxLen {
+		return fmt.Errorf("ble.sniff.min_len %d is greater than ble.sniff.max_len %d", ctx.MinLen, ctx.MaxLen), ctx
+	}
+
+	// Retrieving name filter parameters and handling errors.
+	if err, ctx.Name = mod.StringParam("ble.sniff.name"); err != nil {
+		return err, ctx
+	} else if err, ctx.NameStrict = mod.BoolParam("ble.sniff.name.strict"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving JSON logging parameter and handling errors.
+	if err, ctx.LogJSON = mod.BoolParam("ble.sniff.log.json"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving proximity thresholds and handling errors.
+	if err, ctx.ProximityImmediate = mod.IntParam("ble.sniff.proximity.immediate"); err != nil {
+		return err, ctx
+	} else if err, ctx.ProximityNear = mod.IntParam("ble.sniff.proximity.near"); err != nil {
+		return err, ctx
+	} else if ctx.ProximityNear >= ctx.ProximityImmediate {
+		return fmt.Errorf("ble.sniff.proximity.near (%d) must be lower than ble.sniff.proximity.immediate (%d)", ctx.ProximityNear, ctx.ProximityImmediate), ctx
+	}
+
+	// Retrieving RSSI smoothing parameters and handling errors.
+	if err, ctx.RSSIAlpha = mod.DecParam("ble.sniff.rssi.alpha"); err != nil {
+		return err, ctx
+	} else if ctx.RSSIAlpha <= 0 || ctx.RSSIAlpha > 1 {
+		return fmt.Errorf("ble.sniff.rssi.alpha must be in the (0.0, 1.0] interval, got %f", ctx.RSSIAlpha), ctx
+	} else if err, ctx.RSSIReset = mod.durationParam("ble.sniff.rssi.reset"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the JSON decoding depth and handling errors.
+	if err, ctx.EmitDepth = mod.IntParam("ble.sniff.json.emit_depth"); err != nil {
+		return err, ctx
+	} else if ctx.EmitDepth < minEmitDepth || ctx.EmitDepth > maxEmitDepth {
+		return fmt.Errorf("ble.sniff.json.emit_depth must be between %d and %d, got %d", minEmitDepth, maxEmitDepth, ctx.EmitDepth), ctx
+	}
+
+	// Retrieving the strict JSON flag and handling errors.
+	if err, ctx.JSONStrict = mod.BoolParam("ble.sniff.json.strict"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the input buffer size and handling errors.
+	var read_buffer string
+	var read_buffer_size int64
+	if err, read_buffer = mod.StringParam("ble.sniff.read_buffer"); err != nil {
+		return err, ctx
+	} else if read_buffer_size, err = parseSize(read_buffer); err != nil {
+		return err, ctx
+	} else if read_buffer_size < minReadBuffer {
+		return fmt.Errorf("ble.sniff.read_buffer must be at least %d bytes, got %d", minReadBuffer, read_buffer_size), ctx
+	}
+	ctx.ReadBuffer = int(read_buffer_size)
+
+	// Retrieving the packet queue size and handling errors.
+	if err, ctx.QueueSize = mod.IntParam("ble.sniff.queue.size"); err != nil {
+		return err, ctx
+	} else if ctx.QueueSize < 1 {
+		return fmt.Errorf("ble.sniff.queue.size must be at least 1, got %d", ctx.QueueSize), ctx
+	}
+
+	// Retrieving the number of workers and handling errors.
+	if err, ctx.Workers = mod.IntParam("ble.sniff.workers"); err != nil {
+		return err, ctx
+	} else if ctx.Workers < 1 {
+		return fmt.Errorf("ble.sniff.workers must be at least 1, got %d", ctx.Workers), ctx
+	}
+
+	// Retrieving the shutdown timeout and handling errors.
+	if err, ctx.ShutdownTimeout = mod.durationParam("ble.sniff.shutdown.timeout"); err != nil {
+		return err, ctx
+	} else if ctx.ShutdownTimeout >= stopTimeout {
+		return fmt.Errorf("ble.sniff.shutdown.timeout must be less than %s, the time a module is given to stop", stopTimeout), ctx
+	}
+
+	// Retrieving the report size and handling errors.
+	if err, ctx.ReportTop = mod.IntParam("ble.sniff.report.top"); err != nil {
+		return err, ctx
+	} else if ctx.ReportTop < 0 {
+		return fmt.Errorf("ble.sniff.report.top can't be negative"), ctx
+	}
+
+	// Retrieving the history size and handling errors.
+	if err, ctx.History = mod.IntParam("ble.sniff.history"); err != nil {
+		return err, ctx
+	} else if ctx.History < 0 {
+		return fmt.Errorf("ble.sniff.history can't be negative"), ctx
+	} else if ctx.History > 0 {
+		ctx.history = newEventHistory(ctx.History)
+	}
+
+	// Retrieving the sensor log size and handling errors.
+	if err, ctx.SensorsLog = mod.IntParam("ble.sniff.sensors.log"); err != nil {
+		return err, ctx
+	} else if ctx.SensorsLog < 0 {
+		return fmt.Errorf("ble.sniff.sensors.log can't be negative"), ctx
+	} else if ctx.SensorsLog > 0 {
+		ctx.sensors = newSensorLog(ctx.SensorsLog)
+	}
+
+	// Retrieving the company alerts parameters and handling errors.
+	var alert_companies string
+	if err, alert_companies = mod.StringParam("ble.sniff.alert.company"); err != nil {
+		return err, ctx
+	} else if ctx.AlertCompanies, err = parseCompanyAlerts(alert_companies); err != nil {
+		return fmt.Errorf("ble.sniff.alert.company: %v", err), ctx
+	} else if err, ctx.AlertWindow = mod.durationParam("ble.sniff.alert.window"); err != nil {
+		return err, ctx
+	} else if ctx.AlertWindow <= 0 {
+		return fmt.Errorf("ble.sniff.alert.window must be greater than 0"), ctx
+	} else if err, ctx.AlertCooldown = mod.durationParam("ble.sniff.alert.cooldown"); err != nil {
+		return err, ctx
+	}
+	if ctx.AlertCompanies != nil {
+		ctx.alerts = newCompanyAlerts(ctx.AlertCompanies, ctx.AlertWindow, ctx.AlertCooldown)
+	}
+
+	// Retrieving the heartbeat interval and handling errors.
+	if err, ctx.Heartbeat = mod.durationParam("ble.sniff.heartbeat"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the summary interval and handling errors.
+	if err, ctx.SummaryInterval = mod.durationParam("ble.sniff.summary.interval"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the starvation timeout and handling errors.
+	if err, ctx.StarvationTimeout = mod.durationParam("ble.sniff.starvation.timeout"); err != nil {
+		return err, ctx
+	}
+
+	// Check if an input was injected, otherwise if Source is not specified, then set up TShark for live sniffing.
+	if mod.source != nil {
+		if ctx.DryRun {
+			return ctx.validateOutputs(mod)
+		}
+		ctx.Reader = bufio.NewReaderSize(mod.source, ctx.ReadBuffer)
+	} else if ctx.Source == "" {
 
 		// Retrieving TShark path and handling errors.
-		err, tshark := mod.StringParam("ble.sniff.tshark")
-		if err != nil {
+		if err, ctx.TShark = mod.StringParam("ble.sniff.tshark"); err != nil {
 			return err, ctx
 		}
 
-		// Retrieving network interface parameter and handling errors.
+		// Retrieving network interface parameters and handling errors.
 		if err, ctx.Interface = mod.StringParam("ble.sniff.interface"); err != nil {
 			return err, ctx
+		} else if err, ctx.InterfaceStrict = mod.BoolParam("ble.sniff.interface.strict"); err != nil {
+			return err, ctx
 		}
 
 		// Retrieving pcap file parameter and handling errors.
@@ -67,30 +437,86 @@ func (mod *Sniffer) GetContext() (error, *SnifferContext) {
 			return err, ctx
 		}
 
+		// Retrieving the remote host parameters and handling errors.
+		if err, ctx.Remote = mod.StringParam("ble.sniff.remote"); err != nil {
+			return err, ctx
+		} else if err, ctx.RemoteKey = mod.StringParam("ble.sniff.remote.key"); err != nil {
+			return err, ctx
+		} else if ctx.Remote != "" {
+			// TShark and the interface or the pcap file are looked up on the remote host.
+			if ctx.remote, err = parseRemote(ctx.Remote); err != nil {
+				return fmt.Errorf("ble.sniff.remote: %v", err), ctx
+			}
+		}
+
+		// Retrieving TShark restart parameters and handling errors.
+		if err, ctx.AutoRestart = mod.BoolParam("ble.sniff.autorestart"); err != nil {
+			return err, ctx
+		} else if err, ctx.AutoRestartMax = mod.IntParam("ble.sniff.autorestart.max"); err != nil {
+			return err, ctx
+		} else if ctx.AutoRestartMax < 0 {
+			return fmt.Errorf("ble.sniff.autorestart.max can't be negative"), ctx
+		}
+
+		// Retrieving display filter parameter and handling errors.
+		if err, ctx.Filter = mod.StringParam("ble.sniff.filter"); err != nil {
+			return err, ctx
+		}
+
+		// The name of the nRF Sniffer interface varies by version, look for it if the configured one isn't listed.
+		if ctx.PcapFile == "" && ctx.remote == nil {
+			iface, err := ctx.resolveInterface()
+			if err != nil {
+				return err, ctx
+			} else if iface != ctx.Interface {
+				mod.Info("interface '%s' not found, using '%s'", ctx.Interface, iface)
+				ctx.Interface = iface
+			}
+		}
+
 		// Setting up TShark command based on whether pcap file is provided or not.
+		var args []string
+		// Repeated AD structures are only kept if duplicated keys are merged into arrays.
 		if ctx.PcapFile == "" {
-			ctx.TSharkProc = exec.CommandContext(context.Background(), tshark, "-i", ctx.Interface, "-T", "json")
+			args = []string{"-i", ctx.Interface, "-T", "json", "--no-duplicate-keys"}
 		} else {
-			ctx.TSharkProc = exec.CommandContext(context.Background(), tshark, "-T", "json", "-r", ctx.PcapFile)
+			args = []string{"-T", "json", "--no-duplicate-keys", "-r", ctx.PcapFile}
+		}
+		if ctx.Filter != "" {
+			args = append(args, "-Y", ctx.Filter)
+		}
+		// The raw bytes of the layers are only output on request, they make the JSON much larger.
+		if ctx.Hexdump {
+			args = append(args, "-x")
 		}
 
-		// Creating a pipe to read stdout of TShark process and handling errors.
-		tsharkout, err := ctx.TSharkProc.StdoutPipe()
-		if err != nil {
-			return err, ctx
+		// In dry-run mode only check TShark and its inputs are usable.
+		if ctx.DryRun {
+			if ctx.remote != nil {
+				// The remote host isn't logged in to, only the ssh client is checked.
+				if _, err = exec.LookPath(sshCommand); err != nil {
+					return fmt.Errorf("could not find %s: %v", sshCommand, err), ctx
+				}
+			} else if err = ctx.validateTShark(args); err != nil {
+				return err, ctx
+			}
+			return ctx.validateOutputs(mod)
 		}
 
 		// Starting the TShark process and handling errors.
-		err = ctx.TSharkProc.Start()
-		if err != nil {
+		ctx.TSharkArgs = args
+		if err = ctx.startTShark(); err != nil {
 			return err, ctx
-		} else {
-			ctx.TSharkRunning = true
 		}
 
-		// Setting up a buffered reader to read from TShark's stdout.
-		ctx.Reader = bufio.NewReader(tsharkout)
-
+	} else if ctx.DryRun {
+		// In dry-run mode only check the source file can be read.
+		if file_reader, err := os.Open(ctx.Source); err != nil {
+			return err, ctx
+		} else {
+			file_reader.Close()
+		}
+		return ctx.validateOutputs(mod)
 	} else {
 		// If Source is specified, open the file for reading and set up the buffered reader.
 		file_reader, err := os.Open(ctx.Source)
@@ -98,17 +524,147 @@ func (mod *Sniffer) GetContext() (error, *SnifferContext) {
 			return err, ctx
 		}
 
-		ctx.Reader = bufio.NewReader(file_reader)
+		ctx.Reader = bufio.NewReaderSize(file_reader, ctx.ReadBuffer)
+	}
+
+	// Retrieving the per-device output parameters and handling errors.
+	if err, ctx.SplitByDevice = mod.BoolParam("ble.sniff.output.split_by_device"); err != nil {
+		return err, ctx
+	} else if err, ctx.SplitMaxOpen = mod.IntParam("ble.sniff.output.split_by_device.max_open"); err != nil {
+		return err, ctx
+	} else if ctx.SplitMaxOpen < 1 {
+		return fmt.Errorf("ble.sniff.output.split_by_device.max_open must be at least 1"), ctx
 	}
 
-	// Retrieving output file parameter and handling errors.
-	if err, ctx.Output = mod.StringParam("ble.sniff.output"); err != nil {
+	// Retrieving output file parameters and handling errors.
+	if err, ctx.OutputGzip = mod.BoolParam("ble.sniff.output.gzip"); err != nil {
+		return err, ctx
+	} else if err, ctx.Output = mod.StringParam("ble.sniff.output"); err != nil {
 		return err, ctx
+	} else if ctx.SplitByDevice && ctx.Output != "" {
+		// The output is a directory with a file for every device.
+		if isNamedPipe(ctx.Output) {
+			return fmt.Errorf("ble.sniff.output can't be a named pipe when split by device"), ctx
+		} else if ctx.OutputGzip {
+			return fmt.Errorf("ble.sniff.output.gzip can't be set when split by device"), ctx
+		} else if ctx.deviceFiles, err = newDeviceFiles(ctx.Output, ctx.SplitMaxOpen); err != nil {
+			return err, ctx
+		}
+	} else if isNamedPipe(ctx.Output) {
+		// If output is a named pipe, create it and wait for a reader in background.
+		if ctx.OutputGzip {
+			return fmt.Errorf("ble.sniff.output.gzip can't be set for a named pipe"), ctx
+		} else if ctx.OutputPipe, err = newPipeWriter(ctx.Output); err != nil {
+			return err, ctx
+		}
 	} else if ctx.Output != "" {
-		// If output file is specified, create the file and handle errors.
+		// If output file is specified, create the file, compressed if requested, and handle errors.
+		if ctx.OutputGzip {
+			ctx.Output = gzipOutputName(ctx.Output)
+		}
 		if ctx.OutputFile, err = os.Create(ctx.Output); err != nil {
 			return err, ctx
 		}
+		if ctx.OutputGzip {
+			ctx.outputGzip = gzip.NewWriter(ctx.OutputFile)
+		}
+		ctx.outputOpened = time.Now()
+	}
+
+	// Retrieving output rotation parameters and handling errors.
+	var rotate_size string
+	if err, rotate_size = mod.StringParam("ble.sniff.output.rotate.size"); err != nil {
+		return err, ctx
+	} else if ctx.RotateSize, err = parseSize(rotate_size); err != nil {
+		return err, ctx
+	} else if err, ctx.RotateInterval = mod.durationParam("ble.sniff.output.rotate.interval"); err != nil {
+		return err, ctx
+	} else if err, ctx.RotateKeep = mod.IntParam("ble.sniff.output.rotate.keep"); err != nil {
+		return err, ctx
+	} else if ctx.RotateKeep < 0 {
+		return fmt.Errorf("ble.sniff.output.rotate.keep can't be negative"), ctx
+	}
+
+	// Retrieving the output buffering parameters, buffering the output file and handling errors.
+	var output_buffer string
+	if err, ctx.OutputFlush = mod.durationParam("ble.sniff.output.flush"); err != nil {
+		return err, ctx
+	} else if err, output_buffer = mod.StringParam("ble.sniff.output.buffer"); err != nil {
+		return err, ctx
+	} else if ctx.OutputBuffer, err = parseSize(output_buffer); err != nil {
+		return err, ctx
+	} else if ctx.OutputBuffer <= 0 {
+		return fmt.Errorf("ble.sniff.output.buffer must be greater than 0"), ctx
+	}
+	if ctx.OutputFile != nil && ctx.OutputFlush > 0 {
+		ctx.bufferOutput(int(ctx.OutputBuffer))
+	}
+
+	// Retrieving the object storage parameters, starting the uploads of the rotated files and handling errors.
+	if err, ctx.S3 = mod.StringParam("ble.sniff.output.s3"); err != nil {
+		return err, ctx
+	} else if err, ctx.S3DeleteLocal = mod.BoolParam("ble.sniff.output.s3.delete_local"); err != nil {
+		return err, ctx
+	} else if ctx.S3 != "" {
+		if err = ctx.checkS3(); err != nil {
+			return err, ctx
+		} else if ctx.s3, err = newS3Uploader(ctx.S3, ctx.S3DeleteLocal); err != nil {
+			return fmt.Errorf("ble.sniff.output.s3: %v", err), ctx
+		}
+	}
+
+	// Retrieving output formatting parameter and handling errors.
+	if err, ctx.OutputPretty = mod.BoolParam("ble.sniff.output.pretty"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the inventory to load and handling errors.
+	if err, ctx.InventoryLoad = mod.StringParam("ble.sniff.inventory.load"); err != nil {
+		return err, ctx
+	}
+
+	// Retrieving the OUI database, loading it and handling errors.
+	if err, ctx.OUIDB = mod.StringParam("ble.sniff.oui.db"); err != nil {
+		return err, ctx
+	} else if ctx.OUIDB != "" {
+		if ctx.OUITable, err = loadOUIDatabase(ctx.OUIDB); err != nil {
+			return fmt.Errorf("ble.sniff.oui.db: %v", err), ctx
+		}
+	}
+
+	// Retrieving SQLite database parameter and handling errors.
+	if err, ctx.SQLite = mod.StringParam("ble.sniff.sqlite"); err != nil {
+		return err, ctx
+	} else if ctx.SQLite != "" {
+		// If a database is specified, open the sink.
+		if ctx.SQLiteSink, err = NewSQLiteSink(ctx.SQLite); err != nil {
+			return err, ctx
+		}
+	}
+
+	// Retrieving the InfluxDB parameters, starting the writes and handling errors.
+	if err, ctx.Influx = mod.StringParam("ble.sniff.influx"); err != nil {
+		return err, ctx
+	} else if err, ctx.InfluxOrg = mod.StringParam("ble.sniff.influx.org"); err != nil {
+		return err, ctx
+	} else if err, ctx.InfluxBucket = mod.StringParam("ble.sniff.influx.bucket"); err != nil {
+		return err, ctx
+	} else if err, ctx.InfluxToken = mod.StringParam("ble.sniff.influx.token"); err != nil {
+		return err, ctx
+	} else if ctx.Influx != "" {
+		if ctx.influx, err = newInfluxWriter(ctx.Influx, ctx.InfluxOrg, ctx.InfluxBucket, ctx.InfluxToken); err != nil {
+			return fmt.Errorf("ble.sniff.influx: %v", err), ctx
+		}
+	}
+
+	// Retrieving the GPS parameters and tracking the location in background, the events being pushed without
+	// location while the GPS is unavailable.
+	if err, ctx.GPS = mod.StringParam("ble.sniff.gps"); err != nil {
+		return err, ctx
+	} else if err, ctx.GPSBaudRate = mod.IntParam("ble.sniff.gps.baudrate"); err != nil {
+		return err, ctx
+	} else if ctx.GPS != "" {
+		ctx.gps = newGPSTracker(ctx.GPS, ctx.GPSBaudRate)
 	}
 
 	// Returning the context.
@@ -118,19 +674,104 @@ func (mod *Sniffer) GetContext() (error, *SnifferContext) {
 // NewSnifferContext initializes and returns a new instance of SnifferContext with default values.
 func NewSnifferContext() *SnifferContext {
 	return &SnifferContext{
-		Reader:        nil,         // Initializes Reader as nil; will be set later when TShark starts or a file is opened.
-		TSharkProc:    nil,         // TShark process is initially nil, will be set up when required.
-		TSharkRunning: false,       // Initial state of TShark is not running.
-		Interface:     "",          // Network interface is initially empty, to be configured later.
-		Source:        "",          // Source file for offline sniffing is initially empty.
-		PcapFile:      "",          // Path for pcap file is initially empty.
-		DumpLocal:     false,       // Flag for dumping local packets is initially set to false.
-		Verbose:       false,       // Verbose logging is turned off initially.
-		Filter:        "",          // BPF filter string is initially empty.
-		Expression:    "",          // Regular expression for filtering is initially empty.
-		Compiled:      nil,         // Compiled regular expression object is initially nil.
-		Output:        "",          // Output destination is initially empty.
-		OutputFile:    nil,         // Output file object is initially nil.
+		Reader:             nil,              // Initializes Reader as nil; will be set later when TShark starts or a file is opened.
+		TSharkProc:         nil,              // TShark process is initially nil, will be set up when required.
+		tsharkRunning:      0,                // Initial state of TShark is not running.
+		TShark:             "tshark",         // TShark is looked up in the PATH by default.
+		Remote:             "",               // TShark runs locally by default.
+		RemoteKey:          "",               // The ssh agent and configuration are used by default.
+		TSharkArgs:         nil,              // TShark arguments are set up when required.
+		TSharkExit:         nil,              // Created when TShark is started.
+		AutoRestart:        false,            // TShark is not restarted by default.
+		AutoRestartMax:     3,                // TShark is restarted up to 3 times when enabled.
+		DryRun:             false,            // The capture is started by default.
+		Interface:          "",               // Network interface is initially empty, to be configured later.
+		InterfaceStrict:    false,            // Another nRF Sniffer interface is looked for by default.
+		Source:             "",               // Source file for offline sniffing is initially empty.
+		PcapFile:           "",               // Path for pcap file is initially empty.
+		DumpLocal:          false,            // Flag for dumping local packets is initially set to false.
+		Verbose:            false,            // Verbose logging is turned off initially.
+		Color:              false,            // Messages are plain text by default, so the output files have no escape codes.
+		Hexdump:            false,            // Events carry no hexdump by default.
+		HexdumpMax:         64,               // Hexdumps are truncated to 64 bytes by default.
+		Compat:             false,            // Events use the native ble.sniff schema by default.
+		Tag:                "ble.sniff",      // Events are tagged with the module name by default.
+		DisplayRate:        0,                // Every event is pushed to the session by default.
+		displayLimiter:     nil,              // Created when the context is read if the display rate is limited.
+		SessionID:          "",               // The session identifier is generated when the context is read.
+		Anonymize:          false,            // Events carry the real device addresses by default.
+		AnonymizeKey:       "",               // A random key is generated for every session by default.
+		anonymizer:         nil,              // Created when the context is read if anonymizing.
+		GPS:                "",               // Events have no location by default.
+		GPSBaudRate:        4800,             // NMEA devices talk at 4800 baud by default.
+		gps:                nil,              // Created when the context is read if a GPS is set.
+		ConnectableOnly:    false,            // Every advertisement is reported by default.
+		ChangesOnly:        false,            // Repeated payloads are reported by default.
+		Merge:              true,             // An advertisement is reported in a single event by default.
+		DirectedTarget:     true,             // The directed advertisements are reported to their target by default.
+		ADTypes:            nil,              // Every AD structure is parsed by default.
+		DropBadCRC:         false,            // Packets with a bad CRC are decoded by default.
+		AdvChannelsOnly:    false,            // Packets of every channel are decoded by default.
+		PDU:                "",               // Every advertising PDU type is reported by default.
+		PDUTypes:           nil,              // No advertising PDU type filter by default.
+		Service:            "",               // Advertisements are not filtered by service data by default.
+		Services:           nil,              // No service data filter by default.
+		MinLen:             0,                // Advertisements are not filtered by data length by default.
+		MaxLen:             0,                // The advertising data length has no upper limit by default.
+		Name:               "",               // Devices are not filtered by name by default.
+		NameStrict:         true,             // Devices with an unknown name don't match the name filter by default.
+		LogJSON:            false,            // The colored session log is used by default.
+		ProximityImmediate: -50,              // Devices stronger than -50 dBm are immediate by default.
+		ProximityNear:      -70,              // Devices stronger than -70 dBm are near by default.
+		RSSIAlpha:          0.3,              // New RSSI samples weight 30% of the average by default.
+		RSSIReset:          30 * time.Second, // Averages are reset after 30 seconds of silence by default.
+		EmitDepth:          3,                // Packet layers are nested at depth 3 in the TShark JSON output by default.
+		JSONStrict:         false,            // An unterminated JSON array is the normal end of the input by default.
+		ReadBuffer:         64 << 10,         // The input is read by 64 KiB by default.
+		QueueSize:          1024,             // Up to 1024 packets wait to be processed by default.
+		Workers:            1,                // Packets are decoded in order by the capture loop by default.
+		ShutdownTimeout:    5 * time.Second,  // Stopping waits up to 5 seconds for the queued packets by default.
+		ReportTop:          5,                // The report lists the top 5 entries by default.
+		History:            100,              // The last 100 events are retained by default.
+		history:            nil,              // Created when the context is read if the history is enabled.
+		SensorsLog:         0,                // The sensor log is disabled by default.
+		sensors:            nil,              // Created when the context is read if the sensor log is enabled.
+		AlertCompanies:     nil,              // No company is alerted about by default.
+		AlertWindow:        10 * time.Second, // The advertisements of the companies are counted over 10 seconds by default.
+		AlertCooldown:      time.Minute,      // A company is alerted about at most once a minute by default.
+		alerts:             nil,              // Created when the context is read if a company is alerted about.
+		Heartbeat:          0,                // Heartbeat events are disabled by default.
+		SummaryInterval:    0,                // Summary events are disabled by default.
+		StarvationTimeout:  30 * time.Second, // A capture without events for 30 seconds is reported by default.
+		Filter:             "",               // TShark display filter string is initially empty.
+		Expression:         "",               // Regular expression for filtering is initially empty.
+		Compiled:           nil,              // Compiled regular expression object is initially nil.
+		Output:             "",               // Output destination is initially empty.
+		OutputFile:         nil,              // Output file object is initially nil.
+		OutputPipe:         nil,              // Output named pipe is initially nil.
+		SplitByDevice:      false,            // Every event is written to the same output file by default.
+		SplitMaxOpen:       64,               // Up to 64 per-device files are open at the same time by default.
+		deviceFiles:        nil,              // Per-device output files are opened when the context is read.
+		OutputPretty:       false,            // Events are written as compact JSON lines by default.
+		OutputGzip:         false,            // The output file is not compressed by default.
+		RotateSize:         0,                // The output file is not rotated by size by default.
+		RotateInterval:     0,                // The output file is not rotated by time by default.
+		RotateKeep:         0,                // Every rotated output file is kept by default.
+		OutputFlush:        time.Second,      // The buffered events are written every second by default.
+		OutputBuffer:       64 << 10,         // The output file is buffered by 64 KiB by default.
+		S3:                 "",               // Rotated output files are not uploaded by default.
+		S3DeleteLocal:      false,            // Uploaded files are kept locally by default.
+		s3:                 nil,              // Created when the context is read if a bucket is set.
+		InventoryLoad:      "",               // The device table starts empty by default.
+		OUIDB:              "",               // Only the bundled manufacturers table is used by default.
+		OUITable:           nil,              // No OUI database is loaded by default.
+		SQLite:             "",               // SQLite database is initially empty.
+		SQLiteSink:         nil,              // SQLite sink is initially nil.
+		Influx:             "",               // Events are not written to InfluxDB by default.
+		InfluxOrg:          "",               // No InfluxDB organization by default.
+		InfluxBucket:       "",               // No InfluxDB bucket by default.
+		InfluxToken:        "",               // The InfluxDB token is read from the environment by default.
+		influx:             nil,              // Created when the context is read if a server is set.
 	}
 }
 
@@ -139,7 +780,7 @@ var (
 	no  = tui.Red("no")    // 'no' string colored in red.
 	yes = tui.Green("yes") // 'yes' string colored in green.
 	// Map for converting boolean values to their colored string representations.
-	yn  = map[bool]string{
+	yn = map[bool]string{
 		true:  yes, // True values are represented by 'yes' in green.
 		false: no,  // False values are represented by 'no' in red.
 	}
@@ -147,39 +788,219 @@ var (
 
 // Log method for SnifferContext logs various configuration parameters to the session log.
 func (c *SnifferContext) Log(sess *session.Session) {
+	// Logging whether this is a dry run.
+	logInfo("Dry run            : %s", yn[c.DryRun])
 	// Logging the status of local packet dumping.
-	log.Info("Skip local packets : %s", yn[c.DumpLocal])
+	logInfo("Skip local packets : %s", yn[c.DumpLocal])
 	// Logging whether verbose logging is enabled.
-	log.Info("Verbose            : %s", yn[c.Verbose])
-	// Logging the BPF filter configuration.
-	log.Info("BPF Filter         : '%s'", tui.Yellow(c.Filter))
+	logInfo("Verbose            : %s", yn[c.Verbose])
+	// Logging whether the messages are colored.
+	logInfo("Colored messages   : %s", yn[c.Color])
+	// Logging whether the events carry a hexdump.
+	logInfo("Hexdump            : %s (max %d bytes)", yn[c.Hexdump], c.HexdumpMax)
+	// Logging whether events are compatible with net.sniff.
+	logInfo("net.sniff compat   : %s", yn[c.Compat])
+	// Logging the display rate.
+	logInfo("Display rate       : %d events/s", c.DisplayRate)
+	// Logging the tag of the events.
+	logInfo("Events tag         : '%s'", tui.Yellow(c.Tag))
+	// Logging the capture session identifier.
+	logInfo("Session ID         : %s", c.SessionID)
+	// Logging whether the addresses are anonymized, without the key.
+	logInfo("Anonymize          : %s (configured key %s)", yn[c.Anonymize], yn[c.AnonymizeKey != ""])
+	// Logging the GPS the location is read from.
+	logInfo("GPS                : '%s' (%d baud)", tui.Yellow(c.GPS), c.GPSBaudRate)
+	// Logging whether the logs are JSON lines.
+	logInfo("JSON logs          : %s", yn[c.LogJSON])
+	// Logging the name filter.
+	logInfo("Name filter        : '%s' (strict %s)", tui.Yellow(c.Name), yn[c.NameStrict])
+	// Logging whether only connectable advertisements are reported.
+	logInfo("Connectable only   : %s", yn[c.ConnectableOnly])
+	// Logging whether only the changed payloads are reported.
+	logInfo("Changes only       : %s", yn[c.ChangesOnly])
+	// Logging whether the AD structures of an advertisement are merged.
+	logInfo("Merge AD structures: %s", yn[c.Merge])
+	// Logging whether the directed advertisements are reported to their target.
+	logInfo("Directed target    : %s", yn[c.DirectedTarget])
+	// Logging the types of the AD structures parsed.
+	logInfo("AD types           : %s", adTypesLabel(c.ADTypes))
+	// Logging whether the packets with a bad CRC are dropped.
+	logInfo("Drop bad CRC       : %s", yn[c.DropBadCRC])
+	// Logging whether only the primary advertising channels are decoded.
+	logInfo("Adv channels only  : %s", yn[c.AdvChannelsOnly])
+	// Logging the advertising PDU types filter.
+	logInfo("PDU types          : '%s'", tui.Yellow(c.PDU))
+	// Logging the service data filter.
+	logInfo("Services           : '%s'", tui.Yellow(c.Service))
+	// Logging the advertising data length filter.
+	logInfo("AdvData length     : min %d, max %d", c.MinLen, c.MaxLen)
+	// Logging the proximity thresholds.
+	logInfo("Proximity          : immediate >= %d dBm, near >= %d dBm", c.ProximityImmediate, c.ProximityNear)
+	// Logging the RSSI smoothing parameters.
+	logInfo("RSSI smoothing     : alpha %.2f, reset after %s", c.RSSIAlpha, c.RSSIReset)
+	// Logging the depth the JSON input is decoded at.
+	logInfo("JSON emit depth    : %d", c.EmitDepth)
+	// Logging whether an unterminated JSON input is reported.
+	logInfo("Strict JSON        : %s", yn[c.JSONStrict])
+	// Logging the size of the input buffer.
+	logInfo("Read buffer        : %d bytes", c.ReadBuffer)
+	// Logging the size of the packet queue.
+	logInfo("Packet queue size  : %d", c.QueueSize)
+	// Logging the number of workers.
+	logInfo("Workers            : %d", c.Workers)
+	// Logging the time given to drain the queue on stop.
+	logInfo("Shutdown timeout   : %s", c.ShutdownTimeout)
+	// Logging the size of the report rankings.
+	logInfo("Report top         : %d", c.ReportTop)
+	// Logging the size of the event history.
+	logInfo("Event history      : %d", c.History)
+	// Logging the size of the sensor log.
+	logInfo("Sensor log         : %d", c.SensorsLog)
+	// Logging the company alerts settings.
+	logInfo("Company alerts     : %s per %s, cooldown %s", companyAlertsLabel(c.AlertCompanies), c.AlertWindow, c.AlertCooldown)
+	// Logging the TShark restart settings.
+	logInfo("TShark autorestart : %s (max %d)", yn[c.AutoRestart], c.AutoRestartMax)
+	// Logging the remote host TShark runs on.
+	logInfo("Remote capture     : '%s'", tui.Yellow(c.Remote))
+	// Logging the heartbeat interval.
+	logInfo("Heartbeat          : %s", c.Heartbeat)
+	// Logging the summary interval.
+	logInfo("Summary interval   : %s", c.SummaryInterval)
+	// Logging the starvation timeout.
+	logInfo("Starvation timeout : %s", c.StarvationTimeout)
+	// Logging the TShark display filter configuration.
+	logInfo("Display filter     : '%s'", tui.Yellow(c.Filter))
 	// Logging the regular expression used for filtering.
-	log.Info("Regular expression : '%s'", tui.Yellow(c.Expression))
+	logInfo("Regular expression : '%s'", tui.Yellow(c.Expression))
 	// Logging the output file or destination.
-	log.Info("File output        : '%s'", tui.Yellow(c.Output))
+	logInfo("File output        : '%s'", tui.Yellow(c.Output))
+	// Logging whether the output file is indented.
+	logInfo("Pretty output      : %s", yn[c.OutputPretty])
+	// Logging whether the output file is compressed.
+	logInfo("Gzip output        : %s", yn[c.OutputGzip])
+	// Logging whether the output is split by device.
+	logInfo("Split by device    : %s (max %d open)", yn[c.SplitByDevice], c.SplitMaxOpen)
+	// Logging the output rotation settings.
+	logInfo("Output rotation    : size %d bytes, interval %s, keep %d", c.RotateSize, c.RotateInterval, c.RotateKeep)
+	// Logging the output buffering settings.
+	logInfo("Output buffering   : %d bytes, flushed every %s", c.OutputBuffer, c.OutputFlush)
+	// Logging the bucket the rotated files are uploaded to.
+	logInfo("S3 upload          : '%s' (delete local %s)", tui.Yellow(c.S3), yn[c.S3DeleteLocal])
+	// Logging the SQLite database.
+	logInfo("SQLite output      : '%s'", tui.Yellow(c.SQLite))
+	// Logging the InfluxDB server, without the token.
+	logInfo("InfluxDB output    : '%s' (org '%s', bucket '%s')", tui.Yellow(c.Influx), c.InfluxOrg, c.InfluxBucket)
+	// Logging the OUI database.
+	logInfo("OUI database       : '%s' (%d entries)", tui.Yellow(c.OUIDB), len(c.OUITable))
+	// Logging the inventory the device table is loaded from.
+	logInfo("Inventory load     : '%s'", tui.Yellow(c.InventoryLoad))
 }
 
-// Close method for SnifferContext handles the cleanup and resource release.
+// Close method for SnifferContext handles the cleanup and resource release, giving the outputs the shutdown
+// timeout to be flushed.
 func (c *SnifferContext) Close() {
+	c.closeBy(time.Now().Add(c.ShutdownTimeout))
+}
+
+// closeBy releases the resources of the context, the uploads and the writes still in progress at the deadline
+// being aborted so that it returns by then.
+func (c *SnifferContext) closeBy(deadline time.Time) {
+	// Closing the input of a remote capture, which stops TShark on the remote host.
+	if c.remoteIn != nil {
+		c.remoteIn.Close()
+		c.remoteIn = nil
+	}
+
+	// Stopping the GPS tracker.
+	if c.gps != nil {
+		c.gps.Close()
+		c.gps = nil
+	}
+
 	// Checking if the TShark process is running.
-	if c.TSharkRunning {
+	if c.TSharkRunning() {
 		// Attempting to kill the TShark process and handle potential errors.
 		err := c.TSharkProc.Process.Kill()
 		if err != nil {
 			// Logging successful killing of the process.
-			log.Debug("killed TSharkProc")
+			logDebug("killed TSharkProc")
 		} else {
 			// Logging a warning if unable to kill the TShark process.
-			log.Warning("could not kill TShark Process")
+			logWarning("could not kill TShark Process")
 		}
 	}
 
+	// Writing the buffered events, the flusher being stopped even if a failed rotation lost the file.
+	c.stopOutputFlusher()
+
 	// Checking if there is an output file that needs to be closed.
 	if c.OutputFile != nil {
+		// Ending the gzip stream of the compressed file.
+		c.outputLock.Lock()
+		if err := c.closeOutputGzipUnlocked(); err != nil {
+			logWarning("error compressing the output to %s: %v", c.Output, err)
+		}
+		// The last segment is rotated too when the segments are uploaded, it is named before the compressor is
+		// forgotten so that it keeps the extension.
+		final := ""
+		if c.s3 != nil && c.outputSize > 0 {
+			final = c.rotatedName(time.Now())
+		}
+		c.outputGzip = nil
+		c.outputLock.Unlock()
 		// Logging the closure of the output file.
-		log.Debug("closing output")
+		logDebug("closing output")
 		c.OutputFile.Close() // Closing the output file.
-		log.Debug("output closed")
-		c.OutputFile = nil  // Setting the outputFile pointer to nil.
+		logDebug("output closed")
+		c.OutputFile = nil // Setting the outputFile pointer to nil.
+
+		if final != "" {
+			if err := os.Rename(c.Output, final); err != nil {
+				logWarning("could not rotate the last segment of %s, it isn't uploaded: %v", c.Output, err)
+			} else {
+				c.s3.Enqueue(final)
+			}
+		}
+	}
+
+	// Uploading the queued files until the deadline, once no more files are rotated.
+	if c.s3 != nil {
+		logDebug("stopping the S3 uploads")
+		c.s3.Close(time.Until(deadline))
+		c.s3 = nil
+	}
+
+	// Checking if there are per-device output files that need to be closed.
+	if c.deviceFiles != nil {
+		logDebug("closing per-device outputs")
+		if err := c.deviceFiles.Close(); err != nil {
+			logWarning("error closing the outputs in %s: %v", c.Output, err)
+		}
+		c.deviceFiles = nil
+	}
+
+	// Checking if there is a named pipe that needs to be closed.
+	if c.OutputPipe != nil {
+		logDebug("closing named pipe")
+		if err := c.OutputPipe.Close(); err != nil {
+			logWarning("error closing named pipe %s: %v", c.Output, err)
+		}
+		c.OutputPipe = nil
+	}
+
+	// Writing the last events to InfluxDB.
+	if c.influx != nil {
+		logDebug("flushing the InfluxDB writes")
+		c.influx.Close(time.Until(deadline))
+		c.influx = nil
+	}
+
+	// Checking if there is a SQLite database that needs to be closed.
+	if c.SQLiteSink != nil {
+		logDebug("closing sqlite database")
+		if err := c.SQLiteSink.closeBy(deadline); err != nil {
+			logWarning("error closing sqlite database %s: %v", c.SQLite, err)
+		}
+		c.SQLiteSink = nil
 	}
 }
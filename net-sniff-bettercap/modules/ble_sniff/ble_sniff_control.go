@@ -0,0 +1,120 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, strings for prefix matching,
+// and time for time-related functions.
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Link-layer control PDU opcodes as defined by the Bluetooth Core Specification (Vol 6, Part B, 2.4.2).
+const (
+	LL_CONNECTION_UPDATE_IND = 0x00
+	LL_CHANNEL_MAP_IND       = 0x01
+	LL_TERMINATE_IND         = 0x02
+)
+
+// controlProcedures maps a link-layer control opcode to the name of its procedure.
+var controlProcedures = map[uint8]string{
+	0x00: "LL_CONNECTION_UPDATE_IND",
+	0x01: "LL_CHANNEL_MAP_IND",
+	0x02: "LL_TERMINATE_IND",
+	0x03: "LL_ENC_REQ",
+	0x04: "LL_ENC_RSP",
+	0x05: "LL_START_ENC_REQ",
+	0x06: "LL_START_ENC_RSP",
+	0x07: "LL_UNKNOWN_RSP",
+	0x08: "LL_FEATURE_REQ",
+	0x09: "LL_FEATURE_RSP",
+	0x0a: "LL_PAUSE_ENC_REQ",
+	0x0b: "LL_PAUSE_ENC_RSP",
+	0x0c: "LL_VERSION_IND",
+	0x0d: "LL_REJECT_IND",
+	0x0e: "LL_PERIPHERAL_FEATURE_REQ",
+	0x0f: "LL_CONNECTION_PARAM_REQ",
+	0x10: "LL_CONNECTION_PARAM_RSP",
+	0x11: "LL_REJECT_EXT_IND",
+	0x12: "LL_PING_REQ",
+	0x13: "LL_PING_RSP",
+	0x14: "LL_LENGTH_REQ",
+	0x15: "LL_LENGTH_RSP",
+	0x16: "LL_PHY_REQ",
+	0x17: "LL_PHY_RSP",
+	0x18: "LL_PHY_UPDATE_IND",
+	0x19: "LL_MIN_USED_CHANNELS_IND",
+	0x1a: "LL_CTE_REQ",
+	0x1b: "LL_CTE_RSP",
+	0x1c: "LL_PERIODIC_SYNC_IND",
+	0x1d: "LL_CLOCK_ACCURACY_REQ",
+	0x1e: "LL_CLOCK_ACCURACY_RSP",
+}
+
+// controlProcedureName returns the procedure name for an opcode, or CTRL_0xNN for unknown ones.
+func controlProcedureName(opcode uint8) string {
+	if name, found := controlProcedures[opcode]; found {
+		return name
+	}
+	return fmt.Sprintf("CTRL_0x%02x", opcode)
+}
+
+// controlOpcode extracts the link-layer control opcode from the BLE data, if present.
+func controlOpcode(btleData map[string]interface{}) (uint8, bool) {
+	opcode_string, ok := btleData["btle.control_opcode"].(string)
+	if !ok {
+		return 0, false
+	}
+
+	opcode, err := parseHexUint(opcode_string, 8)
+	if err != nil {
+		return 0, false
+	}
+
+	return uint8(opcode), true
+}
+
+// onControl is a function that processes link-layer control PDUs sent over a data channel, returning their event
+// stamped with the capture time t.
+func onControl(btleData map[string]interface{}, accessAddress string, t time.Time) []SnifferEvent {
+	// Only packets carrying a control opcode are handled here.
+	opcode, ok := controlOpcode(btleData)
+	if !ok {
+		return nil
+	}
+
+	procedure := controlProcedureName(opcode)
+
+	// Collect every decoded control field TShark provided for this procedure.
+	data := SniffData{
+		"access_address": accessAddress,
+		"opcode":         opcode,
+		"procedure":      procedure,
+	}
+	for key, value := range btleData {
+		if strings.HasPrefix(key, "btle.control.") {
+			data[strings.TrimPrefix(key, "btle.control.")] = value
+		}
+	}
+
+	// Expand the new channel map announced by a LL_CHANNEL_MAP_IND.
+	if opcode == LL_CHANNEL_MAP_IND {
+		if channel_map_string, ok := data["channel_map"].(string); ok {
+			if channel_map, err := parseHexBytes(channel_map_string); err == nil && len(channel_map) == channelMapSize {
+				data["channels"] = decodeChannelMap(channel_map)
+			}
+		}
+	}
+
+	// Create a new SnifferEvent with protocol "BLE CTRL".
+	return []SnifferEvent{NewSnifferEvent(t,
+		"BLE CTRL",
+		accessAddress,
+		"CONNECTION",
+		data,
+		"%s on connection %s",
+		procedure,
+		accessAddress,
+	)}
+}
@@ -0,0 +1,22 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// crcOK reads the CRC check of the nRF sniffer, returning false for the corrupted packets. The flag is part of the
+// flags of the nordic_ble layer, the packets without it are assumed to be valid.
+func crcOK(packetMap map[string]interface{}) bool {
+	nordic, ok := packetMap["nordic_ble"].(map[string]interface{})
+	if !ok {
+		return true
+	}
+
+	// Depending on the Wireshark version the flag is in the flags tree or directly in the layer.
+	flag, ok := nordic["nordic_ble.crcok"].(string)
+	if !ok {
+		flags, _ := nordic["nordic_ble.flags_tree"].(map[string]interface{})
+		if flag, ok = flags["nordic_ble.crcok"].(string); !ok {
+			return true
+		}
+	}
+
+	return flag != "0" && flag != "false" && flag != "False"
+}
@@ -0,0 +1,51 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func withCRC(packet interface{}, flag string) map[string]interface{} {
+	corrupted := make(map[string]interface{})
+	for layer, value := range packet.(map[string]interface{}) {
+		corrupted[layer] = value
+	}
+	corrupted["nordic_ble"] = map[string]interface{}{
+		"nordic_ble.flags_tree": map[string]interface{}{
+			"nordic_ble.crcok": flag,
+		},
+	}
+	return corrupted
+}
+
+func TestCRCOK(t *testing.T) {
+	packet := fixturePackets(t)[0]
+
+	if !crcOK(packet.(map[string]interface{})) {
+		t.Errorf("expected a packet without the flag to be valid")
+	} else if !crcOK(withCRC(packet, "1")) {
+		t.Errorf("expected a packet with a good CRC to be valid")
+	} else if crcOK(withCRC(packet, "0")) {
+		t.Errorf("expected a packet with a bad CRC to be corrupted")
+	}
+}
+
+func TestBadCRC(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		sink := &collectSink{}
+		mod := newBenchSniffer(sink)
+		mod.Ctx.DropBadCRC = drop
+
+		for _, packet := range fixturePackets(t) {
+			mod.dispatchPacket(nil, withCRC(packet, "0"))
+		}
+
+		if mod.Stats.NumBadCRC != uint64(len(fixturePackets(t))) {
+			t.Errorf("expected every packet to be counted as corrupted, got %d", mod.Stats.NumBadCRC)
+		}
+		if drop && len(sink.events) != 0 {
+			t.Errorf("expected the corrupted packets to be dropped, got %d events", len(sink.events))
+		} else if !drop && len(sink.events) == 0 {
+			t.Errorf("expected the corrupted packets to be decoded")
+		}
+	}
+}
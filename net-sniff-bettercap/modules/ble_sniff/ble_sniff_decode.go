@@ -0,0 +1,180 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the little-endian fields, encoding/hex for the input, fmt for formatted output and errors,
+// io for the writer, sort for listing the event data in order, strings for cleaning the input, and time for the
+// time of the events.
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// decodeAddress is the advertiser the events of the decoded advertising data are attributed to.
+const decodeAddress = "00:00:00:00:00:00"
+
+// parseAdvDataHex parses advertising data given as hex, with or without a 0x prefix and byte separators.
+func parseAdvDataHex(value string) ([]byte, error) {
+	digits := strings.NewReplacer(":", "", "-", "", " ", "").Replace(strings.TrimSpace(value))
+	digits = strings.TrimPrefix(strings.ToLower(digits), "0x")
+	if digits == "" {
+		return nil, fmt.Errorf("no advertising data to decode")
+	}
+	data, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a hex string: %v", value, err)
+	}
+	return data, nil
+}
+
+// colonHex formats bytes like TShark does, as colon separated hex.
+func colonHex(data []byte) string {
+	digits := make([]string, len(data))
+	for i, b := range data {
+		digits[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(digits, ":")
+}
+
+// formatUUID128 formats a little-endian 128 bit UUID in its canonical form.
+func formatUUID128(data []byte) string {
+	b := make([]byte, 16)
+	for i := range b {
+		b[i] = data[15-i]
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// uuidValues formats the little-endian UUIDs of the given size of a list, as TShark lists them.
+func uuidValues(data []byte, size int) []interface{} {
+	values := make([]interface{}, 0, len(data)/size)
+	for i := 0; i+size <= len(data); i += size {
+		switch size {
+		case 2:
+			values = append(values, fmt.Sprintf("0x%04x", binary.LittleEndian.Uint16(data[i:])))
+		case 4:
+			values = append(values, fmt.Sprintf("0x%08x", binary.LittleEndian.Uint32(data[i:])))
+		default:
+			values = append(values, formatUUID128(data[i:i+size]))
+		}
+	}
+	return values
+}
+
+// rawADEntry builds an AD structure with the fields TShark would decode from its type and payload, so that it can
+// go through the AD structure parsers. The parsers of the other types fall back to the raw payload.
+func rawADEntry(adType uint8, payload []byte) map[string]interface{} {
+	entry := map[string]interface{}{
+		"btcommon.eir_ad.entry.length": fmt.Sprintf("%d", len(payload)+1),
+		"btcommon.eir_ad.entry.type":   fmt.Sprintf("0x%02x", adType),
+		"btcommon.eir_ad.entry.data":   colonHex(payload),
+	}
+
+	switch {
+	case adType == AD_FLAGS && len(payload) > 0:
+		// The flags are listed in the order of their bits.
+		for i, flag := range adFlags {
+			entry[flag.Field] = fmt.Sprintf("%d", payload[0]>>uint(i)&1)
+		}
+	case adType == AD_SHORT_LOCAL_NAME || adType == AD_COMPLETE_LOCAL_NAME:
+		entry["btcommon.eir_ad.entry.device_name"] = string(payload)
+	case adType == AD_INCOMPLETE_UUID16 || adType == AD_COMPLETE_UUID16:
+		entry["btcommon.eir_ad.entry.uuid_16"] = uuidValues(payload, 2)
+	case adType == AD_INCOMPLETE_UUID32 || adType == AD_COMPLETE_UUID32:
+		entry["btcommon.eir_ad.entry.uuid_32"] = uuidValues(payload, 4)
+	case adType == AD_INCOMPLETE_UUID128 || adType == AD_COMPLETE_UUID128:
+		entry["btcommon.eir_ad.entry.custom_uuid_128"] = uuidValues(payload, 16)
+	case adType == AD_TX_POWER_LEVEL && len(payload) == 1:
+		entry["btcommon.eir_ad.entry.power_level"] = fmt.Sprintf("%d", int8(payload[0]))
+	case adType == AD_SERVICE_DATA16 && len(payload) >= 2:
+		entry["btcommon.eir_ad.entry.uuid_16"] = uuidValues(payload[:2], 2)[0]
+		entry["btcommon.eir_ad.entry.service_data"] = colonHex(payload[2:])
+	case adType == AD_SERVICE_DATA32 && len(payload) >= 4:
+		entry["btcommon.eir_ad.entry.uuid_32"] = uuidValues(payload[:4], 4)[0]
+		entry["btcommon.eir_ad.entry.service_data"] = colonHex(payload[4:])
+	case adType == AD_SERVICE_DATA128 && len(payload) >= 16:
+		entry["btcommon.eir_ad.entry.custom_uuid_128"] = uuidValues(payload[:16], 16)[0]
+		entry["btcommon.eir_ad.entry.service_data"] = colonHex(payload[16:])
+	case adType == AD_MANUFACTURER_DATA && len(payload) >= 2:
+		entry["btcommon.eir_ad.entry.company_id"] = fmt.Sprintf("0x%04x", binary.LittleEndian.Uint16(payload))
+		entry["btcommon.eir_ad.entry.data"] = colonHex(payload[2:])
+	}
+	return entry
+}
+
+// rawADEntries splits advertising data into its AD structures, each one a length byte followed by its type and
+// payload. A zero length ends the significant part of the data, the rest being padding.
+func rawADEntries(data []byte) ([]map[string]interface{}, error) {
+	entries := make([]map[string]interface{}, 0)
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		if length == 0 {
+			break
+		} else if i+1+length > len(data) {
+			return nil, fmt.Errorf("AD structure at offset %d is %d bytes long, only %d bytes are left", i, length, len(data)-i-1)
+		}
+		entries = append(entries, rawADEntry(data[i+1], data[i+2:i+1+length]))
+		i += 1 + length
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no AD structure in the advertising data")
+	}
+	return entries, nil
+}
+
+// decodeAdvData runs advertising data through the AD structure parsers, returning an event per structure.
+func decodeAdvData(data []byte, t time.Time) ([]SnifferEvent, error) {
+	entries, err := rawADEntries(data)
+	if err != nil {
+		return nil, err
+	}
+
+	btleData := map[string]interface{}{
+		"btle.advertising_address": decodeAddress,
+	}
+	// The companies of the decoded data aren't accounted to the capture.
+	return onAdvertisementEntries(btleData, entries, nil, NewSnifferStats(), t), nil
+}
+
+// writeDecoded writes a line for each event with its protocol and message, followed by its data sorted by key.
+func writeDecoded(w io.Writer, events []SnifferEvent) {
+	for _, e := range events {
+		fmt.Fprintf(w, "%s : %s\n", e.Protocol, e.Message)
+		data, ok := e.Data.(SniffData)
+		if !ok {
+			continue
+		}
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "  %s = %v\n", key, data[key])
+		}
+	}
+	fmt.Fprintf(w, "%d events\n", len(events))
+}
+
+// DecodeHex handles ble.sniff.decode, printing the events the parsers produce for advertising data given as hex,
+// without a capture.
+func (mod *Sniffer) DecodeHex(value string) error {
+	data, err := parseAdvDataHex(value)
+	if err != nil {
+		return err
+	}
+	events, err := decodeAdvData(data, time.Now())
+	if err != nil {
+		return err
+	}
+
+	writeDecoded(mod.Session.Events.Stdout, events)
+	mod.Session.Refresh()
+
+	return nil
+}
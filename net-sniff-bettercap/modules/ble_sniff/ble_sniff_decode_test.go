@@ -0,0 +1,67 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bettercap/gatt"
+)
+
+func TestDecodeAdvData(t *testing.T) {
+	data, err := parseAdvDataHex("0x02:01:06 07:09:54:68:65:72:6d:6f 0aff4c0010050b1c5ea108 050312180f18 020af8 0616aafe10f8 00:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := decodeAdvData(data, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"Flags LE General Discoverable, BR/EDR Not Supported",
+		`Local name "Thermo"`,
+		"Proprietary " + gatt.CompanyIdents[0x004c] + " Data",
+		"Services 0x1812, 0x180f",
+		"TX power -8 dBm",
+	}
+	if len(events) != len(expected)+1 {
+		t.Fatalf("expected %d events, got %d", len(expected)+1, len(events))
+	}
+	for i, message := range expected {
+		if events[i].Message != message || events[i].Source != decodeAddress {
+			t.Errorf("expected event %d to be %q, got %q from %s", i, message, events[i].Message, events[i].Source)
+		}
+	}
+	if manufacturer := events[2].Data.(SniffData); manufacturer["company_id"] != uint16(0x004c) || manufacturer["data"] != "10:05:0b:1c:5e:a1:08" {
+		t.Errorf("unexpected manufacturer data %v", manufacturer)
+	}
+	if service := events[5].Data.(SniffData); service["uuid"] != "0xfeaa" || !strings.HasPrefix(events[5].Message, "Service 0xfeaa Eddystone-URL") {
+		t.Errorf("expected the Eddystone decoder to run, got %q with %v", events[5].Message, service)
+	}
+
+	out := bytes.Buffer{}
+	writeDecoded(&out, events[:1])
+	if out.String() != "BLE ADVERT : Flags LE General Discoverable, BR/EDR Not Supported\n  flags = [LE General Discoverable BR/EDR Not Supported]\n1 events\n" {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
+
+func TestDecodeAdvDataErrors(t *testing.T) {
+	for _, value := range []string{"", "0x", "02010", "zz0106"} {
+		if _, err := parseAdvDataHex(value); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+
+	for _, value := range []string{"020106 05ff4c00", "0000"} {
+		data, err := parseAdvDataHex(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeAdvData(data, time.Now()); err == nil {
+			t.Errorf("expected an error for the AD structures of %q", value)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for the registration errors, and sync for guarding the decoder tables.
+import (
+	"fmt"
+	"sync"
+)
+
+// DecoderFunc decodes the payload of a manufacturer specific data AD structure, without its company identifier, or
+// of a service data AD structure, without its service UUID. It returns the fields merged into the data of the event,
+// and a short description appended to its message. If it returns an error, the payload is reported undecoded.
+// A decoder can report the payload as an event of another protocol, such as "BLE FINDMY", by setting the "protocol"
+// field, which isn't merged into the data. The description is the whole message of such an event.
+type DecoderFunc func(data []byte) (SniffData, string, error)
+
+// decoderProtocolField is the field a decoder sets to report the payload as an event of another protocol.
+const decoderProtocolField = "protocol"
+
+// Declaring the decoders of the manufacturer specific data keyed by company identifier, and of the service data
+// keyed by normalized service UUID, along with the lock guarding them.
+var (
+	decodersLock         sync.RWMutex
+	manufacturerDecoders = make(map[uint16]DecoderFunc)
+	serviceDecoders      = make(map[string]DecoderFunc)
+)
+
+// RegisterManufacturerDecoder sets the decoder of the manufacturer specific data of a company, replacing any
+// previous one, built-in decoders included. A nil decoder removes it. It is safe to call at any time, but the
+// decoder only applies to the packets processed after the call, so it should be registered before Start.
+func RegisterManufacturerDecoder(companyID uint16, fn DecoderFunc) {
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+
+	if fn == nil {
+		delete(manufacturerDecoders, companyID)
+	} else {
+		manufacturerDecoders[companyID] = fn
+	}
+}
+
+// RegisterServiceDecoder sets the decoder of the service data of a service, replacing any previous one, built-in
+// decoders included. A nil decoder removes it. The UUID is 16 or 32 bit hexadecimal, with or without the 0x prefix,
+// or 128 bit with or without separators, and matches the service whatever the width it is advertised with. It
+// panics if the UUID is invalid, like the other registrations done while initializing a program. It is safe to call
+// at any time, but the decoder only applies to the packets processed after the call, so it should be registered
+// before Start.
+func RegisterServiceDecoder(uuid string, fn DecoderFunc) {
+	normalized, err := parseServiceUUID(uuid)
+	if err != nil {
+		panic(fmt.Sprintf("ble_sniff: RegisterServiceDecoder: %v", err))
+	}
+
+	decodersLock.Lock()
+	defer decodersLock.Unlock()
+
+	if fn == nil {
+		delete(serviceDecoders, normalized)
+	} else {
+		serviceDecoders[normalized] = fn
+	}
+}
+
+// manufacturerDecoder returns the decoder of the manufacturer specific data of a company, if any.
+func manufacturerDecoder(companyID uint16) (DecoderFunc, bool) {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+
+	fn, found := manufacturerDecoders[companyID]
+	return fn, found
+}
+
+// serviceDecoder returns the decoder of the service data of a normalized service UUID, if any.
+func serviceDecoder(uuid string) (DecoderFunc, bool) {
+	decodersLock.RLock()
+	defer decodersLock.RUnlock()
+
+	fn, found := serviceDecoders[shortenUUID(uuid)]
+	return fn, found
+}
+
+// decodePayload decodes a payload with a decoder, merging the decoded fields into the data of the event. It returns
+// the protocol the decoder reported the payload as, if any, and its description, or false if it couldn't be decoded.
+func decodePayload(fn DecoderFunc, payload string, eventData SniffData) (string, string, bool) {
+	raw, err := parseHexBytes(payload)
+	if err != nil {
+		return "", "", false
+	}
+	decoded, description, err := fn(raw)
+	if err != nil {
+		return "", "", false
+	}
+
+	protocol, _ := decoded[decoderProtocolField].(string)
+	for key, value := range decoded {
+		if key != decoderProtocolField {
+			eventData[key] = value
+		}
+	}
+	return protocol, description, true
+}
+
+// Registering the built-in decoders.
+func init() {
+	RegisterManufacturerDecoder(APPLE_COMPANY_ID, decodeApple)
+	RegisterManufacturerDecoder(0x0499, decodeRuuvi)
+
+	RegisterServiceDecoder("0xfcd2", decodeBTHome)
+	RegisterServiceDecoder("0xfe95", decodeMiBeacon)
+	RegisterServiceDecoder("0xfeaa", decodeEddystone)
+}
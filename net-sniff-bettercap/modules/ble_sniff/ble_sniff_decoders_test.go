@@ -0,0 +1,103 @@
+package ble_sniff
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegisterDecoders(t *testing.T) {
+	decoder := func(data []byte) (SniffData, string, error) {
+		if len(data) != 2 {
+			return nil, "", fmt.Errorf("expected 2 bytes")
+		}
+		return SniffData{"level": int(data[1])}, fmt.Sprintf("level=%d", data[1]), nil
+	}
+	RegisterManufacturerDecoder(0xfff0, decoder)
+	RegisterServiceDecoder("0000fff1-0000-1000-8000-00805f9b34fb", decoder)
+	defer RegisterManufacturerDecoder(0xfff0, nil)
+	defer RegisterServiceDecoder("fff1", nil)
+
+	adv := &advertisement{Data: map[string]interface{}{"btle.advertising_address": "d4:3a:2c:11:8e:07"}, Stats: NewSnifferStats()}
+	events := onProprietary(adv, map[string]interface{}{
+		"btcommon.eir_ad.entry.company_id": "0xfff0",
+		"btcommon.eir_ad.entry.data":       "01:2a",
+	})
+	events = append(events, onServiceData(adv, map[string]interface{}{
+		"btcommon.eir_ad.entry.type":         "0x16",
+		"btcommon.eir_ad.entry.uuid_16":      "0xfff1",
+		"btcommon.eir_ad.entry.service_data": "01:07",
+	})...)
+	// Payloads the decoder rejects are reported undecoded.
+	events = append(events, onProprietary(adv, map[string]interface{}{
+		"btcommon.eir_ad.entry.company_id": "0xfff0",
+		"btcommon.eir_ad.entry.data":       "01",
+	})...)
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, level := range []interface{}{42, 7, nil} {
+		if data := events[i].Data.(SniffData); data["level"] != level {
+			t.Errorf("expected level %v in event %d, got %v (%s)", level, i, data["level"], events[i].Message)
+		}
+	}
+
+	RegisterManufacturerDecoder(0xfff0, nil)
+	if _, found := manufacturerDecoder(0xfff0); found {
+		t.Error("expected the decoder to be removed")
+	}
+}
+
+func TestRegisterServiceDecoderInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an invalid UUID")
+		}
+	}()
+	RegisterServiceDecoder("not-a-uuid", nil)
+}
+
+// Run with -race to check the decoders can be registered while packets are decoded.
+func TestRegisterDecodersConcurrent(t *testing.T) {
+	mod := newBenchSniffer(&lockedSink{})
+	packets := fixturePackets(t)
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			for _, packet := range packets {
+				mod.onPacket(packet, time.Now())
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			RegisterServiceDecoder("0xfff2", decodeEddystone)
+			RegisterServiceDecoder("0xfff2", nil)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestDecodeIBeacon(t *testing.T) {
+	data, _ := parseHexBytes("02:15:f7:82:6d:a6:4f:a2:4e:98:80:24:bc:5b:71:e0:89:3e:00:01:00:2a:c5")
+	decoded, description, err := decodeIBeacon(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["ibeacon_uuid"] != "f7826da6-4fa2-4e98-8024-bc5b71e0893e" || decoded["major"] != uint16(1) || decoded["minor"] != uint16(42) || decoded["tx_power"] != int8(-59) {
+		t.Errorf("unexpected iBeacon %v", decoded)
+	}
+	if description != "iBeacon f7826da6-4fa2-4e98-8024-bc5b71e0893e major=1 minor=42" {
+		t.Errorf("unexpected description %q", description)
+	}
+
+	// Other Apple frames, like the Nearby Info of the fixtures, aren't iBeacons.
+	if _, _, err := decodeIBeacon([]byte{0x10, 0x05, 0x0b, 0x1c, 0x5e, 0xa1, 0x08}); err == nil {
+		t.Error("expected an error for a Nearby Info frame")
+	}
+}
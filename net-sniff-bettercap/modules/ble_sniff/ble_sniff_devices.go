@@ -0,0 +1,294 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sort for ordering the device table, strconv for string conversion, time for time-related functions,
+// and bettercap/gatt for the company identifiers.
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bettercap/gatt"
+)
+
+// SnifferDevice struct keeps track of a device seen advertising.
+type SnifferDevice struct {
+	Address        string        `json:"address"`                   // Advertising address of the device.
+	AddressType    string        `json:"address_type,omitempty"`    // Whether the advertising address is public or random, if known.
+	FirstSeen      time.Time     `json:"first_seen"`                // Time when the device was first seen.
+	LastSeen       time.Time     `json:"last_seen"`                 // Time when the device was last seen.
+	Packets        uint64        `json:"packets"`                   // Count of advertisements received from the device.
+	RSSI           int           `json:"rssi"`                      // Last RSSI received from the device.
+	SmoothedRSSI   float64       `json:"rssi_smoothed"`             // Exponential moving average of the RSSI.
+	RSSIHistogram  RSSIHistogram `json:"rssi_histogram"`            // Distribution of the RSSI samples in fixed buckets.
+	Name           string        `json:"name,omitempty"`            // Local name of the device, from its advertisements or scan responses.
+	UUIDs          []string      `json:"uuids,omitempty"`           // Service UUIDs advertised by the device.
+	CompanyID      uint16        `json:"company_id,omitempty"`      // Company identifier of the last manufacturer specific data advertised.
+	Company        string        `json:"company,omitempty"`         // Name of the company, empty if unknown.
+	HardwareVendor string        `json:"hardware_vendor,omitempty"` // Manufacturer owning the OUI of a public address, empty if unknown.
+	Anonymized     bool          `json:"anonymized,omitempty"`      // Whether the address is a pseudonym, for the records saved while anonymizing.
+	rssiSeen       bool          // Flag set once the moving average has been seeded with a sample.
+	seen           bool          // Flag set once the device advertised in this session, unset for the loaded ones.
+}
+
+// SnifferSignal struct describes the signal strength of a packet, attached to the events it generates.
+type SnifferSignal struct {
+	RSSI         int     `json:"rssi"`          // Instantaneous RSSI of the packet.
+	SmoothedRSSI float64 `json:"rssi_smoothed"` // Exponential moving average of the RSSI of the device.
+	Proximity    string  `json:"proximity"`     // Proximity zone computed from the smoothed RSSI.
+}
+
+// packetRSSI extracts the RSSI reported by the nRF layer, if present.
+func packetRSSI(packetMap map[string]interface{}) (int, bool) {
+	nordic, ok := packetMap["nordic_ble"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	rssi_string, ok := nordic["nordic_ble.rssi"].(string)
+	if !ok {
+		return 0, false
+	}
+
+	rssi, err := strconv.Atoi(rssi_string)
+	if err != nil {
+		return 0, false
+	}
+
+	return rssi, true
+}
+
+// addRSSI adds a sample to the device and updates its exponential moving average,
+// where alpha in the (0, 1] interval is the weight given to the new sample.
+func (d *SnifferDevice) addRSSI(rssi int, alpha float64) {
+	d.RSSI = rssi
+	d.RSSIHistogram.Add(rssi)
+
+	// The first sample seeds the average.
+	if !d.rssiSeen {
+		d.SmoothedRSSI = float64(rssi)
+		d.rssiSeen = true
+		return
+	}
+
+	d.SmoothedRSSI = alpha*float64(rssi) + (1-alpha)*d.SmoothedRSSI
+}
+
+// resetRSSI discards the moving average, so that the next sample seeds it again.
+func (d *SnifferDevice) resetRSSI() {
+	d.SmoothedRSSI = 0
+	d.rssiSeen = false
+}
+
+// TrackDevice updates the device table with an advertisement and returns a copy of the device record.
+// The RSSI average is smoothed with the given alpha factor and reset if the device wasn't seen for longer than reset.
+func (s *SnifferStats) TrackDevice(address string, rssi int, hasRSSI bool, t time.Time, alpha float64, reset time.Duration) SnifferDevice {
+	s.Lock()
+	defer s.Unlock()
+
+	dev, found := s.Devices[address]
+	if !found {
+		dev, found = s.adoptDevice(address)
+	}
+	if !found {
+		dev = &SnifferDevice{
+			Address:   address,
+			FirstSeen: t,
+		}
+		s.Devices[address] = dev
+	} else if reset > 0 && t.Sub(dev.LastSeen) > reset {
+		// The old average doesn't describe the current position of the device anymore.
+		dev.resetRSSI()
+	}
+
+	dev.LastSeen = t
+	dev.Packets++
+	dev.seen = true
+	if hasRSSI {
+		dev.addRSSI(rssi, alpha)
+	}
+
+	return dev.copy()
+}
+
+// adoptDevice moves the record loaded under the pseudonym of an address to the address, once the device shows up.
+func (s *SnifferStats) adoptDevice(address string) (*SnifferDevice, bool) {
+	if s.anonymizer == nil {
+		return nil, false
+	}
+
+	pseudonym := s.anonymizer.Address(address)
+	dev, found := s.Devices[pseudonym]
+	if !found || !dev.Anonymized {
+		return nil, false
+	}
+
+	delete(s.Devices, pseudonym)
+	dev.Address = address
+	dev.Anonymized = false
+	s.Devices[address] = dev
+	return dev, true
+}
+
+// copy returns a copy of the device record which doesn't share the UUIDs list.
+func (d *SnifferDevice) copy() SnifferDevice {
+	c := *d
+	c.UUIDs = append([]string(nil), d.UUIDs...)
+	return c
+}
+
+// Device returns a copy of the record of a device, if it is tracked.
+func (s *SnifferStats) Device(address string) (SnifferDevice, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if dev, found := s.Devices[address]; found {
+		return dev.copy(), true
+	}
+	return SnifferDevice{}, false
+}
+
+// DeviceName returns the local name of a device, or an empty string if it is not known.
+func (s *SnifferStats) DeviceName(address string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if dev, found := s.Devices[address]; found {
+		return dev.Name
+	}
+	return ""
+}
+
+// MergeDeviceInfo adds the local name and service UUIDs discovered in a scan response to the record of a device.
+// Devices not seen advertising yet are ignored, since the scan response alone doesn't make them tracked.
+func (s *SnifferStats) MergeDeviceInfo(address string, name string, uuids []string) {
+	s.Lock()
+	defer s.Unlock()
+
+	dev, found := s.Devices[address]
+	if !found {
+		return
+	}
+
+	if name != "" {
+		dev.Name = name
+	}
+	for _, uuid := range uuids {
+		known := false
+		for _, existing := range dev.UUIDs {
+			if existing == uuid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			dev.UUIDs = append(dev.UUIDs, uuid)
+		}
+	}
+}
+
+// SetDeviceAddressType records whether the advertising address of a device is public or random.
+func (s *SnifferStats) SetDeviceAddressType(address string, addressType string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if dev, found := s.Devices[address]; found {
+		dev.AddressType = addressType
+	}
+}
+
+// SetDeviceCompany records the company identifier found in the manufacturer specific data of a device.
+func (s *SnifferStats) SetDeviceCompany(address string, id uint16, name string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if dev, found := s.Devices[address]; found {
+		dev.CompanyID = id
+		dev.Company = name
+	}
+}
+
+// SetDeviceHardwareVendor records the manufacturer owning the OUI of the public address of a device.
+func (s *SnifferStats) SetDeviceHardwareVendor(address string, vendor string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if dev, found := s.Devices[address]; found {
+		dev.HardwareVendor = vendor
+	}
+}
+
+// HardwareVendor returns the manufacturer owning the OUI of the public address of a device, or an empty string if it is not known.
+func (s *SnifferStats) HardwareVendor(address string) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	if dev, found := s.Devices[address]; found {
+		return dev.HardwareVendor
+	}
+	return ""
+}
+
+// trackAdvertiser updates the device table with the advertiser of a packet and returns its signal information.
+func (mod *Sniffer) trackAdvertiser(packetMap map[string]interface{}, btleData map[string]interface{}, entries []map[string]interface{}, t time.Time) *SnifferSignal {
+	// Extract the advertising address from the BLE data.
+	address, ok := btleData["btle.advertising_address"].(string)
+	if !ok {
+		return nil
+	}
+
+	rssi, hasRSSI := packetRSSI(packetMap)
+	dev := mod.Stats.TrackDevice(address, rssi, hasRSSI, t, mod.Ctx.RSSIAlpha, mod.Ctx.RSSIReset)
+
+	// Keep the name and services of the device up to date, so the filters can use them.
+	if name, uuids := deviceInfo(entries); name != "" || len(uuids) > 0 {
+		mod.Stats.MergeDeviceInfo(address, name, uuids)
+	}
+	if address_type, ok := addressType(btleData); ok {
+		mod.Stats.SetDeviceAddressType(address, address_type)
+		// The OUI of a public address is looked up once, random addresses don't have one.
+		if address_type == AddressPublic && dev.Packets == 1 {
+			if vendor := mod.hardwareVendor(address); vendor != "" {
+				mod.Stats.SetDeviceHardwareVendor(address, vendor)
+			}
+		}
+	}
+	if company_id, ok := companyID(entries); ok {
+		mod.Stats.SetDeviceCompany(address, company_id, gatt.CompanyIdents[company_id])
+	}
+
+	// Announce the devices discovered while building the inventory.
+	if mod.recon && dev.Packets == 1 {
+		mod.onNewDevice(dev, t)
+	}
+	if !hasRSSI {
+		return &SnifferSignal{Proximity: ProximityUnknown}
+	}
+
+	return &SnifferSignal{
+		RSSI:         dev.RSSI,
+		SmoothedRSSI: dev.SmoothedRSSI,
+		Proximity:    classifyProximity(dev.SmoothedRSSI, mod.Ctx.ProximityImmediate, mod.Ctx.ProximityNear),
+	}
+}
+
+// DevicesList returns a copy of the device table sorted by number of advertisements, most active first.
+func (s *SnifferStats) DevicesList() []SnifferDevice {
+	s.RLock()
+	defer s.RUnlock()
+
+	list := make([]SnifferDevice, 0, len(s.Devices))
+	for _, dev := range s.Devices {
+		list = append(list, dev.copy())
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Packets == list[j].Packets {
+			return list[i].Address < list[j].Address
+		}
+		return list[i].Packets > list[j].Packets
+	})
+
+	return list
+}
@@ -0,0 +1,97 @@
+package ble_sniff
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTrackDeviceSmoothedRSSIConverges(t *testing.T) {
+	stats := NewSnifferStats()
+	now := time.Now()
+
+	// a device sitting at -70 dBm with +/- 12 dBm of jitter
+	noise := []int{12, -9, 4, -12, 7, -3, 11, -10, 2, -6, 9, -11, 5, -4, 10, -8}
+
+	var dev SnifferDevice
+	for i := 0; i < 10; i++ {
+		for j, n := range noise {
+			now = now.Add(100 * time.Millisecond)
+			dev = stats.TrackDevice("aa:bb:cc:dd:ee:ff", -70+n, true, now, 0.1, 30*time.Second)
+			if i > 0 && math.Abs(dev.SmoothedRSSI-(-70)) > 6 {
+				t.Fatalf("sample %d: smoothed RSSI %f too far from -70", i*len(noise)+j, dev.SmoothedRSSI)
+			}
+		}
+	}
+
+	if math.Abs(dev.SmoothedRSSI-(-70)) > 3 {
+		t.Errorf("expected smoothed RSSI to converge to -70, got %f", dev.SmoothedRSSI)
+	}
+	if dev.RSSI != -70+noise[len(noise)-1] {
+		t.Errorf("expected instantaneous RSSI %d, got %d", -70+noise[len(noise)-1], dev.RSSI)
+	}
+	if dev.Packets != uint64(10*len(noise)) {
+		t.Errorf("expected %d packets, got %d", 10*len(noise), dev.Packets)
+	}
+}
+
+func TestTrackDeviceResetsStaleAverage(t *testing.T) {
+	stats := NewSnifferStats()
+	now := time.Now()
+
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Second)
+		stats.TrackDevice("aa:bb:cc:dd:ee:ff", -90, true, now, 0.2, 10*time.Second)
+	}
+
+	// seen again after longer than the reset timeout, the first sample seeds the average
+	now = now.Add(time.Minute)
+	dev := stats.TrackDevice("aa:bb:cc:dd:ee:ff", -40, true, now, 0.2, 10*time.Second)
+	if dev.SmoothedRSSI != -40 {
+		t.Errorf("expected smoothed RSSI to be reset to -40, got %f", dev.SmoothedRSSI)
+	}
+
+	// without reset the old average is kept
+	stats = NewSnifferStats()
+	stats.TrackDevice("aa:bb:cc:dd:ee:ff", -90, true, now, 0.2, 0)
+	dev = stats.TrackDevice("aa:bb:cc:dd:ee:ff", -40, true, now.Add(time.Hour), 0.2, 0)
+	if dev.SmoothedRSSI != -80 {
+		t.Errorf("expected smoothed RSSI -80, got %f", dev.SmoothedRSSI)
+	}
+}
+
+func TestClassifyProximity(t *testing.T) {
+	tests := []struct {
+		rssi float64
+		want string
+	}{
+		{0, ProximityUnknown},
+		{-45, ProximityImmediate},
+		{-50, ProximityImmediate},
+		{-65, ProximityNear},
+		{-70, ProximityNear},
+		{-85, ProximityFar},
+	}
+	for _, tt := range tests {
+		if got := classifyProximity(tt.rssi, -50, -70); got != tt.want {
+			t.Errorf("classifyProximity(%f) = %s, expected %s", tt.rssi, got, tt.want)
+		}
+	}
+}
+
+func TestRSSIHistogramBuckets(t *testing.T) {
+	var h RSSIHistogram
+	for _, rssi := range []int{-120, -100, -96, -95, -61, -60, -21, -20, 10} {
+		h.Add(rssi)
+	}
+
+	expected := map[int]uint64{0: 3, 1: 1, 7: 1, 8: 1, 15: 3}
+	for bucket, count := range h {
+		if count != expected[bucket] {
+			t.Errorf("bucket %d (%s): expected %d samples, got %d", bucket, rssiBucketLabel(bucket), expected[bucket], count)
+		}
+	}
+	if h.Total() != 9 {
+		t.Errorf("expected 9 samples, got %d", h.Total())
+	}
+}
@@ -0,0 +1,63 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync for guarding the bucket shared by the workers, and time for refilling it.
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of the events pushed to the session, allowing bursts of up to one second of events.
+type tokenBucket struct {
+	lock   sync.Mutex // Lock guarding the tokens, the workers push concurrently.
+	rate   float64    // Tokens added per second.
+	burst  float64    // Maximum number of tokens.
+	tokens float64    // Tokens currently available.
+	last   time.Time  // Time the tokens were last refilled.
+}
+
+// newTokenBucket creates a full bucket allowing rate events per second.
+func newTokenBucket(rate int, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(rate),
+		tokens: float64(rate),
+		last:   now,
+	}
+}
+
+// Allow returns true and takes a token if one is available at the given time, or false if the event must be dropped.
+func (b *tokenBucket) Allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// display returns true if an event can be pushed to the session according to ble.sniff.display.rate, counting the
+// ones dropped. The events about the sniffer itself, like the heartbeats and the summaries, are never dropped.
+func (mod *Sniffer) display(e SnifferEvent) bool {
+	if mod.Ctx.displayLimiter == nil || e.Source == "SNIFFER" {
+		return true
+	}
+	if mod.Ctx.displayLimiter.Allow(time.Now()) {
+		return true
+	}
+	if mod.Stats != nil {
+		mod.Stats.dropDisplay()
+	}
+	return false
+}
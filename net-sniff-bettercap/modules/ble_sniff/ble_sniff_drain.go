@@ -0,0 +1,73 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync/atomic for the dropped packets counter, time for the shutdown deadline,
+// and jstream for the decoded packets.
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/bcicen/jstream"
+)
+
+// stopTimeout is the time the session waits for a module to stop, the shutdown timeout must be shorter.
+const stopTimeout = 10 * time.Second
+
+// drainPackets processes the packets already queued when the module is stopped, until the deadline. The packets
+// decoded afterwards are not waited for, and the ones left in the queue once the deadline passed are dropped.
+func (mod *Sniffer) drainPackets(pool *workerPool, queue chan *jstream.MetaValue, deadline time.Time) {
+	pending := len(queue)
+	drained := 0
+	for drained < pending && time.Now().Before(deadline) {
+		packet, ok := <-queue
+		if !ok {
+			break
+		}
+		mod.dispatchPacket(pool, packet.Value)
+		drained++
+	}
+
+	dropped := pending - drained
+	if dropped > 0 {
+		atomic.AddUint64(&mod.Stats.NumDropped, uint64(dropped))
+		logWarning("stopping: %d queued packets drained, %d dropped after %s", drained, dropped, mod.Ctx.ShutdownTimeout)
+	} else if drained > 0 {
+		logInfo("stopping: %d queued packets drained", drained)
+	}
+}
+
+// waitCapture asks the capture loop to drain its queue until the deadline and waits for it to return. The loop is
+// waited for even past the deadline, since the outputs it writes to are closed next.
+func (mod *Sniffer) waitCapture(deadline time.Time) {
+	if mod.captureStop == nil {
+		return
+	}
+
+	mod.drainDeadline = deadline
+	close(mod.captureStop)
+	mod.captureStop = nil
+
+	if mod.Ctx.ShutdownTimeout > 0 {
+		select {
+		case <-mod.captureDone:
+			return
+		case <-time.After(time.Until(deadline)):
+			mod.Warning("stopping: capture still busy after %s, waiting for the packets being processed", mod.Ctx.ShutdownTimeout)
+		}
+	}
+	<-mod.captureDone
+}
+
+// closeContext closes the context, flushing the outputs until the deadline so that a stuck sink can't hang the
+// session.
+func (mod *Sniffer) closeContext(deadline time.Time) {
+	ctx := mod.Ctx
+	if ctx.SQLiteSink != nil {
+		if pending := ctx.SQLiteSink.Pending(); pending > 0 {
+			mod.Debug("flushing %d events to %s", pending, ctx.SQLite)
+		}
+	}
+
+	ctx.closeBy(deadline)
+}
@@ -0,0 +1,99 @@
+package ble_sniff
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcicen/jstream"
+)
+
+func queuedPackets(packets []interface{}) chan *jstream.MetaValue {
+	queue := make(chan *jstream.MetaValue, len(packets))
+	for _, packet := range packets {
+		queue <- &jstream.MetaValue{Value: packet}
+	}
+	return queue
+}
+
+// quietLogs discards the module logs, which would otherwise go through the session log.
+func quietLogs(t *testing.T) {
+	writer := jsonLogsWriter
+	setJSONLogs(true)
+	jsonLogsWriter = ioutil.Discard
+	t.Cleanup(func() {
+		setJSONLogs(false)
+		jsonLogsWriter = writer
+	})
+}
+
+func TestDrainPackets(t *testing.T) {
+	quietLogs(t)
+	packets := fixturePackets(t)
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+
+	mod.drainPackets(nil, queuedPackets(packets), time.Now().Add(time.Minute))
+	if mod.Stats.NumAdvertisements != uint64(len(packets)) {
+		t.Errorf("expected %d packets to be drained, got %d", len(packets), mod.Stats.NumAdvertisements)
+	}
+	if len(sink.events) == 0 {
+		t.Errorf("expected the drained packets to push events")
+	}
+	if mod.Stats.NumDropped != 0 {
+		t.Errorf("expected no packets to be dropped, got %d", mod.Stats.NumDropped)
+	}
+}
+
+func TestDrainPacketsAfterDeadline(t *testing.T) {
+	quietLogs(t)
+	packets := fixturePackets(t)
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+
+	mod.drainPackets(nil, queuedPackets(packets), time.Now().Add(-time.Second))
+	if len(sink.events) != 0 {
+		t.Errorf("expected no events once the deadline passed, got %d", len(sink.events))
+	}
+	if mod.Stats.NumDropped != uint64(len(packets)) {
+		t.Errorf("expected %d packets to be dropped, got %d", len(packets), mod.Stats.NumDropped)
+	}
+}
+
+func TestShutdownTimeoutBound(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := NewSnifferWithOptions(s, WithShutdownTimeout(stopTimeout)); err == nil {
+		t.Errorf("expected a shutdown timeout of %s to be rejected", stopTimeout)
+	}
+
+	mod := NewSniffer(s)
+	s.Env.Set("ble.sniff.shutdown.timeout", "10")
+	if err, _ := mod.GetContext(); err == nil || !strings.Contains(err.Error(), "ble.sniff.shutdown.timeout") {
+		t.Errorf("expected the shutdown timeout to be rejected, got %v", err)
+	}
+}
+
+func TestWaitCaptureWithoutTimeout(t *testing.T) {
+	quietLogs(t)
+	mod := newBenchSniffer(&collectSink{})
+	mod.Ctx.ShutdownTimeout = 0
+	mod.captureStop, mod.captureDone = make(chan struct{}), make(chan struct{})
+
+	// Without a shutdown timeout the queue isn't drained, but the capture loop is still waited for.
+	stop, done := mod.captureStop, mod.captureDone
+	returned := make(chan struct{})
+	go func() {
+		mod.waitCapture(time.Now())
+		close(returned)
+	}()
+
+	<-stop
+	select {
+	case <-returned:
+		t.Fatal("expected the capture loop to be waited for")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(done)
+	<-returned
+}
@@ -0,0 +1,137 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bytes for the TShark output, encoding/binary for the capture header, fmt for errors,
+// io/ioutil for the temporary capture, os for the files, os/exec for running TShark, and strings for the errors.
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// linktypeNordicBLE is the pcap link type of the nRF Sniffer for Bluetooth LE.
+const linktypeNordicBLE = 272
+
+// emptyCapture returns the path of a temporary pcap file with no packets, used to make TShark compile its arguments.
+func emptyCapture() (string, error) {
+	file, err := ioutil.TempFile("", "ble_sniff_*.pcap")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// pcap global header: magic, version 2.4, timezone, accuracy, snapshot length and link type.
+	header := []uint32{0xa1b2c3d4, 0x00040002, 0, 0, 65535, linktypeNordicBLE}
+	if err = binary.Write(file, binary.LittleEndian, header); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// validateTShark checks the TShark command can be found and accepts the display filter, the pcap file and the interface.
+func (c *SnifferContext) validateTShark(args []string) error {
+	if _, err := exec.LookPath(c.TShark); err != nil {
+		return fmt.Errorf("could not find %s: %v", c.TShark, err)
+	}
+
+	if c.PcapFile != "" {
+		if _, err := os.Stat(c.PcapFile); err != nil {
+			return err
+		}
+	} else {
+		// Make sure the capture interface is known to TShark.
+		out, err := exec.Command(c.TShark, "-D").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("could not list the TShark interfaces: %v", err)
+		} else if !strings.Contains(string(out), c.Interface) {
+			return fmt.Errorf("interface '%s' not found by %s", c.Interface, c.TShark)
+		}
+	}
+
+	// Let TShark compile the display filter against an empty capture.
+	if c.Filter != "" {
+		capture, err := emptyCapture()
+		if err != nil {
+			return err
+		}
+		defer os.Remove(capture)
+
+		if out, err := exec.Command(c.TShark, "-r", capture, "-Y", c.Filter).CombinedOutput(); err != nil {
+			return fmt.Errorf("invalid display filter '%s': %s", c.Filter, bytes.TrimSpace(out))
+		}
+	}
+
+	return nil
+}
+
+// validateOutputs checks the output destinations can be created, without truncating or leaving behind any file.
+func (c *SnifferContext) validateOutputs(mod *Sniffer) (error, *SnifferContext) {
+	var err error
+
+	if err, c.SplitByDevice = mod.BoolParam("ble.sniff.output.split_by_device"); err != nil {
+		return err, c
+	} else if err, c.Output = mod.StringParam("ble.sniff.output"); err != nil {
+		return err, c
+	} else if c.SplitByDevice {
+		// The directory of the per-device files is created on start, only a pipe is not allowed.
+		if isNamedPipe(c.Output) {
+			return fmt.Errorf("ble.sniff.output can't be a named pipe when split by device"), c
+		}
+	} else if c.Output != "" && !isNamedPipe(c.Output) {
+		if err = checkWritable(c.Output); err != nil {
+			return err, c
+		}
+	}
+
+	var rotate_size string
+	if err, rotate_size = mod.StringParam("ble.sniff.output.rotate.size"); err != nil {
+		return err, c
+	} else if c.RotateSize, err = parseSize(rotate_size); err != nil {
+		return err, c
+	} else if err, c.RotateInterval = mod.durationParam("ble.sniff.output.rotate.interval"); err != nil {
+		return err, c
+	}
+
+	// The bucket isn't contacted, only the configuration is checked.
+	if err, c.S3 = mod.StringParam("ble.sniff.output.s3"); err != nil {
+		return err, c
+	} else if c.S3 != "" {
+		if err = c.checkS3(); err != nil {
+			return err, c
+		}
+	}
+
+	if err, c.SQLite = mod.StringParam("ble.sniff.sqlite"); err != nil {
+		return err, c
+	} else if c.SQLite != "" {
+		if err = checkWritable(c.SQLite); err != nil {
+			return err, c
+		}
+	}
+
+	return nil, c
+}
+
+// checkWritable checks a file can be opened for writing, removing it if it didn't exist before.
+func checkWritable(path string) error {
+	_, err := os.Stat(path)
+	existed := err == nil
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	if !existed {
+		return os.Remove(path)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the big-endian values, encoding/hex for the identifiers,
+// fmt for errors and formatted strings, and strings for building the URLs.
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Eddystone frame types, as defined by the Eddystone protocol specification.
+const (
+	EDDYSTONE_UID = 0x00
+	EDDYSTONE_URL = 0x10
+	EDDYSTONE_TLM = 0x20
+	EDDYSTONE_EID = 0x30
+)
+
+// eddystoneSchemes are the URL scheme prefixes of Eddystone-URL frames.
+var eddystoneSchemes = []string{"http://www.", "https://www.", "http://", "https://"}
+
+// eddystoneExpansions are the text expansions of the encoded Eddystone-URL bytes.
+var eddystoneExpansions = []string{
+	".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+	".com", ".org", ".edu", ".net", ".info", ".biz", ".gov",
+}
+
+// decodeEddystoneURL expands an encoded Eddystone-URL.
+func decodeEddystoneURL(scheme byte, encoded []byte) (string, error) {
+	if int(scheme) >= len(eddystoneSchemes) {
+		return "", fmt.Errorf("unknown Eddystone-URL scheme 0x%02x", scheme)
+	}
+
+	url := strings.Builder{}
+	url.WriteString(eddystoneSchemes[scheme])
+	for _, b := range encoded {
+		if int(b) < len(eddystoneExpansions) {
+			url.WriteString(eddystoneExpansions[b])
+		} else if b > 0x20 && b < 0x7f {
+			url.WriteByte(b)
+		} else {
+			return "", fmt.Errorf("invalid Eddystone-URL byte 0x%02x", b)
+		}
+	}
+	return url.String(), nil
+}
+
+// decodeEddystone decodes the UID, URL, TLM and EID frames of the Eddystone service data.
+func decodeEddystone(data []byte) (SniffData, string, error) {
+	if len(data) < 2 {
+		return nil, "", fmt.Errorf("Eddystone frame too short")
+	}
+
+	switch frame := data[0]; frame {
+	case EDDYSTONE_UID:
+		if len(data) < 18 {
+			return nil, "", fmt.Errorf("Eddystone-UID frame too short")
+		}
+		namespace := hex.EncodeToString(data[2:12])
+		instance := hex.EncodeToString(data[12:18])
+		return SniffData{
+			"frame":     "UID",
+			"tx_power":  int8(data[1]),
+			"namespace": namespace,
+			"instance":  instance,
+		}, fmt.Sprintf("Eddystone-UID %s/%s", namespace, instance), nil
+
+	case EDDYSTONE_URL:
+		if len(data) < 3 {
+			return nil, "", fmt.Errorf("Eddystone-URL frame too short")
+		}
+		url, err := decodeEddystoneURL(data[2], data[3:])
+		if err != nil {
+			return nil, "", err
+		}
+		return SniffData{
+			"frame":    "URL",
+			"tx_power": int8(data[1]),
+			"url":      url,
+		}, fmt.Sprintf("Eddystone-URL %s", url), nil
+
+	case EDDYSTONE_TLM:
+		// Only the unencrypted version 0 is decoded.
+		if len(data) < 14 || data[1] != 0x00 {
+			return nil, "", fmt.Errorf("unsupported Eddystone-TLM frame")
+		}
+		battery := binary.BigEndian.Uint16(data[2:4])
+		temperature := float64(int16(binary.BigEndian.Uint16(data[4:6]))) / 256
+		return SniffData{
+			"frame":       "TLM",
+			"battery_mv":  battery,
+			"temperature": temperature,
+			"adv_count":   binary.BigEndian.Uint32(data[6:10]),
+			"uptime":      float64(binary.BigEndian.Uint32(data[10:14])) / 10,
+		}, fmt.Sprintf("Eddystone-TLM battery=%dmV temperature=%.1fC", battery, temperature), nil
+
+	case EDDYSTONE_EID:
+		if len(data) < 10 {
+			return nil, "", fmt.Errorf("Eddystone-EID frame too short")
+		}
+		eid := hex.EncodeToString(data[2:10])
+		return SniffData{
+			"frame":    "EID",
+			"tx_power": int8(data[1]),
+			"eid":      eid,
+		}, fmt.Sprintf("Eddystone-EID %s", eid), nil
+
+	default:
+		return nil, "", fmt.Errorf("unknown Eddystone frame type 0x%02x", frame)
+	}
+}
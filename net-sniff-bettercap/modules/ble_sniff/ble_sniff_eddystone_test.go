@@ -0,0 +1,45 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func TestDecodeEddystoneURL(t *testing.T) {
+	// https://www.google.com/
+	data := []byte{0x10, 0xeb, 0x01, 'g', 'o', 'o', 'g', 'l', 'e', 0x00}
+
+	decoded, _, err := decodeEddystone(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["url"] != "https://www.google.com/" {
+		t.Errorf("expected https://www.google.com/, got %v", decoded["url"])
+	}
+	if decoded["tx_power"] != int8(-21) {
+		t.Errorf("expected tx power -21, got %v", decoded["tx_power"])
+	}
+}
+
+func TestDecodeEddystoneTLM(t *testing.T) {
+	data := []byte{0x20, 0x00, 0x0b, 0xb8, 0x17, 0x80, 0x00, 0x00, 0x00, 0x2a, 0x00, 0x00, 0x00, 0x64}
+
+	decoded, _, err := decodeEddystone(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["battery_mv"] != uint16(3000) {
+		t.Errorf("expected 3000 mV, got %v", decoded["battery_mv"])
+	}
+	if decoded["temperature"] != 23.5 {
+		t.Errorf("expected 23.5 C, got %v", decoded["temperature"])
+	}
+	if decoded["adv_count"] != uint32(42) {
+		t.Errorf("expected 42 advertisements, got %v", decoded["adv_count"])
+	}
+}
+
+func TestDecodeEddystoneTruncated(t *testing.T) {
+	if _, _, err := decodeEddystone([]byte{0x00, 0xeb, 0x01}); err == nil {
+		t.Error("expected an error for a truncated Eddystone-UID frame")
+	}
+}
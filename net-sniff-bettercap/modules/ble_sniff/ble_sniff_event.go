@@ -2,26 +2,141 @@
 package ble_sniff
 
 // Importing necessary packages:
-// fmt for formatted I/O operations, time for time-related functionalities,
-// and the bettercap session package for session management.
+// fmt for formatted I/O operations, strings for protocol names, sync for guarding the handlers list,
+// sync/atomic for the compatibility flag and the tag, time for time-related functionalities,
+// the bettercap session package for session management and net_sniff for its event type.
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/bettercap/bettercap/modules/net_sniff"
 	"github.com/bettercap/bettercap/session"
 )
 
 // SniffData defines a map with string keys and interface{} values to store arbitrary sniffing data.
 type SniffData map[string]interface{}
 
+// EventHandler is a callback invoked with every event pushed by the sniffer.
+type EventHandler func(e SnifferEvent)
+
+// Declaring the handlers notified by the deprecated SnifferEvent.Push, the running sniffers, along with the lock
+// guarding them. The events pushed by a sniffer only reach its own handlers.
+var (
+	pushHandlersLock = sync.RWMutex{}             // Lock guarding the handlers map.
+	pushHandlersID   = 0                          // Identifier assigned to the last added handler.
+	pushHandlers     = make(map[int]EventHandler) // Handlers keyed by their identifier.
+)
+
+// addPushHandler registers a handler for the events of SnifferEvent.Push and returns its identifier.
+func addPushHandler(handler EventHandler) int {
+	pushHandlersLock.Lock()
+	defer pushHandlersLock.Unlock()
+
+	pushHandlersID++
+	pushHandlers[pushHandlersID] = handler
+	return pushHandlersID
+}
+
+// removePushHandler unregisters the handler with the given identifier.
+func removePushHandler(id int) {
+	pushHandlersLock.Lock()
+	defer pushHandlersLock.Unlock()
+
+	delete(pushHandlers, id)
+}
+
+// notifyPushHandlers passes an event of SnifferEvent.Push to the registered handlers.
+func notifyPushHandlers(e SnifferEvent) {
+	pushHandlersLock.RLock()
+	defer pushHandlersLock.RUnlock()
+	for _, handler := range pushHandlers {
+		handler(e)
+	}
+}
+
+// addEventHandler registers a handler for the events pushed by the module and returns its identifier.
+func (mod *Sniffer) addEventHandler(handler EventHandler) int {
+	mod.handlersLock.Lock()
+	defer mod.handlersLock.Unlock()
+
+	if mod.handlers == nil {
+		mod.handlers = make(map[int]EventHandler)
+	}
+	mod.handlersID++
+	mod.handlers[mod.handlersID] = handler
+	return mod.handlersID
+}
+
+// removeEventHandler unregisters the handler with the given identifier.
+func (mod *Sniffer) removeEventHandler(id int) {
+	mod.handlersLock.Lock()
+	defer mod.handlersLock.Unlock()
+
+	delete(mod.handlers, id)
+}
+
+// compatMode is set to 1 when events must be pushed with the same shape used by the net.sniff module.
+var compatMode int32
+
+// setCompatMode enables or disables the net.sniff compatible events.
+func setCompatMode(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&compatMode, 1)
+	} else {
+		atomic.StoreInt32(&compatMode, 0)
+	}
+}
+
+// eventTag holds the tag native events are pushed with.
+var eventTag atomic.Value
+
+// setEventTag sets the tag of the native events.
+func setEventTag(tag string) {
+	eventTag.Store(tag)
+}
+
+// getEventTag returns the tag of the native events, "ble.sniff" unless configured otherwise.
+func getEventTag() string {
+	if tag, ok := eventTag.Load().(string); ok && tag != "" {
+		return tag
+	}
+	return "ble.sniff"
+}
+
+// EventVersion is the version of the schema of the serialized events, bumped whenever a field is renamed,
+// removed or changes meaning so that the consumers can adapt. Adding an optional field doesn't change it.
+//
+// Version 1:
+//
+//	version    int     version of the schema of the event
+//	time       string  capture time of the packet, RFC 3339
+//	protocol   string  kind of packet, such as "BLE ADVERT"
+//	from       string  source address
+//	to         string  destination address, "BROADCAST" for the advertisements but the directed ones
+//	message    string  human readable description
+//	data       object  decoded payload, its keys depend on the protocol and the message
+//	pdu        string  advertising PDU type, omitted for the data channel packets
+//	session_id string  identifier of the capture session, omitted if not set
+//	location   object  lat, lon, alt and time of the GPS fix, omitted without a recent fix
+//	raw_hex    string  hexdump of the packet, omitted unless ble.sniff.hexdump is true
+const EventVersion = 1
+
 // SnifferEvent struct represents a single sniffing event with various details about the captured packet.
 type SnifferEvent struct {
-	PacketTime  time.Time   `json:"time"`     // Time when the packet was captured.
-	Protocol    string      `json:"protocol"` // Protocol used in the packet.
-	Source      string      `json:"from"`     // Source address of the packet.
-	Destination string      `json:"to"`       // Destination address of the packet.
-	Message     string      `json:"message"`  // Formatted message string related to the packet.
-	Data        interface{} `json:"data"`     // Arbitrary data associated with the packet.
+	Version     int              `json:"version"`              // Version of the schema of the event, see EventVersion.
+	PacketTime  time.Time        `json:"time"`                 // Time when the packet was captured.
+	Protocol    string           `json:"protocol"`             // Protocol used in the packet.
+	Source      string           `json:"from"`                 // Source address of the packet.
+	Destination string           `json:"to"`                   // Destination address of the packet.
+	Message     string           `json:"message"`              // Formatted message string related to the packet.
+	Data        interface{}      `json:"data"`                 // Arbitrary data associated with the packet.
+	PDU         string           `json:"pdu,omitempty"`        // Name of the advertising PDU type, empty for data channel packets.
+	SessionID   string           `json:"session_id,omitempty"` // Identifier of the capture session the event belongs to.
+	Location    *SnifferLocation `json:"location,omitempty"`   // Position of the sniffer when the event was pushed, nil without a recent GPS fix.
+	RawHex      string           `json:"raw_hex,omitempty"`    // Hexdump of the packet the event was decoded from, only set by ble.sniff.hexdump.
 }
 
 // NewSnifferEvent constructs and returns a new SnifferEvent.
@@ -29,18 +144,155 @@ type SnifferEvent struct {
 // arbitrary data, and a formatted message string.
 func NewSnifferEvent(t time.Time, proto string, src string, dst string, data interface{}, format string, args ...interface{}) SnifferEvent {
 	return SnifferEvent{
-		PacketTime:  t,                                // Setting the packet time.
-		Protocol:    proto,                            // Setting the protocol used.
-		Source:      src,                              // Setting the source address.
-		Destination: dst,                              // Setting the destination address.
-		Message:     fmt.Sprintf(format, args...),     // Formatting and setting the message.
-		Data:        data,                             // Associating arbitrary data with the event.
+		Version:     EventVersion,                 // Setting the version of the schema.
+		PacketTime:  t,                            // Setting the packet time.
+		Protocol:    proto,                        // Setting the protocol used.
+		Source:      src,                          // Setting the source address.
+		Destination: dst,                          // Setting the destination address.
+		Message:     fmt.Sprintf(format, args...), // Formatting and setting the message.
+		Data:        data,                         // Associating arbitrary data with the event.
 	}
 }
 
-// Push method of SnifferEvent pushes the event to the session's event manager.
-func (e SnifferEvent) Push() {
-	session.I.Events.Add("ble.sniff", e) // Adding the event to the session's event manager with a specific tag.
-	session.I.Refresh()                  // Refreshing the session interface to reflect the new event.
+// WithPDU returns a copy of the event labeled with the name of the advertising PDU type it was decoded from.
+func (e SnifferEvent) WithPDU(label string) SnifferEvent {
+	e.PDU = label
+	return e
 }
 
+// WithRawHex returns a copy of the event carrying the hexdump of the packet it was decoded from.
+func (e SnifferEvent) WithRawHex(rawHex string) SnifferEvent {
+	e.RawHex = rawHex
+	return e
+}
+
+// Compat converts the event to the shape produced by the net.sniff module, returning its tag and the event.
+// The JSON keys are the same in both schemas and map one to one:
+//
+//	time       -> time            (PacketTime)
+//	protocol   -> protocol        (Protocol, lowercased with spaces replaced by dots, "BLE ADVERT" becomes "ble.advert")
+//	from       -> from            (Source)
+//	to         -> to              (Destination)
+//	message    -> message         (Message)
+//	data       -> data            (Data)
+//	pdu        -> data.pdu        (PDU, added to the data when it is a SniffData)
+//	session_id -> data.session_id (SessionID, added to the data when it is a SniffData)
+//	location   -> data.location   (Location, added to the data when it is a SniffData)
+//	raw_hex    -> data.raw_hex    (RawHex, added to the data when it is a SniffData)
+//
+// while the tag follows the "net.sniff.<protocol>" convention instead of being "ble.sniff" for every event.
+// The version isn't carried over, the events then following the schema of the net.sniff module.
+func (e SnifferEvent) Compat() (string, net_sniff.SnifferEvent) {
+	protocol := strings.ToLower(strings.Replace(e.Protocol, " ", ".", -1))
+
+	// net.sniff events have no PDU, session, location and hexdump fields, move them into a copy of the data.
+	data := e.Data
+	if sniff_data, ok := e.Data.(SniffData); ok && (e.PDU != "" || e.SessionID != "" || e.Location != nil || e.RawHex != "") {
+		merged := make(SniffData, len(sniff_data)+4)
+		for key, value := range sniff_data {
+			merged[key] = value
+		}
+		if e.PDU != "" {
+			merged["pdu"] = e.PDU
+		}
+		if e.SessionID != "" {
+			merged["session_id"] = e.SessionID
+		}
+		if e.Location != nil {
+			merged["location"] = e.Location
+		}
+		if e.RawHex != "" {
+			merged["raw_hex"] = e.RawHex
+		}
+		data = merged
+	}
+
+	return "net.sniff." + protocol, net_sniff.SnifferEvent{
+		PacketTime:  e.PacketTime,
+		Protocol:    protocol,
+		Source:      e.Source,
+		Destination: e.Destination,
+		Message:     e.Message,
+		Data:        data,
+	}
+}
+
+// EventSink receives the events decoded by the sniffer, in place of the session of the module.
+type EventSink interface {
+	Push(e SnifferEvent)
+}
+
+// pushToSession adds an event to the events of a session, with the net.sniff schema if compat is true
+// or with the given tag otherwise.
+func pushToSession(s *session.Session, compat bool, tag string, e SnifferEvent) {
+	if s == nil {
+		return
+	}
+
+	if compat {
+		// Adding the event with the same tag and type the net.sniff module would use.
+		compat_tag, compat_event := e.Compat()
+		s.Events.Add(compat_tag, compat_event)
+	} else {
+		s.Events.Add(tag, e) // Adding the event to the session's event manager with the configured tag.
+	}
+	s.Refresh() // Refreshing the session interface to reflect the new event.
+}
+
+// notifyHandlers passes an event to the handlers of the module, such as the output file writer.
+func (mod *Sniffer) notifyHandlers(e SnifferEvent) {
+	mod.handlersLock.RLock()
+	defer mod.handlersLock.RUnlock()
+	for _, handler := range mod.handlers {
+		handler(e)
+	}
+}
+
+// Push pushes an event to the session of the module, or to its sink if one was set with WithEventSink,
+// and then notifies the event handlers.
+func (mod *Sniffer) Push(e SnifferEvent) {
+	if e.SessionID == "" {
+		e.SessionID = mod.Ctx.SessionID
+	}
+	if e.Location == nil && mod.Ctx.gps != nil {
+		e.Location = mod.Ctx.gps.Location(time.Now())
+	}
+	// The addresses are replaced before the event reaches any sink.
+	if mod.Ctx.anonymizer != nil {
+		e = mod.Ctx.anonymizer.Event(e)
+	}
+	if mod.Stats != nil {
+		mod.Stats.countEvent(e)
+	}
+	// Only the display is rate limited, the event still reaches the output sinks.
+	if mod.display(e) {
+		// Only the displayed copy is colored, the outputs get the plain message.
+		shown := e
+		if mod.Ctx.Color {
+			shown = colorize(shown)
+		}
+		if mod.sink != nil {
+			mod.sink.Push(shown)
+		} else {
+			pushToSession(mod.Session, mod.Ctx.Compat, mod.Ctx.Tag, shown)
+		}
+	}
+	mod.notifyHandlers(e)
+}
+
+// pushAll pushes the events returned by the parsers.
+func (mod *Sniffer) pushAll(events []SnifferEvent) {
+	for _, e := range events {
+		mod.Push(e)
+	}
+}
+
+// Push method of SnifferEvent pushes the event to the global session's event manager, and to the handlers of every
+// running sniffer.
+//
+// Deprecated: kept for backward compatibility, the sniffer pushes its events with Sniffer.Push,
+// which uses the session the module was created with.
+func (e SnifferEvent) Push() {
+	pushToSession(session.I, atomic.LoadInt32(&compatMode) == 1, getEventTag(), e)
+	notifyPushHandlers(e)
+}
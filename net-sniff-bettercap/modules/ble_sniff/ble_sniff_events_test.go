@@ -0,0 +1,449 @@
+package ble_sniff
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadFixtures reads the BLE layers of the packets of a TShark JSON capture from testdata.
+func loadFixtures(t testing.TB, name string) []map[string]interface{} {
+	raw, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("error reading fixture %s: %v", name, err)
+	}
+
+	var packets []struct {
+		Source struct {
+			Layers map[string]interface{} `json:"layers"`
+		} `json:"_source"`
+	}
+	if err = json.Unmarshal(raw, &packets); err != nil {
+		t.Fatalf("error decoding fixture %s: %v", name, err)
+	}
+
+	layers := make([]map[string]interface{}, 0, len(packets))
+	for _, packet := range packets {
+		btle, ok := packet.Source.Layers["btle"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("fixture %s has a packet without BLE layer", name)
+		}
+		layers = append(layers, btle)
+	}
+	return layers
+}
+
+// expectedEvent describes an event produced by the parsers, the data only has to contain the listed keys.
+type expectedEvent struct {
+	message string
+	data    SniffData
+}
+
+func TestOnAdvertisementEvents(t *testing.T) {
+	packets := loadFixtures(t, "advertisements.json")
+
+	tests := []struct {
+		name   string
+		source string
+		pdu    string
+		events []expectedEvent
+	}{
+		{
+			name:   "connectable advertisement with name and manufacturer data",
+			source: "d4:3a:2c:11:8e:07",
+			pdu:    "ADV_IND",
+			events: []expectedEvent{
+				{"Flags LE General Discoverable, BR/EDR Not Supported", nil},
+				{`Local name "Thermo"`, SniffData{"name": "Thermo"}},
+				{"", SniffData{"company_id": uint16(0x004c), "data": "10:05:0b:1c:5e:a1:08"}},
+			},
+		},
+		{
+			name:   "Eddystone-URL beacon",
+			source: "c0:ff:ee:00:be:ef",
+			pdu:    "ADV_NONCONN_IND",
+			events: []expectedEvent{
+				{"Services 0xfeaa", nil},
+				{"Service 0xfeaa Eddystone-URL https://www.google.com/", SniffData{"url": "https://www.google.com/"}},
+			},
+		},
+		{
+			name:   "directed advertisement with TX power",
+			source: "00:1a:7d:da:71:13",
+			pdu:    "ADV_DIRECT_IND",
+			events: []expectedEvent{
+				{"TX power -8 dBm", SniffData{"tx_power": -8}},
+				{"Targeting public 11:22:33:44:55:66", SniffData{"target_type": AddressPublic}},
+			},
+		},
+	}
+
+	if len(packets) != len(tests) {
+		t.Fatalf("expected %d packets in the fixture, got %d", len(tests), len(packets))
+	}
+
+	for i, tt := range tests {
+		events := onAdvertisement(packets[i], nil, NewSnifferStats(), time.Now())
+		if len(events) != len(tt.events) {
+			t.Errorf("%s: expected %d events, got %d", tt.name, len(tt.events), len(events))
+			continue
+		}
+
+		for j, expected := range tt.events {
+			e := events[j]
+			if e.Protocol != "BLE ADVERT" || e.Source != tt.source || e.Destination != "BROADCAST" || e.PDU != tt.pdu {
+				t.Errorf("%s: event %d has unexpected header %s %s -> %s (%s)", tt.name, j, e.Protocol, e.Source, e.Destination, e.PDU)
+			}
+			if expected.message != "" && e.Message != expected.message {
+				t.Errorf("%s: event %d: expected message %q, got %q", tt.name, j, expected.message, e.Message)
+			}
+			data, _ := e.Data.(SniffData)
+			for key, value := range expected.data {
+				if data[key] != value {
+					t.Errorf("%s: event %d: expected %s=%v, got %v", tt.name, j, key, value, data[key])
+				}
+			}
+		}
+	}
+}
+
+func TestOnAdvertisementWithoutAddress(t *testing.T) {
+	btleData := map[string]interface{}{
+		"btcommon.eir_ad.advertising_data": map[string]interface{}{
+			"btcommon.eir_ad.entry": map[string]interface{}{
+				"btcommon.eir_ad.entry.type":        "0x09",
+				"btcommon.eir_ad.entry.device_name": "Thermo",
+			},
+		},
+	}
+
+	if events := onAdvertisement(btleData, nil, NewSnifferStats(), time.Now()); len(events) != 0 {
+		t.Errorf("expected no events without an advertising address, got %d", len(events))
+	}
+}
+
+func TestEventSchema(t *testing.T) {
+	packet_time := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	e := NewSnifferEvent(packet_time, "BLE ADVERT", "d4:3a:2c:11:8e:07", "BROADCAST", SniffData{"rssi": -60}, "RSSI %d", -60)
+	raw, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":1,"time":"2024-05-01T12:00:00Z","protocol":"BLE ADVERT","from":"d4:3a:2c:11:8e:07","to":"BROADCAST","message":"RSSI -60","data":{"rssi":-60}}`
+	if string(raw) != expected {
+		t.Errorf("unexpected serialized event:\n%s\nexpected:\n%s", raw, expected)
+	}
+
+	e = e.WithPDU("ADV_IND").WithRawHex("00000000  d6\n")
+	e.SessionID = "site1"
+	e.Location = &SnifferLocation{Latitude: 45.5, Longitude: 9.25, Altitude: 120, Time: packet_time}
+	if raw, err = json.Marshal(e); err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"version":1,"time":"2024-05-01T12:00:00Z","protocol":"BLE ADVERT","from":"d4:3a:2c:11:8e:07","to":"BROADCAST","message":"RSSI -60","data":{"rssi":-60},` +
+		`"pdu":"ADV_IND","session_id":"site1","location":{"lat":45.5,"lon":9.25,"alt":120,"time":"2024-05-01T12:00:00Z"},"raw_hex":"00000000  d6\n"}`
+	if string(raw) != expected {
+		t.Errorf("unexpected serialized event:\n%s\nexpected:\n%s", raw, expected)
+	}
+}
+
+func TestWriteEventVersion(t *testing.T) {
+	file, err := ioutil.TempFile(t.TempDir(), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx := &SnifferContext{Output: file.Name(), OutputFile: file}
+	if written, err := ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT"}); err != nil || !written {
+		t.Fatalf("expected the event to be written, got %v %v", written, err)
+	}
+
+	raw, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e SnifferEvent
+	if err = json.Unmarshal(raw, &e); err != nil {
+		t.Fatal(err)
+	} else if e.Version != EventVersion {
+		t.Errorf("expected version %d, got %d", EventVersion, e.Version)
+	}
+}
+
+func TestBufferedOutput(t *testing.T) {
+	quietLogs(t)
+
+	file, err := ioutil.TempFile(t.TempDir(), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx := &SnifferContext{Output: file.Name(), OutputFile: file, OutputFlush: 20 * time.Millisecond}
+	ctx.bufferOutput(4096)
+
+	if written, err := ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT"}); err != nil || !written {
+		t.Fatalf("expected the event to be written, got %v %v", written, err)
+	}
+	if raw, _ := ioutil.ReadFile(file.Name()); len(raw) != 0 {
+		t.Errorf("expected the event to be buffered, got %q", raw)
+	}
+
+	// The buffer is flushed on the interval.
+	deadline := time.Now().Add(time.Second)
+	for {
+		if raw, _ := ioutil.ReadFile(file.Name()); len(raw) > 0 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("expected the buffer to be flushed on the interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// And when stopped, even between two intervals.
+	ctx.OutputFlush = time.Hour
+	ctx.stopOutputFlusher()
+	ctx.bufferOutput(4096)
+	for i := 0; i < 3; i++ {
+		ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT"})
+	}
+	ctx.stopOutputFlusher()
+
+	raw, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(raw), "\n"); lines != 4 {
+		t.Errorf("expected 4 events in the output, got %d", lines)
+	}
+}
+
+// readGzipEvents decompresses an output file and decodes its events.
+func readGzipEvents(t *testing.T, name string) []SnifferEvent {
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("%s isn't compressed: %v", name, err)
+	}
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("error decompressing %s: %v", name, err)
+	}
+
+	events := make([]SnifferEvent, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var e SnifferEvent
+		if err = json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("error decoding %q from %s: %v", line, name, err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestGzipOutput(t *testing.T) {
+	quietLogs(t)
+
+	if name := gzipOutputName("events.json"); name != "events.json.gz" {
+		t.Errorf("expected events.json.gz, got %s", name)
+	} else if name = gzipOutputName("events.JSON.GZ"); name != "events.JSON.GZ" {
+		t.Errorf("expected the extension to be kept, got %s", name)
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "events.json.gz")
+	file, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &SnifferContext{
+		Output:       output,
+		OutputFile:   file,
+		OutputGzip:   true,
+		outputGzip:   gzip.NewWriter(file),
+		OutputFlush:  time.Hour,
+		RotateSize:   200,
+		outputOpened: time.Now(),
+	}
+	ctx.bufferOutput(4096)
+
+	const count = 5
+	for i := 0; i < count; i++ {
+		if written, err := ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT", Source: strings.Repeat("x", 100)}); err != nil || !written {
+			t.Fatalf("expected the event to be written, got %v %v", written, err)
+		}
+		// Rotated files are named by the millisecond.
+		time.Sleep(2 * time.Millisecond)
+	}
+	ctx.Close()
+
+	// The rotated files keep the extension, and every file is a complete gzip stream.
+	rotated, err := filepath.Glob(filepath.Join(dir, "events.json-*.gz"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rotated) == 0 {
+		t.Fatal("expected the output to be rotated")
+	}
+	sort.Strings(rotated)
+
+	events := make([]SnifferEvent, 0, count)
+	for _, name := range append(rotated, output) {
+		events = append(events, readGzipEvents(t, name)...)
+	}
+	if len(events) != count {
+		t.Fatalf("expected %d events, got %d", count, len(events))
+	}
+	for _, e := range events {
+		if e.Protocol != "BLE HEARTBEAT" || e.Version != EventVersion {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+}
+
+func TestRotationFailure(t *testing.T) {
+	quietLogs(t)
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "events.json")
+	file, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &SnifferContext{
+		Output:       output,
+		OutputFile:   file,
+		OutputFlush:  time.Hour,
+		RotateSize:   200,
+		outputOpened: time.Now(),
+	}
+	ctx.bufferOutput(4096)
+	write := func() (bool, error) {
+		return ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT", Source: strings.Repeat("x", 150)})
+	}
+
+	// The file can't be renamed once deleted, it is reopened and the events are still written.
+	if _, err = write(); err != nil {
+		t.Fatal(err)
+	} else if err = os.Remove(output); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := write(); err != nil || !written {
+		t.Fatalf("expected the event to be written despite the failed rotation, got %v %v", written, err)
+	} else if err = ctx.FlushOutput(); err != nil {
+		t.Fatal(err)
+	}
+	if raw, err := ioutil.ReadFile(output); err != nil || strings.Count(string(raw), "\n") != 1 {
+		t.Errorf("expected the event in the reopened file, got %q %v", raw, err)
+	}
+
+	// Without its directory the file can't be reopened either, and every write fails.
+	if err = os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if written, err := write(); err == nil || written {
+			t.Errorf("expected the lost output to be reported, got %v %v", written, err)
+		}
+	}
+
+	// The flusher is stopped even though the file is lost.
+	ctx.Close()
+	if ctx.outputQuit != nil {
+		t.Error("expected the flusher to be stopped")
+	}
+}
+
+func TestPruneRotated(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "capture[1].json")
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	ctx := &SnifferContext{Output: output, RotateKeep: 2}
+	names := []string{"capture[1].json-notes.txt", "capture[1].json-1.bak", "capture[1].json"}
+	for i := 0; i < 4; i++ {
+		names = append(names, filepath.Base(ctx.rotatedName(start.Add(time.Duration(i)*time.Minute))))
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the oldest rotated files are deleted, the other files whose name starts like the output are kept.
+	if err := ctx.pruneRotated(); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if deleted := i == 3 || i == 4; deleted != os.IsNotExist(err) {
+			t.Errorf("expected %s deleted to be %v, got %v", name, deleted, err)
+		}
+	}
+}
+
+func TestGzipOutputUnbuffered(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "events.json.gz")
+	file, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx := &SnifferContext{Output: output, OutputFile: file, OutputGzip: true, outputGzip: gzip.NewWriter(file)}
+	if written, err := ctx.WriteEvent(SnifferEvent{Protocol: "BLE HEARTBEAT"}); err != nil || !written {
+		t.Fatalf("expected the event to be written, got %v %v", written, err)
+	}
+
+	// Without buffering the event can be decompressed right away, before the end of the stream is written.
+	raw, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := make([]byte, 256)
+	n, _ := reader.Read(line)
+	if !strings.Contains(string(line[:n]), "BLE HEARTBEAT") {
+		t.Errorf("expected the event to be flushed, got %q", line[:n])
+	}
+}
+
+func TestEventHandlersPerSniffer(t *testing.T) {
+	a, b := newBenchSniffer(discardSink{}), newBenchSniffer(discardSink{})
+	subs := make([]<-chan SnifferEvent, 0, 2)
+	for _, mod := range []*Sniffer{a, b} {
+		mod.addEventHandler(mod.onEventSubscribers)
+		subs = append(subs, mod.Subscribe())
+		id := addPushHandler(mod.notifyHandlers)
+		defer removePushHandler(id)
+	}
+
+	// The events of a sniffer only reach its own subscribers.
+	a.Push(NewSnifferEvent(time.Now(), "BLE ADVERT", "aa:bb:cc:dd:ee:ff", "BROADCAST", SniffData{}, "advert"))
+	if len(subs[0]) != 1 || len(subs[1]) != 0 {
+		t.Errorf("expected the event to only reach the first sniffer, got %d and %d", len(subs[0]), len(subs[1]))
+	}
+
+	// The deprecated SnifferEvent.Push reaches every running sniffer.
+	NewSnifferEvent(time.Now(), "BLE ADVERT", "aa:bb:cc:dd:ee:ff", "BROADCAST", SniffData{}, "advert").Push()
+	if len(subs[0]) != 2 || len(subs[1]) != 1 {
+		t.Errorf("expected the event to reach both sniffers, got %d and %d", len(subs[0]), len(subs[1]))
+	}
+}
@@ -0,0 +1,262 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, strings for comparing the addresses, time for the chain timeout,
+// and gatt for handling Bluetooth Low Energy attributes.
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bettercap/gatt"
+)
+
+// auxChainTimeout is the time after which a chain still waiting for AUX packets is flushed as incomplete.
+const auxChainTimeout = 2 * time.Second
+
+// auxChain struct collects the fragments of a BLE 5 extended advertisement, which starts with an ADV_EXT_IND on a
+// primary channel pointing to an AUX_ADV_IND, itself followed by AUX_CHAIN_IND packets as long as they carry an AuxPtr.
+type auxChain struct {
+	Address   string         // Advertising address, only carried by the first packets of the chain.
+	SID       uint64         // Advertising set identifier.
+	DID       uint64         // Advertising data identifier, changed by the advertiser when the payload changes.
+	Entries   []interface{}  // AD structures collected from the fragments.
+	Fragments int            // Count of fragments carrying advertising data.
+	Started   time.Time      // Time when the first packet of the chain was seen.
+	Updated   time.Time      // Time when the last packet of the chain was seen.
+	Signal    *SnifferSignal // Signal information of the advertiser, if known.
+	Header    extendedHeader // Fields of the extended headers of the packets of the chain.
+}
+
+// involves returns true if the address, or the pseudonym given by the anonymizer, is the advertiser of the chain
+// or the target of its directed advertisements.
+func (chain *auxChain) involves(address string, a *anonymizer) bool {
+	for _, value := range []string{chain.Address, chain.Header.TargetAddress} {
+		if value != "" && a.Matches(value, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// advertisingSet extracts the advertising set and data identifiers from the ADI field of an extended header.
+func advertisingSet(btleData map[string]interface{}) (uint64, uint64, bool) {
+	sid_value, ok := findField(btleData, "btle.advertising_data_info.sid")
+	if !ok {
+		return 0, 0, false
+	}
+	did_value, ok := findField(btleData, "btle.advertising_data_info.did")
+	if !ok {
+		return 0, 0, false
+	}
+
+	sid_string, _ := sid_value.(string)
+	did_string, _ := did_value.(string)
+	sid, err := parseUint(sid_string, 8)
+	if err != nil {
+		return 0, 0, false
+	}
+	did, err := parseUint(did_string, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return sid, did, true
+}
+
+// hasAuxPointer returns true if the extended header points to a further AUX packet.
+func hasAuxPointer(btleData map[string]interface{}) bool {
+	if _, found := findField(btleData, "btle.aux_pointer"); found {
+		return true
+	}
+	_, found := findField(btleData, "btle.aux_pointer_tree")
+	return found
+}
+
+// manufacturerData collects the manufacturer specific data of the AD structures.
+func manufacturerData(entries []map[string]interface{}) []SniffData {
+	list := make([]SniffData, 0)
+	for _, entry := range entries {
+		company_code_string, ok := entry["btcommon.eir_ad.entry.company_id"].(string)
+		if !ok {
+			continue
+		}
+		company_code, _ := parseHexUint(company_code_string, 16)
+		data, _ := entry["btcommon.eir_ad.entry.data"].(string)
+
+		list = append(list, SniffData{
+			"company_id": uint16(company_code),
+			"company":    gatt.CompanyIdents[uint16(company_code)],
+			"data":       data,
+		})
+	}
+	return list
+}
+
+// companyID returns the company identifier of the last manufacturer specific data of the AD structures,
+// without decoding the rest of the structure like manufacturerData.
+func companyID(entries []map[string]interface{}) (uint16, bool) {
+	id, found := uint16(0), false
+	for _, entry := range entries {
+		if company_code_string, ok := entry["btcommon.eir_ad.entry.company_id"].(string); ok {
+			if company_code, err := parseHexUint(company_code_string, 16); err == nil {
+				id, found = uint16(company_code), true
+			}
+		}
+	}
+	return id, found
+}
+
+// onExtendedAdvertisement collects the fragments of extended advertisements by advertising set, emitting a single
+// event once the last packet of a chain is seen. Fragments are merged at the AD structure level, as decoded by TShark.
+func (mod *Sniffer) onExtendedAdvertisement(btleData map[string]interface{}, signal *SnifferSignal, t time.Time) {
+	mod.auxChainsLock.Lock()
+	defer mod.auxChainsLock.Unlock()
+
+	// Give up on the chains which stopped receiving packets.
+	mod.flushAuxChainsUnlocked(t, false)
+
+	address, has_address := btleData["btle.advertising_address"].(string)
+	entries := eirEntries(btleData)
+	header, has_header := parseExtendedHeader(btleData)
+
+	sid, did, ok := advertisingSet(btleData)
+	if !ok {
+		// Without an ADI the payload can't be part of a chain.
+		if len(entries) > 0 {
+			chain := &auxChain{Address: address, Started: t, Updated: t, Signal: signal, Header: header}
+			chain.add(entries)
+			mod.onAuxChain(chain, true)
+		}
+		return
+	}
+
+	key := fmt.Sprintf("%d/%d", sid, did)
+	chain, found := mod.auxChains[key]
+	if found && has_address && len(entries) > 0 && chain.Fragments > 0 {
+		// A new AUX_ADV_IND for the same set while the previous chain was still missing packets.
+		mod.onAuxChain(chain, false)
+		found = false
+	}
+	if !found {
+		chain = &auxChain{SID: sid, DID: did, Started: t}
+		mod.auxChains[key] = chain
+	}
+
+	if has_address {
+		chain.Address = address
+	}
+	if signal != nil {
+		chain.Signal = signal
+	}
+	if has_header {
+		chain.Header.merge(header)
+	}
+	chain.Updated = t
+	chain.add(entries)
+
+	// The chain ends with the first packet not pointing to another one.
+	if !hasAuxPointer(btleData) {
+		if chain.Fragments > 0 {
+			mod.onAuxChain(chain, true)
+		}
+		delete(mod.auxChains, key)
+	}
+}
+
+// add appends the AD structures of a fragment to the chain.
+func (c *auxChain) add(entries []map[string]interface{}) {
+	if len(entries) == 0 {
+		return
+	}
+	for _, entry := range entries {
+		c.Entries = append(c.Entries, entry)
+	}
+	c.Fragments++
+}
+
+// flushAuxChains emits the chains not updated within the timeout as incomplete, or all of them if all is true.
+func (mod *Sniffer) flushAuxChains(t time.Time, all bool) {
+	mod.auxChainsLock.Lock()
+	defer mod.auxChainsLock.Unlock()
+
+	mod.flushAuxChainsUnlocked(t, all)
+}
+
+// flushAuxChainsUnlocked is flushAuxChains for callers already holding the lock.
+func (mod *Sniffer) flushAuxChainsUnlocked(t time.Time, all bool) {
+	for key, chain := range mod.auxChains {
+		if all || t.Sub(chain.Updated) > auxChainTimeout {
+			if chain.Fragments > 0 {
+				mod.onAuxChain(chain, false)
+			}
+			delete(mod.auxChains, key)
+		}
+	}
+}
+
+// onAuxChain runs the reassembled payload of a chain through the AD structure parsers and pushes a single event.
+func (mod *Sniffer) onAuxChain(chain *auxChain, complete bool) {
+	// Rebuild the BLE data as if the whole payload was carried by a single packet.
+	btleData := map[string]interface{}{
+		"btle.advertising_address": chain.Address,
+		"btcommon.eir_ad.advertising_data": map[string]interface{}{
+			"btcommon.eir_ad.entry": chain.Entries,
+		},
+	}
+
+	name, uuids := parseDeviceInfo(btleData)
+	if chain.Address != "" {
+		mod.Stats.MergeDeviceInfo(chain.Address, name, uuids)
+	}
+
+	// The chains of the other devices are dropped while following one.
+	if follow := mod.followed(); follow != "" && !chain.involves(follow, mod.Ctx.anonymizer) {
+		return
+	}
+
+	event_data := SniffData{
+		"sid":          chain.SID,
+		"did":          chain.DID,
+		"fragments":    chain.Fragments,
+		"complete":     complete,
+		"name":         name,
+		"uuids":        uuids,
+		"manufacturer": manufacturerData(eirEntries(btleData)),
+	}
+	chain.Header.addTo(event_data)
+	if chain.Signal != nil {
+		event_data["rssi"] = chain.Signal.RSSI
+		event_data["rssi_smoothed"] = chain.Signal.SmoothedRSSI
+		event_data["proximity"] = chain.Signal.Proximity
+	}
+
+	source := chain.Address
+	if source == "" {
+		source = "UNKNOWN"
+	}
+
+	status := "complete"
+	if !complete {
+		status = "incomplete"
+	}
+
+	// A directed advertising set is reported to its target.
+	destination := "BROADCAST"
+	if mod.Ctx.DirectedTarget && chain.Header.TargetAddress != "" {
+		destination = strings.ToLower(chain.Header.TargetAddress)
+	}
+
+	// Create a new SnifferEvent with protocol "BLE EXT ADVERT" and push it.
+	mod.Push(NewSnifferEvent(chain.Updated,
+		"BLE EXT ADVERT",
+		source,
+		destination,
+		event_data,
+		"Extended advertisement set %d with %d fragments (%s)",
+		chain.SID,
+		chain.Fragments,
+		status,
+	).WithPDU(pduTypeName(PDU_ADV_EXT_IND)))
+}
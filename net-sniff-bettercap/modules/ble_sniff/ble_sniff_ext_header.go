@@ -0,0 +1,136 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strconv for the TX power.
+import (
+	"strconv"
+)
+
+// Declaring the bits of the flags of the extended advertising header, announcing which optional fields follow.
+const (
+	EXT_HEADER_ADVA      = 0x01
+	EXT_HEADER_TARGETA   = 0x02
+	EXT_HEADER_CTE_INFO  = 0x04
+	EXT_HEADER_ADI       = 0x08
+	EXT_HEADER_AUX_PTR   = 0x10
+	EXT_HEADER_SYNC_INFO = 0x20
+	EXT_HEADER_TX_POWER  = 0x40
+)
+
+// extHeaderFields names the optional fields of the extended advertising header, in the order of their flags.
+var extHeaderFields = []struct {
+	Flag uint8
+	Name string
+}{
+	{EXT_HEADER_ADVA, "AdvA"},
+	{EXT_HEADER_TARGETA, "TargetA"},
+	{EXT_HEADER_CTE_INFO, "CTEInfo"},
+	{EXT_HEADER_ADI, "ADI"},
+	{EXT_HEADER_AUX_PTR, "AuxPtr"},
+	{EXT_HEADER_SYNC_INFO, "SyncInfo"},
+	{EXT_HEADER_TX_POWER, "TxPower"},
+}
+
+// extAdvModes names the advertising modes of the extended advertising PDUs.
+var extAdvModes = map[uint64]string{
+	0: "non-connectable non-scannable",
+	1: "connectable",
+	2: "scannable",
+}
+
+// extendedHeader struct holds the fields of the extended advertising header of a packet, or the ones collected from
+// the packets of a chain.
+type extendedHeader struct {
+	Flags         uint8  // Flags announcing the optional fields present.
+	Mode          string // Advertising mode, if known.
+	TargetAddress string // Address of the device the advertisement is meant for, if present.
+	TxPower       int    // Transmit power in dBm, if present.
+}
+
+// findString returns the first of the given fields found in the BLE data holding a string.
+func findString(data map[string]interface{}, keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, found := findField(data, key); found {
+			if s, ok := value.(string); ok {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// parseExtendedHeader extracts the extended advertising header of an extended advertising PDU. Its optional fields
+// are only read when announced by the header flags, returning false if the packet has no such header.
+func parseExtendedHeader(btleData map[string]interface{}) (extendedHeader, bool) {
+	header := extendedHeader{}
+
+	flags_string, ok := findString(btleData, "btle.extended_advertising_flags", "btle.extended_advertising_header.flags")
+	if !ok {
+		return header, false
+	}
+	flags, err := parseUint(flags_string, 8)
+	if err != nil {
+		return header, false
+	}
+	header.Flags = uint8(flags)
+
+	if mode_string, ok := findString(btleData, "btle.extended_advertising_mode", "btle.extended_advertising_header.mode"); ok {
+		if mode, err := parseUint(mode_string, 8); err == nil {
+			header.Mode = extAdvModes[mode]
+		}
+	}
+	if header.Flags&EXT_HEADER_TARGETA != 0 {
+		header.TargetAddress, _ = findString(btleData, "btle.target_address", "btle.extended_advertising_header.target_address")
+	}
+	if header.Flags&EXT_HEADER_TX_POWER != 0 {
+		power_string, _ := findString(btleData, "btle.extended_advertising_tx_power", "btle.extended_advertising_header.tx_power")
+		if power, err := strconv.ParseInt(power_string, 10, 8); err == nil {
+			header.TxPower = int(power)
+		} else {
+			// The TX power is announced but wasn't decoded, it isn't reported.
+			header.Flags &^= EXT_HEADER_TX_POWER
+		}
+	}
+
+	return header, true
+}
+
+// merge completes the header with the fields of another packet of the same chain.
+func (h *extendedHeader) merge(other extendedHeader) {
+	h.Flags |= other.Flags
+	if other.Mode != "" {
+		h.Mode = other.Mode
+	}
+	if other.TargetAddress != "" {
+		h.TargetAddress = other.TargetAddress
+	}
+	if other.Flags&EXT_HEADER_TX_POWER != 0 {
+		h.TxPower = other.TxPower
+	}
+}
+
+// Fields returns the names of the optional fields present in the header.
+func (h extendedHeader) Fields() []string {
+	fields := make([]string, 0, len(extHeaderFields))
+	for _, field := range extHeaderFields {
+		if h.Flags&field.Flag != 0 {
+			fields = append(fields, field.Name)
+		}
+	}
+	return fields
+}
+
+// addTo adds the fields of the header to the data of an event.
+func (h extendedHeader) addTo(data SniffData) {
+	data["header_fields"] = h.Fields()
+	if h.Mode != "" {
+		data["adv_mode"] = h.Mode
+	}
+	if h.TargetAddress != "" {
+		data["target_address"] = h.TargetAddress
+	}
+	if h.Flags&EXT_HEADER_TX_POWER != 0 {
+		data["tx_power"] = h.TxPower
+	}
+}
@@ -0,0 +1,83 @@
+package ble_sniff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseExtendedHeader(t *testing.T) {
+	header, ok := parseExtendedHeader(map[string]interface{}{
+		"btle.extended_advertising_header_length": "14",
+		"btle.extended_advertising_mode":          "2",
+		"btle.extended_advertising_header": map[string]interface{}{
+			"btle.extended_advertising_flags":    "0x4b",
+			"btle.target_address":                "11:22:33:44:55:66",
+			"btle.extended_advertising_tx_power": "-7",
+		},
+	})
+	if !ok {
+		t.Fatal("expected the extended header to be parsed")
+	}
+	if fields := header.Fields(); !reflect.DeepEqual(fields, []string{"AdvA", "TargetA", "ADI", "TxPower"}) {
+		t.Errorf("unexpected header fields %v", fields)
+	}
+	if header.Mode != "scannable" || header.TargetAddress != "11:22:33:44:55:66" || header.TxPower != -7 {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	// The fields not announced by the flags are ignored, and the announced ones not decoded aren't reported.
+	header, ok = parseExtendedHeader(map[string]interface{}{
+		"btle.extended_advertising_flags": "0x50",
+		"btle.target_address":             "11:22:33:44:55:66",
+	})
+	if !ok || header.TargetAddress != "" || !reflect.DeepEqual(header.Fields(), []string{"AuxPtr"}) {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	if _, ok = parseExtendedHeader(map[string]interface{}{"btle.advertising_address": "11:22:33:44:55:66"}); ok {
+		t.Error("expected no extended header for a legacy advertisement")
+	}
+}
+
+func TestExtendedAdvertisementHeader(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	now := time.Now()
+
+	// The ADV_EXT_IND on a primary channel only points to the AUX_ADV_IND carrying the payload.
+	mod.onExtendedAdvertisement(map[string]interface{}{
+		"btle.extended_advertising_mode":          "0",
+		"btle.extended_advertising_flags":         "0x18",
+		"btle.advertising_data_info.sid":          "0x3",
+		"btle.advertising_data_info.did":          "0x012",
+		"btle.aux_pointer":                        "",
+		"btle.extended_advertising_header_length": "6",
+	}, nil, now)
+	mod.onExtendedAdvertisement(map[string]interface{}{
+		"btle.advertising_address":           "c0:ff:ee:00:be:ef",
+		"btle.extended_advertising_mode":     "0",
+		"btle.extended_advertising_flags":    "0x4b",
+		"btle.target_address":                "11:22:33:44:55:66",
+		"btle.extended_advertising_tx_power": "4",
+		"btle.advertising_data_info.sid":     "0x3",
+		"btle.advertising_data_info.did":     "0x012",
+		"btcommon.eir_ad.advertising_data": map[string]interface{}{
+			"btcommon.eir_ad.entry": map[string]interface{}{
+				"btcommon.eir_ad.entry.type":        "0x09",
+				"btcommon.eir_ad.entry.device_name": "Set3",
+			},
+		},
+	}, nil, now)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected a single extended advertisement, got %d events", len(sink.events))
+	}
+	data := sink.events[0].Data.(SniffData)
+	if data["sid"] != uint64(3) || data["adv_mode"] != "non-connectable non-scannable" || data["target_address"] != "11:22:33:44:55:66" || data["tx_power"] != 4 {
+		t.Errorf("unexpected extended advertisement data %v", data)
+	}
+	if fields := data["header_fields"]; !reflect.DeepEqual(fields, []string{"AdvA", "TargetA", "ADI", "AuxPtr", "TxPower"}) {
+		t.Errorf("expected the fields of both headers, got %v", fields)
+	}
+}
@@ -0,0 +1,176 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for the configuration errors, sort for listing the PDU and AD types, and strings for the name matching.
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// parsePDUTypes parses a comma separated list of advertising PDU type names, returning nil if the list is empty.
+func parsePDUTypes(list string) (map[uint8]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	types := make(map[uint8]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for pdu_type, pdu_name := range pduTypeNames {
+			if pdu_name == name {
+				types[pdu_type], found = true, true
+				break
+			}
+		}
+		if !found {
+			names := make([]string, 0, len(pduTypeNames))
+			for _, pdu_name := range pduTypeNames {
+				names = append(names, pdu_name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown PDU type '%s', expected one of %s", name, strings.Join(names, ", "))
+		}
+	}
+
+	return types, nil
+}
+
+// matchesPDU returns true if the advertising PDU type passes the PDU types filter.
+func (mod *Sniffer) matchesPDU(pduType uint8, hasPDUType bool) bool {
+	if mod.Ctx.PDUTypes == nil {
+		return true
+	}
+	return hasPDUType && mod.Ctx.PDUTypes[pduType]
+}
+
+// matchesName returns true if the local name of the advertiser contains the name filter, ignoring the case.
+// Advertisers whose name is still unknown only match if the filter isn't strict.
+func (mod *Sniffer) matchesName(btleData map[string]interface{}) bool {
+	if mod.Ctx.Name == "" {
+		return true
+	}
+
+	address, ok := btleData["btle.advertising_address"].(string)
+	if !ok {
+		return !mod.Ctx.NameStrict
+	}
+
+	name := mod.Stats.DeviceName(address)
+	if name == "" {
+		return !mod.Ctx.NameStrict
+	}
+
+	return strings.Contains(strings.ToLower(name), strings.ToLower(mod.Ctx.Name))
+}
+
+// carriesAdvData returns true for the advertising PDU types whose payload ends with AdvData or ScanRspData.
+func carriesAdvData(pduType uint8) bool {
+	switch pduType {
+	case PDU_ADV_IND, PDU_ADV_NONCONN_IND, PDU_ADV_SCAN_IND, PDU_SCAN_RSP:
+		return true
+	}
+	return false
+}
+
+// advDataLength computes the length in bytes of the advertising data from its AD structures, each of them being
+// a length byte followed by as many bytes of type and data.
+func advDataLength(entries []map[string]interface{}) int {
+	total := 0
+	for _, entry := range entries {
+		if length_string, ok := entry["btcommon.eir_ad.entry.length"].(string); ok {
+			if length, err := parseUint(length_string, 8); err == nil {
+				total += 1 + int(length)
+			}
+		}
+	}
+	return total
+}
+
+// matchesLength returns true if the length of the advertising data is within ble.sniff.min_len and
+// ble.sniff.max_len, a maximum of 0 meaning no limit.
+func (mod *Sniffer) matchesLength(entries []map[string]interface{}) bool {
+	if mod.Ctx.MinLen == 0 && mod.Ctx.MaxLen == 0 {
+		return true
+	}
+	length := advDataLength(entries)
+	return length >= mod.Ctx.MinLen && (mod.Ctx.MaxLen == 0 || length <= mod.Ctx.MaxLen)
+}
+
+// isWanted returns true if the events of an advertisement pass the configured filters.
+func (mod *Sniffer) isWanted(btleData map[string]interface{}, pduType uint8, hasPDUType bool) bool {
+	if mod.Ctx.ConnectableOnly && !(hasPDUType && isConnectable(pduType)) {
+		return false
+	} else if !mod.matchesPDU(pduType, hasPDUType) {
+		return false
+	} else if mod.Ctx.Services != nil && !hasServiceData(eirEntries(btleData), mod.Ctx.Services) {
+		return false
+	}
+	return mod.matchesName(btleData)
+}
+
+// parseADTypes parses the comma separated list of AD type codes of ble.sniff.ad_types, each one decimal or "0x"
+// prefixed hex. An empty list returns nil, meaning every type is parsed.
+func parseADTypes(list string) (map[uint8]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	types := make(map[uint8]bool)
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToLower(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		value, err := parseUint(code, 8)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an AD type code between 0x00 and 0xff", code)
+		}
+		types[uint8(value)] = true
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no AD type code in '%s'", list)
+	}
+	return types, nil
+}
+
+// adTypesLabel lists a set of AD types in order, or "all" for a nil set.
+func adTypesLabel(types map[uint8]bool) string {
+	if types == nil {
+		return "all"
+	}
+
+	codes := make([]int, 0, len(types))
+	for code := range types {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	labels := make([]string, len(codes))
+	for i, code := range codes {
+		labels[i] = fmt.Sprintf("0x%02x", code)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// filterADTypes returns the AD structures whose type is in the set, or all of them for a nil set. The structures
+// of the other types are skipped before being decoded.
+func filterADTypes(entries []map[string]interface{}, types map[uint8]bool) []map[string]interface{} {
+	if types == nil {
+		return entries
+	}
+
+	filtered := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		if ad_type, ok := adType(entry); ok && types[ad_type] {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
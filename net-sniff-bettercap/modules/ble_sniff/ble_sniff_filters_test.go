@@ -0,0 +1,255 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func TestParsePDUTypes(t *testing.T) {
+	types, err := parsePDUTypes(" adv_ind, SCAN_RSP ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 || !types[PDU_ADV_IND] || !types[PDU_SCAN_RSP] {
+		t.Errorf("expected ADV_IND and SCAN_RSP, got %v", types)
+	}
+
+	if types, err = parsePDUTypes(""); err != nil || types != nil {
+		t.Errorf("expected no filter for an empty list, got %v, %v", types, err)
+	}
+
+	if _, err = parsePDUTypes("ADV_IND,SCAN_REQUEST"); err == nil {
+		t.Errorf("expected an error for an unknown PDU type")
+	}
+}
+
+func TestPDUFilter(t *testing.T) {
+	packets := fixturePackets(t)
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.PDUTypes, _ = parsePDUTypes("ADV_NONCONN_IND")
+
+	for _, packet := range packets {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected the ADV_NONCONN_IND events to be emitted")
+	}
+	for _, e := range sink.events {
+		if e.PDU != "ADV_NONCONN_IND" {
+			t.Errorf("expected only ADV_NONCONN_IND events, got a %s one", e.PDU)
+		}
+	}
+	if mod.Stats.NumAdvertisements != uint64(len(packets)) {
+		t.Errorf("expected the filtered packets to be counted, got %d", mod.Stats.NumAdvertisements)
+	}
+}
+
+func TestParseServiceUUIDs(t *testing.T) {
+	uuids, err := parseServiceUUIDs("FEAA, 0xFE9F,6E400001-B5A3-F393-E0A9-E50E24DCCA9E,0000180F-0000-1000-8000-00805F9B34FB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"0xfeaa", "0xfe9f", "6e400001b5a3f393e0a9e50e24dcca9e", "0x180f"} {
+		if !uuids[expected] {
+			t.Errorf("expected %s in %v", expected, uuids)
+		}
+	}
+
+	if uuids, err = parseServiceUUIDs(""); err != nil || uuids != nil {
+		t.Errorf("expected no filter for an empty list, got %v, %v", uuids, err)
+	}
+
+	for _, invalid := range []string{"FEA", "ZZZZ", "6E400001-B5A3-F393"} {
+		if _, err = parseServiceUUIDs(invalid); err == nil {
+			t.Errorf("expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestServiceFilter(t *testing.T) {
+	packets := fixturePackets(t)
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.Services, _ = parseServiceUUIDs("FEAA")
+
+	for _, packet := range packets {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected the Eddystone events to be emitted")
+	}
+	for _, e := range sink.events {
+		if e.Source != "c0:ff:ee:00:be:ef" {
+			t.Errorf("expected only the Eddystone beacon, got an event from %s", e.Source)
+		}
+	}
+}
+
+func TestLengthFilter(t *testing.T) {
+	packets := fixturePackets(t)
+
+	// The ADV_IND carries 21 bytes of data and the Eddystone ADV_NONCONN_IND 18, the ADV_DIRECT_IND has none.
+	for _, tt := range []struct {
+		min, max int
+		dropped  string
+	}{
+		{20, 0, "c0:ff:ee:00:be:ef"},
+		{0, 20, "d4:3a:2c:11:8e:07"},
+		{18, 21, ""},
+	} {
+		sink := &collectSink{}
+		mod := newBenchSniffer(sink)
+		mod.Ctx.MinLen, mod.Ctx.MaxLen = tt.min, tt.max
+
+		for _, packet := range packets {
+			mod.dispatchPacket(nil, packet)
+		}
+
+		expected := uint64(0)
+		if tt.dropped != "" {
+			expected = 1
+		}
+		if mod.Stats.NumLengthFiltered != expected {
+			t.Errorf("%d-%d: expected %d filtered advertisements, got %d", tt.min, tt.max, expected, mod.Stats.NumLengthFiltered)
+		}
+		if mod.Stats.NumAdvertisements != uint64(len(packets))-expected {
+			t.Errorf("%d-%d: expected the filtered advertisements not to be decoded, got %d", tt.min, tt.max, mod.Stats.NumAdvertisements)
+		}
+		for _, e := range sink.events {
+			if e.Source == tt.dropped {
+				t.Errorf("%d-%d: unexpected event from %s", tt.min, tt.max, e.Source)
+			}
+		}
+	}
+}
+
+func TestChangesOnly(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.ChangesOnly = true
+
+	// The second round repeats the payloads, only the ADV_DIRECT_IND carrying no data is reported again.
+	first := 0
+	for round := 0; round < 2; round++ {
+		first = len(sink.events)
+		for _, packet := range fixturePackets(t) {
+			mod.dispatchPacket(nil, packet)
+		}
+	}
+	for _, e := range sink.events[first:] {
+		if e.Source != "00:1a:7d:da:71:13" {
+			t.Errorf("unexpected event for the repeated payload of %s: %s", e.Source, e.Message)
+		}
+	}
+	if mod.Stats.NumChanged != 2 || mod.Stats.NumUnchanged != 2 {
+		t.Errorf("expected 2 changed and 2 unchanged payloads, got %d and %d", mod.Stats.NumChanged, mod.Stats.NumUnchanged)
+	}
+	if mod.Stats.NumAdvertisements != 6 {
+		t.Errorf("expected the repeated advertisements to be counted, got %d", mod.Stats.NumAdvertisements)
+	}
+
+	// A new payload of the Eddystone beacon is reported.
+	sink.events = nil
+	for _, packet := range fixturePackets(t) {
+		btle := packet.(map[string]interface{})["btle"].(map[string]interface{})
+		if btle["btle.advertising_address"] == "c0:ff:ee:00:be:ef" {
+			entries := eirEntries(btle)
+			entries[len(entries)-1]["btcommon.eir_ad.entry.changed"] = "1"
+		}
+		mod.dispatchPacket(nil, packet)
+	}
+	reported := false
+	for _, e := range sink.events {
+		if e.Source == "d4:3a:2c:11:8e:07" {
+			t.Errorf("unexpected event for the repeated payload of %s: %s", e.Source, e.Message)
+		}
+		reported = reported || e.Source == "c0:ff:ee:00:be:ef"
+	}
+	if !reported || mod.Stats.NumChanged != 3 {
+		t.Errorf("expected the new payload to be reported, got %d changed payloads", mod.Stats.NumChanged)
+	}
+}
+
+func TestAdvChannelsOnly(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.AdvChannelsOnly = true
+	mod.Ctx.Verbose = true
+
+	for _, packet := range fixturePackets(t) {
+		packet.(map[string]interface{})["nordic_ble"] = map[string]interface{}{"nordic_ble.channel": "38"}
+		mod.dispatchPacket(nil, packet)
+	}
+	advertisements := len(sink.events)
+	if advertisements == 0 || mod.Stats.NumChannelFiltered != 0 {
+		t.Fatalf("expected the advertisements to be reported, got %d events and %d filtered", advertisements, mod.Stats.NumChannelFiltered)
+	}
+
+	// A secondary advertisement on channel 12, and a data channel packet without channel index.
+	mod.dispatchPacket(nil, map[string]interface{}{
+		"nordic_ble": map[string]interface{}{"nordic_ble.channel": "12"},
+		"btle": map[string]interface{}{
+			"btle.access_address":      advertisingAccessAddress,
+			"btle.advertising_address": "d4:3a:2c:11:8e:07",
+		},
+	})
+	mod.dispatchPacket(nil, map[string]interface{}{
+		"btle": map[string]interface{}{
+			"btle.access_address": "0x50654c1a",
+			"btle.control_opcode": "0x02",
+		},
+	})
+	if len(sink.events) != advertisements || mod.Stats.NumChannelFiltered != 2 {
+		t.Errorf("expected the data channel packets to be dropped, got %d events and %d filtered", len(sink.events)-advertisements, mod.Stats.NumChannelFiltered)
+	}
+	if mod.Stats.NumMatched != 3 {
+		t.Errorf("expected 3 matched packets, got %d", mod.Stats.NumMatched)
+	}
+}
+
+func TestParseADTypes(t *testing.T) {
+	types, err := parseADTypes(" 0xFF, 9 ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 || !types[AD_MANUFACTURER_DATA] || !types[AD_COMPLETE_LOCAL_NAME] {
+		t.Errorf("expected the manufacturer data and the complete local name, got %v", types)
+	}
+	if label := adTypesLabel(types); label != "0x09, 0xff" {
+		t.Errorf("expected the types to be listed in order, got %q", label)
+	}
+
+	if types, err = parseADTypes(""); err != nil || types != nil || adTypesLabel(types) != "all" {
+		t.Errorf("expected every type for an empty list, got %v, %v", types, err)
+	}
+
+	for _, list := range []string{"0x100", "name", "-1", " , "} {
+		if _, err = parseADTypes(list); err == nil {
+			t.Errorf("expected an error for %q", list)
+		}
+	}
+}
+
+func TestADTypesFilter(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.ADTypes = map[uint8]bool{AD_MANUFACTURER_DATA: true}
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected a single advertisement with manufacturer data, got %d events", len(sink.events))
+	}
+	data := sink.events[0].Data.(SniffData)
+	if data["name"] != nil || data["flags"] != nil || len(data["manufacturer"].([]SniffData)) != 1 {
+		t.Errorf("expected only the manufacturer data to be parsed, got %v", data)
+	}
+	// The skipped structures still complete the device record.
+	if name := mod.Stats.DeviceName("d4:3a:2c:11:8e:07"); name != "Thermo" || mod.Stats.NumAdvertisements != 3 {
+		t.Errorf("expected the device name and the advertisements to be tracked, got %q and %d", name, mod.Stats.NumAdvertisements)
+	}
+}
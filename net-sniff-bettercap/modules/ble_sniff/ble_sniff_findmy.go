@@ -0,0 +1,68 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings.
+import (
+	"fmt"
+)
+
+// Declaring the company identifier of Apple, and the type and lengths of the Find My frames of its manufacturer
+// specific data.
+const (
+	APPLE_COMPANY_ID        = 0x004c
+	FINDMY_TYPE             = 0x12
+	FINDMY_SEPARATED_LENGTH = 0x19
+	FINDMY_NEARBY_LENGTH    = 0x02
+	FINDMY_BATTERY_SHIFT    = 6
+)
+
+// findMyBatteryLevels are the battery levels of the two most significant bits of the Find My status byte.
+var findMyBatteryLevels = []string{"full", "medium", "low", "critical"}
+
+// decodeFindMy decodes the Find My frames of the Apple manufacturer specific data, advertised by the AirTags and the
+// third-party accessories of the Find My network. The accessories near their owner only send the status byte,
+// the separated ones, lost or carried by someone else, add the part of their rotating public key the address
+// doesn't carry, reported as opaque hex. Only the unencrypted status is decoded.
+func decodeFindMy(data []byte) (SniffData, string, error) {
+	if len(data) < 2 || data[0] != FINDMY_TYPE {
+		return nil, "", fmt.Errorf("not a Find My frame")
+	}
+
+	var decoded SniffData
+	switch length := int(data[1]); {
+	case length == FINDMY_SEPARATED_LENGTH && len(data) >= 2+FINDMY_SEPARATED_LENGTH:
+		decoded = SniffData{
+			"findmy_state": "separated",
+			"public_key":   fmt.Sprintf("%x", data[3:25]),
+			"key_bits":     data[25] & 0x03,
+			"key_hint":     fmt.Sprintf("0x%02x", data[26]),
+		}
+	case length == FINDMY_NEARBY_LENGTH && len(data) >= 2+FINDMY_NEARBY_LENGTH:
+		decoded = SniffData{
+			"findmy_state": "nearby owner",
+			"key_bits":     data[3] & 0x03,
+		}
+	default:
+		return nil, "", fmt.Errorf("Find My frame of %d bytes with length 0x%02x", len(data), data[1])
+	}
+
+	status := data[2]
+	decoded["status"] = fmt.Sprintf("0x%02x", status)
+	decoded["battery"] = findMyBatteryLevels[status>>FINDMY_BATTERY_SHIFT]
+
+	return decoded, fmt.Sprintf("Find My accessory %s, battery %s", decoded["findmy_state"], decoded["battery"]), nil
+}
+
+// decodeApple decodes the Apple manufacturer specific data, the Find My frames, reported as "BLE FINDMY" events to
+// tell the trackers apart, and the iBeacon ones.
+func decodeApple(data []byte) (SniffData, string, error) {
+	if len(data) > 0 && data[0] == FINDMY_TYPE {
+		decoded, description, err := decodeFindMy(data)
+		if err == nil {
+			decoded[decoderProtocolField] = "BLE FINDMY"
+		}
+		return decoded, description, err
+	}
+	return decodeIBeacon(data)
+}
@@ -0,0 +1,73 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// findMySeparated returns a Find My frame of a separated accessory, with a low battery.
+func findMySeparated() []byte {
+	frame := []byte{FINDMY_TYPE, FINDMY_SEPARATED_LENGTH, 0x90}
+	frame = append(frame, bytes.Repeat([]byte{0xab}, 22)...)
+	return append(frame, 0x01, 0x5e)
+}
+
+func TestDecodeFindMy(t *testing.T) {
+	decoded, description, err := decodeFindMy(findMySeparated())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["findmy_state"] != "separated" || decoded["battery"] != "low" || decoded["status"] != "0x90" {
+		t.Errorf("unexpected status %v", decoded)
+	} else if decoded["public_key"] != "abababababababababababababababababababababab" || decoded["key_bits"] != uint8(1) || decoded["key_hint"] != "0x5e" {
+		t.Errorf("unexpected key %v", decoded)
+	} else if description != "Find My accessory separated, battery low" {
+		t.Errorf("unexpected description %q", description)
+	}
+
+	decoded, _, err = decodeFindMy([]byte{FINDMY_TYPE, FINDMY_NEARBY_LENGTH, 0x10, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	} else if decoded["findmy_state"] != "nearby owner" || decoded["battery"] != "full" || decoded["public_key"] != nil {
+		t.Errorf("unexpected nearby frame %v", decoded)
+	}
+
+	for _, data := range [][]byte{
+		{IBEACON_TYPE, IBEACON_LENGTH},
+		{FINDMY_TYPE, FINDMY_SEPARATED_LENGTH, 0x10},
+		{FINDMY_TYPE, 0x05, 0x10, 0x00, 0x00, 0x00, 0x00},
+	} {
+		if _, _, err = decodeFindMy(data); err == nil {
+			t.Errorf("expected % x to be rejected", data)
+		}
+	}
+}
+
+func TestFindMyEvent(t *testing.T) {
+	payload := append([]byte{0x4c, 0x00}, findMySeparated()...)
+	data := append([]byte{byte(len(payload) + 1), AD_MANUFACTURER_DATA}, payload...)
+
+	events, err := decodeAdvData(data, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 {
+		t.Fatalf("expected a single event, got %d", len(events))
+	}
+	if events[0].Protocol != "BLE FINDMY" || events[0].Message != "Find My accessory separated, battery low" {
+		t.Errorf("unexpected event %s %q", events[0].Protocol, events[0].Message)
+	}
+	if company := events[0].Data.(SniffData)["company_id"]; company != uint16(APPLE_COMPANY_ID) {
+		t.Errorf("expected the Apple company, got %v", company)
+	}
+	if protocol, found := events[0].Data.(SniffData)[decoderProtocolField]; found {
+		t.Errorf("expected the protocol of the decoder not to be in the data, got %v", protocol)
+	}
+
+	// The other Apple frames are still decoded by the registered decoder.
+	ibeacon := []byte{0x1a, AD_MANUFACTURER_DATA, 0x4c, 0x00, IBEACON_TYPE, IBEACON_LENGTH}
+	ibeacon = append(ibeacon, make([]byte, IBEACON_LENGTH)...)
+	if events, err = decodeAdvData(ibeacon, time.Now()); err != nil || len(events) != 1 || events[0].Protocol != "BLE ADVERT" {
+		t.Errorf("expected an iBeacon advertisement, got %v %v", events, err)
+	}
+}
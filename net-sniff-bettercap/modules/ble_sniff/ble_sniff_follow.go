@@ -0,0 +1,83 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strings for normalizing the address and time for time-related functions.
+import (
+	"strings"
+	"time"
+)
+
+// addressFields lists the TShark fields of the advertising PDUs carrying a device address.
+var addressFields = []string{
+	"btle.advertising_address",
+	"btle.scanning_address",
+	"btle.initiator_address",
+	"btle.target_address",
+}
+
+// Follow restricts the emitted events to the packets associated with an address, ignoring the other filters,
+// or restores the normal behavior if the address is empty.
+func (mod *Sniffer) Follow(address string) {
+	address = strings.ToLower(strings.Replace(address, "-", ":", -1))
+
+	mod.followLock.Lock()
+	mod.follow = address
+	mod.followLock.Unlock()
+
+	if address == "" {
+		mod.Info("not following any device")
+	} else {
+		mod.Info("following %s", address)
+	}
+}
+
+// followed returns the address being followed, or an empty string if none.
+func (mod *Sniffer) followed() string {
+	mod.followLock.Lock()
+	defer mod.followLock.Unlock()
+
+	return mod.follow
+}
+
+// involvesAddress returns true if the address, or the pseudonym given by the anonymizer, is the sender or the
+// recipient of an advertising PDU.
+func involvesAddress(btleData map[string]interface{}, address string, a *anonymizer) bool {
+	for _, field := range addressFields {
+		if value, ok := btleData[field].(string); ok && a.Matches(value, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionInvolves returns true if the address, or the pseudonym given by the anonymizer, is one of the two ends
+// of a tracked connection.
+func (s *SnifferStats) ConnectionInvolves(accessAddress string, address string, a *anonymizer) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	conn, found := s.Connections[accessAddress]
+	if !found {
+		return false
+	}
+	return a.Matches(conn.Initiator, address) || a.Matches(conn.Advertiser, address)
+}
+
+// onScanRequest pushes a "BLE SCAN_REQ" event for a scanner asking an advertiser for its scan response.
+func (mod *Sniffer) onScanRequest(btleData map[string]interface{}, t time.Time) {
+	scanner, _ := btleData["btle.scanning_address"].(string)
+	advertiser, _ := btleData["btle.advertising_address"].(string)
+	if scanner == "" || advertiser == "" {
+		return
+	}
+
+	mod.Push(NewSnifferEvent(t,
+		"BLE SCAN_REQ",
+		scanner,
+		advertiser,
+		SniffData{},
+		"Scan request to %s",
+		advertiser,
+	).WithPDU(pduTypeName(PDU_SCAN_REQ)))
+}
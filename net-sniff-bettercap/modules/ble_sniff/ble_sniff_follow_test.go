@@ -0,0 +1,75 @@
+package ble_sniff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFollowOverridesFilters(t *testing.T) {
+	packets := fixturePackets(t)
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	// The followed device would otherwise be excluded by the PDU filter.
+	mod.Ctx.PDUTypes, _ = parsePDUTypes("ADV_IND")
+	mod.follow = "c0:ff:ee:00:be:ef"
+
+	for _, packet := range packets {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected the events of the followed device")
+	}
+	for _, e := range sink.events {
+		if e.Source != "c0:ff:ee:00:be:ef" {
+			t.Errorf("expected only the events of the followed device, got one from %s", e.Source)
+		}
+	}
+}
+
+func TestInvolvesAddress(t *testing.T) {
+	scan_req := map[string]interface{}{
+		"btle.scanning_address":    "aa:bb:cc:dd:ee:ff",
+		"btle.advertising_address": "11:22:33:44:55:66",
+	}
+	for _, address := range []string{"aa:bb:cc:dd:ee:ff", "11:22:33:44:55:66"} {
+		if !involvesAddress(scan_req, address, nil) {
+			t.Errorf("expected %s to be involved in the scan request", address)
+		}
+	}
+	if involvesAddress(scan_req, "00:00:00:00:00:01", nil) {
+		t.Errorf("expected an unrelated address not to be involved")
+	}
+
+	stats := NewSnifferStats()
+	stats.AddConnection(&SnifferConnection{AccessAddress: "0x50654c6b", Initiator: "AA:BB:CC:DD:EE:FF", Advertiser: "11:22:33:44:55:66"})
+	if !stats.ConnectionInvolves("0x50654c6b", "aa:bb:cc:dd:ee:ff", nil) || stats.ConnectionInvolves("0x50654c6b", "00:00:00:00:00:01", nil) {
+		t.Errorf("expected only the ends of the connection to be involved")
+	}
+}
+
+func TestFollowAnonymizedExtendedAdvertisements(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.anonymizer, _ = newAnonymizer("research key")
+	mod.follow = mod.Ctx.anonymizer.Address("d4:3a:2c:11:8e:07")
+
+	now := time.Now()
+	chains := []*auxChain{
+		{Address: "D4:3A:2C:11:8E:07", Fragments: 1, Updated: now},
+		{Address: "c0:ff:ee:00:be:ef", Fragments: 1, Updated: now, Header: extendedHeader{TargetAddress: "D4:3A:2C:11:8E:07"}},
+		{Address: "00:1a:7d:da:71:13", Fragments: 1, Updated: now},
+	}
+	for _, chain := range chains {
+		mod.onAuxChain(chain, true)
+	}
+
+	// The chains sent by and to the followed device are kept, whether it is designated by its pseudonym or address.
+	if len(sink.events) != 2 {
+		t.Fatalf("expected the 2 extended advertisements involving the followed device, got %d", len(sink.events))
+	}
+	mod.follow = "d4:3a:2c:11:8e:07"
+	if !chains[0].involves(mod.follow, mod.Ctx.anonymizer) || chains[2].involves(mod.follow, mod.Ctx.anonymizer) {
+		t.Errorf("expected the real address to still match")
+	}
+}
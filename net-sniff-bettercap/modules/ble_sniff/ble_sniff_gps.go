@@ -0,0 +1,238 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for reading the sentences line by line, encoding/json for the gpsd reports, fmt for the gpsd command,
+// io for the readers, net for connecting to gpsd, regexp for the Windows serial ports, strings for the device names,
+// sync for guarding the last fix, time for the fix age, go-nmea for parsing the sentences, and tarm/serial for the
+// serial devices.
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianmo/go-nmea"
+	"github.com/tarm/serial"
+)
+
+// Declaring how long a fix is attached to the events, and the delays of the GPS connection.
+const (
+	gpsFixMaxAge      = 10 * time.Second
+	gpsReadTimeout    = time.Second
+	gpsReconnectDelay = 5 * time.Second
+)
+
+// gpsdWatch asks gpsd to stream its reports as JSON lines.
+const gpsdWatch = `?WATCH={"enable":true,"json":true};`
+
+// windowsSerialPort matches the serial devices on Windows, such as COM3.
+var windowsSerialPort = regexp.MustCompile(`(?i)^COM\d+$`)
+
+// SnifferLocation struct is the position of the sniffer when an event was pushed.
+type SnifferLocation struct {
+	Latitude  float64   `json:"lat"`  // Latitude in decimal degrees.
+	Longitude float64   `json:"lon"`  // Longitude in decimal degrees.
+	Altitude  float64   `json:"alt"`  // Altitude in meters, 0 without a 3D fix.
+	Time      time.Time `json:"time"` // Time when the fix was received.
+}
+
+// gpsdReport holds the fields of the gpsd TPV reports the location is read from.
+type gpsdReport struct {
+	Class string  `json:"class"`
+	Mode  int     `json:"mode"`
+	Lat   float64 `json:"lat"`
+	Lon   float64 `json:"lon"`
+	Alt   float64 `json:"alt"`
+}
+
+// gpsTracker keeps the last fix read from an NMEA serial device or from gpsd, reconnecting in background
+// whenever the device is unavailable.
+type gpsTracker struct {
+	sync.Mutex                  // Guards the last fix and the connection.
+	Device     string           // Serial device, or host:port of a gpsd instance.
+	BaudRate   int              // Baud rate of the serial device.
+	fix        *SnifferLocation // Last fix received, nil if none.
+	conn       io.Closer        // Current connection, closed to interrupt the reads.
+	quit       chan struct{}    // Closed to stop the tracker.
+	done       chan struct{}    // Closed once the tracker stopped.
+}
+
+// isSerialDevice returns true for the serial devices, anything else being a gpsd endpoint.
+func isSerialDevice(device string) bool {
+	return strings.HasPrefix(device, "/") || strings.HasPrefix(device, ".") || windowsSerialPort.MatchString(device)
+}
+
+// newGPSTracker starts tracking the position reported by a GPS device.
+func newGPSTracker(device string, baudRate int) *gpsTracker {
+	g := &gpsTracker{
+		Device:   device,
+		BaudRate: baudRate,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go g.run()
+
+	return g
+}
+
+// update records a new fix.
+func (g *gpsTracker) update(latitude float64, longitude float64, altitude float64, t time.Time) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.fix = &SnifferLocation{
+		Latitude:  latitude,
+		Longitude: longitude,
+		Altitude:  altitude,
+		Time:      t,
+	}
+}
+
+// Location returns the last fix, or nil if there is none or if it is too old to describe the current position.
+func (g *gpsTracker) Location(now time.Time) *SnifferLocation {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.fix == nil || now.Sub(g.fix.Time) > gpsFixMaxAge {
+		return nil
+	}
+	location := *g.fix
+	return &location
+}
+
+// onNMEA processes a sentence of a serial device, the GGA ones with a valid fix update the location.
+func (g *gpsTracker) onNMEA(line string) {
+	sentence, err := nmea.Parse(strings.TrimSpace(line))
+	if err != nil {
+		return
+	}
+	if gga, ok := sentence.(nmea.GGA); ok && gga.FixQuality != nmea.Invalid {
+		g.update(gga.Latitude, gga.Longitude, gga.Altitude, time.Now())
+	}
+}
+
+// onGPSD processes a report of gpsd, the TPV ones with a 2D or 3D fix update the location.
+func (g *gpsTracker) onGPSD(line string) {
+	var report gpsdReport
+	if err := json.Unmarshal([]byte(line), &report); err != nil {
+		return
+	}
+	if report.Class == "TPV" && report.Mode >= 2 {
+		g.update(report.Lat, report.Lon, report.Alt, time.Now())
+	}
+}
+
+// stopping returns true once the tracker is being stopped.
+func (g *gpsTracker) stopping() bool {
+	select {
+	case <-g.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConn stores the current connection, closing it right away if the tracker is being stopped.
+func (g *gpsTracker) setConn(conn io.Closer) bool {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.stopping() {
+		conn.Close()
+		return false
+	}
+	g.conn = conn
+	return true
+}
+
+// readLines passes the lines of a reader to a handler until it fails. The reads of the serial devices time out
+// when no sentence is sent, which is not an error.
+func (g *gpsTracker) readLines(r io.Reader, serial bool, onLine func(line string)) error {
+	reader := bufio.NewReader(r)
+	for !g.stopping() {
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			onLine(line)
+		} else if !serial || (err != io.EOF && err != io.ErrNoProgress) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSerial reads the NMEA sentences of a serial device.
+func (g *gpsTracker) readSerial() error {
+	port, err := serial.OpenPort(&serial.Config{
+		Name:        g.Device,
+		Baud:        g.BaudRate,
+		ReadTimeout: gpsReadTimeout,
+	})
+	if err != nil {
+		return err
+	} else if !g.setConn(port) {
+		return nil
+	}
+	defer port.Close()
+
+	return g.readLines(port, true, g.onNMEA)
+}
+
+// readGPSD reads the reports of a gpsd instance.
+func (g *gpsTracker) readGPSD() error {
+	conn, err := net.DialTimeout("tcp", g.Device, gpsReconnectDelay)
+	if err != nil {
+		return err
+	} else if !g.setConn(conn) {
+		return nil
+	}
+	defer conn.Close()
+
+	if _, err = fmt.Fprintln(conn, gpsdWatch); err != nil {
+		return err
+	}
+	return g.readLines(conn, false, g.onGPSD)
+}
+
+// run reads the GPS device until the tracker is stopped, reconnecting after a delay if it becomes unavailable.
+// Meanwhile the fix gets old and the events are pushed without location.
+func (g *gpsTracker) run() {
+	defer close(g.done)
+
+	for {
+		var err error
+		if isSerialDevice(g.Device) {
+			err = g.readSerial()
+		} else {
+			err = g.readGPSD()
+		}
+		if g.stopping() {
+			return
+		}
+		logDebug("GPS %s unavailable, retrying in %s: %v", g.Device, gpsReconnectDelay, err)
+
+		select {
+		case <-g.quit:
+			return
+		case <-time.After(gpsReconnectDelay):
+		}
+	}
+}
+
+// Close stops the tracker, interrupting the pending read.
+func (g *gpsTracker) Close() {
+	g.Lock()
+	close(g.quit)
+	if g.conn != nil {
+		g.conn.Close()
+	}
+	g.Unlock()
+
+	<-g.done
+}
@@ -0,0 +1,140 @@
+package ble_sniff
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIsSerialDevice(t *testing.T) {
+	for device, expected := range map[string]bool{
+		"/dev/ttyUSB0":   true,
+		"./gps.nmea":     true,
+		"COM4":           true,
+		"com12":          true,
+		"localhost:2947": false,
+		"10.0.0.2:2947":  false,
+	} {
+		if isSerialDevice(device) != expected {
+			t.Errorf("expected %s serial to be %v", device, expected)
+		}
+	}
+}
+
+func TestGPSFix(t *testing.T) {
+	g := &gpsTracker{}
+	now := time.Now()
+
+	if g.Location(now) != nil {
+		t.Fatalf("expected no location without a fix")
+	}
+
+	g.onNMEA("$GPGGA,123519,4807.038,N,01131.000,E,0,00,,,M,,M,,*52\r\n")
+	if g.Location(now) != nil {
+		t.Fatalf("expected no location for an invalid fix")
+	}
+
+	g.onNMEA("$GPGGA,123519,4807.038,N,01131.000,W,1,08,0.9,545.4,M,46.9,M,,*55\r\n")
+	location := g.Location(time.Now())
+	if location == nil {
+		t.Fatalf("expected a location from the GGA sentence")
+	} else if math.Abs(location.Latitude-48.1173) > 1e-4 || math.Abs(location.Longitude+11.5167) > 1e-4 || location.Altitude != 545.4 {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	g.onGPSD(`{"class":"SKY","satellites":[]}`)
+	g.onGPSD(`{"class":"TPV","mode":1}`)
+	if location = g.Location(time.Now()); location.Altitude != 545.4 {
+		t.Errorf("expected the reports without fix to be ignored, got %+v", location)
+	}
+
+	g.onGPSD(`{"class":"TPV","mode":3,"lat":51.5,"lon":-0.12,"alt":35.2}`)
+	if location = g.Location(time.Now()); location.Latitude != 51.5 || location.Longitude != -0.12 || location.Altitude != 35.2 {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	if g.Location(location.Time.Add(gpsFixMaxAge+time.Second)) != nil {
+		t.Errorf("expected no location for a stale fix")
+	}
+}
+
+func TestGPSD(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Reporting the fix once the client asked for the reports.
+		if _, err = bufio.NewReader(conn).ReadString('\n'); err == nil {
+			fmt.Fprintln(conn, `{"class":"VERSION","release":"3.22"}`)
+			fmt.Fprintln(conn, `{"class":"TPV","mode":2,"lat":40.4,"lon":-3.7}`)
+		}
+		time.Sleep(time.Second)
+	}()
+
+	g := newGPSTracker(listener.Addr().String(), 4800)
+	defer g.Close()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if location := g.Location(time.Now()); location != nil {
+			if location.Latitude != 40.4 || location.Longitude != -3.7 {
+				t.Errorf("unexpected location %+v", location)
+			}
+			return
+		}
+	}
+	t.Fatalf("no location received from gpsd")
+}
+
+func TestGPSUnavailable(t *testing.T) {
+	quietLogs(t)
+
+	// Nothing listens on the port of a closed listener.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.gps = newGPSTracker(address, 4800)
+
+	packets := fixturePackets(t)
+	pushed := make(chan struct{})
+	go func() {
+		for _, packet := range packets {
+			mod.dispatchPacket(nil, packet)
+		}
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the events are blocked by the unavailable GPS")
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatalf("expected events without GPS")
+	}
+	for _, e := range sink.events {
+		if e.Location != nil {
+			t.Errorf("unexpected location %+v without GPS", e.Location)
+		}
+	}
+
+	mod.Ctx.gps.Close()
+}
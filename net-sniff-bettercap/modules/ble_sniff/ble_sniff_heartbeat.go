@@ -0,0 +1,70 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// time for the heartbeat timer.
+import (
+	"time"
+)
+
+// startHeartbeat starts pushing heartbeat events whenever no packet arrives for the given interval.
+func (mod *Sniffer) startHeartbeat(interval time.Duration) {
+	mod.heartbeatReset = make(chan struct{}, 1)
+	mod.heartbeatQuit = make(chan struct{})
+
+	go mod.heartbeatLoop(interval, mod.heartbeatReset, mod.heartbeatQuit)
+}
+
+// stopHeartbeat stops the heartbeat loop, if running.
+func (mod *Sniffer) stopHeartbeat() {
+	if mod.heartbeatQuit != nil {
+		close(mod.heartbeatQuit)
+		mod.heartbeatQuit = nil
+	}
+}
+
+// resetHeartbeat tells the heartbeat loop a packet arrived, without ever blocking the capture.
+func (mod *Sniffer) resetHeartbeat() {
+	select {
+	case mod.heartbeatReset <- struct{}{}:
+	default:
+	}
+}
+
+// heartbeatLoop pushes a heartbeat event every interval elapsed without packets, until quit is closed.
+func (mod *Sniffer) heartbeatLoop(interval time.Duration, reset <-chan struct{}, quit <-chan struct{}) {
+	idleSince := time.Now()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-reset:
+			// A packet arrived, restart the timer.
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(interval)
+			idleSince = time.Now()
+		case now := <-timer.C:
+			idle := int(now.Sub(idleSince).Seconds())
+
+			// Create a new SnifferEvent with protocol "BLE HEARTBEAT" and push it.
+			mod.Push(NewSnifferEvent(now,
+				"BLE HEARTBEAT",
+				"SNIFFER",
+				"SNIFFER",
+				SniffData{"idle": idle},
+				"No packets for %d seconds",
+				idle,
+			))
+
+			timer.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/hex for formatting the dump and fmt for the truncation note.
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// rawLayerBytes extracts the bytes of a layer from the raw field TShark adds next to it when run with -x, either
+// the hexadecimal string alone or the [hex, offset, length, bitmask, type] array.
+func rawLayerBytes(packetMap map[string]interface{}, layer string) ([]byte, bool) {
+	var hex_string string
+	switch raw := packetMap[layer+"_raw"].(type) {
+	case string:
+		hex_string = raw
+	case []interface{}:
+		if len(raw) == 0 {
+			return nil, false
+		}
+		hex_string, _ = raw[0].(string)
+	}
+	if hex_string == "" {
+		return nil, false
+	}
+
+	raw, err := parseHexBytes(hex_string)
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+// hexdump formats bytes as offsets, hexadecimal and ASCII columns, keeping at most max bytes if max is positive.
+func hexdump(raw []byte, max int) string {
+	if max <= 0 || len(raw) <= max {
+		return hex.Dump(raw)
+	}
+	return hex.Dump(raw[:max]) + fmt.Sprintf("... %d more bytes\n", len(raw)-max)
+}
+
+// rawHex returns the hexdump of the BLE layer of a packet to attach to its events, or an empty string if the
+// hexdump is disabled or TShark didn't provide the raw bytes.
+func (mod *Sniffer) rawHex(packetMap map[string]interface{}) string {
+	if !mod.Ctx.Hexdump {
+		return ""
+	}
+	raw, ok := rawLayerBytes(packetMap, "btle")
+	if !ok {
+		return ""
+	}
+	return hexdump(raw, mod.Ctx.HexdumpMax)
+}
+
+// withRawHex attaches the hexdump of the packet the events were decoded from to each of them.
+func withRawHex(events []SnifferEvent, rawHex string) []SnifferEvent {
+	if rawHex == "" {
+		return events
+	}
+	for i := range events {
+		events[i] = events[i].WithRawHex(rawHex)
+	}
+	return events
+}
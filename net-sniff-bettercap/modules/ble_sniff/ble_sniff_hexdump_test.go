@@ -0,0 +1,60 @@
+package ble_sniff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRawLayerBytes(t *testing.T) {
+	for _, value := range []interface{}{
+		"d6be898e00",
+		[]interface{}{"d6be898e00", 17.0, 5.0, 0.0, 1.0},
+	} {
+		raw, ok := rawLayerBytes(map[string]interface{}{"btle_raw": value}, "btle")
+		if !ok || len(raw) != 5 || raw[0] != 0xd6 || raw[4] != 0x00 {
+			t.Errorf("unexpected bytes %x for %v", raw, value)
+		}
+	}
+
+	if _, ok := rawLayerBytes(map[string]interface{}{"btle_raw": "zz"}, "btle"); ok {
+		t.Errorf("expected invalid hexadecimal to be ignored")
+	} else if _, ok := rawLayerBytes(map[string]interface{}{}, "btle"); ok {
+		t.Errorf("expected a packet without raw bytes to be ignored")
+	}
+}
+
+func TestHexdump(t *testing.T) {
+	raw := []byte("0123456789abcdefghij")
+
+	if dump := hexdump(raw, 0); strings.Contains(dump, "more bytes") || !strings.Contains(dump, "|ghij|") {
+		t.Errorf("unexpected full dump:\n%s", dump)
+	}
+	if dump := hexdump(raw, 16); !strings.HasSuffix(dump, "... 4 more bytes\n") || strings.Contains(dump, "ghij") {
+		t.Errorf("unexpected truncated dump:\n%s", dump)
+	}
+}
+
+func TestHexdumpEvents(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		sink := &collectSink{}
+		mod := newBenchSniffer(sink)
+		mod.Ctx.Hexdump = enabled
+		mod.Ctx.HexdumpMax = 64
+
+		for _, packet := range fixturePackets(t) {
+			packet.(map[string]interface{})["btle_raw"] = []interface{}{"d6be898e001b", 17.0, 6.0, 0.0, 1.0}
+			mod.dispatchPacket(nil, packet)
+		}
+
+		if len(sink.events) == 0 {
+			t.Fatalf("expected events")
+		}
+		for _, e := range sink.events {
+			if enabled && !strings.HasPrefix(e.RawHex, "00000000  d6 be 89 8e 00 1b") {
+				t.Errorf("expected the hexdump on %s, got %q", e.Message, e.RawHex)
+			} else if !enabled && e.RawHex != "" {
+				t.Errorf("unexpected hexdump on %s", e.Message)
+			}
+		}
+	}
+}
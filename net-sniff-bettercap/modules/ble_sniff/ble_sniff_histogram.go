@@ -0,0 +1,123 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, strings for the bars, and islazy/tui for the table.
+import (
+	"fmt"
+	"strings"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// Bounds of the RSSI histogram: fixed buckets of rssiHistogramStep dBm starting from rssiHistogramMin,
+// where the first and the last buckets also count the samples below and above the range.
+const (
+	rssiHistogramMin     = -100
+	rssiHistogramStep    = 5
+	rssiHistogramBuckets = 16
+	rssiHistogramWidth   = 40 // Width in characters of the longest bar printed by ble.sniff.rssi.
+)
+
+// RSSIHistogram counts the RSSI samples of a device in fixed buckets, so that its memory doesn't grow with the samples.
+type RSSIHistogram [rssiHistogramBuckets]uint64
+
+// rssiBucket returns the index of the bucket a RSSI sample falls into.
+func rssiBucket(rssi int) int {
+	if rssi < rssiHistogramMin {
+		return 0
+	}
+	bucket := (rssi - rssiHistogramMin) / rssiHistogramStep
+	if bucket >= rssiHistogramBuckets {
+		return rssiHistogramBuckets - 1
+	}
+	return bucket
+}
+
+// rssiBucketLabel returns the range of values in dBm counted by a bucket.
+func rssiBucketLabel(bucket int) string {
+	low := rssiHistogramMin + bucket*rssiHistogramStep
+	high := low + rssiHistogramStep - 1
+	if bucket == 0 {
+		return fmt.Sprintf("<= %d", high)
+	} else if bucket == rssiHistogramBuckets-1 {
+		return fmt.Sprintf(">= %d", low)
+	}
+	return fmt.Sprintf("%d .. %d", low, high)
+}
+
+// Add counts a RSSI sample.
+func (h *RSSIHistogram) Add(rssi int) {
+	h[rssiBucket(rssi)]++
+}
+
+// Total returns the count of samples.
+func (h *RSSIHistogram) Total() uint64 {
+	total := uint64(0)
+	for _, count := range h {
+		total += count
+	}
+	return total
+}
+
+// ShowRSSI prints the RSSI histogram of a device, from the strongest to the weakest bucket with samples.
+func (mod *Sniffer) ShowRSSI(address string) error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	dev, found := mod.Stats.Device(strings.ToLower(address))
+	if a := mod.Ctx.anonymizer; !found && a != nil {
+		// The device can be designated by its pseudonym.
+		for _, d := range mod.Stats.DevicesList() {
+			if a.Matches(d.Address, strings.ToLower(address)) {
+				dev, found = d, true
+				break
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("device %s not found", address)
+	}
+
+	total := dev.RSSIHistogram.Total()
+	if total == 0 {
+		mod.Info("no RSSI samples for %s", mod.Ctx.anonymizer.DeviceAddress(dev))
+		return nil
+	}
+
+	// Skip the empty buckets outside of the range of the samples.
+	first, last := -1, -1
+	max := uint64(0)
+	for bucket, count := range dev.RSSIHistogram {
+		if count > 0 {
+			if first < 0 {
+				first = bucket
+			}
+			last = bucket
+		}
+		if count > max {
+			max = count
+		}
+	}
+
+	rows := make([][]string, 0)
+	for bucket := last; bucket >= first; bucket-- {
+		count := dev.RSSIHistogram[bucket]
+		bar := strings.Repeat("█", int(count*rssiHistogramWidth/max))
+		if count > 0 && bar == "" {
+			bar = "▏"
+		}
+		rows = append(rows, []string{
+			rssiBucketLabel(bucket),
+			fmt.Sprintf("%d", count),
+			fmt.Sprintf("%.1f%%", float64(count)*100/float64(total)),
+			tui.Green(bar),
+		})
+	}
+
+	tui.Table(mod.Session.Events.Stdout, []string{"RSSI (dBm)", "Samples", "Share", ""}, rows)
+	mod.Session.Refresh()
+
+	return nil
+}
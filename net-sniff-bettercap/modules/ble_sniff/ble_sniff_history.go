@@ -0,0 +1,79 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted output and errors, io for the writer, and sync for guarding the buffer.
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// eventHistory is a ring buffer retaining the last events pushed by the sniffer, overwriting the oldest ones once
+// full so that its memory never grows beyond its size.
+type eventHistory struct {
+	lock   sync.Mutex     // Lock guarding the buffer, the workers push concurrently.
+	events []SnifferEvent // Retained events, allocated at the size of the buffer.
+	next   int            // Index the next event is stored at.
+	count  int            // Number of events retained, up to the size of the buffer.
+}
+
+// newEventHistory creates a ring buffer retaining up to size events.
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{events: make([]SnifferEvent, size)}
+}
+
+// Add stores an event, overwriting the oldest one if the buffer is full.
+func (h *eventHistory) Add(e SnifferEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.events[h.next] = e
+	h.next = (h.next + 1) % len(h.events)
+	if h.count < len(h.events) {
+		h.count++
+	}
+}
+
+// Recent returns a copy of the last n retained events, oldest first, or all of them if n isn't positive.
+func (h *eventHistory) Recent(n int) []SnifferEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if n <= 0 || n > h.count {
+		n = h.count
+	}
+	recent := make([]SnifferEvent, n)
+	start := h.next - n + len(h.events)
+	for i := range recent {
+		recent[i] = h.events[(start+i)%len(h.events)]
+	}
+	return recent
+}
+
+// writeRecent writes a line for each event with its time, protocol, ends and message.
+func writeRecent(w io.Writer, events []SnifferEvent) {
+	for _, e := range events {
+		fmt.Fprintf(w, "%s %s %s > %s : %s\n", e.PacketTime.Format("15:04:05.000"), e.Protocol, e.Source, e.Destination, e.Message)
+	}
+	fmt.Fprintf(w, "%d recent events\n", len(events))
+}
+
+// onEventHistory is the event handler retaining every pushed event in the history.
+func (mod *Sniffer) onEventHistory(e SnifferEvent) {
+	if mod.Ctx.history != nil {
+		mod.Ctx.history.Add(e)
+	}
+}
+
+// ShowRecent prints the last n events retained in the history, or all of them if n isn't positive.
+func (mod *Sniffer) ShowRecent(n int) error {
+	if mod.Ctx == nil || mod.Ctx.history == nil {
+		return fmt.Errorf("No history, set ble.sniff.history to a positive size and start the sniffer.")
+	}
+
+	writeRecent(mod.Session.Events.Stdout, mod.Ctx.history.Recent(n))
+	mod.Session.Refresh()
+
+	return nil
+}
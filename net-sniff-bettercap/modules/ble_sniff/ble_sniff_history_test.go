@@ -0,0 +1,72 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func historyEvent(i int) SnifferEvent {
+	return NewSnifferEvent(time.Date(2024, 5, 1, 12, 0, i, 0, time.UTC), "BLE ADVERT", "aa:bb:cc:dd:ee:ff", "BROADCAST", nil, "advert %d", i)
+}
+
+func TestEventHistory(t *testing.T) {
+	history := newEventHistory(3)
+	if recent := history.Recent(0); len(recent) != 0 {
+		t.Errorf("expected an empty history, got %d events", len(recent))
+	}
+
+	for i := 0; i < 5; i++ {
+		history.Add(historyEvent(i))
+	}
+	if len(history.events) != 3 {
+		t.Errorf("expected the buffer to stay at 3 events, got %d", len(history.events))
+	}
+
+	for n, expected := range map[int][]string{
+		0:  {"advert 2", "advert 3", "advert 4"},
+		2:  {"advert 3", "advert 4"},
+		10: {"advert 2", "advert 3", "advert 4"},
+	} {
+		recent := history.Recent(n)
+		messages := make([]string, len(recent))
+		for i, e := range recent {
+			messages[i] = e.Message
+		}
+		if fmt.Sprint(messages) != fmt.Sprint(expected) {
+			t.Errorf("expected %v for %d events, got %v", expected, n, messages)
+		}
+	}
+}
+
+func TestEventHistoryConcurrent(t *testing.T) {
+	history := newEventHistory(16)
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				history.Add(historyEvent(i))
+				history.Recent(4)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if recent := history.Recent(0); len(recent) != 16 {
+		t.Errorf("expected 16 events, got %d", len(recent))
+	}
+}
+
+func TestWriteRecent(t *testing.T) {
+	var out bytes.Buffer
+	writeRecent(&out, []SnifferEvent{historyEvent(1)})
+
+	expected := "12:00:01.000 BLE ADVERT aa:bb:cc:dd:ee:ff > BROADCAST : advert 1\n1 recent events\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
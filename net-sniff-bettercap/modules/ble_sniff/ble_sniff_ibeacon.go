@@ -0,0 +1,35 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the big-endian fields, and fmt for errors and formatted strings.
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Declaring the type and length of the iBeacon frames of the Apple manufacturer specific data.
+const (
+	IBEACON_TYPE   = 0x02
+	IBEACON_LENGTH = 0x15
+)
+
+// decodeIBeacon decodes the iBeacon frames of the Apple manufacturer specific data: the proximity UUID, the major
+// and minor numbers and the calibrated TX power at 1 meter. The other Apple frames aren't decoded.
+func decodeIBeacon(data []byte) (SniffData, string, error) {
+	if len(data) < 2 || data[0] != IBEACON_TYPE || data[1] != IBEACON_LENGTH {
+		return nil, "", fmt.Errorf("not an iBeacon frame")
+	} else if len(data) != 2+IBEACON_LENGTH {
+		return nil, "", fmt.Errorf("iBeacon frame must be %d bytes long, got %d", 2+IBEACON_LENGTH, len(data))
+	}
+
+	uuid := fmt.Sprintf("%x-%x-%x-%x-%x", data[2:6], data[6:8], data[8:10], data[10:12], data[12:18])
+	major := binary.BigEndian.Uint16(data[18:20])
+	minor := binary.BigEndian.Uint16(data[20:22])
+	return SniffData{
+		"ibeacon_uuid": uuid,
+		"major":        major,
+		"minor":        minor,
+		"tx_power":     int8(data[22]),
+	}, fmt.Sprintf("iBeacon %s major=%d minor=%d", uuid, major, minor), nil
+}
@@ -0,0 +1,332 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bytes for the batches, context for cancelling the writes, fmt for errors and the fields, io and io/ioutil for the
+// error responses, math for the invalid numbers, net/http for the requests, net/url for the write URL, os for the
+// token, sort for a stable order of the fields, strconv for the numbers, strings for escaping, sync/atomic for the
+// dropped lines counter, and time for the flush timer and the retries.
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Declaring the settings of the InfluxDB writes.
+const (
+	influxMeasurement   = "ble_sniff"
+	influxQueueSize     = 16384
+	influxBatchSize     = 5000
+	influxFlushInterval = time.Second
+	influxAttempts      = 3
+	influxTimeout       = 10 * time.Second
+)
+
+// influxMessageField is the field of the message of the events, the data fields of the same name being prefixed.
+const influxMessageField = "message"
+
+// influxRetryDelay is the delay before the second attempt of a write, growing with every attempt.
+var influxRetryDelay = time.Second
+
+// Declaring the escapers of the line protocol, for the measurement, the tag keys and values and the field keys,
+// and for the string field values.
+var (
+	influxNameEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	influxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// influxField formats a value of the event data as a line protocol field value, returning false for the values
+// that aren't numbers or booleans. The numbers are all written as floats, since a field keeps the type of its first
+// value and a value such as the RSSI is an integer in some events and a float in others.
+func influxField(value interface{}) (string, bool) {
+	var number float64
+	switch v := value.(type) {
+	case int:
+		number = float64(v)
+	case int8:
+		number = float64(v)
+	case int16:
+		number = float64(v)
+	case int32:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case uint8:
+		number = float64(v)
+	case uint16:
+		number = float64(v)
+	case uint32:
+		number = float64(v)
+	case uint64:
+		number = float64(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+	case float64:
+		number = v
+	case bool:
+		return fmt.Sprintf("%t", v), true
+	default:
+		return "", false
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return "", false
+	}
+	return strconv.FormatFloat(number, 'g', -1, 64), true
+}
+
+// influxLine formats an event as a line protocol point tagged by protocol, address, vendor, PDU type and session,
+// with its message and the numbers of its data, such as the RSSI or the counters of the summaries, as fields.
+func influxLine(e SnifferEvent) string {
+	tags := [][2]string{
+		{"protocol", e.Protocol},
+		{"address", e.Source},
+		{"pdu", e.PDU},
+		{"session_id", e.SessionID},
+	}
+	fields := []string{
+		influxMessageField + "=\"" + influxStringEscaper.Replace(e.Message) + "\"",
+	}
+
+	if data, ok := e.Data.(SniffData); ok {
+		if vendor, ok := data["hardware_vendor"].(string); ok {
+			tags = append(tags, [2]string{"vendor", vendor})
+		}
+
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, ok := influxField(data[key])
+			if !ok {
+				continue
+			}
+			name := key
+			if name == influxMessageField {
+				name = "data_" + name
+			}
+			fields = append(fields, influxNameEscaper.Replace(name)+"="+value)
+		}
+	}
+
+	line := strings.Builder{}
+	line.WriteString(influxMeasurement)
+	// The tags must be sorted by key, and the empty ones omitted.
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i][0] < tags[j][0]
+	})
+	for _, tag := range tags {
+		if tag[1] != "" {
+			fmt.Fprintf(&line, ",%s=%s", tag[0], influxNameEscaper.Replace(tag[1]))
+		}
+	}
+	fmt.Fprintf(&line, " %s %d", strings.Join(fields, ","), e.PacketTime.UnixNano())
+	return line.String()
+}
+
+// influxStatusError is the error of a write the server answered with an error status.
+type influxStatusError struct {
+	StatusCode int    // Status code of the response.
+	Status     string // Status of the response.
+	Body       string // Start of the body of the response.
+}
+
+// Error returns the status and the body of the response.
+func (e *influxStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Body)
+}
+
+// influxRetryable returns true if a failed write may succeed later, for the network errors, the rate limiting and
+// the server errors. The other statuses, such as a malformed point or a bad token, would fail again.
+func influxRetryable(err error) bool {
+	status, ok := err.(*influxStatusError)
+	return !ok || status.StatusCode == http.StatusTooManyRequests || status.StatusCode/100 == 5
+}
+
+// influxWriter writes the events to an InfluxDB bucket in batches, from a goroutine of its own so that the capture
+// is never blocked by the database.
+type influxWriter struct {
+	WriteURL string             // URL of the write endpoint, with the organization, the bucket and the precision.
+	token    string             // API token the requests are authorized with.
+	client   *http.Client       // Client sending the requests.
+	queue    chan string        // Lines waiting to be written.
+	dropped  uint64             // Count of lines dropped because the queue was full or the writes kept failing.
+	ctx      context.Context    // Cancelled to abort the write in progress.
+	cancel   context.CancelFunc // Cancels ctx.
+	quit     chan struct{}      // Closed to flush the last lines and stop.
+	done     chan struct{}      // Closed once the writer stopped.
+}
+
+// newInfluxWriter starts writing to a bucket of an InfluxDB 2 server, with the token set or the one of the
+// INFLUX_TOKEN environment variable.
+func newInfluxWriter(server string, org string, bucket string, token string) (*influxWriter, error) {
+	base, err := url.Parse(strings.TrimRight(server, "/"))
+	if err != nil {
+		return nil, err
+	} else if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("'%s' is not an http or https URL", server)
+	} else if org == "" || bucket == "" {
+		return nil, fmt.Errorf("the organization and the bucket must be set")
+	}
+	if token == "" {
+		token = os.Getenv("INFLUX_TOKEN")
+	}
+
+	query := url.Values{}
+	query.Set("org", org)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ns")
+	base.Path += "/api/v2/write"
+	base.RawQuery = query.Encode()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &influxWriter{
+		WriteURL: base.String(),
+		token:    token,
+		client:   &http.Client{Timeout: influxTimeout},
+		queue:    make(chan string, influxQueueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+// Add queues an event to be written, dropping it if the queue is full so that the capture is never blocked.
+func (w *influxWriter) Add(e SnifferEvent) {
+	select {
+	case w.queue <- influxLine(e):
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+	}
+}
+
+// Dropped returns the number of lines dropped because the queue was full or the writes kept failing.
+func (w *influxWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// write sends a batch of lines with a single request.
+func (w *influxWriter) write(batch []string) error {
+	body := bytes.NewBufferString(strings.Join(batch, "\n"))
+	req, err := http.NewRequestWithContext(w.ctx, http.MethodPost, w.WriteURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Token "+w.token)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return &influxStatusError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return nil
+}
+
+// flush writes a batch, retrying the errors that may be temporary after a growing delay, and drops it if every
+// attempt failed.
+func (w *influxWriter) flush(batch []string, attempts int) {
+	if len(batch) == 0 {
+		return
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err := w.write(batch)
+		if err == nil {
+			return
+		} else if w.ctx.Err() != nil {
+			break
+		}
+
+		logWarning("write of %d points to InfluxDB failed (attempt %d of %d): %v", len(batch), attempt, attempts, err)
+		if !influxRetryable(err) {
+			break
+		} else if attempt < attempts {
+			select {
+			case <-w.ctx.Done():
+			case <-w.quit:
+				// Don't delay the stop, the next attempt is made right away.
+			case <-time.After(time.Duration(attempt) * influxRetryDelay):
+			}
+		}
+	}
+
+	atomic.AddUint64(&w.dropped, uint64(len(batch)))
+	logWarning("%d points not written to InfluxDB", len(batch))
+}
+
+// run batches the queued lines, writing them once the batch is full or on every flush interval, until the
+// writer is closed. The last lines are then written without waiting between the attempts.
+func (w *influxWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(influxFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, influxBatchSize)
+	for {
+		select {
+		case line := <-w.queue:
+			if batch = append(batch, line); len(batch) >= influxBatchSize {
+				w.flush(batch, influxAttempts)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch, influxAttempts)
+			batch = batch[:0]
+		case <-w.quit:
+			for pending := len(w.queue); pending > 0; pending-- {
+				batch = append(batch, <-w.queue)
+			}
+			w.flush(batch, influxAttempts)
+			return
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close writes the queued lines for up to timeout, then aborts the write in progress and stops the writer.
+func (w *influxWriter) Close(timeout time.Duration) {
+	close(w.quit)
+	select {
+	case <-w.done:
+	case <-time.After(timeout):
+		logWarning("InfluxDB writes still in progress at the shutdown deadline, aborting them")
+	}
+	w.cancel()
+	<-w.done
+
+	if dropped := w.Dropped(); dropped > 0 {
+		logWarning("%d events were not written to InfluxDB", dropped)
+	}
+}
@@ -0,0 +1,151 @@
+package ble_sniff
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	e := NewSnifferEvent(time.Unix(1714564800, 5), "BLE ADVERT", "d4:3a:2c:11:8e:07", "BROADCAST", SniffData{
+		"rssi":            -60,
+		"rssi_smoothed":   -61.5,
+		"hardware_vendor": "Apple, Inc.",
+		"name":            "skipped",
+		"message":         uint8(3),
+		"timestamp":       uint32(1714564800),
+	}, `Name "Phone"`).WithPDU("ADV_IND")
+
+	// The numbers are all floats, and the data field named like the message is prefixed.
+	expected := `ble_sniff,address=d4:3a:2c:11:8e:07,pdu=ADV_IND,protocol=BLE\ ADVERT,vendor=Apple\,\ Inc. message="Name \"Phone\"",` +
+		`data_message=3,rssi=-60,rssi_smoothed=-61.5,timestamp=1.7145648e+09 1714564800000000005`
+	if line := influxLine(e); line != expected {
+		t.Errorf("unexpected line:\n%s\nexpected:\n%s", line, expected)
+	}
+}
+
+func TestNewInfluxWriter(t *testing.T) {
+	for _, args := range [][3]string{
+		{"localhost:8086", "org", "bucket"},
+		{"http://localhost:8086", "", "bucket"},
+		{"http://localhost:8086", "org", ""},
+	} {
+		if _, err := newInfluxWriter(args[0], args[1], args[2], ""); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestInfluxWriter(t *testing.T) {
+	quietLogs(t)
+
+	lock := sync.Mutex{}
+	lines := make([]string, 0)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("org") != "lab" || r.URL.Query().Get("bucket") != "ble" {
+			t.Errorf("unexpected request %s", r.URL)
+		} else if auth := r.Header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("unexpected authorization '%s'", auth)
+		}
+		// The first write fails and must be retried.
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		lines = append(lines, strings.Split(string(body), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	prev := influxRetryDelay
+	influxRetryDelay = time.Millisecond
+	defer func() { influxRetryDelay = prev }()
+
+	writer, err := newInfluxWriter(server.URL+"/", "lab", "ble", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		writer.Add(NewSnifferEvent(time.Now(), "BLE ADVERT", "d4:3a:2c:11:8e:07", "BROADCAST", SniffData{"rssi": -60}, "advert"))
+	}
+	// The queued events are written on close.
+	writer.Close(time.Second)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(lines) != 3 {
+		t.Errorf("expected 3 points, got %d", len(lines))
+	}
+	if failures != 0 || writer.Dropped() != 0 {
+		t.Errorf("expected the failed write to be retried, got %d dropped points", writer.Dropped())
+	}
+}
+
+func TestInfluxWriterRejected(t *testing.T) {
+	quietLogs(t)
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	prev := influxRetryDelay
+	influxRetryDelay = time.Millisecond
+	defer func() { influxRetryDelay = prev }()
+
+	writer, err := newInfluxWriter(server.URL, "lab", "ble", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Add(NewSnifferEvent(time.Now(), "BLE ADVERT", "d4:3a:2c:11:8e:07", "BROADCAST", SniffData{"rssi": -60}, "advert"))
+	writer.Close(time.Second)
+
+	// A rejected write would fail again, so it isn't retried.
+	if count := atomic.LoadInt32(&requests); count != 1 {
+		t.Errorf("expected a single request, got %d", count)
+	} else if writer.Dropped() != 1 {
+		t.Errorf("expected the point to be dropped, got %d", writer.Dropped())
+	}
+}
+
+func TestInfluxWriterCloseTimeout(t *testing.T) {
+	quietLogs(t)
+	stuck := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-stuck:
+		}
+	}))
+	defer server.Close()
+	defer close(stuck)
+
+	writer, err := newInfluxWriter(server.URL, "lab", "ble", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Add(NewSnifferEvent(time.Now(), "BLE ADVERT", "d4:3a:2c:11:8e:07", "BROADCAST", SniffData{"rssi": -60}, "advert"))
+
+	// The write of a stuck server is aborted once the timeout is over.
+	started := time.Now()
+	writer.Close(50 * time.Millisecond)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected the close to return after the timeout, took %s", elapsed)
+	}
+	if writer.Dropped() != 1 {
+		t.Errorf("expected the point to be dropped, got %d", writer.Dropped())
+	}
+}
@@ -0,0 +1,45 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// io for the input reader, sync/atomic for the state shared with the goroutine of the decoder,
+// and jstream for the decoder position.
+import (
+	"io"
+	"sync/atomic"
+
+	"github.com/bcicen/jstream"
+)
+
+// inputReader counts the bytes read from the TShark JSON input and notices its end, to tell an input ending before
+// the JSON array is closed, as when TShark is killed mid-capture, apart from a malformed one.
+type inputReader struct {
+	r    io.Reader // Input read.
+	read int64     // Count of bytes read.
+	eof  int32     // Set to 1 once the input ended.
+}
+
+// newInputReader wraps the input read by the decoder.
+func newInputReader(r io.Reader) *inputReader {
+	return &inputReader{r: r}
+}
+
+// Read reads from the input, counting the bytes and noticing its end.
+func (in *inputReader) Read(p []byte) (int, error) {
+	n, err := in.r.Read(p)
+	atomic.AddInt64(&in.read, int64(n))
+	if err == io.EOF {
+		atomic.StoreInt32(&in.eof, 1)
+	}
+	return n, err
+}
+
+// Unterminated returns true if the decoder stopped at the end of the input, which happens when the JSON array of
+// TShark is never closed. The packets decoded until then are complete, only the last one may have been cut.
+func (in *inputReader) Unterminated(decoder *jstream.Decoder) bool {
+	if decoder.Err() == nil || atomic.LoadInt32(&in.eof) == 0 {
+		return false
+	}
+	// jstream reports the end of the input inside the array as a syntax error at its last byte.
+	return int64(decoder.Pos()) >= atomic.LoadInt64(&in.read)-1
+}
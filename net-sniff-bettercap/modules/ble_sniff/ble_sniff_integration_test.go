@@ -0,0 +1,163 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bcicen/jstream"
+	"github.com/bettercap/bettercap/session"
+)
+
+// newTestSession creates a session with only the environment and the events, enough to run the module.
+func newTestSession(t *testing.T) *session.Session {
+	env, err := session.NewEnvironment("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &session.Session{
+		Env:    env,
+		Events: session.NewEventPool(false, true),
+	}
+
+	// The module also logs through the global session.
+	prev := session.I
+	session.I = s
+	t.Cleanup(func() {
+		session.I = prev
+	})
+	return s
+}
+
+func (s *lockedSink) Count() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.count
+}
+
+func TestStartStopWithFakeSource(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/advertisements.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &lockedSink{}
+	mod, err := NewSnifferWithOptions(newTestSession(t), withReader(bytes.NewReader(raw)), WithEventSink(sink))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = mod.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait for the events of the three fixture advertisements.
+	deadline := time.Now().Add(5 * time.Second)
+	// The AD structures of every advertisement are merged into a single event.
+	for sink.Count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The module keeps running once the input ended, until it is stopped.
+	if err = mod.Stop(); err != nil {
+		t.Fatal(err)
+	} else if mod.Running() {
+		t.Fatal("expected the module to be stopped")
+	}
+
+	if count := sink.Count(); count != 3 {
+		t.Errorf("expected 3 events, got %d", count)
+	}
+	if mod.Stats.NumAdvertisements != 3 || mod.Stats.NumMatched != 3 {
+		t.Errorf("expected 3 advertisements and matched packets, got %d and %d", mod.Stats.NumAdvertisements, mod.Stats.NumMatched)
+	}
+	if devices := mod.Stats.DevicesList(); len(devices) != 3 {
+		t.Errorf("expected 3 devices, got %d", len(devices))
+	}
+	if mod.Stats.FirstPacket.IsZero() || mod.Stats.LastPacket.Before(mod.Stats.FirstPacket) {
+		t.Errorf("expected the capture times to be recorded, got %s and %s", mod.Stats.FirstPacket, mod.Stats.LastPacket)
+	}
+}
+
+func TestCaptureKilledMidArray(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/advertisements.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// TShark is killed while writing a fourth packet, its JSON array is never closed.
+	raw = bytes.TrimRight(bytes.TrimSpace(raw), "]")
+	raw = append(raw, []byte(`,
+  {
+    "_source": {
+      "layers": {
+        "btle": {
+          "btle.advertising_address": "d4:3a`)...)
+
+	reader, writer := io.Pipe()
+	output := filepath.Join(t.TempDir(), "events.json")
+	sink := &lockedSink{}
+	mod, err := NewSnifferWithOptions(newTestSession(t), withReader(reader), WithEventSink(sink), WithOutput(output, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mod.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	writer.Write(raw)
+	writer.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.Count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err = mod.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The complete packets are decoded, and the output is NDJSON without any trace of the TShark array.
+	if count := sink.Count(); count != 3 {
+		t.Errorf("expected 3 events, got %d", count)
+	}
+	written, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(written), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d:\n%s", len(lines), written)
+	}
+	for _, line := range lines {
+		e := SnifferEvent{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil || e.Protocol == "" {
+			t.Errorf("expected an event per line, got %q: %v", line, err)
+		}
+	}
+}
+
+func TestInputReaderUnterminated(t *testing.T) {
+	tests := []struct {
+		input        string
+		unterminated bool
+	}{
+		{`[{"a": {"b": {"c": 1}}}]`, false},
+		{`[{"a": {"b": {"c": 1}}}`, true},
+		{`[{"a": {"b": {"c": 1}}},`, true},
+		{`[{"a": {"b": {"c": 1}}}, {"a": {"b": {"c":`, true},
+		{`[{"a": {"b": {"c": 1}}}, x, {"a": {"b": {"c": 2}}}]`, false},
+	}
+	for _, tt := range tests {
+		input := newInputReader(strings.NewReader(tt.input))
+		decoder := jstream.NewDecoder(input, 3)
+		for range decoder.Stream() {
+		}
+		if got := input.Unterminated(decoder); got != tt.unterminated {
+			t.Errorf("Unterminated(%q) = %v, expected %v (%v)", tt.input, got, tt.unterminated, decoder.Err())
+		}
+	}
+}
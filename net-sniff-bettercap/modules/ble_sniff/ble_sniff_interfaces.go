@@ -0,0 +1,133 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for reading the interfaces line by line, fmt for errors, os/exec for running TShark,
+// regexp for parsing the interfaces, strings for matching them, and islazy/tui for the table.
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// nrfInterfaceHint is the part of the name of the nRF Sniffer interfaces shared by every version, which may
+// add the serial port or the firmware version to it.
+const nrfInterfaceHint = "nrf sniffer"
+
+// tsharkInterfaceLine matches the lines of tshark -D, such as "6. COM5-4.6 (nRF Sniffer for Bluetooth LE COM5)".
+var tsharkInterfaceLine = regexp.MustCompile(`^\d+\.\s+(\S+)(?:\s+\((.*)\))?\s*$`)
+
+// tsharkInterface is a capture interface listed by TShark.
+type tsharkInterface struct {
+	Name        string // Name of the interface, as given to -i.
+	Description string // Friendly name of the interface, also accepted by -i, empty if there is none.
+}
+
+// parseInterfaces parses the interfaces listed by tshark -D.
+func parseInterfaces(out string) []tsharkInterface {
+	interfaces := make([]tsharkInterface, 0)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if m := tsharkInterfaceLine.FindStringSubmatch(strings.TrimSpace(scanner.Text())); m != nil {
+			interfaces = append(interfaces, tsharkInterface{Name: m[1], Description: m[2]})
+		}
+	}
+	return interfaces
+}
+
+// isNRFSniffer returns true for the interfaces of the nRF Sniffer.
+func (i tsharkInterface) isNRFSniffer() bool {
+	return strings.Contains(strings.ToLower(i.Name+" "+i.Description), nrfInterfaceHint)
+}
+
+// listInterfaces runs tshark -D and parses the capture interfaces it lists.
+func listInterfaces(tshark string) ([]tsharkInterface, error) {
+	if _, err := exec.LookPath(tshark); err != nil {
+		return nil, fmt.Errorf("could not find %s: %v", tshark, err)
+	}
+
+	out, err := exec.Command(tshark, "-D").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("could not list the TShark interfaces: %v", err)
+	}
+	return parseInterfaces(string(out)), nil
+}
+
+// matchInterface looks up an interface by name or by friendly name. Unless strict is set, if it isn't listed the first
+// nRF Sniffer interface is returned instead, returning an error if there is none.
+func matchInterface(interfaces []tsharkInterface, iface string, strict bool) (string, error) {
+	for _, i := range interfaces {
+		if i.Name == iface || i.Description == iface {
+			return iface, nil
+		}
+	}
+
+	if strict {
+		return "", fmt.Errorf("interface '%s' not found", iface)
+	}
+
+	for _, i := range interfaces {
+		if i.isNRFSniffer() {
+			return i.Name, nil
+		}
+	}
+	return "", fmt.Errorf("interface '%s' not found and no nRF Sniffer interface is available", iface)
+}
+
+// resolveInterface checks the capture interface is listed by TShark, returning the nRF Sniffer interface to use
+// instead if it isn't and ble.sniff.interface.strict is not set.
+func (c *SnifferContext) resolveInterface() (string, error) {
+	interfaces, err := listInterfaces(c.TShark)
+	if err != nil {
+		return "", err
+	}
+	return matchInterface(interfaces, c.Interface, c.InterfaceStrict)
+}
+
+// setInterface changes the interface TShark captures from.
+func (c *SnifferContext) setInterface(iface string) {
+	c.Interface = iface
+	for i := 0; i+1 < len(c.TSharkArgs); i++ {
+		if c.TSharkArgs[i] == "-i" {
+			c.TSharkArgs[i+1] = iface
+		}
+	}
+}
+
+// ShowInterfaces prints the capture interfaces listed by the configured TShark, highlighting the nRF Sniffer ones.
+func (mod *Sniffer) ShowInterfaces() error {
+	err, tshark := mod.StringParam("ble.sniff.tshark")
+	if err != nil {
+		return err
+	}
+
+	interfaces, err := listInterfaces(tshark)
+	if err != nil {
+		return err
+	}
+
+	if len(interfaces) == 0 {
+		mod.Info("no capture interfaces listed by %s", tshark)
+		return nil
+	}
+
+	rows := make([][]string, 0, len(interfaces))
+	for n, i := range interfaces {
+		name, description := i.Name, i.Description
+		if i.isNRFSniffer() {
+			name, description = tui.Green(name), tui.Green(description)
+		} else {
+			name, description = tui.Dim(name), tui.Dim(description)
+		}
+		rows = append(rows, []string{fmt.Sprintf("%d", n+1), name, description})
+	}
+
+	tui.Table(mod.Session.Events.Stdout, []string{"#", "Name", "Description"}, rows)
+	mod.Session.Refresh()
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+const tsharkInterfaces = `1. \Device\NPF_{2C3B4D5E-1111-2222-3333-444455556666} (Ethernet)
+2. \Device\NPF_Loopback (Adapter for loopback traffic capture)
+3. COM5-4.6 (nRF Sniffer for Bluetooth LE COM5)
+4. ciscodump (Cisco remote capture)
+5. randpkt
+`
+
+func TestParseInterfaces(t *testing.T) {
+	interfaces := parseInterfaces(tsharkInterfaces)
+	if len(interfaces) != 5 {
+		t.Fatalf("expected 5 interfaces, got %d", len(interfaces))
+	}
+	if interfaces[2].Name != "COM5-4.6" || interfaces[2].Description != "nRF Sniffer for Bluetooth LE COM5" {
+		t.Errorf("unexpected interface %+v", interfaces[2])
+	}
+	if interfaces[4].Name != "randpkt" || interfaces[4].Description != "" {
+		t.Errorf("unexpected interface %+v", interfaces[4])
+	}
+}
+
+func TestMatchInterface(t *testing.T) {
+	interfaces := parseInterfaces(tsharkInterfaces)
+
+	if iface, err := matchInterface(interfaces, "nRF Sniffer for Bluetooth LE COM5", false); err != nil || iface != "nRF Sniffer for Bluetooth LE COM5" {
+		t.Errorf("expected the exact friendly name to be kept, got %s %v", iface, err)
+	}
+	if iface, err := matchInterface(interfaces, "nRF Sniffer for Bluetooth LE", false); err != nil || iface != "COM5-4.6" {
+		t.Errorf("expected the nRF Sniffer interface to be selected, got %s %v", iface, err)
+	}
+	if _, err := matchInterface(interfaces, "nRF Sniffer for Bluetooth LE", true); err == nil {
+		t.Errorf("expected an error in strict mode")
+	}
+	if _, err := matchInterface(interfaces[:2], "nRF Sniffer for Bluetooth LE", false); err == nil {
+		t.Errorf("expected an error without any nRF Sniffer interface")
+	}
+}
+
+func TestSetInterface(t *testing.T) {
+	ctx := NewSnifferContext()
+	ctx.TSharkArgs = []string{"-i", "COM5-4.6", "-T", "json"}
+	ctx.setInterface("COM7-4.6")
+
+	if ctx.Interface != "COM7-4.6" || ctx.TSharkArgs[1] != "COM7-4.6" {
+		t.Errorf("expected the interface to be replaced, got %s %v", ctx.Interface, ctx.TSharkArgs)
+	}
+}
+
+func TestListInterfacesWithoutTShark(t *testing.T) {
+	if _, err := listInterfaces("/nonexistent/tshark"); err == nil {
+		t.Errorf("expected an error if TShark can't be found")
+	}
+}
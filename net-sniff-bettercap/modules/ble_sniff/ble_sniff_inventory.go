@@ -0,0 +1,167 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/csv and encoding/json for the snapshot formats, fmt for errors, io for the writers,
+// os for the snapshot file, path/filepath and strings for the format selection, and time for the timestamps.
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Declaring the formats the device inventory can be saved in.
+const (
+	InventoryJSON = "json"
+	InventoryCSV  = "csv"
+)
+
+// inventoryColumns are the columns of the CSV snapshots of the device inventory.
+var inventoryColumns = []string{"address", "address_type", "name", "vendor", "first_seen", "last_seen", "packets", "rssi"}
+
+// inventoryFormat selects the format of a snapshot by the extension of its path, JSON unless it is .csv.
+func inventoryFormat(path string) string {
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return InventoryCSV
+	}
+	return InventoryJSON
+}
+
+// writeInventoryJSON writes the device records as an indented JSON array.
+func writeInventoryJSON(w io.Writer, devices []SnifferDevice) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(devices)
+}
+
+// writeInventoryCSV writes a row for each device, leaving the RSSI empty for the devices without a sample.
+func writeInventoryCSV(w io.Writer, devices []SnifferDevice) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(inventoryColumns); err != nil {
+		return err
+	}
+
+	for _, dev := range devices {
+		rssi := ""
+		if dev.rssiSeen {
+			rssi = fmt.Sprintf("%d", dev.RSSI)
+		}
+		if err := writer.Write([]string{
+			dev.Address,
+			dev.AddressType,
+			dev.Name,
+			dev.vendor(),
+			dev.FirstSeen.Format(time.RFC3339Nano),
+			dev.LastSeen.Format(time.RFC3339Nano),
+			fmt.Sprintf("%d", dev.Packets),
+			rssi,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// readInventory decodes a JSON inventory written by SaveInventory.
+func readInventory(r io.Reader) ([]SnifferDevice, error) {
+	var devices []SnifferDevice
+	if err := json.NewDecoder(r).Decode(&devices); err != nil {
+		return nil, err
+	}
+
+	for i := range devices {
+		if devices[i].Address == "" {
+			return nil, fmt.Errorf("device %d has no address", i)
+		}
+		// The moving average is only meaningful if the device had RSSI samples.
+		devices[i].rssiSeen = devices[i].RSSIHistogram.Total() > 0
+	}
+
+	return devices, nil
+}
+
+// LoadDevices adds device records to the table, replacing the ones with the same address. The records saved while
+// anonymizing are keyed by pseudonym, they are matched with the devices by the anonymizer, if any.
+func (s *SnifferStats) LoadDevices(devices []SnifferDevice, a *anonymizer) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.anonymizer = a
+	for _, dev := range devices {
+		loaded := dev.copy()
+		s.Devices[dev.Address] = &loaded
+	}
+}
+
+// loadInventory pre-populates the device table with a JSON inventory, so that the first seen times and the counters
+// persist across sessions. A missing or malformed inventory is not fatal, the capture starts with an empty table.
+func (mod *Sniffer) loadInventory(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		mod.Warning("could not load the inventory, starting fresh: %v", err)
+		return
+	}
+	defer file.Close()
+
+	devices, err := readInventory(file)
+	if err != nil {
+		mod.Warning("malformed inventory %s, starting fresh: %v", path, err)
+		return
+	}
+
+	anonymized := 0
+	for _, dev := range devices {
+		if dev.Anonymized {
+			anonymized++
+		}
+	}
+	if anonymized > 0 && mod.Ctx.anonymizer == nil {
+		mod.Warning("%d devices of %s are anonymized, they won't match the devices seen without ble.sniff.anonymize", anonymized, path)
+	}
+
+	mod.Stats.LoadDevices(devices, mod.Ctx.anonymizer)
+	mod.Info("loaded %d devices from %s", len(devices), path)
+}
+
+// SaveInventory writes a snapshot of the device table to a file, as CSV if its extension is .csv and as JSON otherwise.
+// The table is copied first, so it can be saved while capturing, and the file is replaced only once fully written.
+// The addresses are replaced with their pseudonyms when anonymizing.
+func (mod *Sniffer) SaveInventory(path string) error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	devices := mod.Ctx.anonymizer.Devices(mod.Stats.DevicesList())
+
+	temp := path + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	if inventoryFormat(path) == InventoryCSV {
+		err = writeInventoryCSV(file, devices)
+	} else {
+		err = writeInventoryJSON(file, devices)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	} else if err = os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	mod.Info("saved %d devices to %s", len(devices), path)
+	return nil
+}
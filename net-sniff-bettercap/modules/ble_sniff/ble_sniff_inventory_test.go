@@ -0,0 +1,142 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func inventoryStats() *SnifferStats {
+	stats := NewSnifferStats()
+	now := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	stats.TrackDevice("aa:bb:cc:dd:ee:ff", -60, true, now, 0.3, 0)
+	stats.TrackDevice("aa:bb:cc:dd:ee:ff", -62, true, now.Add(time.Second), 0.3, 0)
+	stats.MergeDeviceInfo("aa:bb:cc:dd:ee:ff", "Thermo, Kitchen", nil)
+	stats.SetDeviceCompany("aa:bb:cc:dd:ee:ff", 0x004c, "")
+	stats.TrackDevice("11:22:33:44:55:66", 0, false, now, 0.3, 0)
+	return stats
+}
+
+func TestInventoryFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"devices.csv":  InventoryCSV,
+		"DEVICES.CSV":  InventoryCSV,
+		"devices.json": InventoryJSON,
+		"devices":      InventoryJSON,
+	} {
+		if got := inventoryFormat(path); got != want {
+			t.Errorf("inventoryFormat(%s) = %s, expected %s", path, got, want)
+		}
+	}
+}
+
+func TestWriteInventoryCSV(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeInventoryCSV(&buf, inventoryStats().DevicesList()); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %v", rows)
+	}
+
+	expected := []string{"aa:bb:cc:dd:ee:ff", "", "Thermo, Kitchen", "0x004c", "2024-03-02T10:00:00Z", "2024-03-02T10:00:01Z", "2", "-62"}
+	for i, value := range expected {
+		if rows[1][i] != value {
+			t.Errorf("column %s: expected %q, got %q", inventoryColumns[i], value, rows[1][i])
+		}
+	}
+	if rssi := rows[2][len(inventoryColumns)-1]; rssi != "" {
+		t.Errorf("expected no RSSI for a device without samples, got %q", rssi)
+	}
+}
+
+func TestWriteInventoryJSON(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := writeInventoryJSON(&buf, inventoryStats().DevicesList()); err != nil {
+		t.Fatal(err)
+	}
+
+	var devices []SnifferDevice
+	if err := json.Unmarshal(buf.Bytes(), &devices); err != nil {
+		t.Fatal(err)
+	} else if len(devices) != 2 || devices[0].Address != "aa:bb:cc:dd:ee:ff" || devices[0].Packets != 2 {
+		t.Errorf("unexpected inventory %+v", devices)
+	}
+}
+
+func TestReadInventory(t *testing.T) {
+	saved := inventoryStats()
+	buf := bytes.Buffer{}
+	if err := writeInventoryJSON(&buf, saved.DevicesList()); err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := readInventory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := NewSnifferStats()
+	stats.LoadDevices(devices, nil)
+
+	// New advertisements update the loaded records.
+	dev := stats.TrackDevice("aa:bb:cc:dd:ee:ff", -70, true, time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), 0.5, 0)
+	if dev.Packets != 3 || !dev.FirstSeen.Equal(time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the loaded record to be updated, got %d packets first seen %s", dev.Packets, dev.FirstSeen)
+	}
+	if dev.Name != "Thermo, Kitchen" {
+		t.Errorf("expected the loaded name to be kept, got %q", dev.Name)
+	}
+	if dev.SmoothedRSSI == -70 {
+		t.Errorf("expected the loaded RSSI average to be kept")
+	}
+
+	if _, err = readInventory(bytes.NewBufferString(`{"address": "aa:bb:cc:dd:ee:ff"}`)); err == nil {
+		t.Errorf("expected an error for a malformed inventory")
+	}
+	if _, err = readInventory(bytes.NewBufferString(`[{"packets": 1}]`)); err == nil {
+		t.Errorf("expected an error for a device without address")
+	}
+}
+
+func TestAnonymizedInventory(t *testing.T) {
+	a, _ := newAnonymizer("research key")
+	buf := bytes.Buffer{}
+	if err := writeInventoryJSON(&buf, a.Devices(inventoryStats().DevicesList())); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.String()
+
+	devices, err := readInventory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := NewSnifferStats()
+	stats.LoadDevices(devices, a)
+
+	// The record loaded under the pseudonym is updated once the device shows up with its real address.
+	dev := stats.TrackDevice("aa:bb:cc:dd:ee:ff", -70, true, time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC), 0.5, 0)
+	if dev.Packets != 3 || dev.Name != "Thermo, Kitchen" || dev.Anonymized {
+		t.Errorf("expected the loaded record to be updated, got %+v", dev)
+	} else if _, found := stats.Device(a.Address("aa:bb:cc:dd:ee:ff")); found {
+		t.Errorf("expected the record to be moved to the real address")
+	}
+
+	// Saved again, the devices keep their pseudonyms, including the one which didn't show up.
+	list := a.Devices(stats.DevicesList())
+	if len(list) != 2 {
+		t.Fatalf("expected 2 devices, got %+v", list)
+	}
+	for _, dev := range list {
+		if !dev.Anonymized || !strings.Contains(saved, `"address": "`+dev.Address+`"`) {
+			t.Errorf("expected the pseudonym of the first save, got %s", dev.Address)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings.
+import (
+	"fmt"
+)
+
+// Declaring the size of the LE Bluetooth Device Address AD structure and the flag of its address type byte.
+const (
+	leDeviceAddressSize = 7
+	leAddressRandomFlag = 0x01
+)
+
+// decodeLEDeviceAddress decodes the little-endian device address and the address type of an LE Bluetooth Device
+// Address AD structure payload, whose last byte tells a random address by its lowest bit.
+func decodeLEDeviceAddress(raw []byte) (string, string, error) {
+	if len(raw) != leDeviceAddressSize {
+		return "", "", fmt.Errorf("LE device address must be %d bytes long, got %d", leDeviceAddressSize, len(raw))
+	}
+
+	address_type := AddressPublic
+	if raw[6]&leAddressRandomFlag != 0 {
+		address_type = AddressRandom
+	}
+	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", raw[5], raw[4], raw[3], raw[2], raw[1], raw[0]), address_type, nil
+}
+
+// leDeviceAddress extracts the address and the address type of an LE Bluetooth Device Address AD structure,
+// either from the fields decoded by TShark or from its raw payload.
+func leDeviceAddress(entry map[string]interface{}) (string, string, error) {
+	address, has_address := entry["btcommon.eir_ad.entry.le_bd_addr"].(string)
+	type_string, has_type := entry["btcommon.eir_ad.entry.le_bd_addr.type"].(string)
+	raw, err := adPayload(entry, "LE device address", has_address && has_type, func(size int) bool {
+		return size == leDeviceAddressSize
+	})
+	if err != nil {
+		return "", "", err
+	} else if !has_address || !has_type {
+		return decodeLEDeviceAddress(raw)
+	}
+
+	flags, err := parseUint(type_string, 8)
+	if err != nil {
+		return "", "", err
+	}
+	address_type := AddressPublic
+	if flags&leAddressRandomFlag != 0 {
+		address_type = AddressRandom
+	}
+	return address, address_type, nil
+}
+
+// onLEDeviceAddress processes the LE Bluetooth Device Address AD structure, reporting the address the device
+// states as its own. It can differ from the advertising address, for instance a resolvable private one, and helps
+// correlating the rotating addresses of a device. Malformed structures are ignored.
+func onLEDeviceAddress(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	address, address_type, err := leDeviceAddress(entry)
+	if err != nil {
+		return nil
+	}
+
+	return adv.event(SniffData{
+		"le_address":      address,
+		"le_address_type": address_type,
+	},
+		"LE device address %s (%s)",
+		address,
+		address_type,
+	)
+}
@@ -0,0 +1,88 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/json for the structured lines, fmt for formatted strings, io and os for the destination,
+// regexp for stripping the colors, sync and sync/atomic for guarding the writer and the flag,
+// time for the timestamps, and bettercap/log for the interactive logging.
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bettercap/bettercap/log"
+)
+
+// Declaring the state of the JSON structured logging.
+var (
+	jsonLogs       int32                                            // Set to 1 when the module logs must be JSON lines.
+	jsonLogsLock             = sync.Mutex{}                         // Lock serializing the writes of the JSON lines.
+	jsonLogsWriter io.Writer = os.Stdout                            // Destination of the JSON lines.
+	ansiEscapes              = regexp.MustCompile(`\x1b\[[0-9;]*m`) // Matches the tui color sequences.
+)
+
+// jsonLogLine struct is a single structured log line.
+type jsonLogLine struct {
+	Time    time.Time `json:"time"`    // Time when the line was logged.
+	Level   string    `json:"level"`   // Severity of the line.
+	Module  string    `json:"module"`  // Name of the module logging the line.
+	Message string    `json:"message"` // Message without colors.
+}
+
+// setJSONLogs enables or disables the JSON structured logging.
+func setJSONLogs(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&jsonLogs, 1)
+	} else {
+		atomic.StoreInt32(&jsonLogs, 0)
+	}
+}
+
+// logJSON writes a structured log line, dropping the colors meant for the interactive console.
+func logJSON(level string, format string, args ...interface{}) {
+	line, err := json.Marshal(jsonLogLine{
+		Time:    time.Now(),
+		Level:   level,
+		Module:  "ble.sniff",
+		Message: ansiEscapes.ReplaceAllString(fmt.Sprintf(format, args...), ""),
+	})
+	if err != nil {
+		return
+	}
+
+	jsonLogsLock.Lock()
+	defer jsonLogsLock.Unlock()
+	jsonLogsWriter.Write(append(line, '\n'))
+}
+
+// logDebug logs a debug line either as JSON or through the session log.
+func logDebug(format string, args ...interface{}) {
+	if atomic.LoadInt32(&jsonLogs) == 1 {
+		logJSON("debug", format, args...)
+	} else {
+		log.Debug(format, args...)
+	}
+}
+
+// logInfo logs an informative line either as JSON or through the session log.
+func logInfo(format string, args ...interface{}) {
+	if atomic.LoadInt32(&jsonLogs) == 1 {
+		logJSON("info", format, args...)
+	} else {
+		log.Info(format, args...)
+	}
+}
+
+// logWarning logs a warning line either as JSON or through the session log.
+func logWarning(format string, args ...interface{}) {
+	if atomic.LoadInt32(&jsonLogs) == 1 {
+		logJSON("warning", format, args...)
+	} else {
+		log.Warning(format, args...)
+	}
+}
@@ -0,0 +1,126 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strings for joining the messages, and time for the capture time of the events.
+import (
+	"strings"
+	"time"
+)
+
+// advertiserFields are the fields every event of an advertisement carries about its advertiser, they are only
+// reported once in the merged event.
+var advertiserFields = []string{"rssi", "rssi_smoothed", "proximity", "hardware_vendor"}
+
+// mergedAdvertisement accumulates the events of the AD structures of an advertisement into a single one.
+type mergedAdvertisement struct {
+	event    *SnifferEvent // Merged event, nil until the first event of a structure is added.
+	data     SniffData     // Combined data of the structures.
+	messages []string      // Messages of the structures, in the order of the advertisement.
+}
+
+// add merges the event of an AD structure. The fields of the advertiser and of most structures are combined at the
+// top level, the manufacturer specific data, the service data and the unknown structures, which an advertisement
+// can carry several of, are listed under "manufacturer", "service_data" and "unknown".
+func (m *mergedAdvertisement) add(adType uint8, e SnifferEvent) {
+	if m.event == nil {
+		m.event = &e
+		m.data = SniffData{}
+	}
+	m.messages = append(m.messages, e.Message)
+
+	data, ok := e.Data.(SniffData)
+	if !ok {
+		return
+	}
+	structure := SniffData{}
+	for key, value := range data {
+		structure[key] = value
+	}
+	for _, key := range advertiserFields {
+		if value, found := structure[key]; found {
+			m.data[key] = value
+			delete(structure, key)
+		}
+	}
+
+	list := ""
+	switch {
+	case adType == AD_MANUFACTURER_DATA:
+		list = "manufacturer"
+	case adType == AD_SERVICE_DATA16 || adType == AD_SERVICE_DATA32 || adType == AD_SERVICE_DATA128:
+		list = "service_data"
+	case adParsers[adType] == nil:
+		list = "unknown"
+	}
+	if list != "" {
+		structures, _ := m.data[list].([]SniffData)
+		m.data[list] = append(structures, structure)
+		return
+	}
+
+	for key, value := range structure {
+		m.data[key] = value
+	}
+}
+
+// Event returns the merged event, or false if no structure was added.
+func (m *mergedAdvertisement) Event() (SnifferEvent, bool) {
+	if m.event == nil {
+		return SnifferEvent{}, false
+	}
+
+	e := *m.event
+	e.Data = m.data
+	e.Message = strings.Join(m.messages, ", ")
+	return e, true
+}
+
+// onAdvertisementMerged is onAdvertisementEntries reporting the AD structures of the advertisement in a single
+// "BLE ADVERT" event, whose data combines the ones of the structures and whose message lists theirs. The events of
+// the other protocols, like the Mesh ones, are still reported on their own.
+func onAdvertisementMerged(btleData map[string]interface{}, entries []map[string]interface{}, signal *SnifferSignal, stats *SnifferStats, t time.Time) []SnifferEvent {
+	adv := newAdvertisement(btleData, entries, signal, stats, t)
+
+	events := make([]SnifferEvent, 0, 1)
+	merged := mergedAdvertisement{}
+	for _, entry := range entries {
+		ad_type, structure_events, ok := adv.parse(entry)
+		if !ok {
+			continue
+		}
+		for _, e := range structure_events {
+			if e.Protocol == "BLE ADVERT" {
+				merged.add(ad_type, e)
+			} else {
+				events = append(events, e)
+			}
+		}
+	}
+
+	if e, ok := merged.Event(); ok {
+		events = append([]SnifferEvent{e}, events...)
+	}
+	return events
+}
+
+// advertisementEvents parses the AD structures of an advertisement into a single event or into an event per
+// structure, according to ble.sniff.merge. Only the structures of the types of ble.sniff.ad_types are parsed.
+func (mod *Sniffer) advertisementEvents(btleData map[string]interface{}, entries []map[string]interface{}, signal *SnifferSignal, t time.Time) []SnifferEvent {
+	entries = filterADTypes(entries, mod.Ctx.ADTypes)
+
+	var events []SnifferEvent
+	if mod.Ctx.Merge {
+		events = onAdvertisementMerged(btleData, entries, signal, mod.Stats, t)
+	} else {
+		events = onAdvertisementEntries(btleData, entries, signal, mod.Stats, t)
+	}
+
+	// Without ble.sniff.directed.target, the directed advertisements are reported as broadcast like the others.
+	if !mod.Ctx.DirectedTarget {
+		for i := range events {
+			events[i].Destination = "BROADCAST"
+		}
+	}
+	return events
+}
@@ -0,0 +1,167 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the big-endian fields, encoding/hex for the network ID and fmt for errors and formatted strings.
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// Declaring the types of the Mesh beacons.
+const (
+	meshBeaconUnprovisioned = 0x00
+	meshBeaconSecureNetwork = 0x01
+	meshBeaconPrivate       = 0x02
+)
+
+// Declaring the Generic Provisioning Control Format values of the PB-ADV frames, and the bearer opcodes.
+const (
+	pbAdvTransactionStart        = 0x00
+	pbAdvTransactionAck          = 0x01
+	pbAdvTransactionContinuation = 0x02
+	pbAdvBearerControl           = 0x03
+)
+
+// pbAdvBearerOpcodes maps the opcodes of the Bearer Control PB-ADV frames to their names.
+var pbAdvBearerOpcodes = map[uint8]string{
+	0x00: "Link Open",
+	0x01: "Link Ack",
+	0x02: "Link Close",
+}
+
+// formatMeshUUID formats the 16 bytes of a Device UUID in the usual dashed form.
+func formatMeshUUID(raw []byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", raw[0:4], raw[4:6], raw[6:8], raw[8:10], raw[10:16])
+}
+
+// decodeMeshMessage decodes the clear header of a Mesh Message AD structure, the rest of the network PDU being
+// encrypted.
+func decodeMeshMessage(raw []byte) (SniffData, string, error) {
+	if len(raw) < 1 {
+		return nil, "", fmt.Errorf("mesh message is empty")
+	}
+
+	ivi := raw[0] >> 7
+	nid := raw[0] & 0x7f
+	return SniffData{
+		"mesh_type": "message",
+		"ivi":       ivi,
+		"nid":       nid,
+		"length":    len(raw),
+	}, fmt.Sprintf("Mesh message NID 0x%02x IVI %d (%d bytes)", nid, ivi, len(raw)), nil
+}
+
+// decodeMeshBeacon decodes a Mesh Beacon AD structure: the Device UUID and OOB information of the unprovisioned
+// devices, the network ID and IV index of the secure network beacons, and only the type of the private ones.
+func decodeMeshBeacon(raw []byte) (SniffData, string, error) {
+	if len(raw) < 1 {
+		return nil, "", fmt.Errorf("mesh beacon is empty")
+	}
+
+	switch raw[0] {
+	case meshBeaconUnprovisioned:
+		// The URI hash is optional.
+		if len(raw) != 19 && len(raw) != 23 {
+			return nil, "", fmt.Errorf("unprovisioned device beacon must be 19 or 23 bytes long, got %d", len(raw))
+		}
+		uuid := formatMeshUUID(raw[1:17])
+		oob := binary.BigEndian.Uint16(raw[17:19])
+		data := SniffData{
+			"mesh_type":   "unprovisioned_beacon",
+			"device_uuid": uuid,
+			"oob_info":    fmt.Sprintf("0x%04x", oob),
+		}
+		if len(raw) == 23 {
+			data["uri_hash"] = fmt.Sprintf("0x%08x", binary.BigEndian.Uint32(raw[19:23]))
+		}
+		return data, fmt.Sprintf("Mesh unprovisioned device %s (OOB 0x%04x)", uuid, oob), nil
+	case meshBeaconSecureNetwork:
+		if len(raw) != 22 {
+			return nil, "", fmt.Errorf("secure network beacon must be 22 bytes long, got %d", len(raw))
+		}
+		network_id := hex.EncodeToString(raw[2:10])
+		iv_index := binary.BigEndian.Uint32(raw[10:14])
+		return SniffData{
+			"mesh_type":  "secure_network_beacon",
+			"flags":      raw[1],
+			"network_id": network_id,
+			"iv_index":   iv_index,
+		}, fmt.Sprintf("Mesh secure network beacon %s IV index %d", network_id, iv_index), nil
+	case meshBeaconPrivate:
+		return SniffData{
+			"mesh_type": "private_beacon",
+		}, "Mesh private beacon", nil
+	}
+	return nil, "", fmt.Errorf("unknown mesh beacon type 0x%02x", raw[0])
+}
+
+// decodePBADV decodes the header of a PB-ADV frame, the provisioning bearer of the unprovisioned devices: the link
+// ID, the transaction number and the kind of frame given by its Generic Provisioning Control Format.
+func decodePBADV(raw []byte) (SniffData, string, error) {
+	if len(raw) < 6 {
+		return nil, "", fmt.Errorf("PB-ADV frame must be at least 6 bytes long, got %d", len(raw))
+	}
+
+	link_id := binary.BigEndian.Uint32(raw[0:4])
+	transaction := raw[4]
+	data := SniffData{
+		"mesh_type":   "pb_adv",
+		"link_id":     fmt.Sprintf("0x%08x", link_id),
+		"transaction": transaction,
+	}
+
+	var frame string
+	switch raw[5] & 0x03 {
+	case pbAdvTransactionStart:
+		frame = "Transaction Start"
+	case pbAdvTransactionAck:
+		frame = "Transaction Ack"
+	case pbAdvTransactionContinuation:
+		frame = "Transaction Continuation"
+	case pbAdvBearerControl:
+		frame = "Bearer Control"
+		if opcode, ok := pbAdvBearerOpcodes[raw[5]>>2]; ok {
+			frame = opcode
+		}
+	}
+	data["frame"] = frame
+
+	return data, fmt.Sprintf("Mesh PB-ADV %s link 0x%08x transaction %d", frame, link_id, transaction), nil
+}
+
+// onMesh processes the Mesh Message, Mesh Beacon and PB-ADV AD structures, reporting them as "BLE MESH" events.
+// Malformed structures are ignored.
+func onMesh(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	ad_type, ok := adType(entry)
+	if !ok {
+		return nil
+	}
+	data_string, ok := entry["btcommon.eir_ad.entry.data"].(string)
+	if !ok {
+		return nil
+	}
+	raw, err := parseHexBytes(data_string)
+	if err != nil {
+		return nil
+	}
+
+	var data SniffData
+	var message string
+	switch ad_type {
+	case AD_MESH_MESSAGE:
+		data, message, err = decodeMeshMessage(raw)
+	case AD_MESH_BEACON:
+		data, message, err = decodeMeshBeacon(raw)
+	case AD_PB_ADV:
+		data, message, err = decodePBADV(raw)
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+
+	return adv.protocolEvent("BLE MESH", data, "%s", message)
+}
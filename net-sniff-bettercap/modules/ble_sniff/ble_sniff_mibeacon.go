@@ -0,0 +1,187 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the little-endian fields, fmt for errors and formatted strings, net for the MAC address,
+// and strings for the event message.
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Declaring the bits of the MiBeacon frame control.
+const (
+	MIBEACON_ENCRYPTED      = 0x0008
+	MIBEACON_MAC_INCLUDED   = 0x0010
+	MIBEACON_CAPABILITY     = 0x0020
+	MIBEACON_OBJECT         = 0x0040
+	MIBEACON_MESH           = 0x0080
+	MIBEACON_REGISTERED     = 0x0100
+	MIBEACON_VERSION_SHIFT  = 12
+	MIBEACON_IO_CAPABILITY  = 0x20
+	mibeaconHeaderSize      = 5
+	mibeaconObjectHeaderLen = 3
+)
+
+// Declaring the IDs of the MiBeacon objects carrying measurements.
+const (
+	MIBEACON_TEMPERATURE          = 0x1004
+	MIBEACON_HUMIDITY             = 0x1006
+	MIBEACON_ILLUMINANCE          = 0x1007
+	MIBEACON_MOISTURE             = 0x1008
+	MIBEACON_CONDUCTIVITY         = 0x1009
+	MIBEACON_BATTERY              = 0x100a
+	MIBEACON_TEMPERATURE_HUMIDITY = 0x100d
+	MIBEACON_FORMALDEHYDE         = 0x1010
+)
+
+// mibeaconProducts maps the product IDs of the most common MiBeacon sensors to their model.
+var mibeaconProducts = map[uint16]string{
+	0x0098: "HHCCJCY01",
+	0x01aa: "LYWSDCGQ",
+	0x0347: "CGG1",
+	0x045b: "LYWSD02",
+	0x055b: "LYWSD03MMC",
+}
+
+// mibeaconObjectSizes are the minimum sizes of the values of the MiBeacon objects carrying measurements.
+var mibeaconObjectSizes = map[uint16]int{
+	MIBEACON_TEMPERATURE:          2,
+	MIBEACON_HUMIDITY:             2,
+	MIBEACON_ILLUMINANCE:          3,
+	MIBEACON_MOISTURE:             1,
+	MIBEACON_CONDUCTIVITY:         2,
+	MIBEACON_BATTERY:              1,
+	MIBEACON_TEMPERATURE_HUMIDITY: 4,
+	MIBEACON_FORMALDEHYDE:         2,
+}
+
+// decodeMiBeaconObject decodes the value of a MiBeacon object into the measurements it carries, returning false
+// for the unknown objects or the ones whose value is too short.
+func decodeMiBeaconObject(id uint16, value []byte, decoded SniffData) ([]string, bool) {
+	if size, known := mibeaconObjectSizes[id]; !known || len(value) < size {
+		return nil, false
+	}
+
+	switch id {
+	case MIBEACON_TEMPERATURE:
+		decoded["temperature"] = float64(int16(binary.LittleEndian.Uint16(value))) / 10
+		return []string{fmt.Sprintf("temperature=%.1fC", decoded["temperature"])}, true
+	case MIBEACON_HUMIDITY:
+		decoded["humidity"] = float64(binary.LittleEndian.Uint16(value)) / 10
+		return []string{fmt.Sprintf("humidity=%.1f%%", decoded["humidity"])}, true
+	case MIBEACON_ILLUMINANCE:
+		illuminance := uint32(value[0]) | uint32(value[1])<<8 | uint32(value[2])<<16
+		decoded["illuminance"] = illuminance
+		return []string{fmt.Sprintf("illuminance=%dlux", illuminance)}, true
+	case MIBEACON_MOISTURE:
+		decoded["moisture"] = value[0]
+		return []string{fmt.Sprintf("moisture=%d%%", value[0])}, true
+	case MIBEACON_CONDUCTIVITY:
+		decoded["conductivity"] = binary.LittleEndian.Uint16(value)
+		return []string{fmt.Sprintf("conductivity=%dus/cm", decoded["conductivity"])}, true
+	case MIBEACON_BATTERY:
+		decoded["battery"] = value[0]
+		return []string{fmt.Sprintf("battery=%d%%", value[0])}, true
+	case MIBEACON_TEMPERATURE_HUMIDITY:
+		decoded["temperature"] = float64(int16(binary.LittleEndian.Uint16(value[0:2]))) / 10
+		decoded["humidity"] = float64(binary.LittleEndian.Uint16(value[2:4])) / 10
+		return []string{
+			fmt.Sprintf("temperature=%.1fC", decoded["temperature"]),
+			fmt.Sprintf("humidity=%.1f%%", decoded["humidity"]),
+		}, true
+	case MIBEACON_FORMALDEHYDE:
+		decoded["formaldehyde"] = float64(binary.LittleEndian.Uint16(value)) / 100
+		return []string{fmt.Sprintf("formaldehyde=%.2fmg/m3", decoded["formaldehyde"])}, true
+	}
+	return nil, false
+}
+
+// decodeMiBeacon decodes the Xiaomi MiBeacon service data: the frame control, the product ID and the frame counter,
+// followed by the optional MAC address, capability and objects announced by the frame control. The objects of the
+// encrypted frames can't be decoded without the bind key of the device, they are only reported as such.
+func decodeMiBeacon(data []byte) (SniffData, string, error) {
+	if len(data) < mibeaconHeaderSize {
+		return nil, "", fmt.Errorf("MiBeacon frame must be at least %d bytes long, got %d", mibeaconHeaderSize, len(data))
+	}
+
+	frame_control := binary.LittleEndian.Uint16(data[0:2])
+	product_id := binary.LittleEndian.Uint16(data[2:4])
+	decoded := SniffData{
+		"frame_control":       fmt.Sprintf("0x%04x", frame_control),
+		"mibeacon_version":    frame_control >> MIBEACON_VERSION_SHIFT,
+		"product_id":          fmt.Sprintf("0x%04x", product_id),
+		"frame_counter":       data[4],
+		"encrypted":           frame_control&MIBEACON_ENCRYPTED != 0,
+		"mibeacon_mesh":       frame_control&MIBEACON_MESH != 0,
+		"mibeacon_registered": frame_control&MIBEACON_REGISTERED != 0,
+	}
+	product, ok := mibeaconProducts[product_id]
+	if ok {
+		decoded["product"] = product
+	} else {
+		product = fmt.Sprintf("0x%04x", product_id)
+	}
+
+	// The header grows with the optional fields, in the order of their flags.
+	i := mibeaconHeaderSize
+	if frame_control&MIBEACON_MAC_INCLUDED != 0 {
+		if i+6 > len(data) {
+			return nil, "", fmt.Errorf("MiBeacon MAC address truncated")
+		}
+		// The MAC address is sent in reverse order.
+		mac := make(net.HardwareAddr, 6)
+		for j := range mac {
+			mac[j] = data[i+5-j]
+		}
+		decoded["mibeacon_mac"] = mac.String()
+		i += 6
+	}
+	if frame_control&MIBEACON_CAPABILITY != 0 {
+		if i+1 > len(data) {
+			return nil, "", fmt.Errorf("MiBeacon capability truncated")
+		}
+		capability := data[i]
+		decoded["capability"] = capability
+		i++
+		// The I/O capability follows the capability byte when announced by it.
+		if capability&MIBEACON_IO_CAPABILITY != 0 {
+			if i+2 > len(data) {
+				return nil, "", fmt.Errorf("MiBeacon I/O capability truncated")
+			}
+			i += 2
+		}
+	}
+
+	description := fmt.Sprintf("MiBeacon %s #%d", product, data[4])
+	if frame_control&MIBEACON_OBJECT == 0 {
+		return decoded, description, nil
+	} else if frame_control&MIBEACON_ENCRYPTED != 0 {
+		decoded["note"] = "encrypted objects, the bind key of the device is needed to decode them"
+		return decoded, description + " encrypted", nil
+	}
+
+	measurements := make([]string, 0)
+	for i+mibeaconObjectHeaderLen <= len(data) {
+		id := binary.LittleEndian.Uint16(data[i : i+2])
+		length := int(data[i+2])
+		i += mibeaconObjectHeaderLen
+		if i+length > len(data) {
+			return nil, "", fmt.Errorf("MiBeacon object 0x%04x truncated", id)
+		}
+
+		if values, ok := decodeMiBeaconObject(id, data[i:i+length], decoded); ok {
+			measurements = append(measurements, values...)
+		} else {
+			decoded[fmt.Sprintf("object_0x%04x", id)] = fmt.Sprintf("%x", data[i:i+length])
+		}
+		i += length
+	}
+	if len(measurements) > 0 {
+		description += " " + strings.Join(measurements, " ")
+	}
+
+	return decoded, description, nil
+}
@@ -0,0 +1,68 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func TestDecodeMiBeacon(t *testing.T) {
+	// LYWSDCGQ with its MAC address, a capability and a temperature and humidity object of 23.4 C and 45.6 %.
+	data, err := parseHexBytes("70:20:aa:01:2a:4f:88:4c:33:b8:cb:09:0d:10:04:ea:00:c8:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, description, err := decodeMiBeacon(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := SniffData{
+		"product":       "LYWSDCGQ",
+		"frame_counter": uint8(42),
+		"mibeacon_mac":  "cb:b8:33:4c:88:4f",
+		"capability":    uint8(0x09),
+		"temperature":   23.4,
+		"humidity":      45.6,
+		"encrypted":     false,
+	}
+	for key, value := range expected {
+		if decoded[key] != value {
+			t.Errorf("expected %s %v, got %v", key, value, decoded[key])
+		}
+	}
+	if description != "MiBeacon LYWSDCGQ #42 temperature=23.4C humidity=45.6%" {
+		t.Errorf("unexpected description %q", description)
+	}
+}
+
+func TestDecodeMiBeaconObjects(t *testing.T) {
+	// Battery object without MAC address, then an unknown object.
+	decoded, _, err := decodeMiBeacon([]byte{0x40, 0x20, 0x5b, 0x05, 0x01, 0x0a, 0x10, 0x01, 0x5d, 0x99, 0x10, 0x02, 0xab, 0xcd})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["battery"] != uint8(93) || decoded["product"] != "LYWSD03MMC" || decoded["object_0x1099"] != "abcd" {
+		t.Errorf("unexpected objects %v", decoded)
+	}
+}
+
+func TestDecodeMiBeaconEncrypted(t *testing.T) {
+	decoded, description, err := decodeMiBeacon([]byte{0x58, 0x58, 0x5b, 0x05, 0x07, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded["encrypted"] != true || decoded["note"] == nil || description != "MiBeacon LYWSD03MMC #7 encrypted" {
+		t.Errorf("expected an encrypted frame, got %v %q", decoded, description)
+	}
+}
+
+func TestDecodeMiBeaconTruncated(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x50, 0x20, 0xaa},
+		{0x50, 0x20, 0xaa, 0x01, 0x01, 0x4f, 0x88},
+		{0x60, 0x20, 0xaa, 0x01, 0x01, 0x0d, 0x10, 0x04, 0xea},
+	} {
+		if _, _, err := decodeMiBeacon(data); err == nil {
+			t.Errorf("expected an error for % x", data)
+		}
+	}
+}
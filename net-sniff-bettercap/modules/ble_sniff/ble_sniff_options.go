@@ -0,0 +1,408 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, io for the injected input, strconv for formatting the parameter values, strings for joining
+// the lists, time for durations, and bettercap/session for session management in bettercap.
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bettercap/bettercap/session"
+)
+
+// Option configures a Sniffer created with NewSnifferWithOptions by pre-seeding its parameters.
+type Option func(mod *Sniffer) error
+
+// NewSnifferWithOptions creates a new instance of Sniffer and applies the given options to its parameters,
+// returning an error if any of them is not valid. This is meant for programmatic users embedding the module,
+// the parameters can still be changed afterwards through the session like for NewSniffer.
+func NewSnifferWithOptions(s *session.Session, opts ...Option) (*Sniffer, error) {
+	mod := NewSniffer(s)
+
+	for _, opt := range opts {
+		if err := opt(mod); err != nil {
+			return nil, err
+		}
+	}
+
+	return mod, nil
+}
+
+// withParam returns an option setting a parameter, validated against the rules of the parameter.
+func withParam(name string, value string) Option {
+	return func(mod *Sniffer) error {
+		p := mod.Param(name)
+		if p == nil {
+			return fmt.Errorf("unknown parameter %s", name)
+		}
+
+		// Restore the previous value if the new one isn't valid.
+		_, prev := mod.Session.Env.Get(name)
+		mod.Session.Env.Set(name, value)
+		if err, _ := p.Get(mod.Session); err != nil {
+			mod.Session.Env.Set(name, prev)
+			return err
+		}
+
+		return nil
+	}
+}
+
+// WithInterface sets the extcap interface to capture from.
+func WithInterface(iface string) Option {
+	return withParam("ble.sniff.interface", iface)
+}
+
+// WithInterfaceStrict only captures from the configured interface, without looking for another nRF Sniffer.
+func WithInterfaceStrict(strict bool) Option {
+	return withParam("ble.sniff.interface.strict", strconv.FormatBool(strict))
+}
+
+// WithConfig sets the JSON or YAML file of parameter values applied when the sniffer is started.
+func WithConfig(path string) Option {
+	return withParam("ble.sniff.config", path)
+}
+
+// WithSource sets the TShark JSON file to read from instead of the interface.
+func WithSource(source string) Option {
+	return withParam("ble.sniff.source", source)
+}
+
+// WithPcap sets the PCAP file to read from instead of the interface.
+func WithPcap(pcap string) Option {
+	return withParam("ble.sniff.pcap", pcap)
+}
+
+// WithTShark sets the location of the tshark command.
+func WithTShark(tshark string) Option {
+	return withParam("ble.sniff.tshark", tshark)
+}
+
+// WithFilter sets the TShark display filter packets must match.
+func WithFilter(filter string) Option {
+	return withParam("ble.sniff.filter", filter)
+}
+
+// WithEmitDepth sets the depth of the JSON input at which the packet layers are decoded.
+func WithEmitDepth(depth int) Option {
+	return func(mod *Sniffer) error {
+		if depth < minEmitDepth || depth > maxEmitDepth {
+			return fmt.Errorf("JSON emit depth must be between %d and %d, got %d", minEmitDepth, maxEmitDepth, depth)
+		}
+		return withParam("ble.sniff.json.emit_depth", strconv.Itoa(depth))(mod)
+	}
+}
+
+// WithJSONStrict reports the input ending before the TShark JSON array is closed as a truncated capture.
+func WithJSONStrict(strict bool) Option {
+	return withParam("ble.sniff.json.strict", strconv.FormatBool(strict))
+}
+
+// WithReadBuffer sets the size in bytes of the buffer the output of TShark or the source file is read with.
+func WithReadBuffer(size int) Option {
+	return func(mod *Sniffer) error {
+		if size < minReadBuffer {
+			return fmt.Errorf("read buffer must be at least %d bytes, got %d", minReadBuffer, size)
+		}
+		return withParam("ble.sniff.read_buffer", strconv.Itoa(size))(mod)
+	}
+}
+
+// WithQueueSize sets the number of decoded packets waiting to be processed before the oldest are dropped.
+func WithQueueSize(size int) Option {
+	return func(mod *Sniffer) error {
+		if size < 1 {
+			return fmt.Errorf("packet queue size must be at least 1, got %d", size)
+		}
+		return withParam("ble.sniff.queue.size", strconv.Itoa(size))(mod)
+	}
+}
+
+// WithShutdownTimeout sets the time given on stop to process the queued packets and flush the outputs.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(mod *Sniffer) error {
+		if timeout < 0 {
+			return fmt.Errorf("shutdown timeout can't be negative")
+		} else if timeout >= stopTimeout {
+			return fmt.Errorf("shutdown timeout must be less than %s", stopTimeout)
+		}
+		return withParam("ble.sniff.shutdown.timeout", timeout.String())(mod)
+	}
+}
+
+// WithSummaryInterval pushes a BLE SUMMARY event with the counters of the last interval.
+func WithSummaryInterval(interval time.Duration) Option {
+	return func(mod *Sniffer) error {
+		if interval < 0 {
+			return fmt.Errorf("summary interval can't be negative")
+		}
+		return withParam("ble.sniff.summary.interval", interval.String())(mod)
+	}
+}
+
+// WithOutput sets the file events are written to, indented if pretty is true.
+func WithOutput(output string, pretty bool) Option {
+	return func(mod *Sniffer) error {
+		if err := withParam("ble.sniff.output", output)(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.output.pretty", strconv.FormatBool(pretty))(mod)
+	}
+}
+
+// WithOutputGzip compresses the output file with gzip, adding the .gz extension to its name.
+func WithOutputGzip(compress bool) Option {
+	return withParam("ble.sniff.output.gzip", strconv.FormatBool(compress))
+}
+
+// WithOutputBuffer buffers the writes to the output file by size bytes, flushed every interval, or disables the
+// buffering if the interval is 0.
+func WithOutputBuffer(size int64, interval time.Duration) Option {
+	return func(mod *Sniffer) error {
+		if err := withParam("ble.sniff.output.buffer", strconv.FormatInt(size, 10))(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.output.flush", interval.String())(mod)
+	}
+}
+
+// WithSplitByDevice writes the events of every device to its own file in the output directory.
+func WithSplitByDevice(split bool) Option {
+	return withParam("ble.sniff.output.split_by_device", strconv.FormatBool(split))
+}
+
+// WithS3 uploads the rotated output files to s3://bucket/prefix, deleting them once uploaded if deleteLocal is true.
+func WithS3(destination string, deleteLocal bool) Option {
+	return func(mod *Sniffer) error {
+		if _, err := parseS3Target(destination); err != nil {
+			return err
+		} else if err = withParam("ble.sniff.output.s3", destination)(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.output.s3.delete_local", strconv.FormatBool(deleteLocal))(mod)
+	}
+}
+
+// WithSQLite sets the SQLite database events are stored into.
+func WithSQLite(database string) Option {
+	return withParam("ble.sniff.sqlite", database)
+}
+
+// WithInflux writes the events to a bucket of an InfluxDB server, with the token of INFLUX_TOKEN if empty.
+func WithInflux(server string, org string, bucket string, token string) Option {
+	return func(mod *Sniffer) error {
+		if err := withParam("ble.sniff.influx", server)(mod); err != nil {
+			return err
+		} else if err := withParam("ble.sniff.influx.org", org)(mod); err != nil {
+			return err
+		} else if err := withParam("ble.sniff.influx.bucket", bucket)(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.influx.token", token)(mod)
+	}
+}
+
+// WithVerbose enables the reporting of link-layer control PDUs.
+func WithVerbose(verbose bool) Option {
+	return withParam("ble.sniff.verbose", strconv.FormatBool(verbose))
+}
+
+// WithColor prefixes the message of the events with their protocol colored by packet type.
+func WithColor(color bool) Option {
+	return withParam("ble.sniff.color", strconv.FormatBool(color))
+}
+
+// WithDisplayRate limits the number of events per second pushed to the session, 0 for no limit.
+func WithDisplayRate(rate int) Option {
+	return withParam("ble.sniff.display.rate", strconv.Itoa(rate))
+}
+
+// WithCompat enables pushing events with the net.sniff schema.
+func WithCompat(compat bool) Option {
+	return withParam("ble.sniff.compat", strconv.FormatBool(compat))
+}
+
+// WithTag sets the tag events are pushed to the session with.
+func WithTag(tag string) Option {
+	return withParam("ble.sniff.tag", tag)
+}
+
+// WithHexdump attaches the hexdump of the BLE layer of the packets to the advertising events.
+func WithHexdump(hexdump bool) Option {
+	return withParam("ble.sniff.hexdump", strconv.FormatBool(hexdump))
+}
+
+// WithSessionID sets the identifier attached to every event instead of a random UUID.
+func WithSessionID(id string) Option {
+	return withParam("ble.sniff.session_id", id)
+}
+
+// WithAnonymize replaces the device addresses of the events with hashes keyed by key, or by a random key for
+// the session if key is empty.
+func WithAnonymize(key string) Option {
+	return func(mod *Sniffer) error {
+		if err := withParam("ble.sniff.anonymize", "true")(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.anonymize.key", key)(mod)
+	}
+}
+
+// WithGPS attaches the location read from an NMEA serial device or from a gpsd host:port to every event.
+func WithGPS(device string) Option {
+	return withParam("ble.sniff.gps", device)
+}
+
+// WithEventSink sets the sink receiving the events instead of the session the module was created with.
+func WithEventSink(sink EventSink) Option {
+	return func(mod *Sniffer) error {
+		mod.sink = sink
+		return nil
+	}
+}
+
+// withReader decodes the TShark JSON read from r instead of spawning TShark or opening ble.sniff.source,
+// letting the tests run the whole pipeline without a sniffer.
+func withReader(r io.Reader) Option {
+	return func(mod *Sniffer) error {
+		mod.source = r
+		return nil
+	}
+}
+
+// WithMerge reports the AD structures of an advertisement in a single event, or in an event each if merge is false.
+func WithMerge(merge bool) Option {
+	return withParam("ble.sniff.merge", strconv.FormatBool(merge))
+}
+
+// WithDirectedTarget reports the events of the directed advertisements to their target address, or to BROADCAST
+// like the other advertisements if directed is false.
+func WithDirectedTarget(directed bool) Option {
+	return withParam("ble.sniff.directed.target", strconv.FormatBool(directed))
+}
+
+// WithADTypes restricts the parsing to the AD structures of the given types, all of them are parsed if none is given.
+func WithADTypes(types ...uint8) Option {
+	codes := make([]string, len(types))
+	for i, code := range types {
+		codes[i] = fmt.Sprintf("0x%02x", code)
+	}
+	return withParam("ble.sniff.ad_types", strings.Join(codes, ","))
+}
+
+// WithChangesOnly restricts the emitted events to the advertisements whose payload changed.
+func WithChangesOnly(changes bool) Option {
+	return withParam("ble.sniff.changes_only", strconv.FormatBool(changes))
+}
+
+// WithSensorsLog logs the manufacturer data readings of the devices, keeping size readings per device.
+func WithSensorsLog(size int) Option {
+	return withParam("ble.sniff.sensors.log", strconv.Itoa(size))
+}
+
+// WithCompanyAlerts pushes a "BLE ALERT" event when more advertisements of a company than its threshold are seen
+// within the window, alerting about the same company at most once per cooldown.
+func WithCompanyAlerts(thresholds map[uint16]int, window time.Duration, cooldown time.Duration) Option {
+	return func(mod *Sniffer) error {
+		list := ""
+		if len(thresholds) > 0 {
+			list = companyAlertsLabel(thresholds)
+		}
+		if err := withParam("ble.sniff.alert.company", list)(mod); err != nil {
+			return err
+		} else if err = withParam("ble.sniff.alert.window", window.String())(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.alert.cooldown", cooldown.String())(mod)
+	}
+}
+
+// WithConnectableOnly restricts the emitted events to connectable advertisements.
+func WithConnectableOnly(connectable bool) Option {
+	return withParam("ble.sniff.connectable_only", strconv.FormatBool(connectable))
+}
+
+// WithDropBadCRC drops the packets whose CRC check failed instead of decoding them.
+func WithDropBadCRC(drop bool) Option {
+	return withParam("ble.sniff.drop_bad_crc", strconv.FormatBool(drop))
+}
+
+// WithAdvChannelsOnly drops the packets not captured on the primary advertising channels.
+func WithAdvChannelsOnly(only bool) Option {
+	return withParam("ble.sniff.adv_channels_only", strconv.FormatBool(only))
+}
+
+// WithPDU restricts the emitted events to the given advertising PDU types, such as ADV_IND or SCAN_RSP.
+func WithPDU(names ...string) Option {
+	return func(mod *Sniffer) error {
+		if _, err := parsePDUTypes(strings.Join(names, ",")); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.pdu", strings.Join(names, ","))(mod)
+	}
+}
+
+// WithServices restricts the emitted events to the advertisements carrying service data for one of the given
+// services, as 16 bit UUIDs like FEAA or as 128 bit ones.
+func WithServices(uuids ...string) Option {
+	return func(mod *Sniffer) error {
+		if _, err := parseServiceUUIDs(strings.Join(uuids, ",")); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.service", strings.Join(uuids, ","))(mod)
+	}
+}
+
+// WithAdvDataLength drops the advertisements whose data length in bytes is out of range, a maximum of 0 meaning
+// no limit.
+func WithAdvDataLength(min int, max int) Option {
+	return func(mod *Sniffer) error {
+		if min < 0 || max < 0 || (max > 0 && min > max) {
+			return fmt.Errorf("invalid advertising data length range %d-%d", min, max)
+		} else if err := withParam("ble.sniff.min_len", strconv.Itoa(min))(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.max_len", strconv.Itoa(max))(mod)
+	}
+}
+
+// WithName restricts the emitted events to the devices whose local name contains the given substring,
+// excluding the ones whose name is unknown if strict is true.
+func WithName(name string, strict bool) Option {
+	return func(mod *Sniffer) error {
+		if err := withParam("ble.sniff.name", name)(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.name.strict", strconv.FormatBool(strict))(mod)
+	}
+}
+
+// WithProximity sets the RSSI thresholds in dBm of the immediate and near proximity zones.
+func WithProximity(immediate int, near int) Option {
+	return func(mod *Sniffer) error {
+		if near >= immediate {
+			return fmt.Errorf("near proximity threshold (%d) must be lower than the immediate one (%d)", near, immediate)
+		} else if err := withParam("ble.sniff.proximity.immediate", strconv.Itoa(immediate))(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.proximity.near", strconv.Itoa(near))(mod)
+	}
+}
+
+// WithRSSISmoothing sets the smoothing factor of the RSSI moving average and the time after which it is reset.
+func WithRSSISmoothing(alpha float64, reset time.Duration) Option {
+	return func(mod *Sniffer) error {
+		if alpha <= 0 || alpha > 1 {
+			return fmt.Errorf("RSSI smoothing factor must be in the (0.0, 1.0] interval, got %f", alpha)
+		} else if reset < 0 {
+			return fmt.Errorf("RSSI reset time can't be negative")
+		} else if err := withParam("ble.sniff.rssi.alpha", strconv.FormatFloat(alpha, 'f', -1, 64))(mod); err != nil {
+			return err
+		}
+		return withParam("ble.sniff.rssi.reset", reset.String())(mod)
+	}
+}
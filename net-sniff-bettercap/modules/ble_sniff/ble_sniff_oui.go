@@ -0,0 +1,84 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for reading the database line by line, fmt for errors, os for opening it,
+// strings for parsing the entries, and bettercap/network for the bundled manufacturers table.
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bettercap/bettercap/network"
+)
+
+// ouiTable maps the OUIs, as six lowercase hexadecimal digits, to the name of their manufacturer.
+type ouiTable map[string]string
+
+// ouiPrefix normalizes the first three bytes of an address or of an OUI database entry, such as 00:1A:7D,
+// 00-1A-7D or 001A7D, returning false if there aren't six hexadecimal digits.
+func ouiPrefix(value string) (string, bool) {
+	digits := strings.NewReplacer(":", "", "-", "", ".", "").Replace(value)
+	if len(digits) < 6 {
+		return "", false
+	}
+	digits = strings.ToLower(digits[:6])
+	for _, c := range digits {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return "", false
+		}
+	}
+	return digits, true
+}
+
+// loadOUIDatabase reads an OUI database in the Wireshark manuf format, one "OUI<tab>short name<tab>long name" entry
+// per line, where the long name is optional. Comments, blank lines and the entries of smaller blocks are skipped.
+func loadOUIDatabase(path string) (ouiTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := make(ouiTable)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || strings.Contains(fields[0], "/") {
+			continue
+		}
+		prefix, ok := ouiPrefix(fields[0])
+		if !ok {
+			continue
+		}
+
+		table[prefix] = strings.TrimSpace(fields[len(fields)-1])
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table) == 0 {
+		return nil, fmt.Errorf("no OUI entries found in %s", path)
+	}
+
+	return table, nil
+}
+
+// hardwareVendor returns the manufacturer of a public address, looked up in the OUI database set by ble.sniff.oui.db
+// first and in the manufacturers table bundled with bettercap otherwise. Random addresses have no manufacturer.
+func (mod *Sniffer) hardwareVendor(address string) string {
+	if mod.Ctx.OUITable != nil {
+		if prefix, ok := ouiPrefix(address); ok {
+			if vendor, found := mod.Ctx.OUITable[prefix]; found {
+				return vendor
+			}
+		}
+	}
+	return network.ManufLookup(address)
+}
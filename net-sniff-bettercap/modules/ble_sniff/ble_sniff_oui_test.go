@@ -0,0 +1,46 @@
+package ble_sniff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOUIDatabase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ble_sniff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "manuf")
+	db := "# comment\n\n9C:04:EB\tAcme\tAcme Devices Ltd\n00-1A-7D\tShort\n00:1B:C5:00:00:00/36\tBlock\tSmall Block Inc\n"
+	if err = ioutil.WriteFile(path, []byte(db), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := loadOUIDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ouiTable{"9c04eb": "Acme Devices Ltd", "001a7d": "Short"}
+	if len(table) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, table)
+	}
+	for prefix, vendor := range expected {
+		if table[prefix] != vendor {
+			t.Errorf("expected %s for %s, got %q", vendor, prefix, table[prefix])
+		}
+	}
+
+	// The database takes precedence over the bundled table.
+	mod := newBenchSniffer(discardSink{})
+	if vendor := mod.hardwareVendor("9c:04:eb:11:22:33"); vendor != "Apple, Inc." {
+		t.Errorf("expected the bundled manufacturer, got %q", vendor)
+	}
+	mod.Ctx.OUITable = table
+	if vendor := mod.hardwareVendor("9c:04:eb:11:22:33"); vendor != "Acme Devices Ltd" {
+		t.Errorf("expected the manufacturer of the database, got %q", vendor)
+	}
+}
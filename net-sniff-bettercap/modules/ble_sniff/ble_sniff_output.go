@@ -0,0 +1,207 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for buffering the output file, encoding/json for serializing the events, io for the writer,
+// strings for the file extension, sync/atomic for the shared counters, and time for the flush timer.
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// gzipExtension is the extension of the compressed output files.
+const gzipExtension = ".gz"
+
+// gzipOutputName returns the name of the compressed output file, adding the .gz extension if missing.
+func gzipOutputName(output string) string {
+	if strings.HasSuffix(strings.ToLower(output), gzipExtension) {
+		return output
+	}
+	return output + gzipExtension
+}
+
+// outputTarget returns the writer the events are written to before buffering: the compressor of the output file
+// if it is compressed, or the file itself.
+func (c *SnifferContext) outputTarget() io.Writer {
+	if c.outputGzip != nil {
+		return c.outputGzip
+	}
+	return c.OutputFile
+}
+
+// WriteEvent serializes an event to the output file, either as a compact JSON line or as an indented block.
+// It returns true if the event has been written.
+func (c *SnifferContext) WriteEvent(e SnifferEvent) (bool, error) {
+	c.outputLock.Lock()
+	defer c.outputLock.Unlock()
+
+	// Nothing to do if no output file was configured, or if it was lost by a failed rotation.
+	if c.outputLost != nil {
+		return false, c.outputLost
+	} else if c.OutputFile == nil && c.OutputPipe == nil && c.deviceFiles == nil {
+		return false, nil
+	}
+
+	// Only the events about a device are written to the per-device files.
+	device := ""
+	if c.deviceFiles != nil {
+		if device = eventDevice(e); device == "" {
+			return false, nil
+		}
+	}
+
+	// Every record states the version of its schema, also for the events built without NewSnifferEvent.
+	if e.Version == 0 {
+		e.Version = EventVersion
+	}
+
+	var raw []byte
+	var err error
+	// Named pipes and per-device files are always streamed as NDJSON.
+	if c.OutputPretty && c.OutputPipe == nil && c.deviceFiles == nil {
+		raw, err = json.MarshalIndent(e, "", "  ")
+	} else {
+		raw, err = json.Marshal(e)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Every record is terminated by a newline so the file can be consumed as a stream.
+	raw = append(raw, '\n')
+
+	// Per-device files aren't rotated.
+	if c.deviceFiles != nil {
+		if err = c.deviceFiles.Write(device, raw); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	// Events are dropped while no reader is connected to the pipe.
+	if c.OutputPipe != nil {
+		return c.OutputPipe.WriteLine(raw), nil
+	}
+
+	// Roll the file over before it exceeds the configured size or age.
+	if c.shouldRotateUnlocked(len(raw)) {
+		if err = c.rotateUnlocked(); err != nil && c.OutputFile == nil {
+			return false, err
+		} else if err != nil {
+			// The event is still written to the reopened file.
+			logWarning("%v", err)
+		}
+	}
+
+	// The writes are buffered and flushed on an interval, unless ble.sniff.output.flush is 0.
+	writer := c.outputTarget()
+	if c.outputWriter != nil {
+		writer = c.outputWriter
+	}
+	// The size of a compressed file is the one of the events before compression.
+	n, err := writer.Write(raw)
+	c.outputSize += int64(n)
+	if err != nil {
+		return false, err
+	}
+	// Without buffering, the compressed events mustn't wait in the compressor either.
+	if c.outputWriter == nil && c.outputGzip != nil {
+		if err = c.outputGzip.Flush(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// flushOutputUnlocked writes the buffered events to the output file, through the compressor if it is compressed.
+// The caller must hold the output lock.
+func (c *SnifferContext) flushOutputUnlocked() error {
+	if c.outputWriter != nil {
+		if err := c.outputWriter.Flush(); err != nil {
+			return err
+		}
+	}
+	if c.outputGzip != nil {
+		return c.outputGzip.Flush()
+	}
+	return nil
+}
+
+// closeOutputGzipUnlocked writes the end of the gzip stream of the compressed output file, so that it can be read
+// once closed. The caller must hold the output lock.
+func (c *SnifferContext) closeOutputGzipUnlocked() error {
+	if c.outputGzip == nil {
+		return nil
+	}
+	return c.outputGzip.Close()
+}
+
+// FlushOutput writes the buffered events to the output file.
+func (c *SnifferContext) FlushOutput() error {
+	c.outputLock.Lock()
+	defer c.outputLock.Unlock()
+
+	return c.flushOutputUnlocked()
+}
+
+// bufferOutput buffers the writes to the output file, flushing them every ble.sniff.output.flush from a goroutine
+// stopped by stopOutputFlusher, so that the events don't wait longer than the interval to reach the file.
+func (c *SnifferContext) bufferOutput(size int) {
+	c.outputWriter = bufio.NewWriterSize(c.outputTarget(), size)
+	c.outputQuit = make(chan struct{})
+	c.outputDone = make(chan struct{})
+
+	go func() {
+		defer close(c.outputDone)
+
+		ticker := time.NewTicker(c.OutputFlush)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.FlushOutput(); err != nil {
+					logWarning("error flushing the output to %s: %v", c.Output, err)
+				}
+			case <-c.outputQuit:
+				return
+			}
+		}
+	}()
+}
+
+// stopOutputFlusher stops flushing the output file on the interval and writes the last buffered events.
+func (c *SnifferContext) stopOutputFlusher() {
+	if c.outputQuit != nil {
+		close(c.outputQuit)
+		<-c.outputDone
+		c.outputQuit = nil
+	}
+
+	if err := c.FlushOutput(); err != nil {
+		logWarning("error flushing the output to %s: %v", c.Output, err)
+	}
+}
+
+// onEventOutput is the event handler writing every pushed event to the output sinks.
+func (mod *Sniffer) onEventOutput(e SnifferEvent) {
+	if written, err := mod.Ctx.WriteEvent(e); err != nil {
+		mod.Warning("error writing event to %s: %v", mod.Ctx.Output, err)
+	} else if written {
+		atomic.AddUint64(&mod.Stats.NumWrote, 1)
+	}
+
+	if mod.Ctx.SQLiteSink != nil {
+		if err := mod.Ctx.SQLiteSink.Add(e); err != nil {
+			mod.Warning("error storing event to %s: %v", mod.Ctx.SQLite, err)
+		}
+	}
+
+	if mod.Ctx.influx != nil {
+		mod.Ctx.influx.Add(e)
+	}
+}
@@ -0,0 +1,172 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strconv for parsing the channel index, sync/atomic for the counters shared by the workers and time for
+// time-related functions.
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// advertisingAccessAddress is the access address of the packets sent on the advertising channels.
+const advertisingAccessAddress = "0x8e89bed6"
+
+// firstPrimaryChannel is the index of the first of the primary advertising channels 37, 38 and 39, the lower ones
+// being data channels.
+const firstPrimaryChannel = 37
+
+// onPrimaryChannel returns true if a packet was captured on a primary advertising channel, according to the channel
+// index of the nRF sniffer or, without it, to the access address of the packet.
+func onPrimaryChannel(packetMap map[string]interface{}, btleData map[string]interface{}) bool {
+	if nordic, ok := packetMap["nordic_ble"].(map[string]interface{}); ok {
+		if channel_string, ok := nordic["nordic_ble.channel"].(string); ok {
+			if channel, err := strconv.Atoi(channel_string); err == nil {
+				return channel >= firstPrimaryChannel
+			}
+		}
+	}
+	access_address, _ := btleData["btle.access_address"].(string)
+	return access_address == advertisingAccessAddress
+}
+
+// onPacket processes a packet decoded from the TShark output, returning false if it isn't a BLE packet.
+// Packets are told apart by access address first, so data channel packets skip the advertisement decoding.
+func (mod *Sniffer) onPacket(value interface{}, now time.Time) bool {
+	// Extract packet data as a map.
+	packet_map, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	// Count the packets corrupted on the air, and drop them if they must not be decoded.
+	if !crcOK(packet_map) {
+		atomic.AddUint64(&mod.Stats.NumBadCRC, 1)
+		if mod.Ctx.DropBadCRC {
+			return false
+		}
+	}
+
+	// Extract BLE data from the packet.
+	btle_data, ok := packet_map["btle"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	// Extract the access address from the BLE data.
+	access_address, ok := btle_data["btle.access_address"].(string)
+	if !ok {
+		return false
+	}
+
+	// Count and drop the packets of the data channels, including the secondary advertisements, if only the
+	// primary advertising channels are wanted. This applies to the verbose mode too.
+	if mod.Ctx.AdvChannelsOnly && !onPrimaryChannel(packet_map, btle_data) {
+		atomic.AddUint64(&mod.Stats.NumChannelFiltered, 1)
+		return true
+	}
+
+	if access_address == advertisingAccessAddress {
+		mod.onAdvertisingPacket(packet_map, btle_data, now)
+	} else {
+		mod.onDataPacket(packet_map, btle_data, access_address, now)
+	}
+
+	// Increment the matched packets count and the captured bytes.
+	atomic.AddUint64(&mod.Stats.NumMatched, 1)
+	atomic.AddUint64(&mod.Stats.NumBytes, packetLength(packet_map))
+	return true
+}
+
+// onAdvertisingPacket processes a packet sent on the advertising channels.
+func (mod *Sniffer) onAdvertisingPacket(packetMap map[string]interface{}, btleData map[string]interface{}, now time.Time) {
+	pdu_type, has_pdu_type := pduType(btleData)
+	follow := mod.followed()
+	raw_hex := mod.rawHex(packetMap)
+
+	// Start tracking the connection announced by a CONNECT_IND.
+	if has_pdu_type && pdu_type == PDU_CONNECT_IND {
+		params, events := onConnectInd(btleData, now)
+		if params != nil {
+			mod.Stats.AddConnection(NewSnifferConnection(params, now))
+		}
+		// The connection is tracked even if its event is filtered out.
+		if (follow == "" && mod.matchesPDU(pdu_type, has_pdu_type)) || (follow != "" && involvesAddress(btleData, follow, mod.Ctx.anonymizer)) {
+			mod.pushAll(withRawHex(events, raw_hex))
+		}
+	}
+
+	// The AD structures are extracted once and shared by the device tracking and the parsers.
+	entries := eirEntries(btleData)
+
+	// Drop the advertisements whose data length is out of range before decoding them any further, unless
+	// a device is followed.
+	if follow == "" && has_pdu_type && carriesAdvData(pdu_type) && !mod.matchesLength(entries) {
+		atomic.AddUint64(&mod.Stats.NumLengthFiltered, 1)
+		return
+	}
+
+	// Update the advertiser in the devices table and compute its proximity.
+	signal := mod.trackAdvertiser(packetMap, btleData, entries, now)
+	wanted := mod.isWanted(btleData, pdu_type, has_pdu_type)
+	if follow != "" {
+		// Following a device overrides the other filters. Not every fragment of an extended advertisement
+		// carries the address, so their chains are only filtered once reassembled.
+		wanted = involvesAddress(btleData, follow, mod.Ctx.anonymizer) || (has_pdu_type && pdu_type == PDU_ADV_EXT_IND)
+	}
+	// Count the advertisements of the companies alerted about, the bursts are detected whatever the filters.
+	if !mod.recon && mod.Ctx.alerts != nil && has_pdu_type && carriesAdvData(pdu_type) {
+		mod.checkCompanyAlerts(btleData, entries, now)
+	}
+	// Log the manufacturer data of the sensors, even while only the inventory is built.
+	if wanted && mod.Ctx.sensors != nil && has_pdu_type && carriesAdvData(pdu_type) {
+		mod.logSensorData(btleData, entries, now)
+	}
+	// Process the advertisement data, unless it is excluded by the filters or only the inventory is built.
+	if !mod.recon && wanted {
+		// With ble.sniff.changes_only, the advertisements repeating the previous payload of their device are
+		// counted but not decoded, unless a device is followed.
+		changed := true
+		if follow == "" && has_pdu_type && carriesAdvData(pdu_type) {
+			changed = mod.isChanged(btleData, entries)
+		}
+		// Scan requests carry no data, they are only reported in verbose mode or for the device being followed.
+		if has_pdu_type && pdu_type == PDU_SCAN_REQ && (mod.Ctx.Verbose || follow != "") {
+			mod.onScanRequest(btleData, now)
+		}
+		// Scan responses complete the record of the device with its name and services, they are only reported as
+		// such and not as advertisements too. Extended advertisements are reported once their AUX chain is
+		// reassembled.
+		if has_pdu_type && pdu_type == PDU_SCAN_RSP {
+			if changed {
+				mod.onScanResponse(btleData, signal, raw_hex, now)
+			}
+		} else if has_pdu_type && pdu_type == PDU_ADV_EXT_IND {
+			mod.onExtendedAdvertisement(btleData, signal, now)
+		} else if changed {
+			mod.pushAll(withRawHex(mod.advertisementEvents(btleData, entries, signal, now), raw_hex))
+		}
+	}
+
+	// Increment the advertisement count.
+	atomic.AddUint64(&mod.Stats.NumAdvertisements, 1)
+}
+
+// onDataPacket processes a packet sent on the data channel of a connection.
+func (mod *Sniffer) onDataPacket(packetMap map[string]interface{}, btleData map[string]interface{}, accessAddress string, now time.Time) {
+	// Account the data channel packet to its connection.
+	mod.Stats.CountConnectionPacket(accessAddress, isFromCentral(packetMap), now)
+
+	// Data channel packets are only reported in verbose mode, and only for the connections of the device being followed.
+	if mod.Ctx.Verbose {
+		if follow := mod.followed(); follow == "" || mod.Stats.ConnectionInvolves(accessAddress, follow, mod.Ctx.anonymizer) {
+			mod.pushAll(onControl(btleData, accessAddress, now))
+		}
+	}
+
+	// Stop tracking connections once they are terminated.
+	if opcode, ok := controlOpcode(btleData); ok && opcode == LL_TERMINATE_IND {
+		mod.Stats.RemoveConnection(accessAddress)
+	}
+}
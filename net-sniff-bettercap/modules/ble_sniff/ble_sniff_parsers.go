@@ -2,9 +2,11 @@
 package ble_sniff
 
 // Importing necessary packages:
-// strconv for string conversion, strings for string manipulation, time for time-related functions,
-// and gatt for handling Bluetooth Low Energy attributes.
+// encoding/hex for byte strings, fmt for formatted strings, strconv for string conversion, strings for string manipulation,
+// time for the capture time of the events, and gatt for handling Bluetooth Low Energy attributes.
 import (
+	"encoding/hex"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -12,30 +14,218 @@ import (
 	"github.com/bettercap/gatt"
 )
 
-// onProprietary is a function that processes proprietary BLE advertisement data.
-func onProprietary(btleData map[string]interface{}) {
+// Advertising channel PDU types as reported in btle.advertising_header.pdu_type.
+const (
+	PDU_ADV_IND         = 0x00
+	PDU_ADV_DIRECT_IND  = 0x01
+	PDU_ADV_NONCONN_IND = 0x02
+	PDU_SCAN_REQ        = 0x03
+	PDU_SCAN_RSP        = 0x04
+	PDU_CONNECT_IND     = 0x05
+	PDU_ADV_SCAN_IND    = 0x06
+	PDU_ADV_EXT_IND     = 0x07
+)
+
+// pduTypeNames maps the advertising PDU types to their names in the Bluetooth Core Specification (Vol 6, Part B, 2.3).
+var pduTypeNames = map[uint8]string{
+	PDU_ADV_IND:         "ADV_IND",
+	PDU_ADV_DIRECT_IND:  "ADV_DIRECT_IND",
+	PDU_ADV_NONCONN_IND: "ADV_NONCONN_IND",
+	PDU_SCAN_REQ:        "SCAN_REQ",
+	PDU_SCAN_RSP:        "SCAN_RSP",
+	PDU_CONNECT_IND:     "CONNECT_IND",
+	PDU_ADV_SCAN_IND:    "ADV_SCAN_IND",
+	PDU_ADV_EXT_IND:     "ADV_EXT_IND",
+}
+
+// pduTypeName returns the name of an advertising PDU type, or PDU_0xNN for reserved ones.
+func pduTypeName(pduType uint8) string {
+	if name, found := pduTypeNames[pduType]; found {
+		return name
+	}
+	return fmt.Sprintf("PDU_0x%02x", pduType)
+}
+
+// pduLabel returns the name of the advertising PDU type of the BLE data, or an empty string if it isn't present.
+func pduLabel(btleData map[string]interface{}) string {
+	if pdu_type, ok := pduType(btleData); ok {
+		return pduTypeName(pdu_type)
+	}
+	return ""
+}
+
+// isConnectable returns true for the advertising PDU types a central can answer with a CONNECT_IND:
+// ADV_IND (0x00) and ADV_DIRECT_IND (0x01), as well as ADV_EXT_IND (0x07) whose auxiliary packets may be connectable.
+// ADV_NONCONN_IND (0x02) and ADV_SCAN_IND (0x06) are not connectable, while SCAN_REQ (0x03), SCAN_RSP (0x04)
+// and CONNECT_IND (0x05) are not advertisements at all.
+func isConnectable(pduType uint8) bool {
+	switch pduType {
+	case PDU_ADV_IND, PDU_ADV_DIRECT_IND, PDU_ADV_EXT_IND:
+		return true
+	}
+	return false
+}
 
-	// Extract the advertising address from the BLE data.
-	advert_address, ok := btleData["btle.advertising_address"].(string)
-	// If the address isn't present, return from the function.
+// pduType extracts the advertising PDU type from the BLE data, if present.
+func pduType(btleData map[string]interface{}) (uint8, bool) {
+	header, ok := btleData["btle.advertising_header_tree"].(map[string]interface{})
 	if !ok {
-		return
+		return 0, false
 	}
 
-	// Extract advertising data from the BLE data.
-	advertising_data, ok := btleData["btcommon.eir_ad.advertising_data"].(map[string]interface{})
-	// If advertising data isn't present, return from the function.
+	pdu_type_string, ok := header["btle.advertising_header.pdu_type"].(string)
 	if !ok {
-		return
+		return 0, false
+	}
+
+	pdu_type, err := parseHexUint(pdu_type_string, 8)
+	if err != nil {
+		return 0, false
 	}
 
-	// Extract EIR advertisement entry from the advertising data.
-	eir_ad_entry, ok := advertising_data["btcommon.eir_ad.entry"].(map[string]interface{})
-	// If the EIR advertisement entry isn't present, return from the function.
+	return uint8(pdu_type), true
+}
+
+// Types of the advertising address, as told by the TxAdd bit of the advertising header.
+const (
+	AddressPublic = "public"
+	AddressRandom = "random"
+)
+
+// addressType extracts the type of the advertising address from the TxAdd bit of the advertising header, if present.
+func addressType(btleData map[string]interface{}) (string, bool) {
+	header, ok := btleData["btle.advertising_header_tree"].(map[string]interface{})
 	if !ok {
-		return
+		return "", false
 	}
 
+	tx_add, ok := header["btle.advertising_header.randomized_tx"].(string)
+	if !ok {
+		return "", false
+	}
+
+	switch strings.ToLower(tx_add) {
+	case "1", "true":
+		return AddressRandom, true
+	case "0", "false":
+		return AddressPublic, true
+	}
+	return "", false
+}
+
+// Kinds of the random addresses, as told by their two most significant bits.
+const (
+	AddressStatic        = "static"
+	AddressResolvable    = "resolvable private"
+	AddressNonResolvable = "non-resolvable private"
+)
+
+// addressKind returns the type of the advertising address, and for the random ones whether they are static or
+// private. The private addresses are the rotating ones, the resolvable ones can only be linked together with the
+// identity resolving key of the device.
+func addressKind(btleData map[string]interface{}) (string, bool) {
+	address_type, ok := addressType(btleData)
+	if !ok || address_type == AddressPublic {
+		return address_type, ok
+	}
+
+	address, ok := btleData["btle.advertising_address"].(string)
+	if !ok || len(address) < 2 {
+		return "", false
+	}
+	msb, err := strconv.ParseUint(address[:2], 16, 8)
+	if err != nil {
+		return "", false
+	}
+	switch msb >> 6 {
+	case 0x03:
+		return AddressStatic, true
+	case 0x01:
+		return AddressResolvable, true
+	case 0x00:
+		return AddressNonResolvable, true
+	}
+	// The remaining combination is reserved.
+	return AddressRandom, true
+}
+
+// parseHexUint converts a TShark hex string such as "0x02" into an unsigned integer of the given bit size.
+func parseHexUint(value string, bitSize int) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(value, "0x"), 16, bitSize)
+}
+
+// parseUint converts a TShark numeric string, either decimal or "0x" prefixed hex, into an unsigned integer.
+func parseUint(value string, bitSize int) (uint64, error) {
+	if strings.HasPrefix(value, "0x") {
+		return parseHexUint(value, bitSize)
+	}
+	return strconv.ParseUint(value, 10, bitSize)
+}
+
+// parseHexBytes converts a TShark byte string such as "01:09:20" into a byte slice.
+func parseHexBytes(value string) ([]byte, error) {
+	return hex.DecodeString(strings.Replace(value, ":", "", -1))
+}
+
+// eirEntries returns the AD structures of the advertising data. TShark repeats the entry key for each structure,
+// which decodes to a list when duplicate keys are merged into arrays, or to a single entry otherwise.
+func eirEntries(btleData map[string]interface{}) []map[string]interface{} {
+	advertising_data, ok := btleData["btcommon.eir_ad.advertising_data"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	switch entry := advertising_data["btcommon.eir_ad.entry"].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{entry}
+	case []interface{}:
+		entries := make([]map[string]interface{}, 0, len(entry))
+		for _, value := range entry {
+			if m, ok := value.(map[string]interface{}); ok {
+				entries = append(entries, m)
+			}
+		}
+		return entries
+	}
+
+	return nil
+}
+
+// findField looks a field up in the BLE data and in the subtrees TShark nests it under, returning the first match.
+func findField(data map[string]interface{}, key string) (interface{}, bool) {
+	if value, found := data[key]; found {
+		return value, true
+	}
+	for _, value := range data {
+		if tree, ok := value.(map[string]interface{}); ok {
+			if found, ok := findField(tree, key); ok {
+				return found, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// stringValues returns the values of a field holding either a single string or a list of them.
+func stringValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// onProprietary is a function that processes a manufacturer specific data AD structure of an advertisement,
+// decoding the payload of the known companies.
+func onProprietary(adv *advertisement, eir_ad_entry map[string]interface{}) []SnifferEvent {
 	// Extract the data string from the EIR advertisement entry.
 	data, ok := eir_ad_entry["btcommon.eir_ad.entry.data"].(string)
 	// If the data isn't present, assign a default message to 'data'.
@@ -47,30 +237,94 @@ func onProprietary(btleData map[string]interface{}) {
 	company_code_string, ok := eir_ad_entry["btcommon.eir_ad.entry.company_id"].(string)
 	// If the company code isn't present, return from the function.
 	if !ok {
-		return
+		return nil
 	}
 
 	// Remove the "0x" prefix from the company code string and convert it to an integer.
-	company_code_hex := strings.Replace(company_code_string, "0x", "", -1)
-	company_code, _ := strconv.ParseUint(company_code_hex, 16, 16)
+	company_code, _ := parseHexUint(company_code_string, 16)
 	// Look up the company name using the company code in the gatt package.
 	company_name := gatt.CompanyIdents[uint16(company_code)]
+	// Account the advertisement to the company.
+	adv.Stats.CountCompany(uint16(company_code))
+
+	event_data := SniffData{
+		"data":       data,
+		"company_id": uint16(company_code),
+		"company":    company_name,
+	}
 
-	// Create a new SnifferEvent with the current time, protocol "BLE ADVERT", source address,
-	// destination as "BROADCAST", data, and a formatted message including the company name.
-	// Then push this event.
-	NewSnifferEvent(time.Now(),
-		"BLE ADVERT",
-		advert_address,
-		"BROADCAST",
-		data,
+	// Route the payload to the decoder registered for the company, if any.
+	if decoder, found := manufacturerDecoder(uint16(company_code)); found {
+		if protocol, description, ok := decodePayload(decoder, data, event_data); ok && protocol != "" {
+			return adv.protocolEvent(protocol, event_data, "%s", description)
+		} else if ok {
+			return adv.event(event_data,
+				"Proprietary %s %s",
+				company_name,
+				description,
+			)
+		}
+	}
+
+	// Report the payload along with the signal information of the advertiser.
+	return adv.event(event_data,
 		"Proprietary %s Data",
 		company_name,
-	).Push()
+	)
+}
+
+// onAdvertisement is a function that processes generic BLE advertisements, dispatching each of their AD structures
+// to the parser registered for its type, and returns the events produced by the parsers, stamped with the capture time t.
+func onAdvertisement(btleData map[string]interface{}, signal *SnifferSignal, stats *SnifferStats, t time.Time) []SnifferEvent {
+	return onAdvertisementEntries(btleData, eirEntries(btleData), signal, stats, t)
+}
+
+// newAdvertisement creates the advertisement the AD structures of a packet are parsed for.
+func newAdvertisement(btleData map[string]interface{}, entries []map[string]interface{}, signal *SnifferSignal, stats *SnifferStats, t time.Time) *advertisement {
+	return &advertisement{
+		Data:    btleData,
+		Entries: entries,
+		PDU:     pduLabel(btleData),
+		Signal:  signal,
+		Stats:   stats,
+		Time:    t,
+		Target:  advertisementTarget(btleData),
+	}
+}
+
+// advertisementTarget returns the target address of a directed advertisement, the TargetA of an ADV_DIRECT_IND or
+// of the extended header, or "BROADCAST" for the advertisements meant for every device.
+func advertisementTarget(btleData map[string]interface{}) string {
+	if target, ok := findString(btleData, "btle.target_address", "btle.extended_advertising_header.target_address"); ok && target != "" {
+		return strings.ToLower(target)
+	}
+	return "BROADCAST"
 }
 
-// onAdvertisement is a function that processes generic BLE advertisements by calling onProprietary.
-func onAdvertisement(btleData map[string]interface{}) {
-	// It directly delegates the handling to onProprietary function.
-	onProprietary(btleData)
+// parse dispatches an AD structure to the parser registered for its type, returning its type and the events
+// produced by the parser, or false if the structure has no type.
+func (adv *advertisement) parse(entry map[string]interface{}) (uint8, []SnifferEvent, bool) {
+	ad_type, ok := adType(entry)
+	if !ok {
+		return 0, nil, false
+	}
+
+	if parser, found := adParsers[ad_type]; found {
+		return ad_type, parser(adv, entry), true
+	}
+	return ad_type, onUnknownAD(adv, ad_type, entry), true
+}
+
+// onAdvertisementEntries is onAdvertisement for AD structures already extracted from the BLE data.
+func onAdvertisementEntries(btleData map[string]interface{}, entries []map[string]interface{}, signal *SnifferSignal, stats *SnifferStats, t time.Time) []SnifferEvent {
+	adv := newAdvertisement(btleData, entries, signal, stats, t)
+
+	events := make([]SnifferEvent, 0, len(entries))
+	for _, entry := range entries {
+		if _, structure_events, ok := adv.parse(entry); ok {
+			events = append(events, structure_events...)
+		}
+	}
+
+	return events
 }
@@ -0,0 +1,404 @@
+package ble_sniff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// multiEntryAdvertisement is an advertisement carrying flags, a name, services and manufacturer data,
+// as decoded by TShark with --no-duplicate-keys.
+var multiEntryAdvertisement = map[string]interface{}{
+	"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	"btcommon.eir_ad.advertising_data": map[string]interface{}{
+		"btcommon.eir_ad.entry": []interface{}{
+			map[string]interface{}{
+				"btcommon.eir_ad.entry.length":                             "2",
+				"btcommon.eir_ad.entry.type":                               "0x01",
+				"btcommon.eir_ad.entry.flags.le_general_discoverable_mode": "1",
+				"btcommon.eir_ad.entry.flags.bredr_not_supported":          "1",
+			},
+			map[string]interface{}{
+				"btcommon.eir_ad.entry.length":      "8",
+				"btcommon.eir_ad.entry.type":        "0x09",
+				"btcommon.eir_ad.entry.device_name": "Sensor",
+			},
+			map[string]interface{}{
+				"btcommon.eir_ad.entry.length":  "5",
+				"btcommon.eir_ad.entry.type":    "0x03",
+				"btcommon.eir_ad.entry.uuid_16": []interface{}{"0x180f", "0x181a"},
+			},
+			map[string]interface{}{
+				"btcommon.eir_ad.entry.length":     "11",
+				"btcommon.eir_ad.entry.type":       "0xff",
+				"btcommon.eir_ad.entry.company_id": "0x004c",
+				"btcommon.eir_ad.entry.data":       "10:06:09:1c:81:77:52:18",
+			},
+		},
+	},
+}
+
+func TestEIREntriesMultipleStructures(t *testing.T) {
+	entries := eirEntries(multiEntryAdvertisement)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d", len(entries))
+	}
+
+	expected := []uint8{AD_FLAGS, AD_COMPLETE_LOCAL_NAME, AD_COMPLETE_UUID16, AD_MANUFACTURER_DATA}
+	for i, entry := range entries {
+		if ad_type, ok := adType(entry); !ok || ad_type != expected[i] {
+			t.Errorf("entry %d: expected type 0x%02x, got 0x%02x", i, expected[i], ad_type)
+		}
+	}
+
+	name, uuids := parseDeviceInfo(multiEntryAdvertisement)
+	if name != "Sensor" {
+		t.Errorf("expected name Sensor, got %q", name)
+	}
+	if len(uuids) != 2 || uuids[0] != "0x180f" || uuids[1] != "0x181a" {
+		t.Errorf("unexpected uuids %v", uuids)
+	}
+
+	manufacturer := manufacturerData(entries)
+	if len(manufacturer) != 1 || manufacturer[0]["company_id"] != uint16(0x004c) {
+		t.Errorf("unexpected manufacturer data %v", manufacturer)
+	}
+}
+
+func TestEIREntriesSingleStructure(t *testing.T) {
+	btleData := map[string]interface{}{
+		"btcommon.eir_ad.advertising_data": map[string]interface{}{
+			"btcommon.eir_ad.entry": map[string]interface{}{
+				"btcommon.eir_ad.entry.type":        "0x08",
+				"btcommon.eir_ad.entry.device_name": "Sens",
+			},
+		},
+	}
+
+	entries := eirEntries(btleData)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if ad_type, _ := adType(entries[0]); ad_type != AD_SHORT_LOCAL_NAME {
+		t.Errorf("expected type 0x%02x, got 0x%02x", AD_SHORT_LOCAL_NAME, ad_type)
+	}
+}
+
+func TestDecodeTargetAddresses(t *testing.T) {
+	raw := []byte{0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0xff, 0xee, 0xdd, 0xcc, 0xbb, 0xaa}
+	addresses, err := decodeTargetAddresses(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(addresses) != 2 || addresses[0] != "01:02:03:04:05:06" || addresses[1] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("unexpected addresses %v", addresses)
+	}
+
+	if _, err := decodeTargetAddresses(raw[:7]); err == nil {
+		t.Errorf("expected an error for a truncated address")
+	}
+}
+
+func TestAdvInterval(t *testing.T) {
+	tests := []struct {
+		entry map[string]interface{}
+		ms    interface{}
+	}{
+		// 160 * 0.625 ms.
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1a", "btcommon.eir_ad.entry.length": "3", "btcommon.eir_ad.entry.data": "a0:00"}, 100.0},
+		// 0x010000 * 0.625 ms.
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2f", "btcommon.eir_ad.entry.data": "00:00:01"}, 40960.0},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1a", "btcommon.eir_ad.entry.data": "a0:00:00"}, nil},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2f", "btcommon.eir_ad.entry.data": "a0:00"}, nil},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1a", "btcommon.eir_ad.entry.length": "4", "btcommon.eir_ad.entry.advertising_interval": "160"}, nil},
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for i, tt := range tests {
+		events := onAdvInterval(&advertisement{Data: btle}, tt.entry)
+		if tt.ms == nil {
+			if len(events) != 0 {
+				t.Errorf("%d: expected the malformed structure to be ignored, got %v", i, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: expected an event, got %d", i, len(events))
+		}
+		if ms := events[0].Data.(SniffData)["adv_interval"]; ms != tt.ms {
+			t.Errorf("%d: expected %v ms, got %v", i, tt.ms, ms)
+		}
+	}
+}
+
+func TestLEDeviceAddress(t *testing.T) {
+	tests := []struct {
+		entry       map[string]interface{}
+		address     string
+		addressType string
+	}{
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1b", "btcommon.eir_ad.entry.length": "8", "btcommon.eir_ad.entry.data": "06:05:04:03:02:01:00"}, "01:02:03:04:05:06", AddressPublic},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1b", "btcommon.eir_ad.entry.data": "ff:ee:dd:cc:bb:4a:01"}, "4a:bb:cc:dd:ee:ff", AddressRandom},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1b", "btcommon.eir_ad.entry.le_bd_addr": "4a:bb:cc:dd:ee:ff", "btcommon.eir_ad.entry.le_bd_addr.type": "0x01"}, "4a:bb:cc:dd:ee:ff", AddressRandom},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1b", "btcommon.eir_ad.entry.data": "06:05:04:03:02:01"}, "", ""},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x1b", "btcommon.eir_ad.entry.length": "7", "btcommon.eir_ad.entry.le_bd_addr": "4a:bb:cc:dd:ee:ff", "btcommon.eir_ad.entry.le_bd_addr.type": "0x01"}, "", ""},
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for i, tt := range tests {
+		events := onLEDeviceAddress(&advertisement{Data: btle}, tt.entry)
+		if tt.address == "" {
+			if len(events) != 0 {
+				t.Errorf("%d: expected the malformed structure to be ignored, got %v", i, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: expected an event, got %d", i, len(events))
+		}
+		data := events[0].Data.(SniffData)
+		if data["le_address"] != tt.address || data["le_address_type"] != tt.addressType {
+			t.Errorf("%d: expected %s %s, got %v %v", i, tt.addressType, tt.address, data["le_address_type"], data["le_address"])
+		}
+	}
+}
+
+func TestClassOfDevice(t *testing.T) {
+	tests := []struct {
+		entry    map[string]interface{}
+		major    string
+		minor    string
+		services []string
+	}{
+		// Smartphone with networking, capturing, object transfer, audio and telephony: 0x7a020c.
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x0d", "btcommon.eir_ad.entry.length": "4", "btcommon.eir_ad.entry.data": "0c:02:7a"}, "Phone", "Smartphone", []string{"Networking", "Capturing", "Object Transfer", "Audio", "Telephony"}},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x0d", "btcommon.cod_tree": map[string]interface{}{"btcommon.cod.class_of_device": "0x00010c"}}, "Computer", "Laptop", []string{}},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x0d", "btcommon.eir_ad.entry.data": "0c:02"}, "", "", nil},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x0d", "btcommon.eir_ad.entry.length": "3", "btcommon.eir_ad.entry.data": "0c:02:7a"}, "", "", nil},
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for i, tt := range tests {
+		events := onClassOfDevice(&advertisement{Data: btle}, tt.entry)
+		if tt.major == "" {
+			if len(events) != 0 {
+				t.Errorf("%d: expected the malformed structure to be ignored, got %v", i, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: expected an event, got %d", i, len(events))
+		}
+		data := events[0].Data.(SniffData)
+		if data["major_class"] != tt.major || data["minor_class"] != tt.minor || !reflect.DeepEqual(data["service_classes"], tt.services) {
+			t.Errorf("%d: expected %s/%s %v, got %v/%v %v", i, tt.major, tt.minor, tt.services, data["major_class"], data["minor_class"], data["service_classes"])
+		}
+	}
+}
+
+func TestAppearance(t *testing.T) {
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for entry, expected := range map[string]string{
+		"c1:00": "Watch",
+		"40:0c": "Pulse Oximeter",
+		"ff:ff": "Reserved (0x3ff)",
+		"c1":    "",
+	} {
+		events := onAppearance(&advertisement{Data: btle}, map[string]interface{}{"btcommon.eir_ad.entry.type": "0x19", "btcommon.eir_ad.entry.data": entry})
+		if expected == "" {
+			if len(events) != 0 {
+				t.Errorf("%s: expected the malformed structure to be ignored", entry)
+			}
+		} else if len(events) != 1 || events[0].Data.(SniffData)["appearance_category"] != expected {
+			t.Errorf("%s: expected %s, got %v", entry, expected, events)
+		}
+	}
+}
+
+func TestURI(t *testing.T) {
+	tests := []struct {
+		entry map[string]interface{}
+		uri   string
+	}{
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.data": "03:62:65:74:74:65:72:63:61:70:07"}, "https://bettercap.com"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.data": "02:63:61:66:c3:a9:2e:66:72:2f:6d:65:6e:75"}, "http://café.fr/menu"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.uri": "https://example.org"}, "https://example.org"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.data": "09:61:62"}, ""},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.data": "03:61:ff:62"}, ""},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x24", "btcommon.eir_ad.entry.data": "03:61:1f"}, ""},
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for i, tt := range tests {
+		events := onURI(&advertisement{Data: btle}, tt.entry)
+		if tt.uri == "" {
+			if len(events) != 0 {
+				t.Errorf("%d: expected the malformed structure to be ignored, got %v", i, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: expected an event, got %d", i, len(events))
+		}
+		if uri := events[0].Data.(SniffData)["uri"]; uri != tt.uri {
+			t.Errorf("%d: expected %s, got %v", i, tt.uri, uri)
+		}
+	}
+}
+
+func TestMesh(t *testing.T) {
+	tests := []struct {
+		entry map[string]interface{}
+		key   string
+		value interface{}
+	}{
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2a", "btcommon.eir_ad.entry.data": "00:01:02:03:04:05:06:07:08:09:0a:0b:0c:0d:0e:0f:10:40:00"}, "device_uuid", "01020304-0506-0708-090a-0b0c0d0e0f10"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2a", "btcommon.eir_ad.entry.data": "00:01:02:03:04:05:06:07:08:09:0a:0b:0c:0d:0e:0f:10:40:00"}, "oob_info", "0x4000"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2a", "btcommon.eir_ad.entry.data": "01:00:11:22:33:44:55:66:77:88:00:00:00:05:00:00:00:00:00:00:00:00"}, "iv_index", uint32(5)},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x29", "btcommon.eir_ad.entry.data": "e8:00:00:00"}, "nid", uint8(0x68)},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2b", "btcommon.eir_ad.entry.data": "12:34:56:78:00:03:01:02"}, "frame", "Link Open"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2b", "btcommon.eir_ad.entry.data": "12:34:56:78:80:01"}, "frame", "Transaction Ack"},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2a", "btcommon.eir_ad.entry.data": "00:01:02"}, "", nil},
+		{map[string]interface{}{"btcommon.eir_ad.entry.type": "0x2b", "btcommon.eir_ad.entry.data": "12:34"}, "", nil},
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	for i, tt := range tests {
+		events := onMesh(&advertisement{Data: btle}, tt.entry)
+		if tt.key == "" {
+			if len(events) != 0 {
+				t.Errorf("%d: expected the malformed structure to be ignored, got %v", i, events)
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Fatalf("%d: expected an event, got %d", i, len(events))
+		}
+		if events[0].Protocol != "BLE MESH" {
+			t.Errorf("%d: unexpected protocol %s", i, events[0].Protocol)
+		}
+		if value := events[0].Data.(SniffData)[tt.key]; value != tt.value {
+			t.Errorf("%d: expected %s %v, got %v", i, tt.key, tt.value, value)
+		}
+	}
+}
+
+func TestServiceUUIDs32(t *testing.T) {
+	for value, expected := range map[string]string{
+		"0x0000FEAA":  "0x0000feaa",
+		"0xfeaa":      "0x0000feaa",
+		"12:34:56:78": "0x12345678",
+	} {
+		if uuid := canonicalUUID32(value); uuid != expected {
+			t.Errorf("expected %s for %s, got %s", expected, value, uuid)
+		}
+	}
+
+	btle := map[string]interface{}{
+		"btle.advertising_address": "aa:bb:cc:dd:ee:ff",
+	}
+	entries := []map[string]interface{}{
+		{
+			"btcommon.eir_ad.entry.type":    "0x03",
+			"btcommon.eir_ad.entry.uuid_16": "0x180f",
+		},
+		{
+			"btcommon.eir_ad.entry.type":    "0x05",
+			"btcommon.eir_ad.entry.uuid_32": []interface{}{"0x12345678", "0x0000FEAA"},
+		},
+		{
+			"btcommon.eir_ad.entry.type":    "0x04",
+			"btcommon.eir_ad.entry.uuid_32": "0xcafe0001",
+		},
+	}
+
+	events := onAdvertisementEntries(btle, entries, nil, nil, time.Now())
+	if len(events) != 1 {
+		t.Fatalf("expected the service lists to be reported together, got %d events", len(events))
+	}
+	expected := "Services 0x180f, 0x12345678, 0x0000feaa, 0xcafe0001"
+	if events[0].Message != expected {
+		t.Errorf("expected %q, got %q", expected, events[0].Message)
+	}
+}
+
+func TestMergedAdvertisement(t *testing.T) {
+	packets := loadFixtures(t, "advertisements.json")
+	signal := &SnifferSignal{RSSI: -62, SmoothedRSSI: -62, Proximity: ProximityNear}
+
+	per_structure := onAdvertisementEntries(packets[0], eirEntries(packets[0]), signal, NewSnifferStats(), time.Now())
+	events := onAdvertisementMerged(packets[0], eirEntries(packets[0]), signal, NewSnifferStats(), time.Now())
+	if len(events) != 1 || len(per_structure) < 2 {
+		t.Fatalf("expected a single merged event for %d structures, got %d", len(per_structure), len(events))
+	}
+
+	e := events[0]
+	data := e.Data.(SniffData)
+	if data["name"] != "Thermo" || data["flags"] == nil || data["rssi"] != -62 {
+		t.Errorf("expected the combined data, got %v", data)
+	}
+	manufacturer, _ := data["manufacturer"].([]SniffData)
+	if len(manufacturer) != 1 || manufacturer[0]["company_id"] != uint16(0x004c) || manufacturer[0]["rssi"] != nil {
+		t.Errorf("expected the manufacturer data without the signal, got %v", data["manufacturer"])
+	}
+
+	messages := make([]string, len(per_structure))
+	for i, structure := range per_structure {
+		messages[i] = structure.Message
+	}
+	if e.Message != strings.Join(messages, ", ") || e.Protocol != "BLE ADVERT" || e.Source != "d4:3a:2c:11:8e:07" {
+		t.Errorf("unexpected merged event %s %s: %s", e.Protocol, e.Source, e.Message)
+	}
+
+	// An advertisement without AD structures has no event.
+	if events := onAdvertisementMerged(map[string]interface{}{}, nil, nil, nil, time.Now()); len(events) != 0 {
+		t.Errorf("expected no event, got %d", len(events))
+	}
+}
+
+func TestDirectedAdvertisement(t *testing.T) {
+	btle := map[string]interface{}{
+		"btle.advertising_address": "d4:3a:2c:11:8e:07",
+		"btle.target_address":      "5A:11:22:33:44:55",
+	}
+	entries := []map[string]interface{}{
+		rawADEntry(AD_COMPLETE_LOCAL_NAME, []byte("Thermo")),
+		rawADEntry(AD_MANUFACTURER_DATA, []byte{0x4c, 0x00, 0x10, 0x05}),
+	}
+
+	mod := newBenchSniffer(&collectSink{})
+	mod.Ctx.Merge = false
+	events := mod.advertisementEvents(btle, entries, nil, time.Now())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for _, e := range events {
+		if e.Destination != "5a:11:22:33:44:55" {
+			t.Errorf("expected the event %q to be sent to the target, got %s", e.Message, e.Destination)
+		}
+	}
+
+	// The target can be ignored, and the undirected advertisements are broadcast.
+	mod.Ctx.DirectedTarget = false
+	if events = mod.advertisementEvents(btle, entries, nil, time.Now()); events[0].Destination != "BROADCAST" {
+		t.Errorf("expected a broadcast event, got %s", events[0].Destination)
+	}
+	mod.Ctx.DirectedTarget = true
+	delete(btle, "btle.target_address")
+	if events = mod.advertisementEvents(btle, entries, nil, time.Now()); events[0].Destination != "BROADCAST" {
+		t.Errorf("expected a broadcast event, got %s", events[0].Destination)
+	}
+}
@@ -0,0 +1,16 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strings for matching the pipe prefix.
+import (
+	"strings"
+)
+
+// namedPipePrefix is the prefix of the Windows named pipe paths.
+const namedPipePrefix = `\\.\pipe\`
+
+// isNamedPipe returns true if the output is a Windows named pipe such as \\.\pipe\blesniff.
+func isNamedPipe(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), namedPipePrefix)
+}
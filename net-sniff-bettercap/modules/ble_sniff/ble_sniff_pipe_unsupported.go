@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors.
+import (
+	"fmt"
+)
+
+// pipeWriter is only implemented on Windows.
+type pipeWriter struct {
+	Name string // Path of the named pipe.
+}
+
+// newPipeWriter fails since named pipes are only supported on Windows.
+func newPipeWriter(name string) (*pipeWriter, error) {
+	return nil, fmt.Errorf("named pipe output %s is only supported on Windows", name)
+}
+
+// WriteLine never writes anything.
+func (p *pipeWriter) WriteLine(line []byte) bool {
+	return false
+}
+
+// Close does nothing.
+func (p *pipeWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,158 @@
+//go:build windows
+// +build windows
+
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// os for unblocking the pending connection, sync for guarding the pipe state,
+// and x/sys/windows for the named pipe API.
+import (
+	"os"
+	"sync"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeBufferSize is the size of the output buffer of the named pipe.
+const pipeBufferSize = 64 * 1024
+
+// pipeQueueSize is the number of lines waiting to be written to the pipe before new ones are dropped.
+const pipeQueueSize = 1024
+
+// pipeWriter streams events to a named pipe created by the sniffer, to which one reader at a time can connect.
+// Events are dropped while no reader is connected, and a reader disconnecting doesn't stop the capture.
+// The lines are written in background, so that a slow reader doesn't block the capture.
+type pipeWriter struct {
+	sync.Mutex                // Guards the connection state.
+	Name       string         // Path of the named pipe.
+	handle     windows.Handle // Server end of the pipe.
+	connected  bool           // Set while a reader is connected.
+	closed     bool           // Set once the pipe is closed.
+	lines      chan []byte    // Lines waiting to be written to the reader.
+}
+
+// newPipeWriter creates the named pipe and starts waiting for a reader.
+func newPipeWriter(name string) (*pipeWriter, error) {
+	p := &pipeWriter{
+		Name:  name,
+		lines: make(chan []byte, pipeQueueSize),
+	}
+	if err := p.listen(); err != nil {
+		return nil, err
+	}
+	go p.write()
+
+	return p, nil
+}
+
+// listen creates a new instance of the pipe and waits for a reader in background.
+func (p *pipeWriter) listen() error {
+	path, err := windows.UTF16PtrFromString(p.Name)
+	if err != nil {
+		return err
+	}
+
+	handle, err := windows.CreateNamedPipe(path,
+		windows.PIPE_ACCESS_OUTBOUND,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_WAIT,
+		1,
+		pipeBufferSize,
+		pipeBufferSize,
+		0,
+		nil)
+	if err != nil {
+		return err
+	}
+
+	p.handle = handle
+	go p.accept(handle)
+
+	return nil
+}
+
+// accept blocks until a reader connects to the given instance of the pipe.
+func (p *pipeWriter) accept(handle windows.Handle) {
+	err := windows.ConnectNamedPipe(handle, nil)
+
+	p.Lock()
+	defer p.Unlock()
+	if !p.closed && p.handle == handle && (err == nil || err == windows.ERROR_PIPE_CONNECTED) {
+		p.connected = true
+	}
+}
+
+// WriteLine queues a line for the connected reader, returning false if there is none or too many lines are
+// already waiting for it.
+func (p *pipeWriter) WriteLine(line []byte) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.connected || p.closed {
+		return false
+	}
+
+	// The line is copied since the caller reuses it.
+	select {
+	case p.lines <- append([]byte(nil), line...):
+		return true
+	default:
+		return false
+	}
+}
+
+// write writes the queued lines to the reader until the pipe is closed.
+// If the reader went away, a new instance of the pipe waits for the next one.
+func (p *pipeWriter) write() {
+	for line := range p.lines {
+		p.Lock()
+		handle, connected := p.handle, p.connected && !p.closed
+		p.Unlock()
+		// The lines queued for a reader that went away are dropped.
+		if !connected {
+			continue
+		}
+
+		var written uint32
+		err := windows.WriteFile(handle, line, &written, nil)
+		if err == nil {
+			continue
+		}
+
+		p.Lock()
+		if !p.closed && p.handle == handle {
+			logDebug("named pipe reader disconnected: %v", err)
+			p.connected = false
+			windows.CloseHandle(p.handle)
+			if err = p.listen(); err != nil {
+				logWarning("error recreating named pipe %s: %v", p.Name, err)
+				p.closed = true
+			}
+		}
+		p.Unlock()
+	}
+}
+
+// Close closes the pipe, unblocking a pending wait for a reader or a pending write.
+func (p *pipeWriter) Close() error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.lines)
+
+	// ConnectNamedPipe can only be interrupted by a client connecting, the waiting goroutine giving up once
+	// it gets the lock.
+	if !p.connected {
+		if client, err := os.OpenFile(p.Name, os.O_RDONLY, 0); err == nil {
+			client.Close()
+		}
+	}
+
+	// Aborting a write blocked on a slow reader.
+	windows.CancelIoEx(p.handle, nil)
+	return windows.CloseHandle(p.handle)
+}
@@ -0,0 +1,23 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Proximity zones a device can be classified into, following the iBeacon naming.
+const (
+	ProximityImmediate = "immediate"
+	ProximityNear      = "near"
+	ProximityFar       = "far"
+	ProximityUnknown   = "unknown"
+)
+
+// classifyProximity buckets a RSSI value into a proximity zone given the immediate and near thresholds in dBm.
+func classifyProximity(rssi float64, immediate int, near int) string {
+	if rssi == 0 {
+		// A zero RSSI means no sample is available.
+		return ProximityUnknown
+	} else if rssi >= float64(immediate) {
+		return ProximityImmediate
+	} else if rssi >= float64(near) {
+		return ProximityNear
+	}
+	return ProximityFar
+}
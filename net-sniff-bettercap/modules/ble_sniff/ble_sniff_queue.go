@@ -0,0 +1,39 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync/atomic for the dropped packets counter and jstream for the decoded packets.
+import (
+	"sync/atomic"
+
+	"github.com/bcicen/jstream"
+)
+
+// queuePackets forwards the packets emitted by the decoder to a queue holding up to size packets. When processing
+// can't keep up and the queue is full, the oldest packet is dropped to make room for the new one, so that memory
+// stays bounded and the decoder never stalls. The queue is closed once the decoder is done.
+func (mod *Sniffer) queuePackets(in <-chan *jstream.MetaValue, size int) chan *jstream.MetaValue {
+	queue := make(chan *jstream.MetaValue, size)
+
+	go func() {
+		defer close(queue)
+		for packet := range in {
+			select {
+			case queue <- packet:
+				continue
+			default:
+			}
+
+			// The queue is full, drop the oldest packet unless the processing loop just took it.
+			select {
+			case <-queue:
+				atomic.AddUint64(&mod.Stats.NumDropped, 1)
+			default:
+			}
+			// This is the only sender, so there is room for the packet now.
+			queue <- packet
+		}
+	}()
+
+	return queue
+}
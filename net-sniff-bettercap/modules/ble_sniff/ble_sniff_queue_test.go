@@ -0,0 +1,36 @@
+package ble_sniff
+
+import (
+	"testing"
+
+	"github.com/bcicen/jstream"
+)
+
+func TestQueuePacketsDropsOldest(t *testing.T) {
+	mod := newBenchSniffer(discardSink{})
+
+	in := make(chan *jstream.MetaValue)
+	queue := mod.queuePackets(in, 3)
+	for i := 0; i < 10; i++ {
+		in <- &jstream.MetaValue{Value: i}
+	}
+	close(in)
+
+	received := make([]int, 0)
+	for packet := range queue {
+		received = append(received, packet.Value.(int))
+	}
+
+	// The processing loop may take a packet while the last ones are being queued, sparing it from being dropped.
+	if uint64(len(received))+mod.Stats.NumDropped != 10 {
+		t.Errorf("expected every packet to be either received or dropped, got %v and %d dropped", received, mod.Stats.NumDropped)
+	}
+	if len(received) < 3 || len(received) > 4 || received[len(received)-1] != 9 {
+		t.Errorf("expected the most recent packets to be kept, got %v", received)
+	}
+	for i := 1; i < len(received); i++ {
+		if received[i] != received[i-1]+1 {
+			t.Errorf("expected the kept packets to be in order, got %v", received)
+		}
+	}
+}
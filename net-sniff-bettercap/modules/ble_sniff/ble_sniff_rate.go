@@ -0,0 +1,110 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// math for storing the rate atomically, sync/atomic for the counters shared with the capture,
+// and time for the sampling timer.
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// rateInterval is how often the event rate is sampled.
+const rateInterval = time.Second
+
+// rateGauge computes the event rate from the total count of events and detects the idle periods.
+type rateGauge struct {
+	last      uint64    // Count of events at the previous sample.
+	lastTime  time.Time // Time of the previous sample.
+	idleSince time.Time // Time of the last sample with events.
+	warned    bool      // Set once the current idle period has been reported.
+}
+
+// newRateGauge creates a gauge starting at the given time.
+func newRateGauge(now time.Time) *rateGauge {
+	return &rateGauge{lastTime: now, idleSince: now}
+}
+
+// update samples the total count of events, returning the rate in events per second since the previous sample and
+// whether no event arrived for longer than timeout. Starvation is only reported once per idle period.
+func (g *rateGauge) update(total uint64, now time.Time, timeout time.Duration) (float64, bool) {
+	rate := 0.0
+	if elapsed := now.Sub(g.lastTime).Seconds(); elapsed > 0 {
+		rate = float64(counterDelta(total, g.last)) / elapsed
+	}
+
+	if total != g.last {
+		// Events resumed, a new idle period can be reported.
+		g.idleSince = now
+		g.warned = false
+	}
+	g.last, g.lastTime = total, now
+
+	if timeout <= 0 || g.warned || now.Sub(g.idleSince) < timeout {
+		return rate, false
+	}
+	g.warned = true
+	return rate, true
+}
+
+// countEvent accounts an event produced by the decoding for the event rate, the ones about the sniffer itself
+// like the heartbeats are not counted.
+func (s *SnifferStats) countEvent(e SnifferEvent) {
+	if e.Source != "SNIFFER" {
+		atomic.AddUint64(&s.NumEvents, 1)
+	}
+}
+
+// dropDisplay accounts an event not pushed to the session because of the display rate.
+func (s *SnifferStats) dropDisplay() {
+	atomic.AddUint64(&s.NumDisplayDropped, 1)
+}
+
+// setEventRate stores the last sampled event rate.
+func (s *SnifferStats) setEventRate(rate float64) {
+	atomic.StoreUint64(&s.eventRate, math.Float64bits(rate))
+}
+
+// EventRate returns the last sampled event rate in events per second.
+func (s *SnifferStats) EventRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.eventRate))
+}
+
+// startRateMonitor starts sampling the event rate, warning once per idle period if no event was produced for
+// longer than the starvation timeout while TShark is running.
+func (mod *Sniffer) startRateMonitor(timeout time.Duration) {
+	mod.rateQuit = make(chan struct{})
+
+	go mod.rateLoop(timeout, mod.rateQuit)
+}
+
+// stopRateMonitor stops sampling the event rate, if running.
+func (mod *Sniffer) stopRateMonitor() {
+	if mod.rateQuit != nil {
+		close(mod.rateQuit)
+		mod.rateQuit = nil
+	}
+}
+
+// rateLoop samples the event rate until quit is closed.
+func (mod *Sniffer) rateLoop(timeout time.Duration, quit <-chan struct{}) {
+	gauge := newRateGauge(time.Now())
+	ticker := time.NewTicker(rateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case now := <-ticker.C:
+			rate, starved := gauge.update(atomic.LoadUint64(&mod.Stats.NumEvents), now, timeout)
+			mod.Stats.setEventRate(rate)
+
+			// Reading a capture file has nothing to do with the interface or the capture filter.
+			if starved && mod.Ctx.TSharkRunning() && mod.Ctx.PcapFile == "" {
+				mod.Warning("TShark is running but no event was produced for %s, check that ble.sniff.interface is the sniffer and that ble.sniff.filter isn't too strict", timeout)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ble_sniff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateGauge(t *testing.T) {
+	start := time.Now()
+	gauge := newRateGauge(start)
+	timeout := 3 * time.Second
+
+	if rate, starved := gauge.update(20, start.Add(2*time.Second), timeout); rate != 10 || starved {
+		t.Errorf("expected 10 events/s without starvation, got %f, %v", rate, starved)
+	}
+
+	// No events from now on, the warning fires once the timeout elapsed and only once.
+	expected := []bool{false, false, true, false, false}
+	for i, want := range expected {
+		rate, starved := gauge.update(20, start.Add(time.Duration(3+i)*time.Second), timeout)
+		if rate != 0 || starved != want {
+			t.Errorf("second %d: expected rate 0 and starvation %v, got %f, %v", 3+i, want, rate, starved)
+		}
+	}
+
+	// Events resume, then a new idle period is reported again.
+	gauge.update(21, start.Add(8*time.Second), timeout)
+	if _, starved := gauge.update(21, start.Add(11*time.Second), timeout); !starved {
+		t.Errorf("expected the new idle period to be reported")
+	}
+}
+
+func TestEventCountSkipsSnifferEvents(t *testing.T) {
+	stats := NewSnifferStats()
+	stats.countEvent(NewSnifferEvent(time.Now(), "BLE HEARTBEAT", "SNIFFER", "SNIFFER", SniffData{}, "idle"))
+	stats.countEvent(NewSnifferEvent(time.Now(), "BLE ADVERT", "aa:bb:cc:dd:ee:ff", "BROADCAST", SniffData{}, "advert"))
+	if stats.NumEvents != 1 {
+		t.Errorf("expected only the decoded events to be counted, got %d", stats.NumEvents)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+	bucket := newTokenBucket(10, start)
+
+	// The bucket starts full, allowing a burst of one second of events.
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if bucket.Allow(start) {
+			allowed++
+		}
+	}
+	if allowed != 10 {
+		t.Errorf("expected a burst of 10 events, got %d", allowed)
+	}
+
+	// Half a second later, 5 tokens were added back.
+	allowed = 0
+	for i := 0; i < 20; i++ {
+		if bucket.Allow(start.Add(500 * time.Millisecond)) {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("expected 5 events after half a second, got %d", allowed)
+	}
+}
+
+func TestDisplayRate(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.displayLimiter = newTokenBucket(1, time.Now())
+
+	written := 0
+	mod.addEventHandler(func(e SnifferEvent) { written++ })
+
+	for i := 0; i < 3; i++ {
+		mod.Push(NewSnifferEvent(time.Now(), "BLE ADVERT", "aa:bb:cc:dd:ee:ff", "BROADCAST", SniffData{}, "advert"))
+	}
+	mod.Push(NewSnifferEvent(time.Now(), "BLE HEARTBEAT", "SNIFFER", "SNIFFER", SniffData{}, "idle"))
+
+	if len(sink.events) != 2 {
+		t.Errorf("expected an advertisement and the heartbeat to be displayed, got %d events", len(sink.events))
+	}
+	if written != 4 {
+		t.Errorf("expected every event to reach the handlers, got %d", written)
+	}
+	if mod.Stats.NumDisplayDropped != 2 || mod.Stats.NumEvents != 3 {
+		t.Errorf("expected 2 dropped and 3 counted events, got %d and %d", mod.Stats.NumDisplayDropped, mod.Stats.NumEvents)
+	}
+}
+
+func TestRateMonitorWhileTSharkExits(t *testing.T) {
+	quietLogs(t)
+	mod := NewSniffer(newTestSession(t))
+	mod.Stats = NewSnifferStats()
+	mod.Ctx.TSharkExit = make(chan error, 1)
+
+	// The capture keeps seeing TShark restart and exit while the monitor checks whether it is running. The exits of
+	// the fake TShark are reported directly, waiting for a real process would order the accesses and hide a race.
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-quit:
+				return
+			case mod.Ctx.TSharkExit <- nil:
+				mod.Ctx.setTSharkRunning(true)
+				mod.Ctx.tsharkExited(time.Second)
+			}
+		}
+	}()
+
+	mod.startRateMonitor(time.Nanosecond)
+	time.Sleep(rateInterval + 500*time.Millisecond)
+	mod.stopRateMonitor()
+	close(quit)
+	<-done
+
+	if mod.Ctx.TSharkRunning() {
+		t.Errorf("expected TShark not to be running once exited")
+	}
+}
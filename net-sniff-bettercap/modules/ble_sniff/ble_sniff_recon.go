@@ -0,0 +1,46 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and time for time-related functions.
+import (
+	"fmt"
+	"time"
+)
+
+// StartRecon starts the sniffer in recon mode, where the advertisements only feed the device inventory
+// and a single event is pushed for each newly discovered device.
+func (mod *Sniffer) StartRecon() error {
+	if mod.Running() {
+		return fmt.Errorf("ble.sniff is already running, stop it before starting the recon mode")
+	}
+
+	mod.recon = true
+	if err := mod.Start(); err != nil {
+		mod.recon = false
+		return err
+	}
+	return nil
+}
+
+// StopRecon stops the sniffer started in recon mode.
+func (mod *Sniffer) StopRecon() error {
+	if !mod.recon || !mod.Running() {
+		return fmt.Errorf("ble.sniff recon mode is not running")
+	}
+
+	return mod.Stop()
+}
+
+// onNewDevice pushes a "BLE NEW DEVICE" event for a device seen for the first time.
+func (mod *Sniffer) onNewDevice(dev SnifferDevice, t time.Time) {
+	mod.Push(NewSnifferEvent(t,
+		"BLE NEW DEVICE",
+		dev.Address,
+		"BROADCAST",
+		SniffData{
+			"rssi": dev.RSSI,
+		},
+		"New device discovered",
+	))
+}
@@ -0,0 +1,111 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, net/url for parsing the remote, os for the input pipe,
+// os/exec for running the ssh command, and strings for quoting the remote command.
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sshCommand is the OpenSSH client TShark is run through on a remote host, shipped with Windows 10 and later.
+const sshCommand = "ssh"
+
+// remoteTarget is the host TShark runs on when capturing remotely.
+type remoteTarget struct {
+	User string // User to log in as, the one of the ssh configuration if empty.
+	Host string // Host name or address.
+	Port string // SSH port, the one of the ssh configuration if empty.
+}
+
+// parseRemote parses a remote host in the ssh://[user@]host[:port] form, the scheme being optional.
+func parseRemote(remote string) (*remoteTarget, error) {
+	if !strings.Contains(remote, "://") {
+		remote = "ssh://" + remote
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("unsupported scheme '%s', expected ssh://[user@]host[:port]", u.Scheme)
+	} else if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host, expected ssh://[user@]host[:port]")
+	} else if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("unexpected path '%s', expected ssh://[user@]host[:port]", u.Path)
+	}
+
+	target := &remoteTarget{
+		Host: u.Hostname(),
+		Port: u.Port(),
+	}
+	if u.User != nil {
+		target.User = u.User.Username()
+	}
+	return target, nil
+}
+
+// shellQuote quotes an argument for the POSIX shell of the remote host.
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+// remoteScript returns the shell command running TShark on the remote host. TShark is killed as soon as the input
+// of the command is closed, which happens when the sniffer stops or when the connection drops, so that it doesn't
+// keep capturing on the remote host. The input is duplicated since asynchronous commands read from /dev/null,
+// and the output of the watcher is discarded for the session to end with TShark.
+func remoteScript(tshark string, args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, shellQuote(tshark))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+
+	return fmt.Sprintf("exec 3<&0; %s 3<&- & pid=$!; (read _ <&3; kill $pid) >/dev/null 2>&1 & exec 3<&-; wait $pid", strings.Join(quoted, " "))
+}
+
+// sshArgs returns the arguments of the ssh command running a script on the remote host. Authentication relies on
+// the ssh agent or on the given key file, since there is no terminal to prompt for a password.
+func (r *remoteTarget) sshArgs(key string, script string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+	if r.Port != "" {
+		args = append(args, "-p", r.Port)
+	}
+	if key != "" {
+		args = append(args, "-i", key)
+	}
+
+	destination := r.Host
+	if r.User != "" {
+		destination = r.User + "@" + destination
+	}
+	return append(args, destination, script)
+}
+
+// tsharkCommand returns the command running TShark, locally or through ssh on the remote host. For remote captures
+// the input of the command is a pipe kept open until the context is closed.
+func (c *SnifferContext) tsharkCommand() (*exec.Cmd, error) {
+	if c.remote == nil {
+		return exec.Command(c.TShark, c.TSharkArgs...), nil
+	}
+
+	cmd := exec.Command(sshCommand, c.remote.sshArgs(c.RemoteKey, remoteScript(c.TShark, c.TSharkArgs))...)
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = reader
+
+	// Release the input of a previous ssh process.
+	if c.remoteIn != nil {
+		c.remoteIn.Close()
+	}
+	c.remoteIn = writer
+
+	return cmd, nil
+}
@@ -0,0 +1,84 @@
+package ble_sniff
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   *remoteTarget
+	}{
+		{"ssh://pi@raspberrypi.local", &remoteTarget{User: "pi", Host: "raspberrypi.local"}},
+		{"ssh://pi@10.0.0.2:2222", &remoteTarget{User: "pi", Host: "10.0.0.2", Port: "2222"}},
+		{"sensor", &remoteTarget{Host: "sensor"}},
+		{"http://pi@host", nil},
+		{"ssh://pi@host/tmp", nil},
+		{"ssh://", nil},
+	}
+	for _, tt := range tests {
+		got, err := parseRemote(tt.remote)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("parseRemote(%s): expected an error", tt.remote)
+			}
+		} else if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRemote(%s) = %+v, %v, expected %+v", tt.remote, got, err, tt.want)
+		}
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	remote := &remoteTarget{User: "pi", Host: "sensor", Port: "2222"}
+	got := remote.sshArgs("/home/me/.ssh/pi", "tshark")
+	want := []string{"-o", "BatchMode=yes", "-p", "2222", "-i", "/home/me/.ssh/pi", "pi@sensor", "tshark"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+// The remote script is run by a local shell, standing in for the one of the remote host.
+func TestRemoteScriptStopsOnClosedInput(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no POSIX shell")
+	}
+
+	script := remoteScript("sh", []string{"-c", "echo \"it's alive\"; exec sleep 60"})
+	cmd := exec.Command(sh, "-c", script)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &strings.Builder{}
+	cmd.Stdout = out
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the capture to run until its input is closed")
+	case <-time.After(200 * time.Millisecond):
+	}
+	stdin.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("expected the capture to stop once its input was closed")
+	}
+	if out.String() != "it's alive\n" {
+		t.Errorf("expected the output of the capture, got %q", out.String())
+	}
+}
@@ -0,0 +1,132 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync/atomic for the counters updated by the workers and time for the capture duration.
+import (
+	"sync/atomic"
+	"time"
+)
+
+// captureTimes is a snapshot of the capture times of the statistics.
+type captureTimes struct {
+	FirstPacket   time.Time     // Time when the first packet was captured.
+	LastPacket    time.Time     // Time when the last packet was captured.
+	LongestGap    time.Duration // Longest time elapsed between two consecutive packets.
+	LongestGapEnd time.Time     // Time of the packet ending the longest gap.
+}
+
+// Duration returns how long packets have been captured for, from the first to the last one.
+func (c captureTimes) Duration() time.Duration {
+	if c.FirstPacket.IsZero() {
+		return 0
+	}
+	return c.LastPacket.Sub(c.FirstPacket)
+}
+
+// captureTimes returns a snapshot of the capture times, which the packet loop keeps updating.
+func (s *SnifferStats) captureTimes() captureTimes {
+	s.RLock()
+	defer s.RUnlock()
+
+	return captureTimes{
+		FirstPacket:   s.FirstPacket,
+		LastPacket:    s.LastPacket,
+		LongestGap:    s.LongestGap,
+		LongestGapEnd: s.LongestGapEnd,
+	}
+}
+
+// Duration returns how long packets have been captured for, from the first to the last one.
+func (s *SnifferStats) Duration() time.Duration {
+	return s.captureTimes().Duration()
+}
+
+// trackPacket records the time of a captured packet, restarting the capture times if the counters were cleared.
+func (s *SnifferStats) trackPacket(t time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.restartCapture()
+	if s.FirstPacket.IsZero() {
+		// If this is the first packet, record its time.
+		s.FirstPacket = t
+	} else {
+		// Keep the longest silence between two packets, a large one may be a stalled dongle.
+		s.trackGap(s.LastPacket, t)
+	}
+	s.LastPacket = t
+}
+
+// gapWarning is the time without packets after which the longest gap is reported as a possible stall.
+const gapWarning = 10 * time.Second
+
+// trackGap records the time elapsed since the previous packet if it is the longest gap of the capture, the lock
+// being held.
+func (s *SnifferStats) trackGap(previous time.Time, t time.Time) {
+	if gap := t.Sub(previous); gap > s.LongestGap {
+		s.LongestGap = gap
+		s.LongestGapEnd = t
+	}
+}
+
+// formatDuration formats a duration for humans, to the millisecond below a second, to the hundredth of a second
+// below a minute and to the second above.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(10 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// Report logs a human readable summary of the capture, listing the top companies and most active devices.
+func (s *SnifferStats) Report(top int) error {
+	return s.report(top, nil)
+}
+
+// report is Report with the addresses of the devices replaced with their pseudonyms if an anonymizer is given.
+func (s *SnifferStats) report(top int, a *anonymizer) error {
+	devices := a.Devices(s.DevicesList())
+
+	logInfo("Capture Duration   : %s", s.Duration().Round(time.Second))         // Log how long packets have been captured for.
+	logInfo("Advertisements     : %d", atomic.LoadUint64(&s.NumAdvertisements)) // Log the number of advertisements.
+	logInfo("Devices Seen       : %d", len(devices))                            // Log the number of distinct advertisers.
+	if dropped := atomic.LoadUint64(&s.NumDropped); dropped > 0 {
+		logWarning("Dropped Packets    : %d, consider increasing ble.sniff.queue.size", dropped)
+	}
+	if missed := atomic.LoadUint64(&s.NumMissed); missed > 0 {
+		logWarning("Missed Packets     : %d (%.1f%%), the capture is lossy", missed, s.LossRatio()*100)
+	}
+
+	if len(devices) > 0 {
+		most := devices[0]
+		logInfo("Most Active Device : %s (%d advertisements)", most.Address, most.Packets)
+	}
+
+	// List the top companies by number of advertisements.
+	if companies := s.CompaniesList(); top > 0 && len(companies) > 0 {
+		if len(companies) > top {
+			companies = companies[:top]
+		}
+		logInfo("Top %d Companies:", len(companies))
+		for i, company := range companies {
+			logInfo("  %2d. %s : %d advertisements", i+1, company.Label(), company.Count)
+		}
+	}
+
+	// List the top devices by number of advertisements.
+	if top > 0 && len(devices) > 1 {
+		if len(devices) > top {
+			devices = devices[:top]
+		}
+		logInfo("Top %d Devices:", len(devices))
+		for i, dev := range devices {
+			logInfo("  %2d. %s : %d advertisements, last seen %s", i+1, dev.Address, dev.Packets, dev.LastSeen.Format("15:04:05"))
+		}
+	}
+
+	return nil
+}
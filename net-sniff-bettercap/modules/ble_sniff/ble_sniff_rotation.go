@@ -0,0 +1,197 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, io/ioutil for listing the rotated files, os for the files, path/filepath for their names,
+// regexp for the size syntax, sort for ordering them, strconv for parsing the sizes,
+// strings for the units, and time for the timestamps.
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotationTimeFormat is appended to the name of rotated output files, it sorts chronologically and is valid on Windows.
+const rotationTimeFormat = "2006-01-02T15-04-05.000"
+
+// sizeParser matches a size such as "100MB", "512KiB" or "1048576".
+var sizeParser = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)\s*([KMGT]?)(i?B)?\s*$`)
+
+// sizeUnits maps the unit prefixes to their multipliers.
+var sizeUnits = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseSize converts a human readable size into bytes, an empty string meaning 0.
+func parseSize(value string) (int64, error) {
+	if strings.TrimSpace(value) == "" {
+		return 0, nil
+	}
+
+	m := sizeParser.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("'%s' is not a valid size", value)
+	}
+
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(n * sizeUnits[strings.ToUpper(m[2])]), nil
+}
+
+// shouldRotateUnlocked returns true if writing size more bytes requires rotating the output file first.
+// The caller must hold the output lock.
+func (c *SnifferContext) shouldRotateUnlocked(size int) bool {
+	if c.RotateSize > 0 && c.outputSize > 0 && c.outputSize+int64(size) > c.RotateSize {
+		return true
+	}
+	return c.RotateInterval > 0 && time.Since(c.outputOpened) >= c.RotateInterval
+}
+
+// rotatedAffixes returns what the names of the rotated output files start and end with. The timestamp is inserted
+// before the .gz extension of a compressed output, so that the rotated files keep it.
+func (c *SnifferContext) rotatedAffixes() (string, string) {
+	if c.outputGzip != nil {
+		return c.Output[:len(c.Output)-len(gzipExtension)] + "-", c.Output[len(c.Output)-len(gzipExtension):]
+	}
+	return c.Output + "-", ""
+}
+
+// rotatedName returns the name the output file is renamed to when rotated at t.
+func (c *SnifferContext) rotatedName(t time.Time) string {
+	prefix, suffix := c.rotatedAffixes()
+	return prefix + t.Format(rotationTimeFormat) + suffix
+}
+
+// setOutputFileUnlocked makes the events be written to a newly opened output file. The caller must hold the output lock.
+func (c *SnifferContext) setOutputFileUnlocked(file *os.File) {
+	c.OutputFile = file
+	if c.outputGzip != nil {
+		c.outputGzip.Reset(c.OutputFile)
+	}
+	if c.outputWriter != nil {
+		c.outputWriter.Reset(c.outputTarget())
+	}
+	c.outputSize = 0
+	c.outputOpened = time.Now()
+}
+
+// reopenOutputUnlocked reopens the output file after a failed rotation, the events being appended to it until the
+// rotation is retried, once the file grew by another segment or aged by another interval. If it can't be reopened,
+// the output is lost and every later write fails. The caller must hold the output lock.
+func (c *SnifferContext) reopenOutputUnlocked(cause error) error {
+	file, err := os.OpenFile(c.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		c.outputLost = fmt.Errorf("output file %s lost after a failed rotation: %v", c.Output, err)
+		return fmt.Errorf("could not rotate %s: %v, and could not reopen it: %v", c.Output, cause, err)
+	}
+	c.setOutputFileUnlocked(file)
+	return fmt.Errorf("could not rotate %s: %v", c.Output, cause)
+}
+
+// rotateUnlocked renames the output file to a timestamped name and reopens a fresh one,
+// deleting the oldest rotated files beyond the ones to keep. If the rotation fails, the events keep being written
+// to the current file. The caller must hold the output lock.
+func (c *SnifferContext) rotateUnlocked() error {
+	// Make sure everything reached the disk before the file is moved.
+	err := c.flushOutputUnlocked()
+	if err == nil {
+		err = c.closeOutputGzipUnlocked()
+	}
+	if err == nil {
+		err = c.OutputFile.Sync()
+	}
+	if cerr := c.OutputFile.Close(); err == nil {
+		err = cerr
+	}
+	c.OutputFile = nil
+	if err != nil {
+		return c.reopenOutputUnlocked(err)
+	}
+
+	rotated := c.rotatedName(time.Now())
+	if err = os.Rename(c.Output, rotated); err != nil {
+		return c.reopenOutputUnlocked(err)
+	}
+	file, err := os.Create(c.Output)
+	if err != nil {
+		// Move the segment back so that the events keep being appended to it.
+		if rerr := os.Rename(rotated, c.Output); rerr != nil {
+			c.outputLost = fmt.Errorf("output file %s lost after a failed rotation: %v", c.Output, rerr)
+			return fmt.Errorf("could not rotate %s: %v, and could not restore it from %s: %v", c.Output, err, rotated, rerr)
+		}
+		return c.reopenOutputUnlocked(err)
+	}
+	c.setOutputFileUnlocked(file)
+
+	// Upload the segment to the object storage in background.
+	if c.s3 != nil {
+		c.s3.Enqueue(rotated)
+	}
+
+	if c.RotateKeep > 0 {
+		return c.pruneRotated()
+	}
+	return nil
+}
+
+// rotatedFiles lists the rotated output files, the other files of the directory being ignored even if their name
+// starts like the output one. The directory is listed rather than globbed so that the name of the output doesn't
+// need escaping.
+func (c *SnifferContext) rotatedFiles() ([]string, error) {
+	prefix, suffix := c.rotatedAffixes()
+	dir, start := filepath.Split(prefix)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || len(name) < len(start)+len(suffix) || !strings.HasPrefix(name, start) || !strings.HasSuffix(name, suffix) {
+			continue
+		} else if _, err = time.Parse(rotationTimeFormat, name[len(start):len(name)-len(suffix)]); err != nil {
+			continue
+		}
+		rotated = append(rotated, filepath.Join(dir, name))
+	}
+	return rotated, nil
+}
+
+// pruneRotated deletes the oldest rotated output files, keeping the most recent ones.
+func (c *SnifferContext) pruneRotated() error {
+	rotated, err := c.rotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	// The timestamp suffix makes the lexical order chronological. The files still to be uploaded are never deleted,
+	// the next oldest ones are instead.
+	sort.Strings(rotated)
+	for excess := len(rotated) - c.RotateKeep; excess > 0 && len(rotated) > 0; rotated = rotated[1:] {
+		if c.s3 != nil && c.s3.Queued(rotated[0]) {
+			continue
+		}
+		if err := os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		excess--
+	}
+	return nil
+}
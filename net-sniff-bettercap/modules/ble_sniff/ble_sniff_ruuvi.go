@@ -0,0 +1,76 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/binary for the big-endian fields, fmt for errors and formatted strings, math for rounding the scaled
+// values, and net for the MAC address.
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+)
+
+// Declaring the data format and size of the RuuviTag RAWv2 payloads.
+const (
+	RUUVI_FORMAT_5   = 0x05
+	ruuviFormat5Size = 24
+)
+
+// decodeRuuvi decodes the manufacturer specific data of the RuuviTag sensors, in the data format 5 (RAWv2): the
+// temperature, humidity, pressure, acceleration, battery voltage, TX power and movement counter. The measurements
+// a sensor marks as not available are left out.
+func decodeRuuvi(data []byte) (SniffData, string, error) {
+	if len(data) < 1 {
+		return nil, "", fmt.Errorf("RuuviTag payload is empty")
+	} else if data[0] != RUUVI_FORMAT_5 {
+		return nil, "", fmt.Errorf("unsupported RuuviTag data format %d", data[0])
+	} else if len(data) != ruuviFormat5Size {
+		return nil, "", fmt.Errorf("RuuviTag data format 5 payload must be %d bytes long, got %d", ruuviFormat5Size, len(data))
+	}
+
+	decoded := SniffData{
+		"ruuvi_format": data[0],
+		"ruuvi_mac":    net.HardwareAddr(data[18:24]).String(),
+	}
+	description := "RuuviTag"
+
+	if temperature := int16(binary.BigEndian.Uint16(data[1:3])); temperature != -0x8000 {
+		decoded["temperature"] = math.Round(float64(temperature)*5) / 1000
+		description += fmt.Sprintf(" temperature=%.2fC", decoded["temperature"])
+	}
+	if humidity := binary.BigEndian.Uint16(data[3:5]); humidity != 0xffff {
+		decoded["humidity"] = math.Round(float64(humidity)*25) / 10000
+		description += fmt.Sprintf(" humidity=%.2f%%", decoded["humidity"])
+	}
+	if pressure := binary.BigEndian.Uint16(data[5:7]); pressure != 0xffff {
+		decoded["pressure"] = float64(uint32(pressure)+50000) / 100
+		description += fmt.Sprintf(" pressure=%.2fhPa", decoded["pressure"])
+	}
+
+	// The acceleration is in milli-g on every axis.
+	for i, axis := range []string{"acceleration_x", "acceleration_y", "acceleration_z"} {
+		if acceleration := int16(binary.BigEndian.Uint16(data[7+2*i : 9+2*i])); acceleration != -0x8000 {
+			decoded[axis] = acceleration
+		}
+	}
+
+	// The power info packs the battery voltage above 1.6V in 11 bits and the TX power above -40 dBm in 5 bits.
+	power := binary.BigEndian.Uint16(data[13:15])
+	if voltage := power >> 5; voltage != 0x7ff {
+		decoded["battery_mv"] = voltage + 1600
+		description += fmt.Sprintf(" battery=%dmV", voltage+1600)
+	}
+	if tx_power := power & 0x1f; tx_power != 0x1f {
+		decoded["tx_power"] = int(tx_power)*2 - 40
+	}
+	if movement := data[15]; movement != 0xff {
+		decoded["movement_counter"] = movement
+		description += fmt.Sprintf(" movements=%d", movement)
+	}
+	if sequence := binary.BigEndian.Uint16(data[16:18]); sequence != 0xffff {
+		decoded["measurement_sequence"] = sequence
+	}
+
+	return decoded, description, nil
+}
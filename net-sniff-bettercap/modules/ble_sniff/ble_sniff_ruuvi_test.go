@@ -0,0 +1,75 @@
+package ble_sniff
+
+import (
+	"testing"
+)
+
+func TestDecodeRuuvi(t *testing.T) {
+	// Test vector of the RAWv2 format specification.
+	data, err := parseHexBytes("05:12:fc:53:94:c3:7c:00:04:ff:fc:04:0c:ac:36:42:00:cd:cb:b8:33:4c:88:4f")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, description, err := decodeRuuvi(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := SniffData{
+		"temperature":          24.3,
+		"humidity":             53.49,
+		"pressure":             1000.44,
+		"acceleration_x":       int16(4),
+		"acceleration_y":       int16(-4),
+		"acceleration_z":       int16(1036),
+		"battery_mv":           uint16(2977),
+		"tx_power":             4,
+		"movement_counter":     uint8(66),
+		"measurement_sequence": uint16(205),
+		"ruuvi_mac":            "cb:b8:33:4c:88:4f",
+	}
+	for key, value := range expected {
+		if decoded[key] != value {
+			t.Errorf("expected %s %v (%T), got %v (%T)", key, value, value, decoded[key], decoded[key])
+		}
+	}
+	if description != "RuuviTag temperature=24.30C humidity=53.49% pressure=1000.44hPa battery=2977mV movements=66" {
+		t.Errorf("unexpected description %q", description)
+	}
+}
+
+func TestDecodeRuuviInvalid(t *testing.T) {
+	// Every measurement marked as not available.
+	data, _ := parseHexBytes("05:80:00:ff:ff:ff:ff:80:00:80:00:80:00:ff:ff:ff:ff:ff:ff:ff:ff:ff:ff:ff")
+	decoded, _, err := decodeRuuvi(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, key := range []string{"temperature", "humidity", "pressure", "acceleration_x", "battery_mv", "tx_power", "movement_counter"} {
+		if _, found := decoded[key]; found {
+			t.Errorf("expected %s to be left out, got %v", key, decoded[key])
+		}
+	}
+
+	for _, data := range [][]byte{{}, {0x03, 0x00}, data[:20]} {
+		if _, _, err := decodeRuuvi(data); err == nil {
+			t.Errorf("expected an error for % x", data)
+		}
+	}
+}
+
+func TestProprietaryRuuvi(t *testing.T) {
+	adv := &advertisement{Data: map[string]interface{}{"btle.advertising_address": "cb:b8:33:4c:88:4f"}, Stats: NewSnifferStats()}
+	events := onProprietary(adv, map[string]interface{}{
+		"btcommon.eir_ad.entry.type":       "0xff",
+		"btcommon.eir_ad.entry.company_id": "0x0499",
+		"btcommon.eir_ad.entry.data":       "05:12:fc:53:94:c3:7c:00:04:ff:fc:04:0c:ac:36:42:00:cd:cb:b8:33:4c:88:4f",
+	})
+	if len(events) != 1 {
+		t.Fatalf("expected an event, got %d", len(events))
+	}
+	data := events[0].Data.(SniffData)
+	if data["temperature"] != 24.3 || data["company_id"] != uint16(0x0499) {
+		t.Errorf("expected the decoded RuuviTag data, got %v", data)
+	}
+}
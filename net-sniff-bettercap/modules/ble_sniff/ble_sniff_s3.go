@@ -0,0 +1,399 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// context for cancelling the uploads, crypto/hmac and crypto/sha256 for signing the requests, encoding/hex for
+// the signatures, fmt for errors, io for hashing the files, io/ioutil for the error responses, net/http for the
+// requests, net/url for escaping the keys, os for the files and the credentials, path/filepath for the object names,
+// sort for the signed headers, strings for the canonical request, sync for guarding the queued files, and time for
+// the retries and the signing date.
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Declaring the settings of the uploads of the rotated output files.
+const (
+	s3DefaultRegion = "us-east-1"
+	s3QueueSize     = 64
+	s3Attempts      = 3
+	s3Timeout       = 5 * time.Minute
+)
+
+// s3RetryDelay is the delay before the second attempt of an upload, growing with every attempt.
+var s3RetryDelay = 5 * time.Second
+
+// Declaring the formats of the AWS Signature Version 4 dates.
+const (
+	sigV4DateFormat = "20060102"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+// s3Target is the bucket and the key prefix the rotated output files are uploaded to.
+type s3Target struct {
+	Bucket string // Name of the bucket.
+	Prefix string // Prefix of the object keys, without trailing slash.
+}
+
+// parseS3Target parses a destination in the s3://bucket/prefix form, the scheme and the prefix being optional.
+func parseS3Target(value string) (*s3Target, error) {
+	value = strings.Trim(strings.TrimPrefix(value, "s3://"), "/")
+	if value == "" {
+		return nil, fmt.Errorf("missing bucket, expected s3://bucket/prefix")
+	}
+
+	target := &s3Target{Bucket: value}
+	if slash := strings.IndexByte(value, '/'); slash >= 0 {
+		target.Bucket, target.Prefix = value[:slash], strings.Trim(value[slash+1:], "/")
+	}
+	return target, nil
+}
+
+// Key returns the object key of a file.
+func (t *s3Target) Key(path string) string {
+	if t.Prefix == "" {
+		return filepath.Base(path)
+	}
+	return t.Prefix + "/" + filepath.Base(path)
+}
+
+// s3Credentials holds the AWS credentials the requests are signed with.
+type s3Credentials struct {
+	AccessKey    string // Access key identifier.
+	SecretKey    string // Secret access key.
+	SessionToken string // Session token of temporary credentials, if any.
+}
+
+// s3CredentialsFromEnv reads the credentials from the standard AWS environment variables.
+func s3CredentialsFromEnv() (s3Credentials, error) {
+	creds := s3Credentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return creds, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return creds, nil
+}
+
+// s3RegionFromEnv returns the region set in the environment, us-east-1 if none.
+func s3RegionFromEnv() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return s3DefaultRegion
+}
+
+// escapeS3Key escapes an object key for the request path and the canonical request, keeping its slashes.
+func escapeS3Key(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		// PathEscape leaves a few reserved characters such as '$' and '=' as they are, SigV4 wants them encoded.
+		segments[i] = strings.Replace(url.QueryEscape(segment), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with the given key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// signV4 signs a request to S3 with AWS Signature Version 4, covering the host and every header already set.
+// payloadHash is the hexadecimal SHA-256 of the body.
+func signV4(req *http.Request, payloadHash string, creds s3Credentials, region string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical_headers strings.Builder
+	for _, name := range names {
+		canonical_headers.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed_headers := strings.Join(names, ";")
+
+	canonical_uri := req.URL.EscapedPath()
+	if canonical_uri == "" {
+		canonical_uri = "/"
+	}
+	canonical_request := strings.Join([]string{
+		req.Method,
+		canonical_uri,
+		req.URL.RawQuery,
+		canonical_headers.String(),
+		signed_headers,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format(sigV4DateFormat)
+	scope := date + "/" + region + "/s3/aws4_request"
+	request_hash := sha256.Sum256([]byte(canonical_request))
+	string_to_sign := "AWS4-HMAC-SHA256\n" + now.Format(sigV4TimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(request_hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, string_to_sign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKey, scope, signed_headers, signature))
+}
+
+// checkS3 checks the rotated output files can be uploaded: the output must be a rotated file and the destination
+// and the credentials must be set.
+func (c *SnifferContext) checkS3() error {
+	if c.Output == "" || isNamedPipe(c.Output) || c.SplitByDevice {
+		return fmt.Errorf("ble.sniff.output.s3 requires ble.sniff.output to be a file")
+	} else if c.RotateSize == 0 && c.RotateInterval == 0 {
+		return fmt.Errorf("ble.sniff.output.s3 requires ble.sniff.output.rotate.size or ble.sniff.output.rotate.interval")
+	} else if _, err := parseS3Target(c.S3); err != nil {
+		return fmt.Errorf("ble.sniff.output.s3: %v", err)
+	} else if _, err = s3CredentialsFromEnv(); err != nil {
+		return fmt.Errorf("ble.sniff.output.s3: %v", err)
+	}
+	return nil
+}
+
+// s3ContentType returns the content type of an uploaded file, the compressed outputs being gzip archives.
+func s3ContentType(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), gzipExtension) {
+		return "application/gzip"
+	}
+	return "application/x-ndjson"
+}
+
+// s3Uploader uploads the rotated output files to a bucket in background, retrying the failed uploads
+// without ever blocking the capture.
+type s3Uploader struct {
+	Target      *s3Target          // Bucket and prefix the files are uploaded to.
+	Region      string             // Region of the bucket.
+	Endpoint    string             // Base URL of an S3 compatible storage using path-style requests, empty for AWS.
+	Credentials s3Credentials      // Credentials the requests are signed with.
+	DeleteLocal bool               // Delete the files once uploaded.
+	client      *http.Client       // Client sending the requests.
+	queue       chan string        // Files waiting to be uploaded.
+	queued      map[string]bool    // Files queued or being uploaded, which mustn't be pruned.
+	queuedLock  sync.Mutex         // Lock guarding the queued files.
+	ctx         context.Context    // Cancelled to abort the upload in progress.
+	cancel      context.CancelFunc // Cancels ctx.
+	quit        chan struct{}      // Closed to upload the queued files and stop.
+	done        chan struct{}      // Closed once the uploader stopped.
+}
+
+// newS3Uploader starts uploading the files queued to a bucket, with the credentials, the region and the endpoint
+// set in the environment.
+func newS3Uploader(destination string, deleteLocal bool) (*s3Uploader, error) {
+	target, err := parseS3Target(destination)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := s3CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &s3Uploader{
+		Target:      target,
+		Region:      s3RegionFromEnv(),
+		Endpoint:    strings.TrimRight(os.Getenv("AWS_ENDPOINT_URL"), "/"),
+		Credentials: creds,
+		DeleteLocal: deleteLocal,
+		client:      &http.Client{Timeout: s3Timeout},
+		queue:       make(chan string, s3QueueSize),
+		queued:      make(map[string]bool),
+		ctx:         ctx,
+		cancel:      cancel,
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	go u.run()
+
+	return u, nil
+}
+
+// objectURL returns the URL of an object, virtual-hosted on AWS and path-style on the other storages.
+func (u *s3Uploader) objectURL(key string) string {
+	if u.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Target.Bucket, u.Region, escapeS3Key(key))
+	}
+	return fmt.Sprintf("%s/%s/%s", u.Endpoint, u.Target.Bucket, escapeS3Key(key))
+}
+
+// Enqueue queues a file to be uploaded, leaving it on disk with a warning if the queue is full.
+func (u *s3Uploader) Enqueue(path string) {
+	u.queuedLock.Lock()
+	defer u.queuedLock.Unlock()
+
+	select {
+	case u.queue <- path:
+		u.queued[filepath.Clean(path)] = true
+	default:
+		logWarning("S3 upload queue full, %s is kept locally", path)
+	}
+}
+
+// Queued returns true if a file is waiting to be uploaded or being uploaded.
+func (u *s3Uploader) Queued(path string) bool {
+	u.queuedLock.Lock()
+	defer u.queuedLock.Unlock()
+
+	return u.queued[filepath.Clean(path)]
+}
+
+// Pending returns the number of files waiting to be uploaded or being uploaded.
+func (u *s3Uploader) Pending() int {
+	u.queuedLock.Lock()
+	defer u.queuedLock.Unlock()
+
+	return len(u.queued)
+}
+
+// upload sends a file with a single PUT request.
+func (u *s3Uploader) upload(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The payload is hashed first since it is part of the signature.
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	} else if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(u.ctx, http.MethodPut, u.objectURL(u.Target.Key(path)), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", s3ContentType(path))
+	signV4(req, hex.EncodeToString(hash.Sum(nil)), u.Credentials, u.Region, time.Now())
+
+	res, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// process uploads a file, retrying after a growing delay, and deletes it once uploaded if requested.
+func (u *s3Uploader) process(path string) {
+	defer func() {
+		u.queuedLock.Lock()
+		delete(u.queued, filepath.Clean(path))
+		u.queuedLock.Unlock()
+	}()
+
+	key := u.Target.Key(path)
+	for attempt := 1; attempt <= s3Attempts; attempt++ {
+		err := u.upload(path)
+		if err == nil {
+			logDebug("uploaded %s to s3://%s/%s", path, u.Target.Bucket, key)
+			if u.DeleteLocal {
+				if err = os.Remove(path); err != nil {
+					logWarning("could not delete %s after uploading it: %v", path, err)
+				}
+			}
+			return
+		} else if u.ctx.Err() != nil {
+			logWarning("upload of %s to s3://%s/%s aborted, the file is kept locally", path, u.Target.Bucket, key)
+			return
+		}
+
+		logWarning("upload of %s to s3://%s/%s failed (attempt %d of %d): %v", path, u.Target.Bucket, key, attempt, s3Attempts, err)
+		if attempt < s3Attempts {
+			select {
+			case <-u.ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * s3RetryDelay):
+			}
+		}
+	}
+	logWarning("giving up uploading %s, the file is kept locally", path)
+}
+
+// run uploads the queued files one at a time until the uploader is closed, then uploads the files still queued
+// unless the uploads are aborted.
+func (u *s3Uploader) run() {
+	defer close(u.done)
+
+	for {
+		select {
+		case <-u.ctx.Done():
+			return
+		case path := <-u.queue:
+			u.process(path)
+		case <-u.quit:
+			for u.ctx.Err() == nil {
+				select {
+				case path := <-u.queue:
+					u.process(path)
+				default:
+					return
+				}
+			}
+			return
+		}
+	}
+}
+
+// Close uploads the queued files for up to timeout, then aborts the upload in progress and stops the uploader,
+// the files not uploaded yet are kept locally.
+func (u *s3Uploader) Close(timeout time.Duration) {
+	close(u.quit)
+	select {
+	case <-u.done:
+	case <-time.After(timeout):
+		logWarning("S3 uploads still in progress at the shutdown deadline, aborting them")
+	}
+	u.cancel()
+	<-u.done
+
+	if pending := u.Pending(); pending > 0 {
+		logWarning("%d rotated files not uploaded to s3://%s, they are kept locally", pending, u.Target.Bucket)
+	}
+}
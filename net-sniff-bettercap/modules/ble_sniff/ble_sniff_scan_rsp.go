@@ -0,0 +1,114 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatting the 32 bit UUIDs, strconv and strings for parsing them, and time for time-related functions.
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uuidFields lists the TShark fields holding the 16 and 128 bit service UUIDs of an AD structure.
+var uuidFields = []string{
+	"btcommon.eir_ad.entry.uuid_16",
+	"btcommon.eir_ad.entry.uuid_128",
+	"btcommon.eir_ad.entry.custom_uuid_128",
+}
+
+// uuid32Fields lists the TShark fields holding the 32 bit service UUIDs of an AD structure.
+var uuid32Fields = []string{
+	"btcommon.eir_ad.entry.uuid_32",
+	"btcommon.eir_ad.entry.custom_uuid_32",
+}
+
+// canonicalUUID32 formats a 32 bit UUID as eight lowercase hexadecimal digits prefixed by 0x, whatever the width
+// and the separators TShark decoded it with.
+func canonicalUUID32(value string) string {
+	digits := strings.TrimPrefix(normalizeUUID(value), "0x")
+	if uuid, err := strconv.ParseUint(digits, 16, 32); err == nil {
+		return fmt.Sprintf("0x%08x", uuid)
+	}
+	return normalizeUUID(value)
+}
+
+// serviceUUIDs32 extracts the 32 bit service UUIDs of an AD structure in their canonical form.
+func serviceUUIDs32(entry map[string]interface{}) []string {
+	var uuids []string
+	for _, field := range uuid32Fields {
+		for _, value := range stringValues(entry[field]) {
+			uuids = append(uuids, canonicalUUID32(value))
+		}
+	}
+	return uuids
+}
+
+// entryUUIDs extracts the service UUIDs of an AD structure, whatever their width.
+func entryUUIDs(entry map[string]interface{}) []string {
+	var uuids []string
+	for _, field := range uuidFields {
+		uuids = append(uuids, stringValues(entry[field])...)
+	}
+	return append(uuids, serviceUUIDs32(entry)...)
+}
+
+// parseDeviceInfo extracts the local name and the service UUIDs from the AD structures of the BLE data.
+func parseDeviceInfo(btleData map[string]interface{}) (string, []string) {
+	name, uuids := deviceInfo(eirEntries(btleData))
+	if uuids == nil {
+		uuids = make([]string, 0)
+	}
+	return name, uuids
+}
+
+// deviceInfo extracts the local name and the service UUIDs from AD structures, the UUIDs being nil if there are none.
+func deviceInfo(entries []map[string]interface{}) (string, []string) {
+	name := ""
+	var uuids []string
+
+	for _, entry := range entries {
+		// Both the complete and the shortened local names are decoded in this field.
+		if device_name, ok := entry["btcommon.eir_ad.entry.device_name"].(string); ok {
+			name = device_name
+		}
+		uuids = append(uuids, entryUUIDs(entry)...)
+	}
+
+	return name, uuids
+}
+
+// onScanResponse processes a SCAN_RSP, merging the name and service UUIDs it carries into the record of the device
+// which sent the preceding advertisement. The hexdump of the packet, if any, is attached to the event.
+func (mod *Sniffer) onScanResponse(btleData map[string]interface{}, signal *SnifferSignal, rawHex string, t time.Time) {
+	// Extract the advertising address from the BLE data.
+	advert_address, ok := btleData["btle.advertising_address"].(string)
+	if !ok {
+		return
+	}
+
+	name, uuids := parseDeviceInfo(btleData)
+	mod.Stats.MergeDeviceInfo(advert_address, name, uuids)
+
+	// Collect the scan response data along with the signal information of the advertiser.
+	event_data := SniffData{
+		"name":  name,
+		"uuids": uuids,
+	}
+	if signal != nil {
+		event_data["rssi"] = signal.RSSI
+		event_data["rssi_smoothed"] = signal.SmoothedRSSI
+		event_data["proximity"] = signal.Proximity
+	}
+
+	// Create a new SnifferEvent with protocol "BLE SCAN_RSP" and push it.
+	mod.Push(NewSnifferEvent(t,
+		"BLE SCAN_RSP",
+		advert_address,
+		"BROADCAST",
+		event_data,
+		"Scan response name=%q uuids=%d",
+		name,
+		len(uuids),
+	).WithPDU(pduTypeName(PDU_SCAN_RSP)).WithRawHex(rawHex))
+}
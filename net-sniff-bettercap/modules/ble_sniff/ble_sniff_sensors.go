@@ -0,0 +1,160 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted output and errors, io for the writer, sort for listing the devices in order, strings for
+// normalizing the addresses, sync for guarding the log, and time for the time of the changes.
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SensorReading is a value of the manufacturer specific data of a device, recorded when it changed.
+type SensorReading struct {
+	Time      time.Time `json:"time"`              // Time of the advertisement carrying the new value.
+	CompanyID uint16    `json:"company_id"`        // Company identifier of the manufacturer specific data.
+	Company   string    `json:"company,omitempty"` // Name of the company, if known.
+	Data      string    `json:"data"`              // Payload of the manufacturer specific data, as decoded by TShark.
+}
+
+// sensorLog records, per device, the successive values of the manufacturer specific data, turning the beacons of
+// the sensors into a compact log of their readings. The repeated values are not recorded, and only the last
+// readings of each device are kept.
+type sensorLog struct {
+	lock    sync.Mutex                 // Lock guarding the log, the workers record concurrently.
+	size    int                        // Maximum number of readings kept per device.
+	devices map[string][]SensorReading // Readings of each device, oldest first.
+}
+
+// newSensorLog creates a log keeping up to size readings per device.
+func newSensorLog(size int) *sensorLog {
+	return &sensorLog{
+		size:    size,
+		devices: make(map[string][]SensorReading),
+	}
+}
+
+// Record adds a reading to the log of a device and returns true, unless it repeats the last one of the device.
+// The oldest reading is discarded once the log of the device is full.
+func (l *sensorLog) Record(address string, reading SensorReading) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	readings := l.devices[address]
+	if n := len(readings); n > 0 && readings[n-1].CompanyID == reading.CompanyID && readings[n-1].Data == reading.Data {
+		return false
+	}
+
+	if len(readings) < l.size {
+		readings = append(readings, reading)
+	} else {
+		copy(readings, readings[1:])
+		readings[len(readings)-1] = reading
+	}
+	l.devices[address] = readings
+	return true
+}
+
+// Readings returns a copy of the readings of a device, oldest first.
+func (l *sensorLog) Readings(address string) []SensorReading {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return append([]SensorReading(nil), l.devices[address]...)
+}
+
+// Addresses returns the addresses of the devices with readings, sorted.
+func (l *sensorLog) Addresses() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	addresses := make([]string, 0, len(l.devices))
+	for address := range l.devices {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// logSensorData records the manufacturer specific data of an advertisement in the log of its device, pushing a
+// "BLE SENSOR" event when its value changed, unless only the inventory is built.
+func (mod *Sniffer) logSensorData(btleData map[string]interface{}, entries []map[string]interface{}, t time.Time) {
+	address, ok := btleData["btle.advertising_address"].(string)
+	if !ok {
+		return
+	}
+	manufacturer := manufacturerData(entries)
+	if len(manufacturer) == 0 {
+		return
+	}
+
+	// The last manufacturer specific data is logged, like the company of the device.
+	last := manufacturer[len(manufacturer)-1]
+	reading := SensorReading{Time: t}
+	reading.CompanyID, _ = last["company_id"].(uint16)
+	reading.Company, _ = last["company"].(string)
+	reading.Data, _ = last["data"].(string)
+	// The readings are logged under the pseudonym of the device when anonymizing, the one ble.sniff.sensors shows.
+	if !mod.Ctx.sensors.Record(mod.Ctx.anonymizer.Address(address), reading) || mod.recon {
+		return
+	}
+
+	destination := "BROADCAST"
+	if mod.Ctx.DirectedTarget {
+		destination = advertisementTarget(btleData)
+	}
+
+	mod.Push(NewSnifferEvent(t,
+		"BLE SENSOR",
+		address,
+		destination,
+		SniffData{
+			"company_id": reading.CompanyID,
+			"company":    reading.Company,
+			"data":       reading.Data,
+		},
+		"%s data changed to %s",
+		reading.Company,
+		reading.Data,
+	).WithPDU(pduLabel(btleData)))
+}
+
+// writeSensorReadings writes a line for each reading of a device with its time, company and payload.
+func writeSensorReadings(w io.Writer, address string, readings []SensorReading) {
+	for _, r := range readings {
+		fmt.Fprintf(w, "%s %s (0x%04x) %s\n", r.Time.Format("15:04:05.000"), r.Company, r.CompanyID, r.Data)
+	}
+	fmt.Fprintf(w, "%d readings of %s\n", len(readings), address)
+}
+
+// writeSensorDevices writes a line for each device of the log with its number of readings and its last one.
+func writeSensorDevices(w io.Writer, log *sensorLog) {
+	addresses := log.Addresses()
+	for _, address := range addresses {
+		readings := log.Readings(address)
+		last := readings[len(readings)-1]
+		fmt.Fprintf(w, "%s %3d readings, last %s %s\n", address, len(readings), last.Time.Format("15:04:05.000"), last.Data)
+	}
+	fmt.Fprintf(w, "%d devices\n", len(addresses))
+}
+
+// ShowSensors prints the readings recorded for a device, or the devices with readings if the address is empty.
+func (mod *Sniffer) ShowSensors(address string) error {
+	if mod.Ctx == nil || mod.Ctx.sensors == nil {
+		return fmt.Errorf("No sensor log, set ble.sniff.sensors.log to a positive size and start the sniffer.")
+	}
+
+	if address == "" {
+		writeSensorDevices(mod.Session.Events.Stdout, mod.Ctx.sensors)
+	} else {
+		address = strings.ToLower(address)
+		writeSensorReadings(mod.Session.Events.Stdout, address, mod.Ctx.sensors.Readings(address))
+	}
+	mod.Session.Refresh()
+
+	return nil
+}
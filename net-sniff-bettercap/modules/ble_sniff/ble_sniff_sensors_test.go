@@ -0,0 +1,82 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func sensorReading(i int, data string) SensorReading {
+	return SensorReading{Time: time.Date(2024, 5, 1, 12, 0, i, 0, time.UTC), CompanyID: 0x004c, Company: "Apple, Inc.", Data: data}
+}
+
+func TestSensorLog(t *testing.T) {
+	log := newSensorLog(3)
+
+	for i, data := range []string{"01", "01", "02", "03", "03", "04"} {
+		log.Record("aa:bb:cc:dd:ee:ff", sensorReading(i, data))
+	}
+	if !log.Record("11:22:33:44:55:66", sensorReading(0, "01")) {
+		t.Errorf("expected the first reading of a device to be recorded")
+	}
+
+	readings := log.Readings("aa:bb:cc:dd:ee:ff")
+	values := make([]string, len(readings))
+	for i, r := range readings {
+		values[i] = r.Data
+	}
+	// The repeated values are skipped and the oldest one is discarded.
+	if fmt.Sprint(values) != "[02 03 04]" {
+		t.Errorf("expected [02 03 04], got %v", values)
+	}
+	if addresses := log.Addresses(); fmt.Sprint(addresses) != "[11:22:33:44:55:66 aa:bb:cc:dd:ee:ff]" {
+		t.Errorf("unexpected addresses %v", addresses)
+	}
+
+	var out bytes.Buffer
+	writeSensorReadings(&out, "aa:bb:cc:dd:ee:ff", readings[2:])
+	expected := "12:00:05.000 Apple, Inc. (0x004c) 04\n1 readings of aa:bb:cc:dd:ee:ff\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestSensorLogPackets(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.SensorsLog = 10
+	mod.Ctx.sensors = newSensorLog(mod.Ctx.SensorsLog)
+
+	// The second round repeats the manufacturer data, only the temperature change of the third one is logged.
+	for round := 0; round < 3; round++ {
+		for _, packet := range fixturePackets(t) {
+			if round == 2 {
+				btle := packet.(map[string]interface{})["btle"].(map[string]interface{})
+				entries := eirEntries(btle)
+				if btle["btle.advertising_address"] == "d4:3a:2c:11:8e:07" {
+					entries[len(entries)-1]["btcommon.eir_ad.entry.data"] = "10:05:0b:1c:5e:a2:08"
+				}
+			}
+			mod.dispatchPacket(nil, packet)
+		}
+	}
+
+	readings := mod.Ctx.sensors.Readings("d4:3a:2c:11:8e:07")
+	if len(readings) != 2 || readings[1].Data != "10:05:0b:1c:5e:a2:08" || readings[1].CompanyID != 0x004c {
+		t.Fatalf("expected 2 readings, got %+v", readings)
+	}
+
+	changes := 0
+	for _, e := range sink.events {
+		if e.Protocol == "BLE SENSOR" {
+			changes++
+			if e.Source != "d4:3a:2c:11:8e:07" {
+				t.Errorf("unexpected sensor event for %s", e.Source)
+			}
+		}
+	}
+	if changes != 2 {
+		t.Errorf("expected 2 sensor events, got %d", changes)
+	}
+}
@@ -0,0 +1,81 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync/atomic for the counter read by the other goroutines.
+import (
+	"sync/atomic"
+)
+
+// packetCounterWindow is the largest jump of the packet counter still considered a gap, larger ones are taken as a
+// restart of the sniffer firmware or a new capture file rather than as missed packets.
+const packetCounterWindow = 1024
+
+// packetCounter reads the packet counter the nRF sniffer firmware increments for every packet it sends to the host.
+func packetCounter(packetMap map[string]interface{}) (uint16, bool) {
+	nordic, ok := packetMap["nordic_ble"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	counter_string, ok := nordic["nordic_ble.packet_counter"].(string)
+	if !ok {
+		return 0, false
+	}
+	counter, err := parseUint(counter_string, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(counter), true
+}
+
+// sequenceTracker detects the gaps in the packet counter, which reveal the packets the firmware sent but the
+// capture lost, for instance because of the USB bandwidth.
+type sequenceTracker struct {
+	last uint16 // Counter of the previous packet.
+	seen bool   // Set once a first counter was seen.
+}
+
+// update records the counter of a packet and returns how many packets were missed since the previous one. The
+// 16 bit counter wraps around, and the jumps beyond packetCounterWindow restart the tracking without counting a gap.
+func (t *sequenceTracker) update(counter uint16) uint64 {
+	if !t.seen {
+		t.last, t.seen = counter, true
+		return 0
+	}
+
+	// The subtraction wraps around like the counter does.
+	step := counter - t.last
+	if step == 0 {
+		// Duplicated packet.
+		return 0
+	}
+	t.last = counter
+	if step > packetCounterWindow {
+		return 0
+	}
+	return uint64(step - 1)
+}
+
+// trackSequence counts the packets missed before the given one. It must be called in capture order, before the
+// packets are handed to the workers.
+func (s *SnifferStats) trackSequence(packetMap map[string]interface{}) {
+	counter, ok := packetCounter(packetMap)
+	if !ok {
+		return
+	}
+	atomic.AddUint64(&s.NumSequenced, 1)
+	if missed := s.sequence.update(counter); missed > 0 {
+		atomic.AddUint64(&s.NumMissed, missed)
+	}
+}
+
+// LossRatio returns the estimated fraction of the packets sent by the sniffer firmware that were lost by the
+// capture, from the packets received and the gaps in their counter.
+func (s *SnifferStats) LossRatio() float64 {
+	missed := atomic.LoadUint64(&s.NumMissed)
+	received := atomic.LoadUint64(&s.NumSequenced)
+	if missed == 0 {
+		return 0
+	}
+	return float64(missed) / float64(missed+received)
+}
@@ -0,0 +1,45 @@
+package ble_sniff
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSequenceTracker(t *testing.T) {
+	tracker := sequenceTracker{}
+	for _, step := range []struct {
+		counter uint16
+		missed  uint64
+	}{
+		{100, 0},   // First packet, nothing to compare with.
+		{101, 0},   // In sequence.
+		{104, 2},   // 102 and 103 were lost.
+		{104, 0},   // Duplicate.
+		{65534, 0}, // Too far ahead, the tracking restarts.
+		{65535, 0},
+		{1, 1}, // Wraps around, 0 was lost.
+		{2, 0},
+	} {
+		if missed := tracker.update(step.counter); missed != step.missed {
+			t.Errorf("counter %d: expected %d missed packets, got %d", step.counter, step.missed, missed)
+		}
+	}
+}
+
+func TestTrackSequence(t *testing.T) {
+	stats := NewSnifferStats()
+	for _, counter := range []int{10, 11, 13, 14, 20} {
+		stats.trackSequence(map[string]interface{}{
+			"nordic_ble": map[string]interface{}{"nordic_ble.packet_counter": strconv.Itoa(counter)},
+		})
+	}
+	// Packets without the nRF layer are ignored.
+	stats.trackSequence(map[string]interface{}{})
+
+	if stats.NumMissed != 6 || stats.NumSequenced != 5 {
+		t.Errorf("expected 6 missed out of 5 received packets, got %d and %d", stats.NumMissed, stats.NumSequenced)
+	}
+	if ratio := stats.LossRatio(); ratio < 0.54 || ratio > 0.55 {
+		t.Errorf("expected a loss ratio of 6/11, got %f", ratio)
+	}
+}
@@ -0,0 +1,147 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// encoding/hex for validating the UUIDs, fmt for the configuration errors, and strings for normalizing the UUIDs.
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// serviceDataUUIDFields lists the TShark fields the UUID of a service data AD structure can be decoded in,
+// depending on its width and on whether Wireshark knows the service.
+var serviceDataUUIDFields = map[uint8][]string{
+	AD_SERVICE_DATA16:  {"btcommon.eir_ad.entry.uuid_16"},
+	AD_SERVICE_DATA32:  {"btcommon.eir_ad.entry.uuid_32", "btcommon.eir_ad.entry.custom_uuid_32"},
+	AD_SERVICE_DATA128: {"btcommon.eir_ad.entry.uuid_128", "btcommon.eir_ad.entry.custom_uuid_128"},
+}
+
+// normalizeUUID lowercases a UUID and removes the separators of the 128 bit ones, so they can be looked up.
+func normalizeUUID(uuid string) string {
+	uuid = strings.ToLower(uuid)
+	if strings.HasPrefix(uuid, "0x") {
+		return uuid
+	}
+	return strings.NewReplacer(":", "", "-", "").Replace(uuid)
+}
+
+// bluetoothBaseUUID is the suffix of the 128 bit form of the 16 and 32 bit UUIDs assigned by the Bluetooth SIG.
+const bluetoothBaseUUID = "00001000800000805f9b34fb"
+
+// shortenUUID returns the 16 or 32 bit form of a normalized 128 bit UUID derived from the Bluetooth base UUID,
+// so that a service matches whatever the width it is advertised with.
+func shortenUUID(uuid string) string {
+	if len(uuid) != 32 || !strings.HasSuffix(uuid, bluetoothBaseUUID) {
+		return uuid
+	} else if strings.HasPrefix(uuid, "0000") {
+		return "0x" + uuid[4:8]
+	}
+	return "0x" + uuid[:8]
+}
+
+// parseServiceUUID parses a service UUID given by the user, either as 16 or 32 bit hexadecimal with or without
+// the 0x prefix, or as 128 bit with or without separators, returning it in the normalized form of the parsers.
+func parseServiceUUID(value string) (string, error) {
+	digits := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "0x")
+	digits = strings.NewReplacer(":", "", "-", "").Replace(digits)
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("invalid service UUID '%s'", value)
+	}
+
+	switch len(digits) {
+	case 4, 8:
+		return "0x" + digits, nil
+	case 32:
+		return shortenUUID(digits), nil
+	}
+	return "", fmt.Errorf("invalid service UUID '%s', expected 16, 32 or 128 bits", value)
+}
+
+// uuidSet is a set of normalized service UUIDs.
+type uuidSet map[string]bool
+
+// parseServiceUUIDs parses a comma separated list of service UUIDs, returning nil if the list is empty.
+func parseServiceUUIDs(list string) (uuidSet, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+
+	uuids := make(uuidSet)
+	for _, value := range strings.Split(list, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		uuid, err := parseServiceUUID(value)
+		if err != nil {
+			return nil, err
+		}
+		uuids[uuid] = true
+	}
+	return uuids, nil
+}
+
+// hasServiceData returns true if one of the AD structures is the service data of one of the given services.
+func hasServiceData(entries []map[string]interface{}, uuids uuidSet) bool {
+	for _, entry := range entries {
+		ad_type, ok := adType(entry)
+		if !ok {
+			continue
+		}
+		if uuid, ok := serviceDataUUID(ad_type, entry); ok && uuids[shortenUUID(uuid)] {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceDataUUID extracts the service UUID of a service data AD structure of the given type.
+func serviceDataUUID(adType uint8, entry map[string]interface{}) (string, bool) {
+	for _, field := range serviceDataUUIDFields[adType] {
+		if uuid, ok := entry[field].(string); ok {
+			return normalizeUUID(uuid), true
+		}
+	}
+	return "", false
+}
+
+// onServiceData processes the service data AD structures with 16, 32 and 128 bit UUIDs, decoding the payload
+// of the known services and reporting the raw bytes of the others.
+func onServiceData(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	ad_type, _ := adType(entry)
+	uuid, ok := serviceDataUUID(ad_type, entry)
+	if !ok {
+		return nil
+	}
+
+	data_string, _ := entry["btcommon.eir_ad.entry.service_data"].(string)
+	event_data := SniffData{
+		"uuid": uuid,
+		"data": data_string,
+	}
+	// The Tile trackers are told by their services.
+	note := ""
+	if tileServices[shortenUUID(uuid)] {
+		note = adv.tileTracker(event_data)
+	}
+
+	// Route the payload to the decoder registered for the service, if any.
+	if decoder, found := serviceDecoder(uuid); found {
+		if protocol, description, ok := decodePayload(decoder, data_string, event_data); ok && protocol != "" {
+			return adv.protocolEvent(protocol, event_data, "%s%s", description, note)
+		} else if ok {
+			return adv.event(event_data,
+				"Service %s %s%s",
+				uuid,
+				description,
+				note,
+			)
+		}
+	}
+
+	return adv.event(event_data,
+		"Service %s Data%s",
+		uuid,
+		note,
+	)
+}
@@ -0,0 +1,21 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// crypto/rand for the random bytes and fmt for formatting the UUID.
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// newSessionID generates a random version 4 UUID identifying a capture session.
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4.
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant.
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,40 @@
+package ble_sniff
+
+import (
+	"regexp"
+	"testing"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewSessionID(t *testing.T) {
+	first, second := newSessionID(), newSessionID()
+	if !uuidV4.MatchString(first) {
+		t.Errorf("expected a version 4 UUID, got %s", first)
+	} else if first == second {
+		t.Errorf("expected a new identifier every time, got %s twice", first)
+	}
+}
+
+func TestSessionIDAttached(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+	mod.Ctx.SessionID = "sensor-1"
+
+	for _, packet := range fixturePackets(t) {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected events")
+	}
+	for _, e := range sink.events {
+		if e.SessionID != "sensor-1" {
+			t.Errorf("expected the session identifier on every event, got %q", e.SessionID)
+		}
+	}
+
+	if _, compat := sink.events[0].Compat(); compat.Data.(SniffData)["session_id"] != "sensor-1" {
+		t.Errorf("expected the session identifier in the data of the net.sniff events")
+	}
+}
@@ -0,0 +1,170 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted strings, sort for ordering the inventory, strings for the column names,
+// time for the age of the devices, and islazy/tui for the table.
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/evilsocket/islazy/tui"
+)
+
+// showColumns lists the columns of the ble.sniff.show table, which are also the ones it can be sorted by.
+var showColumns = []string{"address", "type", "name", "vendor", "rssi", "packets", "age"}
+
+// showAliveInterval is the age under which a device is highlighted as currently advertising.
+const showAliveInterval = 5 * time.Second
+
+// sortColumn validates a column name, returning its index in showColumns.
+func sortColumn(by string) (int, error) {
+	by = strings.ToLower(strings.TrimSpace(by))
+	if by == "seen" {
+		// Kept for the older ble.sniff.show.sort values.
+		by = "age"
+	}
+	for i, column := range showColumns {
+		if column == by {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column '%s', expected one of %s", by, strings.Join(showColumns, ", "))
+}
+
+// sortDevices orders the devices by the given column. Text columns and age are sorted in ascending order,
+// RSSI and packets with the highest values first. Devices without a RSSI sample are listed last when sorting by RSSI.
+func sortDevices(devices []SnifferDevice, by string) {
+	sort.SliceStable(devices, func(i, j int) bool {
+		a, b := devices[i], devices[j]
+		switch by {
+		case "type":
+			if a.AddressType != b.AddressType {
+				return a.AddressType < b.AddressType
+			}
+		case "name":
+			if a.Name != b.Name {
+				// Unnamed devices go last.
+				return b.Name == "" || (a.Name != "" && strings.ToLower(a.Name) < strings.ToLower(b.Name))
+			}
+		case "vendor":
+			if a.vendor() != b.vendor() {
+				return b.vendor() == "" || (a.vendor() != "" && a.vendor() < b.vendor())
+			}
+		case "age":
+			if !a.LastSeen.Equal(b.LastSeen) {
+				return a.LastSeen.After(b.LastSeen)
+			}
+		case "packets":
+			if a.Packets != b.Packets {
+				return a.Packets > b.Packets
+			}
+		case "rssi":
+			if a.rssiSeen != b.rssiSeen {
+				return a.rssiSeen
+			} else if a.RSSI != b.RSSI {
+				return a.RSSI > b.RSSI
+			}
+		}
+		return a.Address < b.Address
+	})
+}
+
+// vendor returns the name of the company advertised by the device, or its identifier if the name is unknown,
+// falling back to the manufacturer of its public address.
+func (d SnifferDevice) vendor() string {
+	if d.Company != "" {
+		return d.Company
+	} else if d.CompanyID != 0 {
+		return fmt.Sprintf("0x%04x", d.CompanyID)
+	}
+	return d.HardwareVendor
+}
+
+// colorRSSI colors a RSSI value by the proximity zone of the device.
+func (mod *Sniffer) colorRSSI(dev SnifferDevice) string {
+	if !dev.rssiSeen {
+		return ""
+	}
+
+	rssi := fmt.Sprintf("%d dBm", dev.RSSI)
+	switch classifyProximity(dev.SmoothedRSSI, mod.Ctx.ProximityImmediate, mod.Ctx.ProximityNear) {
+	case ProximityImmediate:
+		return tui.Green(rssi)
+	case ProximityNear:
+		return tui.Yellow(rssi)
+	}
+	return tui.Red(rssi)
+}
+
+// showRow returns the row of a device, dimming the ones which stopped advertising.
+func (mod *Sniffer) showRow(dev SnifferDevice, now time.Time) []string {
+	address := mod.Ctx.anonymizer.DeviceAddress(dev)
+	age := now.Sub(dev.LastSeen).Round(time.Second)
+	age_string := age.String()
+	if age <= showAliveInterval {
+		age_string = tui.Bold(age_string)
+	} else if mod.Ctx.RSSIReset > 0 && age > mod.Ctx.RSSIReset {
+		// The signal information of the device is outdated.
+		address = tui.Dim(address)
+		age_string = tui.Dim(age_string)
+	}
+
+	address_type := dev.AddressType
+	if address_type == AddressRandom {
+		address_type = tui.Dim(address_type)
+	}
+
+	return []string{
+		address,
+		address_type,
+		tui.Yellow(dev.Name),
+		tui.Dim(dev.vendor()),
+		mod.colorRSSI(dev),
+		fmt.Sprintf("%d", dev.Packets),
+		age_string,
+	}
+}
+
+// Show prints the device inventory as a table sorted by the given column, or by the ble.sniff.show.sort one if empty.
+func (mod *Sniffer) Show(by string) error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	if by == "" {
+		var err error
+		if err, by = mod.StringParam("ble.sniff.show.sort"); err != nil {
+			return err
+		}
+	}
+	sort_index, err := sortColumn(by)
+	if err != nil {
+		return err
+	}
+
+	devices := mod.Stats.DevicesList()
+	sortDevices(devices, showColumns[sort_index])
+
+	now := time.Now()
+	rows := make([][]string, 0, len(devices))
+	for _, dev := range devices {
+		rows = append(rows, mod.showRow(dev, now))
+	}
+
+	if len(rows) == 0 {
+		mod.Info("no devices discovered yet")
+		return nil
+	}
+
+	// Mark the column the table is sorted by.
+	columns := []string{"Address", "Type", "Name", "Vendor", "RSSI", "Packets", "Age"}
+	columns[sort_index] += " " + tui.Bold("▾")
+
+	tui.Table(mod.Session.Events.Stdout, columns, rows)
+	mod.Session.Refresh()
+
+	return nil
+}
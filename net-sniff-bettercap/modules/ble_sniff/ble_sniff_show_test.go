@@ -0,0 +1,60 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSortDevices(t *testing.T) {
+	now := time.Now()
+	devices := []SnifferDevice{
+		{Address: "aa:00:00:00:00:01", Name: "", RSSI: -80, rssiSeen: true, Packets: 5, LastSeen: now.Add(-time.Minute)},
+		{Address: "aa:00:00:00:00:02", Name: "beta", Packets: 50, LastSeen: now},
+		{Address: "aa:00:00:00:00:03", Name: "Alpha", RSSI: -40, rssiSeen: true, Packets: 1, LastSeen: now.Add(-time.Second)},
+	}
+
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{"rssi", []string{"aa:00:00:00:00:03", "aa:00:00:00:00:01", "aa:00:00:00:00:02"}},
+		{"packets", []string{"aa:00:00:00:00:02", "aa:00:00:00:00:01", "aa:00:00:00:00:03"}},
+		{"age", []string{"aa:00:00:00:00:02", "aa:00:00:00:00:03", "aa:00:00:00:00:01"}},
+		{"name", []string{"aa:00:00:00:00:03", "aa:00:00:00:00:02", "aa:00:00:00:00:01"}},
+	}
+	for _, tt := range tests {
+		sortDevices(devices, tt.by)
+		for i, address := range tt.want {
+			if devices[i].Address != address {
+				t.Errorf("sorting by %s: expected %s at %d, got %s", tt.by, address, i, devices[i].Address)
+			}
+		}
+	}
+}
+
+func TestSortColumn(t *testing.T) {
+	if i, err := sortColumn("seen"); err != nil || showColumns[i] != "age" {
+		t.Errorf("expected seen to be an alias of age, got %d %v", i, err)
+	}
+	if _, err := sortColumn("foo"); err == nil {
+		t.Errorf("expected an error for an unknown column")
+	}
+}
+
+func TestUniqueDevices(t *testing.T) {
+	stats := NewSnifferStats()
+	stats.LoadDevices([]SnifferDevice{{Address: "aa:00:00:00:00:09", Name: "old"}}, nil)
+	stats.TrackDevice("aa:00:00:00:00:02", 0, false, time.Now(), 0.3, 0)
+	stats.TrackDevice("aa:00:00:00:00:01", 0, false, time.Now(), 0.3, 0)
+	stats.TrackDevice("aa:00:00:00:00:02", 0, false, time.Now(), 0.3, 0)
+	stats.MergeDeviceInfo("aa:00:00:00:00:01", "Alpha", nil)
+
+	var out bytes.Buffer
+	writeUniques(&out, stats.UniqueDevices())
+
+	expected := "aa:00:00:00:00:01\tAlpha\naa:00:00:00:00:02\t\n2 unique devices\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,123 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// container/list for the least recently used files, net for validating the addresses,
+// os for the files, path/filepath for their paths, and strings for their names.
+import (
+	"container/list"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// deviceFileExt is the extension of the per-device output files.
+const deviceFileExt = ".ndjson"
+
+// deviceFile is an output file open for a device.
+type deviceFile struct {
+	Address string   // Address of the device.
+	File    *os.File // File its events are appended to.
+}
+
+// deviceFiles writes the events of every device to its own file in a directory, keeping at most MaxOpen files
+// open and closing the least recently used one when another must be opened.
+type deviceFiles struct {
+	Dir     string                   // Directory the files are written into.
+	MaxOpen int                      // Maximum number of files open at the same time.
+	files   map[string]*list.Element // Open files keyed by device address.
+	lru     *list.List               // Open files, the most recently used first.
+}
+
+// newDeviceFiles creates the directory of the per-device output files if it doesn't exist yet.
+func newDeviceFiles(dir string, maxOpen int) (*deviceFiles, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if maxOpen < 1 {
+		maxOpen = 1
+	}
+
+	return &deviceFiles{
+		Dir:     dir,
+		MaxOpen: maxOpen,
+		files:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// eventDevice returns the address of the advertiser an event is about, or an empty string for the events without
+// one, such as the control PDUs keyed by access address and the events of the sniffer itself. Scan requests and
+// connection requests are sent by another device to the advertiser.
+func eventDevice(e SnifferEvent) string {
+	address := e.Source
+	if e.Protocol == "BLE SCAN_REQ" || e.Protocol == "BLE CONNECT" {
+		address = e.Destination
+	}
+
+	if _, err := net.ParseMAC(address); err != nil {
+		return ""
+	}
+	return strings.ToLower(address)
+}
+
+// deviceFileName returns the name of the file of a device, with dashes instead of colons since these aren't allowed
+// in the file names on Windows.
+func deviceFileName(address string) string {
+	return strings.Replace(address, ":", "-", -1) + deviceFileExt
+}
+
+// open returns the file of a device, reopening it in append mode if it was closed.
+func (d *deviceFiles) open(address string) (*os.File, error) {
+	if elem, found := d.files[address]; found {
+		d.lru.MoveToFront(elem)
+		return elem.Value.(*deviceFile).File, nil
+	}
+
+	// Make room for the new file.
+	for d.lru.Len() >= d.MaxOpen {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		evicted := oldest.Value.(*deviceFile)
+		delete(d.files, evicted.Address)
+		if err := evicted.File.Close(); err != nil {
+			logWarning("error closing %s: %v", evicted.File.Name(), err)
+		}
+	}
+
+	file, err := os.OpenFile(filepath.Join(d.Dir, deviceFileName(address)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.files[address] = d.lru.PushFront(&deviceFile{Address: address, File: file})
+	return file, nil
+}
+
+// Write appends a line to the file of a device.
+func (d *deviceFiles) Write(address string, raw []byte) error {
+	file, err := d.open(address)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(raw)
+	return err
+}
+
+// Open returns the number of files currently open.
+func (d *deviceFiles) Open() int {
+	return d.lru.Len()
+}
+
+// Close closes every open file, returning the first error.
+func (d *deviceFiles) Close() error {
+	var first error
+	for elem := d.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := elem.Value.(*deviceFile).File.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	d.files = make(map[string]*list.Element)
+	d.lru.Init()
+	return first
+}
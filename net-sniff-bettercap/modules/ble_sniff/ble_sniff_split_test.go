@@ -0,0 +1,88 @@
+package ble_sniff
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventDevice(t *testing.T) {
+	for _, test := range []struct {
+		event    SnifferEvent
+		expected string
+	}{
+		{NewSnifferEvent(time.Now(), "BLE ADVERT", "D4:3A:2C:11:8E:07", "BROADCAST", nil, ""), "d4:3a:2c:11:8e:07"},
+		{NewSnifferEvent(time.Now(), "BLE SCAN_REQ", "11:22:33:44:55:66", "d4:3a:2c:11:8e:07", nil, ""), "d4:3a:2c:11:8e:07"},
+		{NewSnifferEvent(time.Now(), "BLE CONNECT", "11:22:33:44:55:66", "d4:3a:2c:11:8e:07", nil, ""), "d4:3a:2c:11:8e:07"},
+		{NewSnifferEvent(time.Now(), "BLE CTRL", "0x50654a8e", "CONNECTION", nil, ""), ""},
+		{NewSnifferEvent(time.Now(), "BLE HEARTBEAT", "SNIFFER", "SNIFFER", nil, ""), ""},
+	} {
+		if device := eventDevice(test.event); device != test.expected {
+			t.Errorf("expected device '%s' for %s from %s, got '%s'", test.expected, test.event.Protocol, test.event.Source, device)
+		}
+	}
+}
+
+func readDeviceFile(t *testing.T, dir string, address string) []SnifferEvent {
+	file, err := os.Open(filepath.Join(dir, deviceFileName(address)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []SnifferEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e SnifferEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid line '%s': %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestSplitByDevice(t *testing.T) {
+	quietLogs(t)
+
+	dir := filepath.Join(t.TempDir(), "devices")
+	files, err := newDeviceFiles(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := &SnifferContext{Output: dir, deviceFiles: files}
+
+	addresses := []string{"aa:aa:aa:aa:aa:01", "aa:aa:aa:aa:aa:02", "aa:aa:aa:aa:aa:03"}
+	for round := 0; round < 2; round++ {
+		for _, address := range addresses {
+			e := NewSnifferEvent(time.Now(), "BLE ADVERT", address, "BROADCAST", SniffData{"round": round}, "")
+			if written, err := ctx.WriteEvent(e); err != nil || !written {
+				t.Fatalf("event of %s not written: %v", address, err)
+			}
+			if files.Open() > 2 {
+				t.Fatalf("expected at most 2 open files, got %d", files.Open())
+			}
+		}
+	}
+
+	if written, _ := ctx.WriteEvent(NewSnifferEvent(time.Now(), "BLE HEARTBEAT", "SNIFFER", "SNIFFER", nil, "")); written {
+		t.Errorf("expected the events without device to be skipped")
+	}
+
+	ctx.Close()
+	if files.Open() != 0 {
+		t.Errorf("expected every file to be closed, %d still open", files.Open())
+	}
+
+	// The evicted files were reopened in append mode.
+	for _, address := range addresses {
+		if events := readDeviceFile(t, dir, address); len(events) != 2 {
+			t.Errorf("expected 2 events in the file of %s, got %d", address, len(events))
+		} else if events[0].Source != address {
+			t.Errorf("unexpected event of %s in the file of %s", events[0].Source, address)
+		}
+	}
+}
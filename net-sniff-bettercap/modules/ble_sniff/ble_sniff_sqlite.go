@@ -0,0 +1,277 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// context for the shutdown deadline, database/sql for the database, encoding/json for serializing the event data,
+// fmt for formatted strings, sync for guarding the pending batch, time for the flush timer, and the pure Go
+// modernc.org/sqlite driver, which doesn't require cgo.
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Declaring how often and after how many events the pending batch is committed to the database, and how many events
+// can wait for it before the new ones are dropped.
+const (
+	sqliteFlushInterval = time.Second
+	sqliteBatchSize     = 256
+	sqliteMaxPending    = 64 * sqliteBatchSize
+)
+
+// sqliteSchema creates the events table if the database doesn't have it yet.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	"from" TEXT,
+	"to" TEXT,
+	message TEXT,
+	data TEXT,
+	session_id TEXT
+);
+`
+
+// sqliteSessionColumn counts the session_id columns of the events table, which the tables created by the previous
+// versions lack.
+const sqliteSessionColumn = `SELECT COUNT(*) FROM pragma_table_info('events') WHERE name = 'session_id';`
+
+// sqliteInsert inserts an event, prepared once per batch.
+const sqliteInsert = `INSERT INTO events (time, protocol, "from", "to", message, data, session_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?);`
+
+// SQLiteSink stores events into a SQLite database, in batched transactions committed from a goroutine of its own
+// so that the capture is never blocked by the database. The inserts of a batch use a prepared statement, the first
+// failed one rolling its transaction back and being reported.
+type SQLiteSink struct {
+	sync.Mutex                // Guards the pending batch, the dropped events and the failure.
+	Path       string         // Path of the database file.
+	db         *sql.DB        // The database.
+	writeLock  sync.Mutex     // Serializes the batches written to the database.
+	pending    []SnifferEvent // Events waiting for the next transaction.
+	dropped    uint64         // Count of events dropped because too many were waiting.
+	failure    error          // First error of the database, after which the events are dropped.
+	reported   bool           // Whether the failure was returned by Add.
+	full       chan struct{}  // Signals the flush loop that a batch is full.
+	quit       chan struct{}  // Closed to stop the flush loop.
+	done       chan struct{}  // Closed once the flush loop returned.
+}
+
+// migrateSQLite creates the events table of the database, adding the session_id column to the tables created by the
+// previous versions.
+func migrateSQLite(db *sql.DB) error {
+	columns := 0
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("could not create the events table: %v", err)
+	} else if err = db.QueryRow(sqliteSessionColumn).Scan(&columns); err != nil {
+		return fmt.Errorf("could not read the events table: %v", err)
+	} else if columns > 0 {
+		return nil
+	}
+
+	if _, err := db.Exec("ALTER TABLE events ADD COLUMN session_id TEXT;"); err != nil {
+		return fmt.Errorf("could not add the session_id column: %v", err)
+	}
+	return nil
+}
+
+// NewSQLiteSink opens the given database, once its events table is created.
+func NewSQLiteSink(path string) (*SQLiteSink, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// A single connection, the batches being written one at a time anyway.
+	db.SetMaxOpenConns(1)
+	if err = migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	sink := &SQLiteSink{
+		Path:    path,
+		db:      db,
+		pending: make([]SnifferEvent, 0, sqliteBatchSize),
+		full:    make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go sink.flushLoop()
+
+	return sink, nil
+}
+
+// fail records the first error of the sink.
+func (s *SQLiteSink) fail(err error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failure == nil {
+		s.failure = err
+	}
+}
+
+// Add queues an event for insertion, waking the flush loop up if the batch is full. The event is dropped if too many
+// are already waiting. The failure of the database is returned once, the events being lost from then on.
+func (s *SQLiteSink) Add(e SnifferEvent) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.failure != nil {
+		if s.reported {
+			return nil
+		}
+		s.reported = true
+		return s.failure
+	} else if len(s.pending) >= sqliteMaxPending {
+		s.dropped++
+		return nil
+	}
+
+	s.pending = append(s.pending, e)
+	if len(s.pending) >= sqliteBatchSize {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// take returns the pending batch, replacing it with an empty one.
+func (s *SQLiteSink) take() []SnifferEvent {
+	s.Lock()
+	defer s.Unlock()
+
+	batch := s.pending
+	s.pending = make([]SnifferEvent, 0, sqliteBatchSize)
+	return batch
+}
+
+// write inserts a batch in a single transaction, rolled back if any insert fails.
+func (s *SQLiteSink) write(ctx context.Context, batch []SnifferEvent) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	err := s.insert(ctx, batch)
+	if err != nil {
+		logWarning("sqlite error on %s: %v", s.Path, err)
+		s.fail(err)
+	}
+	return err
+}
+
+// insert runs the inserts of a batch with a statement prepared in its transaction.
+func (s *SQLiteSink) insert(ctx context.Context, batch []SnifferEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, sqliteInsert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range batch {
+		data, err := json.Marshal(e.Data)
+		if err != nil {
+			data = []byte("null")
+		}
+
+		if _, err = stmt.ExecContext(ctx,
+			e.PacketTime.Format(time.RFC3339Nano),
+			e.Protocol,
+			e.Source,
+			e.Destination,
+			e.Message,
+			string(data),
+			e.SessionID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Flush inserts the pending events in a single transaction.
+func (s *SQLiteSink) Flush() error {
+	return s.write(context.Background(), s.take())
+}
+
+// flushLoop commits the pending events every flush interval, or once the batch is full, until the sink is closed.
+func (s *SQLiteSink) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(sqliteFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.full:
+			s.Flush()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Pending returns the number of events waiting for the next transaction.
+func (s *SQLiteSink) Pending() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.pending)
+}
+
+// Close commits the pending events and closes the database, returning its failure if any.
+func (s *SQLiteSink) Close() error {
+	return s.closeBy(time.Time{})
+}
+
+// closeBy closes the sink like Close, the last transaction being aborted if it is still running at the deadline,
+// unless it is zero.
+func (s *SQLiteSink) closeBy(deadline time.Time) error {
+	ctx := context.Background()
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	close(s.quit)
+	<-s.done
+
+	err := s.write(ctx, s.take())
+	if ctx.Err() != nil {
+		err = fmt.Errorf("sqlite still writing at the shutdown deadline, aborted")
+	}
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.dropped > 0 {
+		logWarning("%d events were not stored to %s, too many were waiting", s.dropped, s.Path)
+	}
+	if s.failure != nil {
+		return s.failure
+	}
+	return err
+}
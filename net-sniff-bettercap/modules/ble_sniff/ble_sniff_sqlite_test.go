@@ -0,0 +1,102 @@
+package ble_sniff
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqliteQuery runs a statement on the database, returning the first column of its first row, if any.
+func sqliteQuery(t *testing.T, path string, query string) string {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var value sql.NullString
+	if err = db.QueryRow(query).Scan(&value); err != nil && err != sql.ErrNoRows {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return value.String
+}
+
+func TestSQLiteSinkMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	// A table created before session_id gets the column, a new one already has it.
+	old := filepath.Join(dir, "old.db")
+	sqliteQuery(t, old, `CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, protocol TEXT NOT NULL, "from" TEXT, "to" TEXT, message TEXT, data TEXT);`)
+	for _, path := range []string{old, filepath.Join(dir, "new.db")} {
+		for run := 0; run < 2; run++ {
+			sink, err := NewSQLiteSink(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = sink.Add(SnifferEvent{PacketTime: time.Now(), Protocol: "BLE ADVERT", SessionID: "lab"}); err != nil {
+				t.Fatal(err)
+			} else if err = sink.Close(); err != nil {
+				t.Errorf("unexpected error closing %s: %v", path, err)
+			}
+		}
+		if rows := sqliteQuery(t, path, "SELECT COUNT(*) FROM events WHERE session_id = 'lab';"); rows != "2" {
+			t.Errorf("expected 2 events in %s, got %s", path, rows)
+		}
+	}
+}
+
+func TestSQLiteSinkFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	sqliteQuery(t, path, `CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, protocol TEXT NOT NULL CHECK (protocol != 'BAD'), "from" TEXT, "to" TEXT, message TEXT, data TEXT, session_id TEXT);`)
+
+	sink, err := NewSQLiteSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quietLogs(t)
+	for _, protocol := range []string{"BLE ADVERT", "BAD"} {
+		if err = sink.Add(SnifferEvent{PacketTime: time.Now(), Protocol: protocol}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err == nil || !strings.Contains(err.Error(), "CHECK constraint failed") {
+		t.Errorf("expected the failed insert to be reported, got %v", err)
+	}
+
+	// The transaction of the failed insert is rolled back.
+	if rows := sqliteQuery(t, path, "SELECT COUNT(*) FROM events;"); rows != "0" {
+		t.Errorf("expected no event to be stored, got %s", rows)
+	}
+}
+
+func TestSQLiteSinkHostileValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+
+	sink, err := NewSQLiteSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The values are bound to the statement, never parsed as SQL.
+	messages := []string{"before", "a\x00b'); DROP TABLE events; --", "it's \"quoted\"", "after"}
+	for _, message := range messages {
+		if err = sink.Add(SnifferEvent{PacketTime: time.Now(), Protocol: "BLE ADVERT", Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = sink.Close(); err != nil {
+		t.Fatalf("unexpected error closing the sink: %v", err)
+	}
+
+	if rows := sqliteQuery(t, path, "SELECT COUNT(*) FROM events;"); rows != "4" {
+		t.Fatalf("expected 4 events, got %s", rows)
+	}
+	if out := sqliteQuery(t, path, "SELECT hex(message) FROM events WHERE id = 2;"); out != strings.ToUpper(hex.EncodeToString([]byte(messages[1]))) {
+		t.Errorf("expected the message to be stored as is, got %s", out)
+	}
+	if out := sqliteQuery(t, path, "SELECT message FROM events WHERE id = 3;"); out != messages[2] {
+		t.Errorf("expected %q, got %q", messages[2], out)
+	}
+}
@@ -2,58 +2,125 @@
 package ble_sniff
 
 // Importing necessary packages:
-// time for handling time-related functionalities,
-// and bettercap/log for logging purposes.
+// fmt for formatting the times, sync for guarding the shared tables, sync/atomic for the counters updated by other
+// goroutines, and time for handling time-related functionalities.
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/bettercap/bettercap/log"
 )
 
 // SnifferStats struct keeps track of various statistics for the sniffer.
 type SnifferStats struct {
-	NumAdvertisements uint64    // Count of total advertisements seen.
-	NumMatched        uint64    // Count of packets matched with some criteria.
-	NumDumped         uint64    // Count of packets dumped.
-	NumWrote          uint64    // Count of packets written to a destination.
-	Started           time.Time // Time when the sniffer was started.
-	FirstPacket       time.Time // Time when the first packet was captured.
-	LastPacket        time.Time // Time when the last packet was captured.
+	sync.RWMutex                                       // Guards the tables shared with the command handlers.
+	NumAdvertisements    uint64                        // Count of total advertisements seen.
+	NumMatched           uint64                        // Count of packets matched with some criteria.
+	NumDumped            uint64                        // Count of packets dumped.
+	NumDropped           uint64                        // Count of packets dropped because the packet queue was full.
+	NumBadCRC            uint64                        // Count of packets whose CRC check failed.
+	NumSequenced         uint64                        // Count of packets carrying the packet counter of the nRF sniffer.
+	NumMissed            uint64                        // Estimated count of packets lost by the capture, from the gaps in the packet counter.
+	sequence             sequenceTracker               // Tracks the packet counter to detect the gaps.
+	NumBytes             uint64                        // Count of bytes of the BLE packets captured.
+	NumLengthFiltered    uint64                        // Count of advertisements dropped by the data length filter.
+	NumChannelFiltered   uint64                        // Count of packets dropped because they weren't captured on a primary advertising channel.
+	NumChanged           uint64                        // Count of advertisements whose payload differed from the previous one of their device.
+	NumUnchanged         uint64                        // Count of advertisements repeating the previous payload of their device.
+	NumWrote             uint64                        // Count of packets written to a destination.
+	NumSubscriberDropped uint64                        // Count of events dropped because a subscriber was too slow.
+	NumDisplayDropped    uint64                        // Count of events not pushed to the session because of the display rate.
+	NumEvents            uint64                        // Count of events produced by the decoding.
+	eventRate            uint64                        // Bits of the last sampled event rate, in events per second.
+	Started              time.Time                     // Time when the sniffer was started.
+	FirstPacket          time.Time                     // Time when the first packet was captured.
+	LastPacket           time.Time                     // Time when the last packet was captured.
+	LongestGap           time.Duration                 // Longest time elapsed between two consecutive packets.
+	LongestGapEnd        time.Time                     // Time of the packet ending the longest gap.
+	restart              int32                         // Set to 1 when the counters were cleared, until the capture times are restarted.
+	Connections          map[string]*SnifferConnection // Active connections keyed by access address.
+	Devices              map[string]*SnifferDevice     // Devices seen advertising keyed by address.
+	anonymizer           *anonymizer                   // Anonymizer matching the devices with the loaded records keyed by pseudonym.
+	Companies            map[uint16]uint64             // Count of proprietary advertisements keyed by company code.
+	payloads             map[string]uint64             // Hash of the last payload keyed by device address and PDU type.
 }
 
 // NewSnifferStats initializes and returns a new instance of SnifferStats with default values.
 func NewSnifferStats() *SnifferStats {
 	return &SnifferStats{
-		NumAdvertisements: 0,        // Initializing advertisement count as 0.
-		NumMatched:        0,        // Initializing matched packet count as 0.
-		NumDumped:         0,        // Initializing dumped packet count as 0.
-		Started:           time.Now(), // Setting the start time to the current time.
-		FirstPacket:       time.Time{}, // Initializing the first packet time as zero value.
-		LastPacket:        time.Time{}, // Initializing the last packet time as zero value.
+		NumAdvertisements: 0,                                   // Initializing advertisement count as 0.
+		NumMatched:        0,                                   // Initializing matched packet count as 0.
+		NumDumped:         0,                                   // Initializing dumped packet count as 0.
+		Started:           time.Now(),                          // Setting the start time to the current time.
+		FirstPacket:       time.Time{},                         // Initializing the first packet time as zero value.
+		LastPacket:        time.Time{},                         // Initializing the last packet time as zero value.
+		Connections:       make(map[string]*SnifferConnection), // Initializing an empty connections table.
+		Devices:           make(map[string]*SnifferDevice),     // Initializing an empty devices table.
+		Companies:         make(map[uint16]uint64),             // Initializing an empty companies table.
 	}
 }
 
+// statsTimeLayout is the layout of the times printed with the statistics.
+const statsTimeLayout = "2006-01-02 15:04:05"
+
+// formatStatsTime formats a time of the statistics along with how long ago it was, or "never" for the zero time.
+func formatStatsTime(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(statsTimeLayout), now.Sub(t).Round(time.Second))
+}
+
 // Print method for SnifferStats logs the statistics to the console.
 func (s *SnifferStats) Print() error {
-	first := "never" // Default value for the time of the first packet.
-	last := "never"  // Default value for the time of the last packet.
+	return s.printAt(time.Now())
+}
 
-	// Update the first packet time if it is not the zero value.
-	if !s.FirstPacket.IsZero() {
-		first = s.FirstPacket.String()
-	}
-	// Update the last packet time if it is not the zero value.
-	if !s.LastPacket.IsZero() {
-		last = s.LastPacket.String()
-	}
+// printAt logs the statistics, with the ages of their times relative to now.
+func (s *SnifferStats) printAt(now time.Time) error {
+	// The capture times are updated by the packet loop meanwhile.
+	times := s.captureTimes()
 
 	// Log various statistics.
-	log.Info("Sniffer Started    : %s", s.Started) // Log the start time of the sniffer.
-	log.Info("First Packet Seen  : %s", first)     // Log the time of the first packet seen.
-	log.Info("Last Packet Seen   : %s", last)      // Log the time of the last packet seen.
-	log.Info("Advertisements     : %d", s.NumAdvertisements) // Log the number of advertisements.
-	log.Info("Matched Packets    : %d", s.NumMatched)        // Log the number of matched packets.
-	log.Info("Dumped Packets     : %d", s.NumDumped)         // Log the number of dumped packets.
+	logInfo("Sniffer Started    : %s", formatStatsTime(s.Started, now))            // Log the start time of the sniffer.
+	logInfo("First Packet Seen  : %s", formatStatsTime(times.FirstPacket, now))    // Log the time of the first packet seen.
+	logInfo("Last Packet Seen   : %s", formatStatsTime(times.LastPacket, now))     // Log the time of the last packet seen.
+	logInfo("Capture Duration   : %s", formatDuration(times.Duration()))           // Log how long packets have been captured for.
+	logInfo("Advertisements     : %d", atomic.LoadUint64(&s.NumAdvertisements))    // Log the number of advertisements.
+	logInfo("Matched Packets    : %d", atomic.LoadUint64(&s.NumMatched))           // Log the number of matched packets.
+	logInfo("Dumped Packets     : %d", atomic.LoadUint64(&s.NumDumped))            // Log the number of dumped packets.
+	logInfo("Written Packets    : %d", atomic.LoadUint64(&s.NumWrote))             // Log the number of packets written to a destination.
+	logInfo("Dropped Packets    : %d", atomic.LoadUint64(&s.NumDropped))           // Log the number of packets dropped by the full queue.
+	logInfo("Bad CRC Packets    : %d", atomic.LoadUint64(&s.NumBadCRC))            // Log the number of corrupted packets.
+	logInfo("Captured Bytes     : %d", atomic.LoadUint64(&s.NumBytes))             // Log the number of bytes of the BLE packets.
+	logInfo("Length Filtered    : %d", atomic.LoadUint64(&s.NumLengthFiltered))    // Log the number of advertisements out of the length range.
+	logInfo("Channel Filtered   : %d", atomic.LoadUint64(&s.NumChannelFiltered))   // Log the number of packets of the data channels.
+	logInfo("Changed Payloads   : %d", atomic.LoadUint64(&s.NumChanged))           // Log the number of advertisements with a new payload.
+	logInfo("Unchanged Payloads : %d", atomic.LoadUint64(&s.NumUnchanged))         // Log the number of repeated payloads.
+	logInfo("Connections        : %d", len(s.ConnectionsList()))                   // Log the number of active connections.
+	logInfo("Subscriber Drops   : %d", atomic.LoadUint64(&s.NumSubscriberDropped)) // Log the number of events dropped by slow subscribers.
+	logInfo("Display Drops      : %d", atomic.LoadUint64(&s.NumDisplayDropped))    // Log the number of events over the display rate.
+
+	// Log the longest silence between two packets, warning about the ones long enough to be a stalled dongle.
+	if times.LongestGap >= gapWarning {
+		logWarning("Longest Gap        : %s, until %s, the capture may have stalled", formatDuration(times.LongestGap), times.LongestGapEnd.Format("15:04:05.000"))
+	} else if !times.LongestGapEnd.IsZero() {
+		logInfo("Longest Gap        : %s, until %s", formatDuration(times.LongestGap), times.LongestGapEnd.Format("15:04:05.000"))
+	}
+
+	// Log the estimated number of packets lost by the capture and their share of the packets sent by the firmware.
+	logInfo("Sequenced Packets  : %d", atomic.LoadUint64(&s.NumSequenced))
+	logInfo("Missed Packets     : %d (%.1f%%)", atomic.LoadUint64(&s.NumMissed), s.LossRatio()*100)
+
+	// Log the number of events produced by the decoding and their last sampled rate.
+	logInfo("Events             : %d (%.1f/s)", atomic.LoadUint64(&s.NumEvents), s.EventRate())
+
+	// Log the vendor mix, most frequent companies first.
+	companies := s.CompaniesList()
+	logInfo("Companies          : %d", len(companies))
+	for _, company := range companies {
+		logInfo("  %s : %d", company.Label(), company.Count)
+	}
 
 	return nil // Return nil error after printing.
 }
@@ -0,0 +1,70 @@
+package ble_sniff
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// printedStats returns the lines logged by the statistics printed at a given time.
+func printedStats(t *testing.T, s *SnifferStats, now time.Time) []string {
+	var logs bytes.Buffer
+	writer := jsonLogsWriter
+	setJSONLogs(true)
+	jsonLogsWriter = &logs
+	defer func() {
+		setJSONLogs(false)
+		jsonLogsWriter = writer
+	}()
+
+	s.printAt(now)
+
+	messages := make([]string, 0)
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		line := jsonLogLine{}
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, line.Message)
+	}
+	return messages
+}
+
+func TestStatsPrint(t *testing.T) {
+	now := time.Date(2024, 3, 2, 11, 0, 0, 0, time.UTC)
+	s := NewSnifferStats()
+	s.Started = now.Add(-90 * time.Second)
+	s.FirstPacket = now.Add(-80*time.Second - 400*time.Millisecond)
+	s.LastPacket = now.Add(-12 * time.Second)
+	s.NumWrote = 42
+
+	expected := []string{
+		"Sniffer Started    : 2024-03-02 10:58:30 (1m30s ago)",
+		"First Packet Seen  : 2024-03-02 10:58:39 (1m20s ago)",
+		"Last Packet Seen   : 2024-03-02 10:59:48 (12s ago)",
+		"Capture Duration   : 1m8s",
+		"Advertisements     : 0",
+		"Matched Packets    : 0",
+		"Dumped Packets     : 0",
+		"Written Packets    : 42",
+	}
+	if messages := printedStats(t, s, now); len(messages) < len(expected) || !reflect.DeepEqual(messages[:len(expected)], expected) {
+		t.Errorf("unexpected statistics:\n%q\nexpected them to start with:\n%q", messages, expected)
+	}
+
+	// The packet times are never until a packet is captured.
+	s = NewSnifferStats()
+	s.Started = now
+	expected = []string{
+		"Sniffer Started    : 2024-03-02 11:00:00 (0s ago)",
+		"First Packet Seen  : never",
+		"Last Packet Seen   : never",
+		"Capture Duration   : 0s",
+	}
+	if messages := printedStats(t, s, now); len(messages) < len(expected) || !reflect.DeepEqual(messages[:len(expected)], expected) {
+		t.Errorf("unexpected statistics:\n%q\nexpected them to start with:\n%q", messages, expected)
+	}
+}
@@ -0,0 +1,63 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync/atomic for the shared counters.
+import (
+	"sync/atomic"
+)
+
+// subscriberBuffer is the number of events a subscriber channel can hold before new events are dropped.
+const subscriberBuffer = 256
+
+// Subscribe returns a channel receiving every event pushed by the sniffer, allowing the module to be used as a library
+// without going through the session events. Events are dropped rather than blocking the capture if the channel is full,
+// and the channel is closed when the sniffer is stopped.
+func (mod *Sniffer) Subscribe() <-chan SnifferEvent {
+	mod.subscribersLock.Lock()
+	defer mod.subscribersLock.Unlock()
+
+	ch := make(chan SnifferEvent, subscriberBuffer)
+	mod.subscribers = append(mod.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe closes a channel returned by Subscribe and stops feeding it.
+func (mod *Sniffer) Unsubscribe(sub <-chan SnifferEvent) {
+	mod.subscribersLock.Lock()
+	defer mod.subscribersLock.Unlock()
+
+	for i, ch := range mod.subscribers {
+		if ch == sub {
+			close(ch)
+			mod.subscribers = append(mod.subscribers[:i], mod.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// onEventSubscribers is the event handler feeding every pushed event to the subscribers.
+func (mod *Sniffer) onEventSubscribers(e SnifferEvent) {
+	mod.subscribersLock.Lock()
+	defer mod.subscribersLock.Unlock()
+
+	for _, ch := range mod.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// A slow subscriber must not block the capture loop.
+			atomic.AddUint64(&mod.Stats.NumSubscriberDropped, 1)
+		}
+	}
+}
+
+// closeSubscribers closes and forgets every subscriber channel.
+func (mod *Sniffer) closeSubscribers() {
+	mod.subscribersLock.Lock()
+	defer mod.subscribersLock.Unlock()
+
+	for _, ch := range mod.subscribers {
+		close(ch)
+	}
+	mod.subscribers = nil
+}
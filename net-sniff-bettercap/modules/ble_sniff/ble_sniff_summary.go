@@ -0,0 +1,133 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// strconv for parsing the frame length, sync/atomic for the counters updated by the workers,
+// and time for the summary timer.
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// packetLength extracts the length in bytes of a packet from the frame layer of the TShark output, 0 if unknown.
+func packetLength(packetMap map[string]interface{}) uint64 {
+	frame, ok := packetMap["frame"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	length, ok := frame["frame.len"].(string)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.ParseUint(length, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// summaryCounters is a snapshot of the cumulative counters the summaries are computed from.
+type summaryCounters struct {
+	Advertisements uint64            // Total count of advertisements.
+	Bytes          uint64            // Total count of bytes captured.
+	Devices        map[string]uint64 // Count of advertisements keyed by device address.
+}
+
+// summaryCounters takes a snapshot of the cumulative counters.
+func (s *SnifferStats) summaryCounters() summaryCounters {
+	s.RLock()
+	defer s.RUnlock()
+
+	devices := make(map[string]uint64, len(s.Devices))
+	for address, dev := range s.Devices {
+		devices[address] = dev.Packets
+	}
+
+	return summaryCounters{
+		Advertisements: atomic.LoadUint64(&s.NumAdvertisements),
+		Bytes:          atomic.LoadUint64(&s.NumBytes),
+		Devices:        devices,
+	}
+}
+
+// summaryGauge computes the deltas of the counters between two summaries, leaving the cumulative statistics intact.
+type summaryGauge struct {
+	last     summaryCounters // Counters at the previous summary.
+	lastTime time.Time       // Time of the previous summary.
+}
+
+// newSummaryGauge creates a gauge starting from the given counters.
+func newSummaryGauge(counters summaryCounters, now time.Time) *summaryGauge {
+	return &summaryGauge{last: counters, lastTime: now}
+}
+
+// update returns the data of the summary since the previous one: the advertisements, the devices which advertised,
+// the ones seen for the first time, and the bytes captured.
+func (g *summaryGauge) update(counters summaryCounters, now time.Time) SniffData {
+	devices, new_devices := 0, 0
+	for address, packets := range counters.Devices {
+		previous, found := g.last.Devices[address]
+		if !found {
+			new_devices++
+		}
+		if packets != previous {
+			devices++
+		}
+	}
+
+	data := SniffData{
+		"interval":       int(now.Sub(g.lastTime).Round(time.Second).Seconds()),
+		"advertisements": counterDelta(counters.Advertisements, g.last.Advertisements),
+		"devices":        devices,
+		"new_devices":    new_devices,
+		"bytes":          counterDelta(counters.Bytes, g.last.Bytes),
+	}
+	g.last, g.lastTime = counters, now
+	return data
+}
+
+// startSummary starts pushing a summary event every interval.
+func (mod *Sniffer) startSummary(interval time.Duration) {
+	mod.summaryQuit = make(chan struct{})
+
+	go mod.summaryLoop(interval, mod.summaryQuit)
+}
+
+// stopSummary stops the summary events, if running.
+func (mod *Sniffer) stopSummary() {
+	if mod.summaryQuit != nil {
+		close(mod.summaryQuit)
+		mod.summaryQuit = nil
+	}
+}
+
+// summaryLoop pushes a summary event every interval until quit is closed.
+func (mod *Sniffer) summaryLoop(interval time.Duration, quit <-chan struct{}) {
+	gauge := newSummaryGauge(mod.Stats.summaryCounters(), time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case now := <-ticker.C:
+			data := gauge.update(mod.Stats.summaryCounters(), now)
+
+			// Create a new SnifferEvent with protocol "BLE SUMMARY" and push it.
+			mod.Push(NewSnifferEvent(now,
+				"BLE SUMMARY",
+				"SNIFFER",
+				"SNIFFER",
+				data,
+				"%d advertisements from %d devices (%d new), %d bytes in the last %d seconds",
+				data["advertisements"],
+				data["devices"],
+				data["new_devices"],
+				data["bytes"],
+				data["interval"],
+			))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ble_sniff
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSummaryGauge(t *testing.T) {
+	mod := newBenchSniffer(&collectSink{})
+	start := time.Now()
+	gauge := newSummaryGauge(mod.Stats.summaryCounters(), start)
+
+	packets := fixturePackets(t)
+	for _, packet := range packets {
+		packet.(map[string]interface{})["frame"] = map[string]interface{}{"frame.len": "40"}
+	}
+	for _, packet := range packets {
+		mod.dispatchPacket(nil, packet)
+	}
+
+	first := gauge.update(mod.Stats.summaryCounters(), start.Add(10*time.Second))
+	if first["interval"] != 10 {
+		t.Errorf("expected a 10 seconds interval, got %v", first["interval"])
+	}
+	if first["advertisements"] != uint64(3) || first["devices"] != 3 || first["new_devices"] != 3 {
+		t.Errorf("unexpected first summary %v", first)
+	}
+	if first["bytes"] != uint64(120) {
+		t.Errorf("expected the 120 bytes of the packets to be counted, got %v", first["bytes"])
+	}
+
+	// The same devices advertise again, none of them is new.
+	for _, packet := range packets[:1] {
+		mod.dispatchPacket(nil, packet)
+	}
+	second := gauge.update(mod.Stats.summaryCounters(), start.Add(20*time.Second))
+	if second["advertisements"] != uint64(1) || second["devices"] != 1 || second["new_devices"] != 0 || second["bytes"] != uint64(40) {
+		t.Errorf("unexpected second summary %v", second)
+	}
+
+	// The cumulative statistics are left intact.
+	if total := atomic.LoadUint64(&mod.Stats.NumAdvertisements); total != 4 {
+		t.Errorf("expected 4 advertisements in total, got %d", total)
+	}
+
+	if empty := gauge.update(mod.Stats.summaryCounters(), start.Add(30*time.Second)); empty["advertisements"] != uint64(0) || empty["bytes"] != uint64(0) || empty["devices"] != 0 {
+		t.Errorf("expected an empty summary, got %v", empty)
+	}
+}
@@ -0,0 +1,65 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings, strings for joining the addresses.
+import (
+	"fmt"
+	"strings"
+)
+
+// targetAddressSize is the size of each address of the target address AD structures.
+const targetAddressSize = 6
+
+// decodeTargetAddresses decodes the little-endian device addresses of a target address AD structure payload.
+func decodeTargetAddresses(raw []byte) ([]string, error) {
+	if len(raw) == 0 || len(raw)%targetAddressSize != 0 {
+		return nil, fmt.Errorf("target address list must be a multiple of %d bytes long, got %d", targetAddressSize, len(raw))
+	}
+
+	addresses := make([]string, 0, len(raw)/targetAddressSize)
+	for offset := 0; offset < len(raw); offset += targetAddressSize {
+		address := raw[offset : offset+targetAddressSize]
+		addresses = append(addresses, fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x",
+			address[5], address[4], address[3], address[2], address[1], address[0]))
+	}
+	return addresses, nil
+}
+
+// targetAddresses extracts the addresses of a target address AD structure, either from the fields decoded
+// by TShark or from its raw payload.
+func targetAddresses(entry map[string]interface{}) ([]string, error) {
+	addresses := stringValues(entry["btcommon.eir_ad.entry.bd_addr"])
+	raw, err := adPayload(entry, "target address list", len(addresses) > 0, func(size int) bool {
+		return size > 0 && size%targetAddressSize == 0
+	})
+	if err != nil {
+		return nil, err
+	} else if len(addresses) == 0 {
+		return decodeTargetAddresses(raw)
+	}
+	return addresses, nil
+}
+
+// onTargetAddress processes the public and random target address AD structures, reporting the devices
+// a directed advertising campaign is meant for.
+func onTargetAddress(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	addresses, err := targetAddresses(entry)
+	if err != nil {
+		return nil
+	}
+
+	target_type := AddressPublic
+	if ad_type, _ := adType(entry); ad_type == AD_RANDOM_TARGET_ADDRESS {
+		target_type = AddressRandom
+	}
+
+	return adv.event(SniffData{
+		"target_type":      target_type,
+		"target_addresses": addresses,
+	},
+		"Targeting %s %s",
+		target_type,
+		strings.Join(addresses, ", "),
+	)
+}
@@ -0,0 +1,63 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for the description of the payload.
+import (
+	"fmt"
+)
+
+// tileServices are the 16 bit service UUIDs assigned to Tile, which its trackers advertise in their service list
+// or with their service data.
+var tileServices = uuidSet{
+	"0xfeec": true,
+	"0xfeed": true,
+}
+
+// hasTileService returns true if one of the service UUIDs is a Tile one.
+func hasTileService(uuids []string) bool {
+	for _, uuid := range uuids {
+		if tileServices[shortenUUID(normalizeUUID(uuid))] {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeTile decodes the service data of the Tile trackers, whose payload is the identifier the tracker is
+// advertised with, reported as hex since its format isn't documented.
+func decodeTile(data []byte) (SniffData, string, error) {
+	if len(data) == 0 {
+		return SniffData{}, "Tile", nil
+	}
+
+	id := fmt.Sprintf("%x", data)
+	return SniffData{
+		"tile_id": id,
+	}, fmt.Sprintf("Tile %s", id), nil
+}
+
+// tileTracker flags the data of an event about a Tile tracker with the kind of its address, and returns the note
+// appended to the message of the event when the tracker uses a rotating private address, as the recent ones do
+// to hinder their tracking.
+func (adv *advertisement) tileTracker(data SniffData) string {
+	data["tracker"] = "Tile"
+
+	kind, ok := addressKind(adv.Data)
+	if !ok {
+		return ""
+	}
+	rotating := kind == AddressResolvable || kind == AddressNonResolvable
+	data["address_kind"] = kind
+	data["rotating_address"] = rotating
+	if rotating {
+		return fmt.Sprintf(", Tile tracker with a %s address", kind)
+	}
+	return ", Tile tracker"
+}
+
+// Registering the decoder of the Tile service data.
+func init() {
+	RegisterServiceDecoder("0xfeed", decodeTile)
+	RegisterServiceDecoder("0xfeec", decodeTile)
+}
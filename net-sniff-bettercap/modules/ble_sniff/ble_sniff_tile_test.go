@@ -0,0 +1,76 @@
+package ble_sniff
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddressKind(t *testing.T) {
+	for address, expected := range map[string]string{
+		"c0:ff:ee:00:be:ef": AddressStatic,
+		"5a:11:22:33:44:55": AddressResolvable,
+		"3a:11:22:33:44:55": AddressNonResolvable,
+		"8a:11:22:33:44:55": AddressRandom,
+	} {
+		btle := map[string]interface{}{
+			"btle.advertising_address": address,
+			"btle.advertising_header_tree": map[string]interface{}{
+				"btle.advertising_header.randomized_tx": "1",
+			},
+		}
+		if kind, ok := addressKind(btle); !ok || kind != expected {
+			t.Errorf("expected %s to be %s, got %s", address, expected, kind)
+		}
+	}
+
+	public := map[string]interface{}{
+		"btle.advertising_address": "5a:11:22:33:44:55",
+		"btle.advertising_header_tree": map[string]interface{}{
+			"btle.advertising_header.randomized_tx": "0",
+		},
+	}
+	if kind, ok := addressKind(public); !ok || kind != AddressPublic {
+		t.Errorf("expected a public address, got %s", kind)
+	}
+	if _, ok := addressKind(map[string]interface{}{"btle.advertising_address": "5a:11:22:33:44:55"}); ok {
+		t.Error("expected the kind to be unknown without the advertising header")
+	}
+}
+
+func TestTileAdvertisement(t *testing.T) {
+	btle := map[string]interface{}{
+		"btle.advertising_address": "5a:11:22:33:44:55",
+		"btle.advertising_header_tree": map[string]interface{}{
+			"btle.advertising_header.randomized_tx": "1",
+		},
+	}
+	entries := []map[string]interface{}{
+		rawADEntry(AD_COMPLETE_UUID16, []byte{0xed, 0xfe}),
+		rawADEntry(AD_SERVICE_DATA16, []byte{0xed, 0xfe, 0x02, 0x00, 0x8d, 0x1c, 0x6a, 0x40, 0x91, 0x2e, 0x0b, 0x77}),
+	}
+
+	events := onAdvertisementEntries(btle, entries, nil, NewSnifferStats(), time.Now())
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	for _, e := range events {
+		data := e.Data.(SniffData)
+		if data["tracker"] != "Tile" || data["address_kind"] != AddressResolvable || data["rotating_address"] != true {
+			t.Errorf("expected a Tile tracker with a rotating address, got %v", data)
+		}
+		if !strings.HasSuffix(e.Message, "Tile tracker with a resolvable private address") {
+			t.Errorf("unexpected message %q", e.Message)
+		}
+	}
+	if id := events[1].Data.(SniffData)["tile_id"]; id != "02008d1c6a40912e0b77" {
+		t.Errorf("unexpected Tile ID %v", id)
+	}
+
+	// A static address doesn't rotate.
+	btle["btle.advertising_address"] = "d4:11:22:33:44:55"
+	events = onAdvertisementEntries(btle, entries[:1], nil, NewSnifferStats(), time.Now())
+	if data := events[0].Data.(SniffData); data["rotating_address"] != false || events[0].Message != "Services 0xfeed, Tile tracker" {
+		t.Errorf("unexpected event %q %v", events[0].Message, data)
+	}
+}
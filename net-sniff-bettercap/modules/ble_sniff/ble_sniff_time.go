@@ -0,0 +1,81 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors, strconv for parsing the timestamp and the durations, strings for splitting the timestamp, and time
+// for time-related functions.
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// packetTime extracts the time a packet was captured at from the frame layer of the TShark output.
+// The timestamp of the nordic_ble layer is not used since it counts the microseconds elapsed on the
+// sniffer board, which can't be told apart from an absolute time.
+func packetTime(packetMap map[string]interface{}) (time.Time, bool) {
+	frame, ok := packetMap["frame"].(map[string]interface{})
+	if !ok {
+		return time.Time{}, false
+	}
+	epoch, ok := frame["frame.time_epoch"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	return parseEpoch(epoch)
+}
+
+// parseEpoch parses a TShark epoch timestamp, the seconds followed by up to nine decimals, without
+// the rounding errors of a float.
+func parseEpoch(epoch string) (time.Time, bool) {
+	seconds_string, fraction_string := epoch, ""
+	if dot := strings.IndexByte(epoch, '.'); dot >= 0 {
+		seconds_string, fraction_string = epoch[:dot], epoch[dot+1:]
+	}
+
+	seconds, err := strconv.ParseInt(seconds_string, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	nanoseconds := int64(0)
+	if fraction_string != "" {
+		if len(fraction_string) > 9 {
+			fraction_string = fraction_string[:9]
+		}
+		// Pad the decimals to nanoseconds.
+		fraction_string += strings.Repeat("0", 9-len(fraction_string))
+		if nanoseconds, err = strconv.ParseInt(fraction_string, 10, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	return time.Unix(seconds, nanoseconds), true
+}
+
+// durationValidator matches the values of the duration parameters, a number of seconds or a duration such as 1.5s.
+const durationValidator = `^([0-9]+(\.[0-9]+)?|([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+)$`
+
+// parseDuration parses the value of a duration parameter, a number of seconds or a duration such as 1.5s, keeping
+// the fractions of a second.
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// durationParam returns the value of a duration parameter.
+func (mod *Sniffer) durationParam(name string) (error, time.Duration) {
+	err, value := mod.StringParam(name)
+	if err != nil {
+		return err, 0
+	}
+
+	duration, err := parseDuration(value)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err), 0
+	}
+	return nil, duration
+}
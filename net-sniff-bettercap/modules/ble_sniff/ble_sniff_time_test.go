@@ -0,0 +1,174 @@
+package ble_sniff
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		epoch string
+		want  time.Time
+		ok    bool
+	}{
+		{"1709377145.123456000", time.Unix(1709377145, 123456000), true},
+		{"1709377145.5", time.Unix(1709377145, 500000000), true},
+		{"1709377145", time.Unix(1709377145, 0), true},
+		{"1709377145.1234567891", time.Unix(1709377145, 123456789), true},
+		{"", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"1709377145.x", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseEpoch(tt.epoch)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("parseEpoch(%q) = %s, %v, expected %s, %v", tt.epoch, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDispatchPacketUsesCaptureTime(t *testing.T) {
+	sink := &collectSink{}
+	mod := newBenchSniffer(sink)
+
+	captured := time.Unix(1709377145, 123456000)
+	packet := map[string]interface{}{
+		"frame": map[string]interface{}{"frame.time_epoch": "1709377145.123456000"},
+		"btle":  loadFixtures(t, "advertisements.json")[0],
+	}
+	mod.dispatchPacket(nil, packet)
+
+	if len(sink.events) == 0 {
+		t.Fatal("expected the packet to push events")
+	}
+	for _, e := range sink.events {
+		if !e.PacketTime.Equal(captured) {
+			t.Errorf("expected %s event at the capture time %s, got %s", e.Protocol, captured, e.PacketTime)
+		}
+	}
+	if !mod.Stats.FirstPacket.Equal(captured) || !mod.Stats.LastPacket.Equal(captured) {
+		t.Errorf("expected the first and last packet times to be %s, got %s and %s", captured, mod.Stats.FirstPacket, mod.Stats.LastPacket)
+	}
+
+	// Without a frame layer the current time is used.
+	before := time.Now()
+	mod.dispatchPacket(nil, map[string]interface{}{"btle": loadFixtures(t, "advertisements.json")[0]})
+	if mod.Stats.LastPacket.Before(before) {
+		t.Errorf("expected the last packet time to fall back to the current time, got %s", mod.Stats.LastPacket)
+	}
+}
+
+func TestDispatchPacketTracksLongestGap(t *testing.T) {
+	mod := newBenchSniffer(&collectSink{})
+	btle := loadFixtures(t, "advertisements.json")[0]
+
+	for _, epoch := range []string{"1709377145.0", "1709377146.5", "1709377160.25", "1709377161.0"} {
+		mod.dispatchPacket(nil, map[string]interface{}{
+			"frame": map[string]interface{}{"frame.time_epoch": epoch},
+			"btle":  btle,
+		})
+	}
+
+	if mod.Stats.LongestGap != 13750*time.Millisecond || !mod.Stats.LongestGapEnd.Equal(time.Unix(1709377160, 250000000)) {
+		t.Errorf("expected a 13.75s gap ending at 1709377160.25, got %s ending at %s", mod.Stats.LongestGap, mod.Stats.LongestGapEnd)
+	}
+	if duration := mod.Stats.Duration(); duration != 16*time.Second {
+		t.Errorf("expected a 16s capture, got %s", duration)
+	}
+}
+
+func TestCaptureTimesWhileReading(t *testing.T) {
+	mod := newBenchSniffer(&collectSink{})
+	btle := loadFixtures(t, "advertisements.json")[0]
+
+	// The capture duration is read by a command while the packet loop updates the capture times.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mod.Stats.Duration()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		mod.dispatchPacket(nil, map[string]interface{}{
+			"frame": map[string]interface{}{"frame.time_epoch": fmt.Sprintf("%d.0", 1709377145+i)},
+			"btle":  btle,
+		})
+	}
+	<-done
+
+	if duration := mod.Stats.Duration(); duration != 99*time.Second {
+		t.Errorf("expected a 99s capture, got %s", duration)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{1234567 * time.Microsecond, "1.23s"},
+		{345678 * time.Microsecond, "346ms"},
+		{13750 * time.Millisecond, "13.75s"},
+		{3*time.Hour + 25*time.Minute + 1500*time.Millisecond, "3h25m2s"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%s) = %q, expected %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestDurationParams(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"0":      0,
+		"30":     30 * time.Second,
+		"2.5":    2500 * time.Millisecond,
+		"250ms":  250 * time.Millisecond,
+		"1m30s":  90 * time.Second,
+		"1.5h":   90 * time.Minute,
+		"1500us": 1500 * time.Microsecond,
+	} {
+		if duration, err := parseDuration(value); err != nil || duration != expected {
+			t.Errorf("expected %s for '%s', got %s (%v)", expected, value, duration, err)
+		}
+	}
+
+	// The options keep the fractions of a second.
+	s := newTestSession(t)
+	mod, err := NewSnifferWithOptions(s,
+		WithShutdownTimeout(2500*time.Millisecond),
+		WithSummaryInterval(1500*time.Millisecond),
+		WithCompanyAlerts(nil, 500*time.Millisecond, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]time.Duration{
+		"ble.sniff.shutdown.timeout":   2500 * time.Millisecond,
+		"ble.sniff.summary.interval":   1500 * time.Millisecond,
+		"ble.sniff.alert.window":       500 * time.Millisecond,
+		"ble.sniff.alert.cooldown":     time.Minute,
+		"ble.sniff.starvation.timeout": 30 * time.Second,
+	} {
+		if err, duration := mod.durationParam(name); err != nil || duration != expected {
+			t.Errorf("expected %s for %s, got %s (%v)", expected, name, duration, err)
+		}
+	}
+
+	for _, value := range []string{"-1", "-1s", "1d", "many", "NaN", "1e3"} {
+		if err := withParam("ble.sniff.heartbeat", value)(mod); err == nil {
+			t.Errorf("expected '%s' to be rejected", value)
+		}
+	}
+}
+
+func TestConnectionPacketTime(t *testing.T) {
+	// A replayed capture dates the connections by its packets.
+	captured := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	conn := NewSnifferConnection(&ConnectIndData{AccessAddress: "0x50654a2b"}, captured)
+	if !conn.Started.Equal(captured) || !conn.LastSeen.Equal(captured) {
+		t.Errorf("expected the connection to start at %s, got %s and %s", captured, conn.Started, conn.LastSeen)
+	}
+}
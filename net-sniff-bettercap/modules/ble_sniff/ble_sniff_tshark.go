@@ -0,0 +1,187 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// bufio for buffered I/O operations, fmt for formatted strings, os for the output pipe,
+// os/exec for running TShark, sync/atomic for the running flag, and time for time-related functions.
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+)
+
+// startTShark spawns TShark with the stored arguments and sets up the reader on its output.
+// A goroutine waits for the process, sending its result to TSharkExit once it terminated.
+func (c *SnifferContext) startTShark() error {
+	// A plain pipe is used instead of StdoutPipe so that waiting for the process doesn't close the read end
+	// while the packet loop is still consuming the buffered output.
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	// Release the output of a previous TShark process.
+	if c.tsharkOut != nil {
+		c.tsharkOut.Close()
+	}
+
+	if c.TSharkProc, err = c.tsharkCommand(); err != nil {
+		reader.Close()
+		writer.Close()
+		return err
+	}
+	c.TSharkProc.Stdout = writer
+
+	// The child has its own copy of the pipes, the input of a remote capture is only kept open on this side.
+	stdin, _ := c.TSharkProc.Stdin.(*os.File)
+	if err = c.TSharkProc.Start(); err != nil {
+		reader.Close()
+		writer.Close()
+		if stdin != nil {
+			stdin.Close()
+		}
+		return err
+	}
+	// The reader gets EOF once the child exits.
+	writer.Close()
+	if stdin != nil {
+		stdin.Close()
+	}
+
+	c.setTSharkRunning(true)
+	c.tsharkOut = reader
+	c.TSharkExit = make(chan error, 1)
+	c.Reader = bufio.NewReaderSize(reader, c.ReadBuffer)
+
+	go func(proc *exec.Cmd, exit chan<- error) {
+		exit <- proc.Wait()
+	}(c.TSharkProc, c.TSharkExit)
+
+	return nil
+}
+
+// TSharkRunning returns true while TShark is running.
+func (c *SnifferContext) TSharkRunning() bool {
+	return atomic.LoadInt32(&c.tsharkRunning) == 1
+}
+
+// setTSharkRunning records whether TShark is running, the flag being read by the rate monitor while the capture
+// restarts TShark.
+func (c *SnifferContext) setTSharkRunning(running bool) {
+	if running {
+		atomic.StoreInt32(&c.tsharkRunning, 1)
+	} else {
+		atomic.StoreInt32(&c.tsharkRunning, 0)
+	}
+}
+
+// tsharkExited returns the result of TShark if it exited within the timeout, and whether it did.
+func (c *SnifferContext) tsharkExited(timeout time.Duration) (error, bool) {
+	if c.TSharkExit == nil {
+		return nil, false
+	}
+
+	select {
+	case err := <-c.TSharkExit:
+		c.setTSharkRunning(false)
+		return err, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+// Declaring the delays between two TShark restarts, doubled after every attempt.
+const (
+	restartBackoff    = time.Second
+	restartBackoffMax = 30 * time.Second
+)
+
+// onCaptureEnd checks whether the end of the input was caused by TShark terminating on its own. In that case TShark
+// is restarted if allowed, returning true, otherwise an error event is pushed and the module stops itself.
+// Reading a pcap file until its end is not an error. The restart is abandoned once stop is closed.
+func (mod *Sniffer) onCaptureEnd(stop <-chan struct{}) bool {
+	if mod.Ctx.TSharkProc == nil || !mod.Running() {
+		return false
+	}
+
+	err, exited := mod.Ctx.tsharkExited(time.Second)
+	if !exited || (err == nil && mod.Ctx.PcapFile != "") {
+		return false
+	}
+
+	reason := "exited"
+	if err != nil {
+		reason = err.Error()
+	}
+
+	if mod.Ctx.AutoRestart {
+		if mod.restartTShark(reason, stop) {
+			return true
+		} else if !mod.Running() {
+			// Stopped while waiting to restart.
+			return false
+		}
+		reason = fmt.Sprintf("%s, gave up after %d restarts", reason, mod.Ctx.tsharkRestarts)
+	}
+
+	// Create a new SnifferEvent with protocol "BLE ERROR" and push it.
+	mod.Push(NewSnifferEvent(time.Now(),
+		"BLE ERROR",
+		"SNIFFER",
+		"SNIFFER",
+		SniffData{"error": reason},
+		"TShark terminated unexpectedly: %s",
+		reason,
+	))
+
+	mod.Warning("TShark terminated unexpectedly (%s), stopping", reason)
+	// Stop from another goroutine, since stopping waits for the capture loop this is called from to return.
+	go mod.Stop()
+	return false
+}
+
+// restartTShark spawns TShark again with an exponential backoff, until it starts or the retries are exhausted.
+// The statistics and tables are kept, so the capture continues where it stopped. Stopping the module while waiting
+// to restart, by closing stop, returns right away.
+func (mod *Sniffer) restartTShark(reason string, stop <-chan struct{}) bool {
+	for mod.Ctx.tsharkRestarts < mod.Ctx.AutoRestartMax {
+		delay := restartBackoff << uint(mod.Ctx.tsharkRestarts)
+		if delay > restartBackoffMax || delay <= 0 {
+			delay = restartBackoffMax
+		}
+		mod.Ctx.tsharkRestarts++
+
+		mod.Warning("TShark terminated (%s), restart %d/%d in %s", reason, mod.Ctx.tsharkRestarts, mod.Ctx.AutoRestartMax, delay)
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return false
+		}
+		if !mod.Running() {
+			return false
+		}
+
+		// The sniffer may be listed under another serial port once it is plugged back.
+		if !mod.Ctx.InterfaceStrict && mod.Ctx.PcapFile == "" && mod.Ctx.remote == nil {
+			if iface, err := mod.Ctx.resolveInterface(); err != nil {
+				reason = err.Error()
+				continue
+			} else if iface != mod.Ctx.Interface {
+				mod.Info("interface '%s' not found, using '%s'", mod.Ctx.Interface, iface)
+				mod.Ctx.setInterface(iface)
+			}
+		}
+
+		if err := mod.Ctx.startTShark(); err != nil {
+			reason = err.Error()
+			continue
+		}
+
+		mod.Info("TShark restarted")
+		return true
+	}
+	return false
+}
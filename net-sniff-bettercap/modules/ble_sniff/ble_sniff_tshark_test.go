@@ -0,0 +1,23 @@
+package ble_sniff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartAbandonedOnStop(t *testing.T) {
+	quietLogs(t)
+	mod := NewSniffer(newTestSession(t))
+	mod.Ctx.AutoRestartMax = 10
+	mod.Ctx.tsharkRestarts = 5
+
+	// The backoff is 30 seconds by now, stopping doesn't wait for it.
+	stop := make(chan struct{})
+	close(stop)
+	started := time.Now()
+	if mod.restartTShark("exited", stop) {
+		t.Fatal("expected the restart to be abandoned")
+	} else if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected the restart to be abandoned right away, took %s", elapsed)
+	}
+}
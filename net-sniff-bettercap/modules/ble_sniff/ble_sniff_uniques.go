@@ -0,0 +1,64 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for formatted output, io for the writer, and sort for ordering the addresses.
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// UniqueDevice is a line of the ble.sniff.uniques listing.
+type UniqueDevice struct {
+	Address string // Advertising address of the device.
+	Name    string // Local name of the device, empty if unknown.
+}
+
+// UniqueDevices returns the addresses and names of the devices seen advertising in this session, sorted by address.
+// The devices loaded from an inventory are skipped until they advertise again.
+func (s *SnifferStats) UniqueDevices() []UniqueDevice {
+	s.RLock()
+	list := make([]UniqueDevice, 0, len(s.Devices))
+	for _, dev := range s.Devices {
+		if dev.seen {
+			list = append(list, UniqueDevice{Address: dev.Address, Name: dev.Name})
+		}
+	}
+	s.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+// writeUniques writes a tab separated line for each device, followed by the count of devices.
+func writeUniques(w io.Writer, devices []UniqueDevice) {
+	for _, dev := range devices {
+		fmt.Fprintf(w, "%s\t%s\n", dev.Address, dev.Name)
+	}
+	fmt.Fprintf(w, "%d unique devices\n", len(devices))
+}
+
+// ShowUniques prints the distinct addresses seen in this session with their names, one per line. The pseudonyms of
+// the addresses are printed instead when anonymizing.
+func (mod *Sniffer) ShowUniques() error {
+	if mod.Stats == nil {
+		return fmt.Errorf("No stats yet.")
+	}
+
+	devices := mod.Stats.UniqueDevices()
+	if a := mod.Ctx.anonymizer; a != nil {
+		for i := range devices {
+			devices[i].Address = a.Address(devices[i].Address)
+		}
+		sort.Slice(devices, func(i, j int) bool {
+			return devices[i].Address < devices[j].Address
+		})
+	}
+	writeUniques(mod.Session.Events.Stdout, devices)
+	mod.Session.Refresh()
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// fmt for errors and formatted strings, strings for building the URIs and unicode/utf8 for validating them.
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// decodeURI decodes the payload of a URI AD structure, whose first byte is a scheme prefix and the rest the URI
+// encoded as an Eddystone-URL, except that the bytes beyond the expansions can be any UTF-8 text.
+func decodeURI(raw []byte) (string, error) {
+	if len(raw) < 1 {
+		return "", fmt.Errorf("URI is empty")
+	} else if int(raw[0]) >= len(eddystoneSchemes) {
+		return "", fmt.Errorf("unknown URI scheme 0x%02x", raw[0])
+	}
+
+	uri := strings.Builder{}
+	uri.WriteString(eddystoneSchemes[raw[0]])
+	for _, b := range raw[1:] {
+		if int(b) < len(eddystoneExpansions) {
+			uri.WriteString(eddystoneExpansions[b])
+		} else if b < 0x20 || b == 0x7f {
+			return "", fmt.Errorf("invalid URI byte 0x%02x", b)
+		} else {
+			uri.WriteByte(b)
+		}
+	}
+
+	if !utf8.ValidString(uri.String()) {
+		return "", fmt.Errorf("URI is not valid UTF-8")
+	}
+	return uri.String(), nil
+}
+
+// onURI processes the URI AD structure, reporting the URI the device advertises, either as decoded by TShark or
+// from its raw payload. Malformed structures are ignored.
+func onURI(adv *advertisement, entry map[string]interface{}) []SnifferEvent {
+	uri, ok := entry["btcommon.eir_ad.entry.uri"].(string)
+	if !ok {
+		data_string, ok := entry["btcommon.eir_ad.entry.data"].(string)
+		if !ok {
+			return nil
+		}
+		raw, err := parseHexBytes(data_string)
+		if err != nil {
+			return nil
+		}
+		if uri, err = decodeURI(raw); err != nil {
+			return nil
+		}
+	}
+
+	return adv.event(SniffData{
+		"uri": uri,
+	},
+		"URI %s",
+		uri,
+	)
+}
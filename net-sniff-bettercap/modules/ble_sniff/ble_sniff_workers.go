@@ -0,0 +1,55 @@
+// Package ble_sniff declares the package name for BLE sniffing functionalities.
+package ble_sniff
+
+// Importing necessary packages:
+// sync for waiting for the workers and time for time-related functions.
+import (
+	"sync"
+	"time"
+)
+
+// workerJob is a decoded packet waiting to be processed by a worker.
+type workerJob struct {
+	Value interface{} // Packet as decoded from the TShark output.
+	Time  time.Time   // Time when the packet was received.
+}
+
+// workerPool processes packets concurrently. The device table, the connections and the counters are safe
+// to share between the workers, while the events of different packets may be pushed out of order.
+type workerPool struct {
+	jobs chan workerJob
+	done sync.WaitGroup
+}
+
+// newWorkerPool starts the given number of workers, returning nil if packets must be processed by the caller.
+func (mod *Sniffer) newWorkerPool(workers int) *workerPool {
+	if workers <= 1 {
+		return nil
+	}
+
+	pool := &workerPool{
+		jobs: make(chan workerJob, workers),
+	}
+	for i := 0; i < workers; i++ {
+		pool.done.Add(1)
+		go func() {
+			defer pool.done.Done()
+			for job := range pool.jobs {
+				mod.onPacket(job.Value, job.Time)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// Process hands a packet to the first available worker.
+func (p *workerPool) Process(value interface{}, t time.Time) {
+	p.jobs <- workerJob{Value: value, Time: t}
+}
+
+// Wait stops accepting packets and waits for the workers to process the pending ones.
+func (p *workerPool) Wait() {
+	close(p.jobs)
+	p.done.Wait()
+}
@@ -0,0 +1,82 @@
+package ble_sniff
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fixturePackets returns the fixture packets wrapped as decoded by the capture loop.
+func fixturePackets(t testing.TB) []interface{} {
+	packets := make([]interface{}, 0)
+	for _, btle := range loadFixtures(t, "advertisements.json") {
+		packets = append(packets, map[string]interface{}{"btle": btle})
+	}
+	return packets
+}
+
+// Run with -race to check the workers share the device table and the stats safely.
+func TestWorkerPoolStatsConsistency(t *testing.T) {
+	packets := fixturePackets(t)
+	sink := &lockedSink{}
+	mod := newBenchSniffer(sink)
+
+	const rounds = 500
+	pool := mod.newWorkerPool(4)
+	for i := 0; i < rounds; i++ {
+		for _, packet := range packets {
+			pool.Process(packet, time.Now())
+		}
+	}
+	pool.Wait()
+
+	if mod.Stats.NumAdvertisements != rounds*3 || mod.Stats.NumMatched != rounds*3 {
+		t.Errorf("expected %d advertisements and matched packets, got %d and %d", rounds*3, mod.Stats.NumAdvertisements, mod.Stats.NumMatched)
+	}
+	for _, dev := range mod.Stats.DevicesList() {
+		if dev.Packets != rounds {
+			t.Errorf("expected %d packets for %s, got %d", rounds, dev.Address, dev.Packets)
+		}
+	}
+	if sink.count != rounds*3 {
+		t.Errorf("expected %d events, got %d", rounds*3, sink.count)
+	}
+}
+
+func TestWorkerPoolSingleWorker(t *testing.T) {
+	if pool := newBenchSniffer(discardSink{}).newWorkerPool(1); pool != nil {
+		t.Error("expected a single worker to process packets inline")
+	}
+}
+
+func BenchmarkWorkers(b *testing.B) {
+	packets := fixturePackets(b)
+
+	for _, workers := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("%d_workers", workers), func(b *testing.B) {
+			mod := newBenchSniffer(discardSink{})
+			pool := mod.newWorkerPool(workers)
+			now := time.Now()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pool.Process(packets[i%len(packets)], now)
+			}
+			pool.Wait()
+		})
+	}
+}
+
+// lockedSink is an EventSink counting the events pushed by concurrent workers.
+type lockedSink struct {
+	sync.Mutex
+	count int
+}
+
+func (s *lockedSink) Push(e SnifferEvent) {
+	s.Lock()
+	defer s.Unlock()
+	s.count++
+}
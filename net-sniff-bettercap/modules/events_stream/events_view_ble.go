@@ -49,10 +49,17 @@ func (mod *EventsStream) viewBLEEvent(output io.Writer, e session.Event) {
 			name,
 			dev.Device.ID(),
 			vend)
-	} else if e.Tag == "ble.sniff" {
-		fmt.Fprintf(output, "[%s] [%s] %s\n",
+	} else if event, ok := e.Data.(ble_sniff.SnifferEvent); ok {
+		// Sniffer events can be pushed with a custom tag by setting ble.sniff.tag.
+		pdu := ""
+		if event.PDU != "" {
+			pdu = tui.Dim(event.PDU) + " "
+		}
+
+		fmt.Fprintf(output, "[%s] [%s] %s%s\n",
 			e.Time.Format(mod.timeFormat),
 			tui.Green(e.Tag),
-			e.Data.(ble_sniff.SnifferEvent).Message)
+			pdu,
+			event.Message)
 	}
 }